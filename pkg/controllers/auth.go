@@ -5,10 +5,13 @@ import (
 	"errors"
 	"kamoushop/pkg/models"
 	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
 	"kamoushop/pkg/services/token"
 	"kamoushop/pkg/services/types"
 	"kamoushop/pkg/utils"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +33,7 @@ type authController struct {
 	config       utils.Config
 	t_col        mongo.Collection
 	redis_client *redis.Client
+	guest_carts  api.GuestCartService
 }
 
 type tokens struct {
@@ -37,13 +41,14 @@ type tokens struct {
 	RefreshToken string
 }
 
-func NewAuthController(service api.AuthService, maker token.Maker, config utils.Config, token_col mongo.Collection, redis_client *redis.Client) AuthController {
+func NewAuthController(service api.AuthService, maker token.Maker, config utils.Config, token_col mongo.Collection, redis_client *redis.Client, guest_carts api.GuestCartService) AuthController {
 	return &authController{
 		s:            service,
 		maker:        maker,
 		config:       config,
 		t_col:        token_col,
 		redis_client: redis_client,
+		guest_carts:  guest_carts,
 	}
 }
 
@@ -64,16 +69,28 @@ func (a *authController) CreateUser() gin.HandlerFunc {
 			return
 		}
 
-		if err := a.s.CreateUser(models.User{
+		currency := strings.ToUpper(request.Currency)
+		if currency == "" {
+			currency = a.config.DefaultCurrency
+		}
+		if !money.Valid(currency) {
+			ctx.JSON(http.StatusBadRequest, errorRes(money.ErrUnknownCurrency))
+			return
+		}
+
+		user, err := a.s.CreateUser(models.User{
 			FirstName: request.FirstName,
 			LastName:  request.LastName,
 			Email:     request.Email,
 			Password:  request.Password,
-			StarredBy: make([]primitive.ObjectID, 500),
-		}); err != nil {
+			Currency:  currency,
+		})
+		if err != nil {
 			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
+		mergeGuestCart(ctx, a, user.ID)
+
 		code, err := sendVerificationCode(ctx, a, request.Email)
 
 		if err != nil {
@@ -105,6 +122,7 @@ func (a *authController) LoginUser() gin.HandlerFunc {
 			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
+		mergeGuestCart(ctx, a, user.ID)
 
 		token, err := generateAuthTokens(ctx, a, user.ID, a.config.AccessTokenDuration)
 
@@ -158,6 +176,18 @@ func sendVerificationCode(ctx context.Context, a *authController, email string)
 	return random_code, nil
 }
 
+// mergeGuestCart moves the guest cart sent in the x-cart-token header into the user's cart.
+// A forged or unreachable guest cart must not stop the user from signing in, so failures are only logged.
+func mergeGuestCart(ctx *gin.Context, a *authController, user_id primitive.ObjectID) {
+	cart_token := ctx.GetHeader(guestCartHeader)
+	if cart_token == "" {
+		return
+	}
+	if _, err := a.guest_carts.Merge(cart_token, user_id); err != nil {
+		log.Printf("cannot merge guest cart into %s: %v", user_id.Hex(), err)
+	}
+}
+
 func generateAuthTokens(ctx context.Context, a *authController, user_id primitive.ObjectID, duration time.Duration) (*tokens, error) {
 	access_token, err := a.maker.CreateToken(user_id, duration)
 	if err != nil {
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CartController interface {
+	GetCart() gin.HandlerFunc
+	AddItem() gin.HandlerFunc
+	SetQuantity() gin.HandlerFunc
+	RemoveLine() gin.HandlerFunc
+	ClearCart() gin.HandlerFunc
+	CheckCart() gin.HandlerFunc
+	AddToCart() gin.HandlerFunc
+	RemoveFromCart() gin.HandlerFunc
+}
+
+type cartController struct {
+	s      api.CartService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewCartController(s api.CartService, maker token.Maker, config utils.Config) CartController {
+	return &cartController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// GetCart godoc
+// @Summary Get the caller's cart with its totals per currency
+// @Tags cart
+// @Produce json
+// @Success 200 {object} models.Cart
+// @Router		/cart	[get]
+func (c *cartController) GetCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		cart, err := c.s.GetCart(payload.UserID)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// AddItem godoc
+// @Summary Add units of a product to the cart, an existing line gets its quantity raised
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param types.CartItem body types.CartItem true "line"
+// @Success 200 {object} models.Cart
+// @Router		/cart/items	[post]
+func (c *cartController) AddItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.CartItem
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		cart, err := c.s.AddItem(payload.UserID, product_id, request.Variant, request.Quantity)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// SetQuantity godoc
+// @Summary Set the quantity of a cart line, zero removes it
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param types.SetCartQuantity body types.SetCartQuantity true "line"
+// @Success 200 {object} models.Cart
+// @Router		/cart/items	[patch]
+func (c *cartController) SetQuantity() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.SetCartQuantity
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		cart, err := c.s.SetQuantity(payload.UserID, product_id, request.Variant, *request.Quantity)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// RemoveLine godoc
+// @Summary Remove a line from the cart
+// @Tags cart
+// @Produce json
+// @Param types.CartLineVariant query types.CartLineVariant false "variant"
+// @Success 200 {object} models.Cart
+// @Router		/cart/items/{product_id}	[delete]
+func (c *cartController) RemoveLine() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetCartLine
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.CartLineVariant
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(uri.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		cart, err := c.s.RemoveLine(payload.UserID, product_id, request.Variant)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// ClearCart godoc
+// @Summary Remove every line from the cart
+// @Tags cart
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/cart	[delete]
+func (c *cartController) ClearCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := c.s.Clear(payload.UserID); err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("cart cleared"))
+	}
+}
+
+// CheckCart godoc
+// @Summary List cart lines whose price changed, that are no longer sold or that exceed the stock
+// @Tags cart
+// @Produce json
+// @Success 200 {array} models.CartIssue
+// @Router		/cart/check	[get]
+func (c *cartController) CheckCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		issues, err := c.s.Check(payload.UserID)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, issues)
+	}
+}
+
+// AddToCart godoc
+// @Summary Add one unit of a product to the cart, kept for older clients
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param types.AddToCart body types.AddToCart true "product"
+// @Success 200 {string} msgRes
+// @Router		/product/add-to-cart	[post]
+func (c *cartController) AddToCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddToCart
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProdID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if _, err = c.s.AddItem(payload.UserID, product_id, "", 1); err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("added to cart"))
+	}
+}
+
+// RemoveFromCart godoc
+// @Summary Remove every line of a product from the cart, kept for older clients
+// @Tags cart
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/product/remove-from-cart/{id}	[patch]
+func (c *cartController) RemoveFromCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetProdById
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if _, err = c.s.RemoveProduct(payload.UserID, product_id); err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("removed from cart"))
+	}
+}
+
+func cartErrStatus(err error) int {
+	switch err {
+	case api.ErrCantFindProduct, api.ErrLineNotFound:
+		return http.StatusNotFound
+	case api.ErrInvalidQuantity, api.ErrUnknownVariant:
+		return http.StatusBadRequest
+	case api.ErrNotEnoughStock:
+		return http.StatusConflict
+	case api.ErrInvalidCartToken:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
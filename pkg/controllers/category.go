@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CategoryController interface {
+	CreateCategory() gin.HandlerFunc
+	UpdateCategory() gin.HandlerFunc
+	DeleteCategory() gin.HandlerFunc
+	GetCategories() gin.HandlerFunc
+	GetCategoryProducts() gin.HandlerFunc
+}
+
+type categoryController struct {
+	s      api.CategoryService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewCategoryController(s api.CategoryService, maker token.Maker, config utils.Config) CategoryController {
+	return &categoryController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateCategory godoc
+// @Summary Add a category to the taxonomy (admins only)
+// @Tags category
+// @Accept json
+// @Produce json
+// @Param types.AddCategory body types.AddCategory true "category"
+// @Success 201 {object} models.Category
+// @Router		/categories	[post]
+func (c *categoryController) CreateCategory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddCategory
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		category, err := c.s.CreateCategory(request)
+		if err != nil {
+			ctx.JSON(categoryErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, category)
+	}
+}
+
+// UpdateCategory godoc
+// @Summary Rename, reorder or move a category (admins only)
+// @Tags category
+// @Accept json
+// @Produce json
+// @Param types.UpdateCategory body types.UpdateCategory true "fields to update"
+// @Success 200 {object} models.Category
+// @Router		/categories/{id}	[patch]
+func (c *categoryController) UpdateCategory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetCategoryById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.UpdateCategory
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		category, err := c.s.UpdateCategory(id, request)
+		if err != nil {
+			ctx.JSON(categoryErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, category)
+	}
+}
+
+// DeleteCategory godoc
+// @Summary Delete a category without subcategories (admins only)
+// @Tags category
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/categories/{id}	[delete]
+func (c *categoryController) DeleteCategory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetCategoryById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		if err = c.s.DeleteCategory(id); err != nil {
+			ctx.JSON(categoryErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// GetCategories godoc
+// @Summary Get the whole category tree
+// @Tags category
+// @Produce json
+// @Success 200 {array} models.CategoryNode
+// @Router		/categories	[get]
+func (c *categoryController) GetCategories() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tree, err := c.s.GetTree()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"categories": tree})
+	}
+}
+
+// GetCategoryProducts godoc
+// @Summary Get the products of a category and all of its subcategories
+// @Tags category
+// @Produce json
+// @Param types.GetCategoryProducts query types.GetCategoryProducts true "pagination"
+// @Success 200 {string} products
+// @Router		/categories/{slug}/products	[get]
+func (c *categoryController) GetCategoryProducts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetCategory
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.GetCategoryProducts
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		req := pagination.Request{Limit: request.Limit, Cursor: request.Cursor}
+		category, products, err := c.s.GetProducts(uri.Slug, req)
+		if err != nil {
+			ctx.JSON(categoryErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, struct {
+			pagination.Page[models.Product]
+			Category models.Category `json:"category"`
+		}{products, category})
+	}
+}
+
+func categoryErrStatus(err error) int {
+	switch err {
+	case api.ErrCategoryNotFound:
+		return http.StatusNotFound
+	case pagination.ErrInvalidLimit, pagination.ErrInvalidCursor, api.ErrInvalidSlug:
+		return http.StatusBadRequest
+	case api.ErrCategoryExists, api.ErrCategoryHasChildren, api.ErrCategoryCycle:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyHeader carries the client's key for a checkout, retries must send the same key.
+const idempotencyHeader = "Idempotency-Key"
+
+type CheckoutController interface {
+	Checkout() gin.HandlerFunc
+	Quote() gin.HandlerFunc
+}
+
+type checkoutController struct {
+	s        api.CheckoutService
+	carts    api.CartService
+	invoices api.InvoiceService
+	maker    token.Maker
+	config   utils.Config
+}
+
+func NewCheckoutController(s api.CheckoutService, carts api.CartService, invoices api.InvoiceService, maker token.Maker, config utils.Config) CheckoutController {
+	return &checkoutController{
+		s:        s,
+		carts:    carts,
+		invoices: invoices,
+		maker:    maker,
+		config:   config,
+	}
+}
+
+// Checkout godoc
+// @Summary Place an order for the caller's cart, retrying with the same Idempotency-Key returns the same order
+// @Tags checkout
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string true "unique key per order attempt"
+// @Param types.Checkout body types.Checkout false "coupon code, delivery address and shipping rates"
+// @Success 201 {object} models.Order
+// @Failure 409 {array} models.CartIssue
+// @Router		/checkout	[post]
+func (c *checkoutController) Checkout() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// the body is optional, an order without a coupon to the default address at the cheapest rates needs none
+		var request types.Checkout
+		if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, created, err := c.s.Checkout(payload.UserID, ctx.GetHeader(idempotencyHeader), request)
+		if err == api.ErrCartChanged {
+			issues, check_err := c.carts.Check(payload.UserID)
+			if check_err != nil {
+				ctx.JSON(http.StatusInternalServerError, errorRes(check_err))
+				return
+			}
+			res := errorRes(err)
+			res["issues"] = issues
+			ctx.JSON(http.StatusConflict, res)
+			return
+		}
+		if err != nil {
+			ctx.JSON(checkoutErrStatus(err), errorRes(err))
+			return
+		}
+
+		if !created {
+			ctx.JSON(http.StatusOK, order)
+			return
+		}
+		// the order is placed, the buyer doesn't wait for the mail server
+		go func() {
+			if err := c.invoices.SendConfirmation(order.ID); err != nil {
+				log.Printf("cannot send confirmation of order %s: %v", order.ID.Hex(), err)
+			}
+		}()
+		ctx.JSON(http.StatusCreated, order)
+	}
+}
+
+// Quote godoc
+// @Summary List the shipping rates every seller in the caller's cart offers for an address, cheapest first
+// @Tags checkout
+// @Accept json
+// @Produce json
+// @Param types.ShippingQuote body types.ShippingQuote false "delivery address"
+// @Success 200 {array} models.ShippingQuote
+// @Failure 409 {array} models.CartIssue
+// @Router		/checkout/quote	[post]
+func (c *checkoutController) Quote() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// the body is optional, without one the default address is quoted
+		var request types.ShippingQuote
+		if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		quotes, err := c.s.Quote(payload.UserID, request)
+		if err == api.ErrCartChanged {
+			issues, check_err := c.carts.Check(payload.UserID)
+			if check_err != nil {
+				ctx.JSON(http.StatusInternalServerError, errorRes(check_err))
+				return
+			}
+			res := errorRes(err)
+			res["issues"] = issues
+			ctx.JSON(http.StatusConflict, res)
+			return
+		}
+		if err != nil {
+			ctx.JSON(checkoutErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, quotes)
+	}
+}
+
+func checkoutErrStatus(err error) int {
+	switch err {
+	case api.ErrIdempotencyKeyRequired, api.ErrEmptyCart, api.ErrCouponExpired, api.ErrCouponMinSpend, api.ErrCouponNotApplicable,
+		tax.ErrInvalidRegion, api.ErrAddressRequired, api.ErrNoDelivery, api.ErrShippingRateNotFound:
+		return http.StatusBadRequest
+	case api.ErrCouponNotFound, api.ErrAddressNotFound, api.ErrUserNotFound:
+		return http.StatusNotFound
+	case api.ErrOutOfStock, api.ErrPromotionUsedUp:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
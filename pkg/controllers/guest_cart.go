@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// guestCartHeader carries the token of a guest cart, sending it on login or registration merges the cart.
+const guestCartHeader = "x-cart-token"
+
+type GuestCartController interface {
+	CreateGuestCart() gin.HandlerFunc
+	GetGuestCart() gin.HandlerFunc
+	AddGuestItem() gin.HandlerFunc
+	SetGuestQuantity() gin.HandlerFunc
+	RemoveGuestLine() gin.HandlerFunc
+}
+
+type guestCartController struct {
+	s      api.GuestCartService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewGuestCartController(s api.GuestCartService, maker token.Maker, config utils.Config) GuestCartController {
+	return &guestCartController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateGuestCart godoc
+// @Summary Start a cart for a visitor who isn't signed in, send the token back in the x-cart-token header
+// @Tags guest-cart
+// @Produce json
+// @Success 201 {string} token
+// @Router		/guest-cart	[post]
+func (g *guestCartController) CreateGuestCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cart_token, err := g.s.NewToken()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, gin.H{"token": cart_token})
+	}
+}
+
+// GetGuestCart godoc
+// @Summary Get a guest cart
+// @Tags guest-cart
+// @Produce json
+// @Success 200 {object} models.Cart
+// @Router		/guest-cart	[get]
+func (g *guestCartController) GetGuestCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cart, err := g.s.GetCart(ctx.GetHeader(guestCartHeader))
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// AddGuestItem godoc
+// @Summary Add units of a product to a guest cart
+// @Tags guest-cart
+// @Accept json
+// @Produce json
+// @Param types.CartItem body types.CartItem true "line"
+// @Success 200 {object} models.Cart
+// @Router		/guest-cart/items	[post]
+func (g *guestCartController) AddGuestItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.CartItem
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		cart, err := g.s.AddItem(ctx.GetHeader(guestCartHeader), product_id, request.Variant, request.Quantity)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// SetGuestQuantity godoc
+// @Summary Set the quantity of a guest cart line, zero removes it
+// @Tags guest-cart
+// @Accept json
+// @Produce json
+// @Param types.SetCartQuantity body types.SetCartQuantity true "line"
+// @Success 200 {object} models.Cart
+// @Router		/guest-cart/items	[patch]
+func (g *guestCartController) SetGuestQuantity() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.SetCartQuantity
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		cart, err := g.s.SetQuantity(ctx.GetHeader(guestCartHeader), product_id, request.Variant, *request.Quantity)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
+
+// RemoveGuestLine godoc
+// @Summary Remove a line from a guest cart
+// @Tags guest-cart
+// @Produce json
+// @Param types.CartLineVariant query types.CartLineVariant false "variant"
+// @Success 200 {object} models.Cart
+// @Router		/guest-cart/items/{product_id}	[delete]
+func (g *guestCartController) RemoveGuestLine() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetCartLine
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.CartLineVariant
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(uri.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		cart, err := g.s.RemoveLine(ctx.GetHeader(guestCartHeader), product_id, request.Variant)
+		if err != nil {
+			ctx.JSON(cartErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, cart)
+	}
+}
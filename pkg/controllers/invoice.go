@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"bytes"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvoiceController interface {
+	GetInvoice() gin.HandlerFunc
+}
+
+type invoiceController struct {
+	s      api.InvoiceService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewInvoiceController(s api.InvoiceService, maker token.Maker, config utils.Config) InvoiceController {
+	return &invoiceController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// GetInvoice godoc
+// @Summary Download the pdf invoice of one of the caller's orders
+// @Tags order
+// @Produce application/pdf
+// @Success 200 {file} file
+// @Router		/orders/{id}/invoice.pdf	[get]
+func (i *invoiceController) GetInvoice() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		// rendered in full first so a failure can still be answered with an error
+		var buf bytes.Buffer
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := i.s.Invoice(id, payload.UserID, &buf)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.Header("Content-Disposition", "inline; filename="+api.InvoiceFilename(order))
+		ctx.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type NotificationController interface {
+	GetNotifications() gin.HandlerFunc
+	MarkRead() gin.HandlerFunc
+	MarkAllRead() gin.HandlerFunc
+}
+
+type notificationController struct {
+	s      api.NotificationService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewNotificationController(s api.NotificationService, maker token.Maker, config utils.Config) NotificationController {
+	return &notificationController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// GetNotifications godoc
+// @Summary List the caller's notifications, newest first
+// @Tags notification
+// @Produce json
+// @Param types.GetNotifications query types.GetNotifications true "filters"
+// @Success 200 {string} notifications
+// @Router		/notifications	[get]
+func (n *notificationController) GetNotifications() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetNotifications
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		notifications, err := n.s.List(payload.UserID, request.Unread, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(pageErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, notifications)
+	}
+}
+
+// MarkRead godoc
+// @Summary Mark one of the caller's notifications as read
+// @Tags notification
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/notifications/{id}/read	[patch]
+func (n *notificationController) MarkRead() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetNotification
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err = n.s.MarkRead(id, payload.UserID); err != nil {
+			if err == api.ErrNotificationNotFound {
+				ctx.JSON(http.StatusNotFound, errorRes(err))
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// MarkAllRead godoc
+// @Summary Mark all of the caller's notifications as read
+// @Tags notification
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/notifications/read-all	[patch]
+func (n *notificationController) MarkAllRead() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if _, err := n.s.MarkAllRead(payload.UserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
@@ -0,0 +1,493 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderController interface {
+	UpdateOrderStatus() gin.HandlerFunc
+	GetSellerOrders() gin.HandlerFunc
+	GetSellerOrder() gin.HandlerFunc
+	AcceptOrder() gin.HandlerFunc
+	RejectOrder() gin.HandlerFunc
+	ShipOrder() gin.HandlerFunc
+	DeliverOrder() gin.HandlerFunc
+	ExportSellerOrders() gin.HandlerFunc
+	GetOrders() gin.HandlerFunc
+	GetOrder() gin.HandlerFunc
+	GetOrderByNumber() gin.HandlerFunc
+	GetSellerOrderByNumber() gin.HandlerFunc
+	Reorder() gin.HandlerFunc
+	CancelOrder() gin.HandlerFunc
+}
+
+type orderController struct {
+	s       api.OrderService
+	returns api.ReturnService
+	maker   token.Maker
+	config  utils.Config
+}
+
+func NewOrderController(s api.OrderService, returns api.ReturnService, maker token.Maker, config utils.Config) OrderController {
+	return &orderController{
+		s:       s,
+		returns: returns,
+		maker:   maker,
+		config:  config,
+	}
+}
+
+// UpdateOrderStatus godoc
+// @Summary Move an order to processing, shipped or delivered, only transitions allowed from its current status are accepted
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param types.UpdateOrderStatus body types.UpdateOrderStatus true "status"
+// @Success 200 {object} models.Order
+// @Router		/orders/{id}/status	[patch]
+func (o *orderController) UpdateOrderStatus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetOrder
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.UpdateOrderStatus
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		order, err := o.s.UpdateStatus(id, request.Status, request.Note)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// GetSellerOrders godoc
+// @Summary List the caller's sub-orders, newest first, filtered by status and the date they were placed
+// @Tags order
+// @Produce json
+// @Param types.GetOrders query types.GetOrders true "filters"
+// @Success 200 {string} sub-orders
+// @Router		/seller/orders	[get]
+func (o *orderController) GetSellerOrders() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetOrders
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		orders, err := o.s.SellerOrders(payload.UserID, orderQuery(request))
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, orders)
+	}
+}
+
+// GetSellerOrder godoc
+// @Summary Get one of the caller's sub-orders
+// @Tags order
+// @Produce json
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/{id}	[get]
+func (o *orderController) GetSellerOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.SellerOrder(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// GetSellerOrderByNumber godoc
+// @Summary Get one of the caller's sub-orders by its order or invoice number
+// @Tags order
+// @Produce json
+// @Param number path string true "order or invoice number"
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/number/{number}	[get]
+func (o *orderController) GetSellerOrderByNumber() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetOrderByNumber
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.SellerOrderByNumber(uri.Number, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// AcceptOrder godoc
+// @Summary Start preparing one of the caller's paid sub-orders
+// @Tags order
+// @Produce json
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/{id}/accept	[post]
+func (o *orderController) AcceptOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.AcceptOrder(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// RejectOrder godoc
+// @Summary Cancel one of the caller's sub-orders they can't fulfil, the items go back in stock and a paid sub-order is refunded
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param types.RejectOrder body types.RejectOrder true "reason"
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/{id}/reject	[post]
+func (o *orderController) RejectOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.RejectOrder
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.returns.RejectOrder(id, payload.UserID, request.Reason)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// ShipOrder godoc
+// @Summary Mark one of the caller's sub-orders shipped
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param types.ShipOrder body types.ShipOrder true "carrier and tracking number"
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/{id}/ship	[post]
+func (o *orderController) ShipOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.ShipOrder
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.ShipOrder(id, payload.UserID, request.Carrier, request.TrackingNumber)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// DeliverOrder godoc
+// @Summary Mark one of the caller's shipped sub-orders delivered
+// @Tags order
+// @Produce json
+// @Success 200 {object} models.SubOrder
+// @Router		/seller/orders/{id}/deliver	[post]
+func (o *orderController) DeliverOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.DeliverOrder(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// ExportSellerOrders godoc
+// @Summary Stream the caller's sub-orders placed in a date range as csv, one row per item
+// @Tags order
+// @Produce text/csv
+// @Param types.ExportOrders query types.ExportOrders true "date range"
+// @Success 200 {file} file
+// @Router		/seller/orders/export	[get]
+func (o *orderController) ExportSellerOrders() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.ExportOrders
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		query := api.OrderQuery{Status: request.Status, From: request.From, To: request.To}
+		if err := query.Validate(); err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Header("Content-Disposition", "attachment; filename=orders.csv")
+		ctx.Status(http.StatusOK)
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		// the status line is already out, so a failure can only cut the stream short
+		if err := o.s.ExportSellerOrders(payload.UserID, query, ctx.Writer); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
+// orderID reads the order or sub-order id from the path, it answers the request itself when the id is invalid.
+func orderID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetOrder
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+// GetOrders godoc
+// @Summary List the caller's orders, newest first, filtered by status and the date they were placed
+// @Tags order
+// @Produce json
+// @Param types.GetOrders query types.GetOrders true "filters"
+// @Success 200 {string} orders
+// @Router		/orders	[get]
+func (o *orderController) GetOrders() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetOrders
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		orders, err := o.s.BuyerOrders(payload.UserID, orderQuery(request))
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, orders)
+	}
+}
+
+// GetOrder godoc
+// @Summary Get one of the caller's orders with every seller's part of it
+// @Tags order
+// @Produce json
+// @Success 200 {object} models.Order
+// @Router		/orders/{id}	[get]
+func (o *orderController) GetOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetOrder
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.BuyerOrder(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// GetOrderByNumber godoc
+// @Summary Get one of the caller's orders by its order or invoice number
+// @Tags order
+// @Produce json
+// @Param number path string true "order or invoice number"
+// @Success 200 {object} models.Order
+// @Router		/orders/number/{number}	[get]
+func (o *orderController) GetOrderByNumber() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetOrderByNumber
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.s.BuyerOrderByNumber(uri.Number, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+// Reorder godoc
+// @Summary Put the items of one of the caller's orders back in their cart at today's prices
+// @Tags order
+// @Produce json
+// @Success 200 {string} cart
+// @Router		/orders/{id}/reorder	[post]
+func (o *orderController) Reorder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetOrder
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		cart, skipped, err := o.s.Reorder(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		// skipped lists the items that are no longer sold
+		ctx.JSON(http.StatusOK, gin.H{"cart": cart, "skipped": skipped})
+	}
+}
+
+// CancelOrder godoc
+// @Summary Cancel the parts of one of the caller's orders that haven't shipped, paid parts are refunded
+// @Tags order
+// @Accept json
+// @Produce json
+// @Param types.CancelOrder body types.CancelOrder false "reason"
+// @Success 200 {object} models.Order
+// @Router		/orders/{id}/cancel	[post]
+func (o *orderController) CancelOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.CancelOrder
+		// the reason is optional, so is the body
+		if ctx.Request.ContentLength != 0 {
+			if err := ctx.ShouldBindJSON(&request); err != nil {
+				ctx.JSON(http.StatusBadRequest, errorRes(err))
+				return
+			}
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		order, err := o.returns.CancelOrder(id, payload.UserID, request.Reason)
+		if err != nil {
+			ctx.JSON(orderErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, order)
+	}
+}
+
+func orderQuery(request types.GetOrders) api.OrderQuery {
+	return api.OrderQuery{
+		Status: request.Status,
+		From:   request.From,
+		To:     request.To,
+		Limit:  request.Limit,
+		Cursor: request.Cursor,
+	}
+}
+
+func orderErrStatus(err error) int {
+	switch err {
+	case api.ErrOrderNotFound, api.ErrSubOrderNotFound:
+		return http.StatusNotFound
+	case api.ErrInvalidOrderStatus, api.ErrInvalidDateRange, api.ErrTrackingRequired:
+		return http.StatusBadRequest
+	case api.ErrInvalidOrderTransition, api.ErrCannotCancel:
+		return http.StatusConflict
+	default:
+		return pageErrStatus(err)
+	}
+}
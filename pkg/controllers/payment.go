@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/payment"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookSize bounds the body of a provider webhook.
+const maxWebhookSize = 1 << 20
+
+type PaymentController interface {
+	Pay() gin.HandlerFunc
+	GetPayments() gin.HandlerFunc
+	Webhook() gin.HandlerFunc
+}
+
+type paymentController struct {
+	s      api.PaymentService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewPaymentController(s api.PaymentService, maker token.Maker, config utils.Config) PaymentController {
+	return &paymentController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// Pay godoc
+// @Summary Start paying one of the caller's pending orders, the client finishes with the provider using the returned client secret or authorization url
+// @Tags payment
+// @Produce json
+// @Success 201 {object} models.Payment
+// @Router		/orders/{id}/pay	[post]
+func (p *paymentController) Pay() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		attempt, err := p.s.Pay(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(paymentErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, attempt)
+	}
+}
+
+// GetPayments godoc
+// @Summary List every payment attempt, capture, refund and webhook of one of the caller's orders
+// @Tags payment
+// @Produce json
+// @Success 200 {array} models.Payment
+// @Router		/orders/{id}/payments	[get]
+func (p *paymentController) GetPayments() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		payments, err := p.s.Payments(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(paymentErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, payments)
+	}
+}
+
+// Webhook godoc
+// @Summary Receive a signed payment provider webhook, redelivered events are acknowledged without acting on them again
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/payments/webhooks/{provider}	[post]
+func (p *paymentController) Webhook() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.PaymentWebhook
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		// the signature covers the exact bytes, so the body is read raw rather than bound
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxWebhookSize))
+		if err != nil {
+			ctx.JSON(http.StatusRequestEntityTooLarge, errorRes(err))
+			return
+		}
+
+		if err = p.s.HandleWebhook(uri.Provider, ctx.Request.Header, body); err != nil {
+			ctx.JSON(paymentErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("received"))
+	}
+}
+
+func paymentErrStatus(err error) int {
+	var provider_err *payment.Error
+	switch {
+	case err == api.ErrOrderNotFound, err == api.ErrPaymentNotFound, err == payment.ErrUnknownProvider:
+		return http.StatusNotFound
+	case err == api.ErrOrderNotPayable, err == api.ErrRefundPending:
+		return http.StatusConflict
+	case err == payment.ErrInvalidSignature:
+		return http.StatusUnauthorized
+	case errors.As(err, &provider_err):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
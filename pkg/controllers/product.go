@@ -6,15 +6,20 @@ import (
 	"kamoushop/pkg/libs"
 	"kamoushop/pkg/models"
 	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/catalog"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/search"
 	"kamoushop/pkg/services/token"
 	"kamoushop/pkg/services/types"
 	"kamoushop/pkg/utils"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductController interface {
@@ -24,27 +29,44 @@ type ProductController interface {
 	GetProdById() gin.HandlerFunc
 	DeleteProduct() gin.HandlerFunc
 	UpdateProduct() gin.HandlerFunc
-	AddToCart() gin.HandlerFunc
-	RemoveFromCart() gin.HandlerFunc
-	MakeOrder() gin.HandlerFunc
+	AssignCategories() gin.HandlerFunc
+	SearchProducts() gin.HandlerFunc
+	ListProducts() gin.HandlerFunc
+	ChangeStatus() gin.HandlerFunc
+	ImportProducts() gin.HandlerFunc
+	ExportProducts() gin.HandlerFunc
+	UpdatePrice() gin.HandlerFunc
+	SetSale() gin.HandlerFunc
+	ClearSale() gin.HandlerFunc
+	PriceHistory() gin.HandlerFunc
+	Feed() gin.HandlerFunc
 }
 
 type productController struct {
-	s      api.ProductService
-	maker  token.Maker
-	config utils.Config
+	s       api.ProductService
+	cats    api.CategoryService
+	search  search.Backend
+	imports api.ImportService
+	rates   *money.Converter
+	maker   token.Maker
+	config  utils.Config
 }
 
-func NewProductController(s api.ProductService, maker token.Maker, config utils.Config) ProductController {
+func NewProductController(s api.ProductService, cats api.CategoryService, search search.Backend, imports api.ImportService, rates *money.Converter, maker token.Maker, config utils.Config) ProductController {
 	return &productController{
-		s:      s,
-		maker:  maker,
-		config: config,
+		s:       s,
+		cats:    cats,
+		search:  search,
+		imports: imports,
+		rates:   rates,
+		maker:   maker,
+		config:  config,
 	}
 }
 
 // CreateProduct godoc
 // @Summary Add a new product to the database
+// @Description price is in the minor unit of the shop's currency (kobo for NGN), it used to be whole units
 // @Tags product
 // @Accept json
 // @Produce json
@@ -59,6 +81,18 @@ func (p *productController) CreateProduct() gin.HandlerFunc {
 			return
 		}
 
+		category_ids, err := p.cats.ResolveSlugs(request.Categories)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		category_names, err := p.cats.SearchNames(category_ids)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
 		secure_url, _, err := libs.UploadToCloud(ctx)
 		if err != nil {
 			ctx.JSON(http.StatusExpectationFailed, errorRes(err))
@@ -68,13 +102,18 @@ func (p *productController) CreateProduct() gin.HandlerFunc {
 		payload := ctx.MustGet(authPayload).(*token.Payload)
 
 		data := types.Product{
-			Price:       request.Price,
-			Name:        request.Name,
-			Image:       secure_url,
-			Description: request.Description,
+			Price:         request.Price,
+			Name:          request.Name,
+			Image:         secure_url,
+			Description:   request.Description,
+			Stock:         request.Stock,
+			CategoryNames: category_names,
+			Weight:        request.Weight,
+			Status:        request.Status,
+			PublishAt:     request.PublishAt,
 		}
 
-		result, err := p.s.CreateProduct(data, payload.UserID)
+		result, err := p.s.CreateProduct(data, payload.UserID, category_ids)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, errorRes(err))
 			return
@@ -98,20 +137,19 @@ func (p *productController) GetProductsByUserId() gin.HandlerFunc {
 			return
 		}
 
-		counter := int64(1)
-		skip := (request.Page - counter) * request.Limit
-		filter := bson.D{{Key: "userId", Value: user_id}}
-		options := &options.FindOptions{
-			Limit: &request.Limit,
-			Skip:  &skip,
+		query := api.ProductQuery{ShopID: &user_id, Limit: request.Limit, Cursor: request.Cursor}
+
+		// sellers see their drafts, scheduled and archived products too
+		if payload := ctx.MustGet(authPayload).(*token.Payload); payload.UserID == user_id {
+			query.Statuses = api.ProductStatuses
 		}
-		result, totalDocs, err := p.s.GetProducts(filter, options)
+		result, err := p.s.ListProducts(query)
 
 		if err != nil {
-			ctx.JSON(http.StatusExpectationFailed, errorRes(err))
+			ctx.JSON(productErrStatus(err), errorRes(err))
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{"products": result, "totalDocuments": totalDocs})
+		ctx.JSON(http.StatusOK, result)
 	}
 }
 
@@ -123,22 +161,284 @@ func (p *productController) QueryProductsByName() gin.HandlerFunc {
 			return
 		}
 
-		counter := int64(1)
-		skip := (request.Page - counter) * request.Limit
+		result, err := p.search.Search(search.Query{Text: request.Keyword, Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
 
-		regex := primitive.Regex{Pattern: request.Keyword, Options: "i"}
-		filter := bson.D{{Key: "name", Value: regex}}
+		ctx.JSON(http.StatusOK, result.Page)
+	}
+}
 
-		var products []models.Product
+// ListProducts godoc
+// @Summary List products with filters and sorting
+// @Tags product
+// @Produce json
+// @Param types.ListProducts query types.ListProducts true "filters"
+// @Success 200 {string} products
+// @Router		/product	[get]
+func (p *productController) ListProducts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.ListProducts
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		query := api.ProductQuery{
+			MinPrice:     request.MinPrice,
+			MaxPrice:     request.MaxPrice,
+			Currency:     strings.ToUpper(request.Currency),
+			InStock:      request.InStock,
+			CreatedAfter: request.CreatedAfter,
+			Sort:         request.Sort,
+			Limit:        request.Limit,
+			Cursor:       request.Cursor,
+		}
+
+		if request.Category != "" {
+			ids, err := p.cats.SubtreeIDs(request.Category)
+			if err != nil {
+				ctx.JSON(categoryErrStatus(err), errorRes(err))
+				return
+			}
+			query.CategoryIDs = ids
+		}
 
-		products, totalDocs, err := p.s.GetProducts(filter, &options.FindOptions{Limit: &request.Limit, Skip: &skip})
+		if request.Shop != "" {
+			shop_id, err := primitive.ObjectIDFromHex(request.Shop)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, errorRes(err))
+				return
+			}
+			query.ShopID = &shop_id
+		}
 
+		products, err := p.s.ListProducts(query)
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		for i := range products.Items {
+			if err = p.display(&products.Items[i], request.DisplayCurrency); err != nil {
+				ctx.JSON(productErrStatus(err), errorRes(err))
+				return
+			}
+		}
+
+		ctx.JSON(http.StatusOK, products)
+	}
+}
+
+// Feed godoc
+// @Summary Newest products from the shops the caller has starred
+// @Tags product
+// @Produce json
+// @Param types.GetFeed query types.GetFeed true "pagination"
+// @Success 200 {string} products
+// @Router		/product/feed	[get]
+func (p *productController) Feed() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetFeed
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		products, err := p.s.Feed(payload.UserID, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		for i := range products.Items {
+			if err = p.display(&products.Items[i], request.DisplayCurrency); err != nil {
+				ctx.JSON(productErrStatus(err), errorRes(err))
+				return
+			}
+		}
+
+		ctx.JSON(http.StatusOK, products)
+	}
+}
+
+// ChangeStatus godoc
+// @Summary Move one of the caller's products through draft, scheduled, published, unpublished and archived
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param types.ChangeProductStatus body types.ChangeProductStatus true "new status"
+// @Success 200 {object} models.Product
+// @Router		/product/{id}/status	[patch]
+func (p *productController) ChangeStatus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.ChangeProductStatus
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		product, err := p.s.ChangeStatus(id, payload.UserID, request.Status, request.PublishAt)
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, product)
+	}
+}
+
+// ImportProducts godoc
+// @Summary Create or update the caller's products in bulk from a csv or json lines file, matched by sku
+// @Tags product
+// @Accept mpfd
+// @Produce json
+// @Param types.ImportProducts query types.ImportProducts true "format and dry run"
+// @Param file formData file true "csv or jsonl file"
+// @Success 200 {object} catalog.Report
+// @Router		/product/import	[post]
+func (p *productController) ImportProducts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.ImportProducts
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		file, _, err := ctx.Request.FormFile("file")
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+		defer file.Close()
+
+		rows, row_errors, err := catalog.Parse(request.Format, file)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		report, err := p.imports.Import(payload.UserID, rows, row_errors, request.DryRun)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"products: ": products, "totalDocuments: ": totalDocs})
+		ctx.JSON(http.StatusOK, report)
+	}
+}
+
+// ExportProducts godoc
+// @Summary Stream the caller's whole catalog as csv or json lines
+// @Tags product
+// @Produce octet-stream
+// @Param types.ExportProducts query types.ExportProducts true "format"
+// @Success 200 {file} file
+// @Router		/product/export	[get]
+func (p *productController) ExportProducts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.ExportProducts
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		content_type := "text/csv"
+		if request.Format == catalog.FormatJSONL {
+			content_type = "application/x-ndjson"
+		}
+
+		ctx.Header("Content-Type", content_type)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=products.%s", request.Format))
+		ctx.Status(http.StatusOK)
+
+		w, err := catalog.NewWriter(request.Format, ctx.Writer)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		// the status line is already out, so a failure can only cut the stream short
+		if err = p.imports.Export(payload.UserID, w); err != nil {
+			ctx.Error(err)
+		}
+	}
+}
+
+// SearchProducts godoc
+// @Summary Full text product search ranked by relevance, with price, category and shop facets
+// @Tags product
+// @Produce json
+// @Param types.SearchProducts query types.SearchProducts true "search query"
+// @Success 200 {object} search.Result
+// @Router		/product/search	[get]
+func (p *productController) SearchProducts() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.SearchProducts
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		query := search.Query{
+			Text:     request.Q,
+			MinPrice: request.MinPrice,
+			MaxPrice: request.MaxPrice,
+			Currency: strings.ToUpper(request.Currency),
+			Limit:    request.Limit,
+			Cursor:   request.Cursor,
+		}
+
+		if request.Category != "" {
+			ids, err := p.cats.SubtreeIDs(request.Category)
+			if err != nil {
+				ctx.JSON(categoryErrStatus(err), errorRes(err))
+				return
+			}
+			query.CategoryIDs = ids
+		}
+
+		if request.Shop != "" {
+			shop_id, err := primitive.ObjectIDFromHex(request.Shop)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, errorRes(err))
+				return
+			}
+			query.ShopID = &shop_id
+		}
+
+		result, err := p.search.Search(query)
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		for i := range result.Items {
+			if err = p.display(&result.Items[i].Product, request.DisplayCurrency); err != nil {
+				ctx.JSON(productErrStatus(err), errorRes(err))
+				return
+			}
+		}
+
+		ctx.JSON(http.StatusOK, result)
 	}
 }
 
@@ -163,6 +463,25 @@ func (p *productController) GetProdById() gin.HandlerFunc {
 			return
 		}
 
+		// unpublished products can only be previewed by their seller, the public catalog has no caller
+		if product.Status != api.StatusPublished {
+			payload, ok := ctx.Get(authPayload)
+			if !ok || payload.(*token.Payload).UserID != product.UserID {
+				ctx.JSON(http.StatusNotFound, errorRes(api.ErrCantFindProduct))
+				return
+			}
+		}
+
+		var display types.DisplayCurrency
+		if err := ctx.ShouldBindQuery(&display); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+		if err = p.display(&product, display.Currency); err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
 		ctx.JSON(http.StatusOK, product)
 	}
 }
@@ -204,96 +523,263 @@ func (p *productController) UpdateProduct() gin.HandlerFunc {
 			return
 		}
 
-		filter := bson.D{primitive.E{Key: "_id", Value: id}}
-		descrObj := bson.D{{Key: "description", Value: request.Description}}
-		priceObj := bson.D{{Key: "price", Value: fmt.Sprint(request.Price)}}
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		filter := bson.D{primitive.E{Key: "_id", Value: id}, {Key: "userId", Value: payload.UserID}}
+		setObj := bson.D{}
 
-		var updateObj bson.D
+		if len(request.Description) > 1 {
+			setObj = append(setObj, bson.E{Key: "description", Value: request.Description})
+		}
+		if request.Stock != nil {
+			setObj = append(setObj, bson.E{Key: "stock", Value: *request.Stock})
+		}
+		if request.Weight != nil {
+			setObj = append(setObj, bson.E{Key: "weight", Value: *request.Weight})
+		}
 
-		if len(request.Description) > 1 && request.Price > 1 {
-			updateObj = bson.D{{Key: "$set", Value: descrObj}, {Key: "$set", Value: priceObj}}
-		} else if len(request.Description) > 1 {
-			updateObj = bson.D{{Key: "$set", Value: descrObj}}
-		} else if request.Price > 1 {
-			updateObj = bson.D{{Key: "$set", Value: priceObj}}
-		} else {
+		if len(setObj) == 0 && request.Price == nil {
 			ctx.JSON(http.StatusBadRequest, errorRes(errors.New("please provide a field to update")))
 			return
 		}
 
-		if err = p.s.UpdateOne(filter, updateObj); err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
-			return
+		if len(setObj) > 0 {
+			updateObj := bson.D{{Key: "$set", Value: append(setObj, bson.E{Key: "updatedAt", Value: time.Now()})}}
+			if err = p.s.UpdateOne(filter, updateObj); err != nil {
+				ctx.JSON(http.StatusInternalServerError, errorRes(err))
+				return
+			}
+		}
+
+		// price changes go through the price history
+		if request.Price != nil {
+			if _, err = p.s.UpdatePrice(id, payload.UserID, *request.Price); err != nil {
+				ctx.JSON(productErrStatus(err), errorRes(err))
+				return
+			}
 		}
 
 		ctx.JSON(http.StatusOK, msgRes("updated"))
 	}
 }
 
-func (p *productController) AddToCart() gin.HandlerFunc {
+// UpdatePrice godoc
+// @Summary Change the regular price of one of the caller's products
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param types.UpdatePrice body types.UpdatePrice true "new price"
+// @Success 200 {object} models.Product
+// @Router		/product/{id}/price	[patch]
+func (p *productController) UpdatePrice() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var request types.AddToCart
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
 
+		var request types.UpdatePrice
 		if err := ctx.ShouldBindJSON(&request); err != nil {
 			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
-		payload, _ := ctx.MustGet(authPayload).(*token.Payload)
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		product, err := p.s.UpdatePrice(id, payload.UserID, request.Price)
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, product)
+	}
+}
 
-		id := payload.UserID
-		prod_id, er := primitive.ObjectIDFromHex(request.ProdID)
+// SetSale godoc
+// @Summary Put one of the caller's products on sale, optionally between two dates
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param types.SetSale body types.SetSale true "sale price and window"
+// @Success 200 {object} models.Product
+// @Router		/product/{id}/sale	[put]
+func (p *productController) SetSale() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
 
-		if er != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(er))
+		var request types.SetSale
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
-		if er = p.s.AddToCart(prod_id, id); er != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(er))
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, msgRes("added to cart"))
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		product, err := p.s.SetSale(id, payload.UserID, request.SalePrice, request.StartsAt, request.EndsAt)
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, product)
 	}
 }
 
-func (p *productController) RemoveFromCart() gin.HandlerFunc {
+// ClearSale godoc
+// @Summary End the sale on one of the caller's products
+// @Tags product
+// @Produce json
+// @Success 200 {object} models.Product
+// @Router		/product/{id}/sale	[delete]
+func (p *productController) ClearSale() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var request types.GetProdById
-		if err := ctx.ShouldBindUri(&request); err != nil {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
 			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
-		payload, _ := ctx.MustGet(authPayload).(*token.Payload)
-		prod_id, err := primitive.ObjectIDFromHex(request.ID)
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
 
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		product, err := p.s.ClearSale(id, payload.UserID)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			ctx.JSON(productErrStatus(err), errorRes(err))
 			return
 		}
 
-		if err = p.s.RemoveFromCart(prod_id, payload.UserID); err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+		ctx.JSON(http.StatusOK, product)
+	}
+}
+
+// PriceHistory godoc
+// @Summary Get the price and sale changes of a product, newest first
+// @Tags product
+// @Produce json
+// @Param types.GetPriceHistory query types.GetPriceHistory true "pagination"
+// @Success 200 {string} history
+// @Router		/product/{id}/price-history	[get]
+func (p *productController) PriceHistory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.GetPriceHistory
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, msgRes("removed from cart"))
+		history, err := p.s.PriceHistory(id, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(productErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, history)
 	}
 }
 
-// TODO: send a pdf instead as invoice with order details to user
-func (p *productController) MakeOrder() gin.HandlerFunc {
+// AssignCategories godoc
+// @Summary Replace the categories of one of the caller's products
+// @Tags product
+// @Accept json
+// @Produce json
+// @Param types.AssignCategories body types.AssignCategories true "category slugs"
+// @Success 200 {string} msgRes
+// @Router		/product/{id}/categories	[put]
+func (p *productController) AssignCategories() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		payload, _ := ctx.MustGet(authPayload).(*token.Payload)
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.AssignCategories
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
 
-		order, err := p.s.MakeOrder(payload.UserID)
+		prod_id, err := primitive.ObjectIDFromHex(uri.ID)
 		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+
+		if err = p.cats.AssignProduct(prod_id, payload.UserID, request.Categories); err != nil {
+			if err == api.ErrCategoryNotFound || err == api.ErrCantFindProduct {
+				ctx.JSON(http.StatusNotFound, errorRes(err))
+				return
+			}
 			ctx.JSON(http.StatusInternalServerError, errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, order)
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// display fills in the product's price converted to currency, an empty currency leaves it out.
+func (p *productController) display(product *models.Product, currency string) error {
+	if currency == "" {
+		return nil
+	}
+
+	converted, err := p.rates.Convert(product.EffectivePrice, strings.ToUpper(currency))
+	if err != nil {
+		return err
+	}
+	product.DisplayPrice = &converted
+	return nil
+}
+
+func productErrStatus(err error) int {
+	if errors.Is(err, money.ErrUnknownCurrency) || errors.Is(err, money.ErrNoRate) {
+		return http.StatusBadRequest
+	}
+
+	switch err {
+	case api.ErrInvalidPriceRange, api.ErrInvalidSort, pagination.ErrInvalidLimit, pagination.ErrInvalidCursor:
+		return http.StatusBadRequest
+	case api.ErrInvalidStatus, api.ErrPublishAtRequired, api.ErrInvalidPrice, api.ErrInvalidSalePrice, api.ErrInvalidSaleDates:
+		return http.StatusBadRequest
+	case api.ErrInvalidTransition:
+		return http.StatusConflict
+	case api.ErrCantFindProduct:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PromotionController interface {
+	CreatePromotion() gin.HandlerFunc
+	UpdatePromotion() gin.HandlerFunc
+	GetPromotion() gin.HandlerFunc
+	GetPromotions() gin.HandlerFunc
+}
+
+type promotionController struct {
+	s      api.PromotionService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewPromotionController(s api.PromotionService, maker token.Maker, config utils.Config) PromotionController {
+	return &promotionController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreatePromotion godoc
+// @Summary Create a coupon, or a promotion that applies by itself when it has no code (admins only)
+// @Tags promotion
+// @Accept json
+// @Produce json
+// @Param types.AddPromotion body types.AddPromotion true "promotion"
+// @Success 201 {object} models.Promotion
+// @Router		/promotions	[post]
+func (p *promotionController) CreatePromotion() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddPromotion
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+		request.Currency = strings.ToUpper(request.Currency)
+		if request.Currency == "" {
+			request.Currency = p.config.DefaultCurrency
+		}
+
+		promotion, err := p.s.CreatePromotion(request)
+		if err != nil {
+			ctx.JSON(promotionErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, promotion)
+	}
+}
+
+// UpdatePromotion godoc
+// @Summary Rename, switch on or off, or change the limits and dates of a promotion (admins only)
+// @Tags promotion
+// @Accept json
+// @Produce json
+// @Param types.UpdatePromotion body types.UpdatePromotion true "fields to update"
+// @Success 200 {object} models.Promotion
+// @Router		/promotions/{id}	[patch]
+func (p *promotionController) UpdatePromotion() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := promotionID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.UpdatePromotion
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		promotion, err := p.s.UpdatePromotion(id, request)
+		if err != nil {
+			ctx.JSON(promotionErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, promotion)
+	}
+}
+
+// GetPromotion godoc
+// @Summary Get a promotion and how often it was used (admins only)
+// @Tags promotion
+// @Produce json
+// @Success 200 {object} models.Promotion
+// @Router		/promotions/{id}	[get]
+func (p *promotionController) GetPromotion() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := promotionID(ctx)
+		if !ok {
+			return
+		}
+
+		promotion, err := p.s.GetPromotion(id)
+		if err != nil {
+			ctx.JSON(promotionErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, promotion)
+	}
+}
+
+// GetPromotions godoc
+// @Summary List every promotion, newest first (admins only)
+// @Tags promotion
+// @Produce json
+// @Param types.GetPromotions query types.GetPromotions true "pagination"
+// @Success 200 {string} promotions
+// @Router		/promotions	[get]
+func (p *promotionController) GetPromotions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetPromotions
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		promotions, err := p.s.GetPromotions(pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(promotionErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, promotions)
+	}
+}
+
+func promotionID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetPromotion
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func promotionErrStatus(err error) int {
+	switch err {
+	case api.ErrPromotionNotFound:
+		return http.StatusNotFound
+	case api.ErrPromotionExists:
+		return http.StatusConflict
+	case api.ErrInvalidPromotionKind, api.ErrInvalidPercent, api.ErrInvalidDiscount, api.ErrInvalidBuyXGetY,
+		api.ErrInvalidPromotionScope, api.ErrInvalidPromotionSeller, api.ErrInvalidPromotionDates, api.ErrInvalidPromotionLimits, money.ErrUnknownCurrency:
+		return http.StatusBadRequest
+	default:
+		return pageErrStatus(err)
+	}
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"encoding/json"
+	"kamoushop/pkg/libs"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/payment"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxReturnPhotos caps the photos attached to a single return.
+const maxReturnPhotos = 5
+
+type ReturnController interface {
+	RequestReturn() gin.HandlerFunc
+	GetOrderReturns() gin.HandlerFunc
+	GetSellerReturns() gin.HandlerFunc
+	ApproveReturn() gin.HandlerFunc
+	DenyReturn() gin.HandlerFunc
+}
+
+type returnController struct {
+	s      api.ReturnService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewReturnController(s api.ReturnService, maker token.Maker, config utils.Config) ReturnController {
+	return &returnController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// RequestReturn godoc
+// @Summary Ask to send back items of a delivered part of one of the caller's orders
+// @Tags return
+// @Accept mpfd
+// @Produce json
+// @Param types.RequestReturn formData types.RequestReturn true "sub-order, reason, items as json and up to 5 photos under photos"
+// @Success 201 {object} models.Return
+// @Router		/orders/{id}/returns	[post]
+func (r *returnController) RequestReturn() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.RequestReturn
+		if err := ctx.ShouldBind(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		sub_order_id, err := primitive.ObjectIDFromHex(request.SubOrderID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var requested []types.ReturnItem
+		if err = json.Unmarshal([]byte(request.Items), &requested); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+		items := []models.ReturnItem{}
+		for _, item := range requested {
+			product_id, err := primitive.ObjectIDFromHex(item.ProductID)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, errorRes(err))
+				return
+			}
+			items = append(items, models.ReturnItem{ProductID: product_id, Variant: item.Variant, Quantity: item.Quantity})
+		}
+
+		photos, err := libs.UploadFilesToCloud(ctx, "photos", maxReturnPhotos)
+		if err != nil {
+			ctx.JSON(http.StatusExpectationFailed, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		ret, err := r.s.RequestReturn(id, payload.UserID, sub_order_id, request.Reason, items, photos)
+		if err != nil {
+			ctx.JSON(returnErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, ret)
+	}
+}
+
+// GetOrderReturns godoc
+// @Summary List the returns of one of the caller's orders, oldest first
+// @Tags return
+// @Produce json
+// @Success 200 {array} models.Return
+// @Router		/orders/{id}/returns	[get]
+func (r *returnController) GetOrderReturns() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := orderID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		returns, err := r.s.OrderReturns(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(returnErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, returns)
+	}
+}
+
+// GetSellerReturns godoc
+// @Summary List returns of the caller's sub-orders, newest first, optionally only those in a status
+// @Tags return
+// @Produce json
+// @Param types.GetReturns query types.GetReturns true "filters"
+// @Success 200 {string} returns
+// @Router		/seller/returns	[get]
+func (r *returnController) GetSellerReturns() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetReturns
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		returns, err := r.s.SellerReturns(payload.UserID, request.Status, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(returnErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, returns)
+	}
+}
+
+// ApproveReturn godoc
+// @Summary Accept a return of one of the caller's sub-orders, the buyer is refunded in full or the given amount and the items go back in stock
+// @Tags return
+// @Accept json
+// @Produce json
+// @Param types.ApproveReturn body types.ApproveReturn true "optional partial amount and note"
+// @Success 200 {object} models.Return
+// @Router		/seller/returns/{id}/approve	[post]
+func (r *returnController) ApproveReturn() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := returnID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.ApproveReturn
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		ret, err := r.s.ApproveReturn(id, payload.UserID, request.Amount, request.Note)
+		if err != nil {
+			ctx.JSON(returnErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, ret)
+	}
+}
+
+// DenyReturn godoc
+// @Summary Refuse a return of one of the caller's sub-orders
+// @Tags return
+// @Accept json
+// @Produce json
+// @Param types.DenyReturn body types.DenyReturn true "note for the buyer"
+// @Success 200 {object} models.Return
+// @Router		/seller/returns/{id}/deny	[post]
+func (r *returnController) DenyReturn() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := returnID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.DenyReturn
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		ret, err := r.s.DenyReturn(id, payload.UserID, request.Note)
+		if err != nil {
+			ctx.JSON(returnErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, ret)
+	}
+}
+
+func returnID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetReturn
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func returnErrStatus(err error) int {
+	switch err {
+	case api.ErrReturnNotFound:
+		return http.StatusNotFound
+	case api.ErrInvalidReturnItems, api.ErrInvalidRefund, payment.ErrRefundTooLarge:
+		return http.StatusBadRequest
+	case api.ErrNotReturnable, api.ErrInvalidReturnTransition, api.ErrOrderNotPaid, api.ErrRefundAmountChanged:
+		return http.StatusConflict
+	case api.ErrOrderNotFound, api.ErrSubOrderNotFound:
+		return orderErrStatus(err)
+	default:
+		if status := paymentErrStatus(err); status != http.StatusInternalServerError {
+			return status
+		}
+		return pageErrStatus(err)
+	}
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"kamoushop/pkg/libs"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxReviewPhotos caps the photos attached to a single review.
+const maxReviewPhotos = 5
+
+type ReviewController interface {
+	CreateReview() gin.HandlerFunc
+	UpdateReview() gin.HandlerFunc
+	DeleteReview() gin.HandlerFunc
+	GetProductReviews() gin.HandlerFunc
+	ReplyToReview() gin.HandlerFunc
+	ModerateReview() gin.HandlerFunc
+	GetPendingReviews() gin.HandlerFunc
+}
+
+type reviewController struct {
+	s      api.ReviewService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewReviewController(s api.ReviewService, maker token.Maker, config utils.Config) ReviewController {
+	return &reviewController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateReview godoc
+// @Summary Review a product the caller has ordered, the review is shown once a moderator approves it
+// @Tags review
+// @Accept mpfd
+// @Produce json
+// @Param types.CreateReview formData types.CreateReview true "rating, text and up to 5 photos under photos"
+// @Success 201 {object} models.Review
+// @Router		/product/{id}/reviews	[post]
+func (r *reviewController) CreateReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.CreateReview
+		if err := ctx.ShouldBind(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		photos, err := libs.UploadFilesToCloud(ctx, "photos", maxReviewPhotos)
+		if err != nil {
+			ctx.JSON(http.StatusExpectationFailed, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		review, err := r.s.CreateReview(payload.UserID, product_id, request.Rating, request.Body, photos)
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, review)
+	}
+}
+
+// UpdateReview godoc
+// @Summary Edit the caller's review, it goes back to moderation, new photos replace the old ones
+// @Tags review
+// @Accept mpfd
+// @Produce json
+// @Param types.CreateReview formData types.CreateReview true "rating, text and optional photos"
+// @Success 200 {object} models.Review
+// @Router		/reviews/{id}	[patch]
+func (r *reviewController) UpdateReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetReview
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.CreateReview
+		if err := ctx.ShouldBind(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		photos, err := libs.UploadFilesToCloud(ctx, "photos", maxReviewPhotos)
+		if err != nil {
+			ctx.JSON(http.StatusExpectationFailed, errorRes(err))
+			return
+		}
+		if len(photos) == 0 {
+			photos = nil
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		review, err := r.s.UpdateReview(id, payload.UserID, request.Rating, request.Body, photos)
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, review)
+	}
+}
+
+// DeleteReview godoc
+// @Summary Delete the caller's review
+// @Tags review
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/reviews/{id}	[delete]
+func (r *reviewController) DeleteReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetReview
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err = r.s.DeleteReview(id, payload.UserID); err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// GetProductReviews godoc
+// @Summary List the approved reviews of a product, newest first
+// @Tags review
+// @Produce json
+// @Param types.GetProductReviews query types.GetProductReviews true "filters"
+// @Success 200 {string} reviews
+// @Router		/product/{id}/reviews	[get]
+func (r *reviewController) GetProductReviews() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetProdById
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.GetProductReviews
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		reviews, err := r.s.ProductReviews(product_id, request.Rating, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, reviews)
+	}
+}
+
+// ReplyToReview godoc
+// @Summary Answer a review of one of the caller's products
+// @Tags review
+// @Accept json
+// @Produce json
+// @Param types.ReplyToReview body types.ReplyToReview true "reply"
+// @Success 200 {object} models.Review
+// @Router		/reviews/{id}/reply	[put]
+func (r *reviewController) ReplyToReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetReview
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.ReplyToReview
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		review, err := r.s.Reply(id, payload.UserID, request.Body)
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, review)
+	}
+}
+
+// ModerateReview godoc
+// @Summary Approve or reject a review (admins only)
+// @Tags review
+// @Accept json
+// @Produce json
+// @Param types.ModerateReview body types.ModerateReview true "decision"
+// @Success 200 {object} models.Review
+// @Router		/reviews/{id}/moderation	[patch]
+func (r *reviewController) ModerateReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetReview
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.ModerateReview
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		review, err := r.s.Moderate(id, request.Status)
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, review)
+	}
+}
+
+// GetPendingReviews godoc
+// @Summary The moderation queue, oldest first (admins only)
+// @Tags review
+// @Produce json
+// @Param types.GetPendingReviews query types.GetPendingReviews true "pagination"
+// @Success 200 {string} reviews
+// @Router		/reviews/pending	[get]
+func (r *reviewController) GetPendingReviews() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetPendingReviews
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		reviews, err := r.s.PendingReviews(pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(reviewErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, reviews)
+	}
+}
+
+func reviewErrStatus(err error) int {
+	switch err {
+	case api.ErrInvalidRating, api.ErrInvalidModeration, pagination.ErrInvalidLimit, pagination.ErrInvalidCursor:
+		return http.StatusBadRequest
+	case api.ErrNotPurchased, api.ErrOwnProduct:
+		return http.StatusForbidden
+	case api.ErrDuplicateReview:
+		return http.StatusConflict
+	case api.ErrReviewNotFound, api.ErrCantFindProduct:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
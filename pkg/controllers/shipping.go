@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/shipping"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ShippingController interface {
+	CreateDeliveryZone() gin.HandlerFunc
+	UpdateDeliveryZone() gin.HandlerFunc
+	DeleteDeliveryZone() gin.HandlerFunc
+	GetDeliveryZones() gin.HandlerFunc
+}
+
+type shippingController struct {
+	s      api.ShippingService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewShippingController(s api.ShippingService, maker token.Maker, config utils.Config) ShippingController {
+	return &shippingController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateDeliveryZone godoc
+// @Summary Add regions the caller's shop delivers to and the rates it charges there
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param types.AddDeliveryZone body types.AddDeliveryZone true "zone"
+// @Success 201 {object} models.DeliveryZone
+// @Router		/seller/shipping/zones	[post]
+func (s *shippingController) CreateDeliveryZone() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddDeliveryZone
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		zone, err := s.s.CreateZone(payload.UserID, request)
+		if err != nil {
+			ctx.JSON(shippingErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, zone)
+	}
+}
+
+// UpdateDeliveryZone godoc
+// @Summary Replace the name, regions and rates of one of the caller's delivery zones
+// @Tags shipping
+// @Accept json
+// @Produce json
+// @Param types.AddDeliveryZone body types.AddDeliveryZone true "zone"
+// @Success 200 {object} models.DeliveryZone
+// @Router		/seller/shipping/zones/{id}	[put]
+func (s *shippingController) UpdateDeliveryZone() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := deliveryZoneID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.AddDeliveryZone
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		zone, err := s.s.UpdateZone(payload.UserID, id, request)
+		if err != nil {
+			ctx.JSON(shippingErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, zone)
+	}
+}
+
+// DeleteDeliveryZone godoc
+// @Summary Stop delivering to the regions of one of the caller's delivery zones
+// @Tags shipping
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/seller/shipping/zones/{id}	[delete]
+func (s *shippingController) DeleteDeliveryZone() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := deliveryZoneID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := s.s.DeleteZone(payload.UserID, id); err != nil {
+			ctx.JSON(shippingErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// GetDeliveryZones godoc
+// @Summary List the caller's delivery zones, a shop without any ships everywhere for free
+// @Tags shipping
+// @Produce json
+// @Success 200 {array} models.DeliveryZone
+// @Router		/seller/shipping/zones	[get]
+func (s *shippingController) GetDeliveryZones() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		zones, err := s.s.GetZones(payload.UserID)
+		if err != nil {
+			ctx.JSON(shippingErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, zones)
+	}
+}
+
+func deliveryZoneID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetDeliveryZone
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func shippingErrStatus(err error) int {
+	switch err {
+	case api.ErrDeliveryZoneNotFound, api.ErrUserNotFound:
+		return http.StatusNotFound
+	case api.ErrDeliveryZoneOverlaps:
+		return http.StatusConflict
+	case shipping.ErrInvalidRateKind, shipping.ErrInvalidRatePrice, shipping.ErrInvalidDeliveryDays, tax.ErrInvalidRegion, money.ErrUnknownCurrency:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
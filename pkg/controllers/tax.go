@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaxController interface {
+	CreateTaxRule() gin.HandlerFunc
+	UpdateTaxRule() gin.HandlerFunc
+	DeleteTaxRule() gin.HandlerFunc
+	GetTaxRules() gin.HandlerFunc
+}
+
+type taxController struct {
+	s      api.TaxService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewTaxController(s api.TaxService, maker token.Maker, config utils.Config) TaxController {
+	return &taxController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateTaxRule godoc
+// @Summary Add the tax rate of a region, optionally only for a category (admins only)
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param types.AddTaxRule body types.AddTaxRule true "rule"
+// @Success 201 {object} models.TaxRule
+// @Router		/tax/rules	[post]
+func (t *taxController) CreateTaxRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddTaxRule
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		rule, err := t.s.CreateRule(request)
+		if err != nil {
+			ctx.JSON(taxErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, rule)
+	}
+}
+
+// UpdateTaxRule godoc
+// @Summary Rename a tax rule or change its rate or rounding (admins only)
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param types.UpdateTaxRule body types.UpdateTaxRule true "fields to update"
+// @Success 200 {object} models.TaxRule
+// @Router		/tax/rules/{id}	[patch]
+func (t *taxController) UpdateTaxRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := taxRuleID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.UpdateTaxRule
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		rule, err := t.s.UpdateRule(id, request)
+		if err != nil {
+			ctx.JSON(taxErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteTaxRule godoc
+// @Summary Delete a tax rule (admins only)
+// @Tags tax
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/tax/rules/{id}	[delete]
+func (t *taxController) DeleteTaxRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := taxRuleID(ctx)
+		if !ok {
+			return
+		}
+
+		if err := t.s.DeleteRule(id); err != nil {
+			ctx.JSON(taxErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// GetTaxRules godoc
+// @Summary List every tax rule by region (admins only)
+// @Tags tax
+// @Produce json
+// @Success 200 {array} models.TaxRule
+// @Router		/tax/rules	[get]
+func (t *taxController) GetTaxRules() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rules, err := t.s.GetRules()
+		if err != nil {
+			ctx.JSON(taxErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, rules)
+	}
+}
+
+func taxRuleID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetTaxRule
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func taxErrStatus(err error) int {
+	switch err {
+	case api.ErrTaxRuleNotFound, api.ErrCategoryNotFound:
+		return http.StatusNotFound
+	case api.ErrTaxRuleExists:
+		return http.StatusConflict
+	case tax.ErrInvalidRegion, tax.ErrInvalidRate, tax.ErrInvalidRounding:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
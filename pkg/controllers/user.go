@@ -4,11 +4,14 @@ import (
 	"errors"
 	"kamoushop/pkg/libs"
 	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
 	"kamoushop/pkg/services/password"
 	"kamoushop/pkg/services/token"
 	"kamoushop/pkg/services/types"
 	"kamoushop/pkg/utils"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -29,10 +32,20 @@ type UserController interface {
 	UpdateImage() gin.HandlerFunc
 	UpdateProfile() gin.HandlerFunc
 	UpdateBrandName() gin.HandlerFunc
+	UpdateCurrency() gin.HandlerFunc
+	UpdateTaxPricing() gin.HandlerFunc
+	UpdateFreeShipping() gin.HandlerFunc
 	GetAllUsers() gin.HandlerFunc
 	QueryBrands() gin.HandlerFunc
 	DeleteUser() gin.HandlerFunc
 	StarUserShop() gin.HandlerFunc
+	UnstarUserShop() gin.HandlerFunc
+	GetFollowing() gin.HandlerFunc
+	GetAddresses() gin.HandlerFunc
+	AddAddress() gin.HandlerFunc
+	UpdateAddress() gin.HandlerFunc
+	DeleteAddress() gin.HandlerFunc
+	SetDefaultAddress() gin.HandlerFunc
 }
 
 type userController struct {
@@ -250,10 +263,93 @@ func (u *userController) UpdateBrandName() gin.HandlerFunc {
 			return
 		}
 		payload := ctx.MustGet(authPayload).(*token.Payload)
-		filter := bson.D{{Key: "_id", Value: payload.UserID}}
-		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "brandName", Value: request.BrandName}, {Key: "updatedAt", Value: time.Now()}}}}
 
-		if err = u.s.UpdateUser(filter, updateObj); err != nil {
+		if err = u.s.UpdateBrandName(payload.UserID, request.BrandName); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// UpdateCurrency godoc
+// @Summary Set the currency the user's shop prices its products in
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.UpdateCurrency body types.UpdateCurrency true "ISO currency code"
+// @Success 200 {string} msgRes
+// @Router		/user/update/currency	[patch]
+func (u *userController) UpdateCurrency() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.UpdateCurrency
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := u.s.UpdateCurrency(payload.UserID, strings.ToUpper(request.Currency)); err != nil {
+			switch err {
+			case money.ErrUnknownCurrency:
+				ctx.JSON(http.StatusBadRequest, errorRes(err))
+			case api.ErrShopHasProducts:
+				ctx.JSON(http.StatusConflict, errorRes(err))
+			default:
+				ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			}
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// UpdateTaxPricing godoc
+// @Summary Set whether the prices of the user's shop include tax or tax is added at checkout
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.UpdateTaxPricing body types.UpdateTaxPricing true "prices_include_tax"
+// @Success 200 {string} msgRes
+// @Router		/user/update/tax-pricing	[patch]
+func (u *userController) UpdateTaxPricing() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.UpdateTaxPricing
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := u.s.UpdateTaxPricing(payload.UserID, *request.PricesIncludeTax); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// UpdateFreeShipping godoc
+// @Summary Set whether the user's shop delivers for free where none of its delivery zones does
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.UpdateFreeShipping body types.UpdateFreeShipping true "free_shipping"
+// @Success 200 {string} msgRes
+// @Router		/user/update/free-shipping	[patch]
+func (u *userController) UpdateFreeShipping() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.UpdateFreeShipping
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := u.s.UpdateFreeShipping(payload.UserID, *request.FreeShipping); err != nil {
 			ctx.JSON(http.StatusInternalServerError, errorRes(err))
 			return
 		}
@@ -279,18 +375,14 @@ func (u *userController) GetAllUsers() gin.HandlerFunc {
 			return
 		}
 
-		users, totalDocs, err := u.s.GetAllUsers(request.Limit, request.Page)
+		users, err := u.s.GetAllUsers(pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
 
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				ctx.JSON(http.StatusNotFound, errorRes(errors.New("resource not found")))
-				return
-			}
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			ctx.JSON(pageErrStatus(err), errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"users": users, "totalDocuments": totalDocs})
+		ctx.JSON(http.StatusOK, users)
 	}
 }
 
@@ -311,18 +403,14 @@ func (u *userController) QueryBrands() gin.HandlerFunc {
 			return
 		}
 
-		brands, totalDocs, err := u.s.QueryBrands(request.Keyword, request.Limit, request.Page)
+		brands, err := u.s.QueryBrands(request.Keyword, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
 
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				ctx.JSON(http.StatusNotFound, errorRes(errors.New("resource not found")))
-				return
-			}
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			ctx.JSON(pageErrStatus(err), errorRes(err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"brands": brands, "totalDocuments": totalDocs})
+		ctx.JSON(http.StatusOK, brands)
 	}
 }
 
@@ -370,7 +458,7 @@ func (u *userController) DeleteUser() gin.HandlerFunc {
 }
 
 // StarUserShop godoc
-// @Summary Star a user's shop
+// @Summary Star a user's shop, starring it again changes nothing
 // @Tags user
 // @Accept json
 // @Produce json
@@ -387,19 +475,92 @@ func (u *userController) StarUserShop() gin.HandlerFunc {
 
 		shop_id, err := primitive.ObjectIDFromHex(request.ID)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
 			return
 		}
 
 		payload := ctx.MustGet(authPayload).(*token.Payload)
-		filter := bson.D{primitive.E{Key: "_id", Value: shop_id}}
-		updateObj := bson.D{{Key: "$inc", Value: bson.D{{Key: "stars", Value: 1}}}, {Key: "$addToSet", Value: bson.D{{Key: "starredBy", Value: payload.UserID}}}}
+		if err = u.s.StarShop(payload.UserID, shop_id); err != nil {
+			ctx.JSON(starErrStatus(err), errorRes(err))
+			return
+		}
 
-		if err = u.s.UpdateUser(filter, updateObj); err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorRes(err))
+		ctx.JSON(http.StatusOK, msgRes("updated"))
+	}
+}
+
+// UnstarUserShop godoc
+// @Summary Remove the caller's star from a user's shop
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.StarShop query types.StarShop true "user id"
+// @Success 200 {string} msgRes
+// @Router		/user/star/:id	[delete]
+func (u *userController) UnstarUserShop() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.StarShop
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		shop_id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err = u.s.UnstarShop(payload.UserID, shop_id); err != nil {
+			ctx.JSON(starErrStatus(err), errorRes(err))
 			return
 		}
 
 		ctx.JSON(http.StatusOK, msgRes("updated"))
 	}
 }
+
+// GetFollowing godoc
+// @Summary List the shops the caller has starred
+// @Tags user
+// @Produce json
+// @Param types.GetUsers query types.GetUsers true "pagination"
+// @Success 200 {string} users
+// @Router		/user/following	[get]
+func (u *userController) GetFollowing() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetUsers
+		if err := ctx.ShouldBindQuery(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		shops, err := u.s.Following(payload.UserID, pagination.Request{Limit: request.Limit, Cursor: request.Cursor})
+		if err != nil {
+			ctx.JSON(pageErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, shops)
+	}
+}
+
+func starErrStatus(err error) int {
+	switch err {
+	case api.ErrStarOwnShop:
+		return http.StatusBadRequest
+	case api.ErrShopNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func pageErrStatus(err error) int {
+	if err == pagination.ErrInvalidLimit || err == pagination.ErrInvalidCursor {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetAddresses godoc
+// @Summary List the caller's address book
+// @Tags user
+// @Produce json
+// @Success 200 {array} models.Address
+// @Router		/user/addresses	[get]
+func (u *userController) GetAddresses() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		addresses, err := u.s.GetAddresses(payload.UserID)
+		if err != nil {
+			ctx.JSON(addressErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, addresses)
+	}
+}
+
+// AddAddress godoc
+// @Summary Add an address to the caller's address book, the first one becomes the default
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.AddAddress body types.AddAddress true "address"
+// @Success 201 {object} models.Address
+// @Router		/user/addresses	[post]
+func (u *userController) AddAddress() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.AddAddress
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		address, err := u.s.AddAddress(payload.UserID, request)
+		if err != nil {
+			ctx.JSON(addressErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, address)
+	}
+}
+
+// UpdateAddress godoc
+// @Summary Replace an address of the caller's address book, placed orders keep the address they were sent to
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param types.AddAddress body types.AddAddress true "address"
+// @Success 200 {object} models.Address
+// @Router		/user/addresses/{id}	[put]
+func (u *userController) UpdateAddress() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := addressID(ctx)
+		if !ok {
+			return
+		}
+
+		var request types.AddAddress
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		address, err := u.s.UpdateAddress(payload.UserID, id, request)
+		if err != nil {
+			ctx.JSON(addressErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, address)
+	}
+}
+
+// DeleteAddress godoc
+// @Summary Remove an address from the caller's address book, the oldest one left becomes the default
+// @Tags user
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/user/addresses/{id}	[delete]
+func (u *userController) DeleteAddress() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := addressID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := u.s.DeleteAddress(payload.UserID, id); err != nil {
+			ctx.JSON(addressErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// SetDefaultAddress godoc
+// @Summary Make an address the caller's default delivery address
+// @Tags user
+// @Produce json
+// @Success 200 {object} models.Address
+// @Router		/user/addresses/{id}/default	[patch]
+func (u *userController) SetDefaultAddress() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, ok := addressID(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		address, err := u.s.SetDefaultAddress(payload.UserID, id)
+		if err != nil {
+			ctx.JSON(addressErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, address)
+	}
+}
+
+func addressID(ctx *gin.Context) (primitive.ObjectID, bool) {
+	var uri types.GetAddress
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(uri.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+func addressErrStatus(err error) int {
+	switch err {
+	case api.ErrAddressNotFound, api.ErrUserNotFound:
+		return http.StatusNotFound
+	case api.ErrAddressBookFull, api.ErrInvalidAddressRegion:
+		return http.StatusBadRequest
+	case api.ErrAddressBookChanged:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WishlistController interface {
+	CreateWishlist() gin.HandlerFunc
+	GetWishlists() gin.HandlerFunc
+	GetWishlist() gin.HandlerFunc
+	GetSharedWishlist() gin.HandlerFunc
+	UpdateWishlist() gin.HandlerFunc
+	DeleteWishlist() gin.HandlerFunc
+	AddItem() gin.HandlerFunc
+	RemoveItem() gin.HandlerFunc
+	MoveToCart() gin.HandlerFunc
+	SaveForLater() gin.HandlerFunc
+}
+
+type wishlistController struct {
+	s      api.WishlistService
+	maker  token.Maker
+	config utils.Config
+}
+
+func NewWishlistController(s api.WishlistService, maker token.Maker, config utils.Config) WishlistController {
+	return &wishlistController{
+		s:      s,
+		maker:  maker,
+		config: config,
+	}
+}
+
+// CreateWishlist godoc
+// @Summary Create a named wishlist, shared lists get a link anyone can open
+// @Tags wishlist
+// @Accept json
+// @Produce json
+// @Param types.CreateWishlist body types.CreateWishlist true "wishlist"
+// @Success 201 {object} models.Wishlist
+// @Router		/wishlists	[post]
+func (w *wishlistController) CreateWishlist() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.CreateWishlist
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.CreateWishlist(payload.UserID, request.Name, request.Shared)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, wishlist)
+	}
+}
+
+// GetWishlists godoc
+// @Summary List the caller's wishlists
+// @Tags wishlist
+// @Produce json
+// @Success 200 {array} models.Wishlist
+// @Router		/wishlists	[get]
+func (w *wishlistController) GetWishlists() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlists, err := w.s.GetWishlists(payload.UserID)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlists)
+	}
+}
+
+// GetWishlist godoc
+// @Summary Get one of the caller's wishlists
+// @Tags wishlist
+// @Produce json
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/{id}	[get]
+func (w *wishlistController) GetWishlist() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetWishlist
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.GetWishlist(id, payload.UserID)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// GetSharedWishlist godoc
+// @Summary Open a shared wishlist through its link, no account needed
+// @Tags wishlist
+// @Produce json
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/shared/{token}	[get]
+func (w *wishlistController) GetSharedWishlist() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetSharedWishlist
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		wishlist, err := w.s.GetShared(request.Token)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// UpdateWishlist godoc
+// @Summary Rename a wishlist or switch it between private and shared
+// @Tags wishlist
+// @Accept json
+// @Produce json
+// @Param types.UpdateWishlist body types.UpdateWishlist true "changes"
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/{id}	[patch]
+func (w *wishlistController) UpdateWishlist() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetWishlist
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.UpdateWishlist
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.UpdateWishlist(id, payload.UserID, request.Name, request.Shared)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// DeleteWishlist godoc
+// @Summary Delete one of the caller's wishlists
+// @Tags wishlist
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/wishlists/{id}	[delete]
+func (w *wishlistController) DeleteWishlist() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.GetWishlist
+		if err := ctx.ShouldBindUri(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err = w.s.DeleteWishlist(id, payload.UserID); err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("deleted"))
+	}
+}
+
+// AddItem godoc
+// @Summary Add a product to one of the caller's wishlists
+// @Tags wishlist
+// @Accept json
+// @Produce json
+// @Param types.WishlistProduct body types.WishlistProduct true "product"
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/{id}/items	[post]
+func (w *wishlistController) AddItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var uri types.GetWishlist
+		if err := ctx.ShouldBindUri(&uri); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		var request types.WishlistProduct
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		id, err := primitive.ObjectIDFromHex(uri.ID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.AddItem(id, payload.UserID, product_id)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// RemoveItem godoc
+// @Summary Take a product off one of the caller's wishlists
+// @Tags wishlist
+// @Produce json
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/{id}/items/{product_id}	[delete]
+func (w *wishlistController) RemoveItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, product_id, ok := bindWishlistItem(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.RemoveItem(id, payload.UserID, product_id)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// MoveToCart godoc
+// @Summary Move a product from a wishlist into the cart
+// @Tags wishlist
+// @Produce json
+// @Success 200 {string} msgRes
+// @Router		/wishlists/{id}/items/{product_id}/move-to-cart	[post]
+func (w *wishlistController) MoveToCart() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, product_id, ok := bindWishlistItem(ctx)
+		if !ok {
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		if err := w.s.MoveToCart(id, payload.UserID, product_id); err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, msgRes("moved to cart"))
+	}
+}
+
+// SaveForLater godoc
+// @Summary Move a product from the cart to the caller's saved for later list
+// @Tags wishlist
+// @Accept json
+// @Produce json
+// @Param types.WishlistProduct body types.WishlistProduct true "product"
+// @Success 200 {object} models.Wishlist
+// @Router		/wishlists/save-for-later	[post]
+func (w *wishlistController) SaveForLater() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var request types.WishlistProduct
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRes(err))
+			return
+		}
+
+		payload := ctx.MustGet(authPayload).(*token.Payload)
+		wishlist, err := w.s.SaveForLater(payload.UserID, product_id)
+		if err != nil {
+			ctx.JSON(wishlistErrStatus(err), errorRes(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, wishlist)
+	}
+}
+
+func bindWishlistItem(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	var request types.GetWishlistItem
+	if err := ctx.ShouldBindUri(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(request.ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	product_id, err := primitive.ObjectIDFromHex(request.ProductID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRes(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return id, product_id, true
+}
+
+func wishlistErrStatus(err error) int {
+	switch err {
+	case api.ErrWishlistNotFound, api.ErrCantFindProduct, api.ErrNotWishlisted:
+		return http.StatusNotFound
+	case api.ErrAlreadyWishlisted, api.ErrNotEnoughStock:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
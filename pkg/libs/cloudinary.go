@@ -2,6 +2,7 @@ package libs
 
 import (
 	"context"
+	"fmt"
 	"kamoushop/pkg/utils"
 	"log"
 	"time"
@@ -41,6 +42,19 @@ func UploadToCloud(ctx *gin.Context) (string, string, error) {
 	return res.SecureURL, res.PublicID, nil
 }
 
+// UploadFromURL lets cloudinary fetch a remote image and returns the url of our copy.
+func UploadFromURL(ctx context.Context, url string) (string, error) {
+	res, err := InitCloud().Upload.Upload(ctx, url, uploader.UploadParams{
+		PublicID: "kamou-shop-import" + time.Now().String(),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return res.SecureURL, nil
+}
+
 func DeleteFromCloud(publicId string, ctx context.Context) error {
 	_, err := InitCloud().Upload.Destroy(ctx, uploader.DestroyParams{
 		PublicID: publicId,
@@ -52,3 +66,34 @@ func DeleteFromCloud(publicId string, ctx context.Context) error {
 
 	return nil
 }
+
+// UploadFilesToCloud uploads every file sent under field, at most max of them.
+func UploadFilesToCloud(ctx *gin.Context, field string, max int) ([]string, error) {
+	urls := []string{}
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return urls, nil
+	}
+
+	files := form.File[field]
+	if len(files) > max {
+		return nil, fmt.Errorf("at most %d files can be uploaded", max)
+	}
+
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := InitCloud().Upload.Upload(ctx, file, uploader.UploadParams{
+			PublicID: "kamou-shop-upload" + time.Now().String(),
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, res.SecureURL)
+	}
+	return urls, nil
+}
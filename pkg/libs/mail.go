@@ -0,0 +1,112 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// Mail is a plain text email, optionally with files attached.
+type Mail struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends mail through an smtp server, it authenticates when it has a username.
+type Mailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewMailer(host string, port int, username string, password string, from string) *Mailer {
+	if port == 0 {
+		port = 587
+	}
+	return &Mailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (m *Mailer) Send(mail Mail) error {
+	msg, err := mail.message(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(m.host+":"+strconv.Itoa(m.port), auth, m.from, []string{mail.To}, msg)
+}
+
+// message renders mail as a multipart/mixed MIME message.
+func (mail Mail) message(from string, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	body := quotedprintable.NewWriter(part)
+	if _, err = body.Write([]byte(mail.Body)); err != nil {
+		return nil, err
+	}
+	if err = body.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range mail.Attachments {
+		part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// base64 bodies are wrapped at 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			if _, err = part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return nil, err
+			}
+			encoded = encoded[76:]
+		}
+		if _, err = part.Write([]byte(encoded + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailMessage(t *testing.T) {
+	attachment := bytes.Repeat([]byte("%PDF-1.3 invoice "), 20)
+	msg, err := Mail{
+		To:          "ada@example.com",
+		Subject:     "Your order",
+		Body:        "Thanks for your order",
+		Attachments: []Attachment{{Name: "invoice.pdf", ContentType: "application/pdf", Data: attachment}},
+	}.message("orders@kamou.shop", time.Now())
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	require.NoError(t, err)
+	require.Equal(t, "ada@example.com", parsed.Header.Get("To"))
+	require.Equal(t, "Your order", parsed.Header.Get("Subject"))
+
+	media, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", media)
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	body, err := parts.NextPart()
+	require.NoError(t, err)
+	text, err := io.ReadAll(body)
+	require.NoError(t, err)
+	require.Equal(t, "Thanks for your order", string(text))
+
+	file, err := parts.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "invoice.pdf", file.FileName())
+	encoded, err := io.ReadAll(file)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(bytes.ReplaceAll(encoded, []byte("\r\n"), nil))))
+	require.NoError(t, err)
+	require.Equal(t, attachment, decoded)
+}
@@ -1,275 +1,301 @@
 package libs
 
-// import (
-// 	"fmt"
-// 	"kamoushop/pkg/utils"
-// 	"strings"
+import (
+	"fmt"
+	"io"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"strconv"
+	"strings"
+	"time"
 
-// 	"github.com/unidoc/unipdf/v3/common/license"
-// 	"github.com/unidoc/unipdf/v3/creator"
-// )
+	"github.com/go-pdf/fpdf"
+)
 
-// type Client struct {
-// 	creator *creator.Creator
-// }
+// Invoice is everything printed on an invoice, amounts are computed by the caller.
+type Invoice struct {
+	Number   string
+	OrderID  string
+	IssuedAt time.Time
+	Shop     InvoiceShop
+	Customer InvoiceCustomer
+	Items    []InvoiceItem
+	// before discounts, the discount row is left out when Discount is zero
+	Subtotal models.Money
+	Discount models.Money
+	// added on top of the prices
+	Tax models.Money
+	// already part of the prices, its row is left out when zero
+	IncludedTax models.Money
+	// what delivery costs, its row is left out when zero
+	Shipping models.Money
+	Total    models.Money
+	// printed under the totals, e.g. payment instructions
+	Notes string
+}
 
-// type cellStyle struct {
-// 	ColSpan         int
-// 	HAlignment      creator.CellHorizontalAlignment
-// 	BackgroundColor creator.Color
-// 	BorderSide      creator.CellBorderSide
-// 	BorderStyle     creator.CellBorderStyle
-// 	BorderWidth     float64
-// 	BorderColor     creator.Color
-// 	Indent          float64
-// }
+// InvoiceShop is the branding at the top of the invoice.
+type InvoiceShop struct {
+	Name    string
+	Address string
+	Email   string
+	// hex colour of the header band and table heading, e.g. "#332f3f"
+	Color string
+	// path to a png or jpeg logo, none is printed when empty
+	Logo string
+}
 
-// var cellStyles = map[string]cellStyle{
-// 	"heading-left": {
-// 		BackgroundColor: creator.ColorRGBFromHex("#332f3f"),
-// 		HAlignment:      creator.CellHorizontalAlignmentLeft,
-// 		BorderColor:     creator.ColorWhite,
-// 		BorderSide:      creator.CellBorderSideAll,
-// 		BorderStyle:     creator.CellBorderStyleSingle,
-// 		BorderWidth:     6,
-// 	},
-// 	"heading-centered": {
-// 		BackgroundColor: creator.ColorRGBFromHex("#332f3f"),
-// 		HAlignment:      creator.CellHorizontalAlignmentCenter,
-// 		BorderColor:     creator.ColorWhite,
-// 		BorderSide:      creator.CellBorderSideAll,
-// 		BorderStyle:     creator.CellBorderStyleSingle,
-// 		BorderWidth:     6,
-// 	},
-// 	"left-highlighted": {
-// 		BackgroundColor: creator.ColorRGBFromHex("#dde4e5"),
-// 		HAlignment:      creator.CellHorizontalAlignmentLeft,
-// 		BorderColor:     creator.ColorWhite,
-// 		BorderSide:      creator.CellBorderSideAll,
-// 		BorderStyle:     creator.CellBorderStyleSingle,
-// 		BorderWidth:     6,
-// 	},
-// 	"centered-highlighted": {
-// 		BackgroundColor: creator.ColorRGBFromHex("#dde4e5"),
-// 		HAlignment:      creator.CellHorizontalAlignmentCenter,
-// 		BorderColor:     creator.ColorWhite,
-// 		BorderSide:      creator.CellBorderSideAll,
-// 		BorderStyle:     creator.CellBorderStyleSingle,
-// 		BorderWidth:     6,
-// 	},
-// 	"left": {
-// 		HAlignment: creator.CellHorizontalAlignmentLeft,
-// 	},
-// 	"centered": {
-// 		HAlignment: creator.CellHorizontalAlignmentCenter,
-// 	},
-// 	"gradingsys-head": {
-// 		HAlignment: creator.CellHorizontalAlignmentLeft,
-// 	},
-// 	"gradingsys-row": {
-// 		HAlignment: creator.CellHorizontalAlignmentCenter,
-// 	},
-// 	"conduct-head": {
-// 		HAlignment: creator.CellHorizontalAlignmentLeft,
-// 	},
-// 	"conduct-key": {
-// 		HAlignment: creator.CellHorizontalAlignmentLeft,
-// 	},
-// 	"conduct-val": {
-// 		BackgroundColor: creator.ColorRGBFromHex("#dde4e5"),
-// 		HAlignment:      creator.CellHorizontalAlignmentCenter,
-// 		BorderColor:     creator.ColorWhite,
-// 		BorderSide:      creator.CellBorderSideAll,
-// 		BorderStyle:     creator.CellBorderStyleSingle,
-// 		BorderWidth:     3,
-// 	},
-// }
+type InvoiceCustomer struct {
+	Name  string
+	Email string
+	Phone string
+	// where the order is delivered, one line per row
+	Address string
+}
 
-// func GenerateInvoicePdf(invoice Invoice) error {
-// 	conf, err := utils.LoadConfig(".")
-// 	if err != nil {
-// 		return err
-// 	}
+type InvoiceItem struct {
+	Title    string
+	Seller   string
+	Quantity int64
+	Price    models.Money
+	Discount models.Money
+	Tax      models.Money
+	Total    models.Money
+}
 
-// 	err = license.SetMeteredKey(conf.UniCloudKey)
-// 	if err != nil {
-// 		return err
-// 	}
+const (
+	invoiceHeading   = "#332f3f"
+	invoiceHighlight = "#dde4e5"
+	// A4 width minus the margins, in mm
+	invoiceWidth = 180.0
+)
 
-// 	c := creator.New()
-// 	c.SetPageMargins(40, 40, 0, 0)
+type cellStyle struct {
+	Align     string
+	Fill      string
+	TextColor string
+	Bold      bool
+}
 
-// 	cr := &Client{creator: c}
-// 	err = cr.generatePdf(invoice)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
-// }
+var cellStyles = map[string]cellStyle{
+	"heading-left":         {Align: "L", TextColor: "#fdfdfd", Bold: true},
+	"heading-right":        {Align: "R", TextColor: "#fdfdfd", Bold: true},
+	"left-highlighted":     {Align: "L", Fill: invoiceHighlight},
+	"right-highlighted":    {Align: "R", Fill: invoiceHighlight},
+	"left":                 {Align: "L"},
+	"right":                {Align: "R"},
+	"total-key":            {Align: "L", Bold: true},
+	"total-val":            {Align: "R", Fill: invoiceHighlight, Bold: true},
+	"centered-highlighted": {Align: "C", Fill: invoiceHighlight},
+}
 
-// func (c *Client) generatePdf(invoice Invoice) error {
-// 	rect := c.creator.NewRectangle(0, 0, creator.PageSizeLetter[0], 120)
-// 	rect.SetFillColor(creator.ColorRGBFromHex("#dde4e5"))
-// 	rect.SetBorderWidth(0)
-// 	err := c.creator.Draw(rect)
-// 	if err != nil {
-// 		return err
-// 	}
+// invoiceColumns are the item table columns, their widths add up to invoiceWidth.
+var invoiceColumns = []struct {
+	Title string
+	Width float64
+}{
+	{"Item", 62}, {"Qty", 12}, {"Price", 28}, {"Discount", 26}, {"Tax", 24}, {"Total", 28},
+}
 
-// 	headerStyle := c.creator.NewTextStyle()
-// 	headerStyle.FontSize = 50
+// GenerateInvoicePdf writes invoice to w as an A4 pdf.
+func GenerateInvoicePdf(invoice Invoice, w io.Writer) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.SetTitle("Invoice "+invoice.Number, true)
+	pdf.SetAuthor(invoice.Shop.Name, true)
+	pdf.SetCreationDate(invoice.IssuedAt)
 
-// 	table := c.creator.NewTable(1)
-// 	table.SetMargins(0, 0, 20, 0)
-// 	err = drawCell(table, c.newPara("Sample Invoice", headerStyle), cellStyles["centered"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = c.creator.Draw(table)
-// 	if err != nil {
-// 		return err
-// 	}
+	c := &invoicePdf{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor(""), color: invoice.Shop.Color}
+	if c.color == "" {
+		c.color = invoiceHeading
+	}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		c.font(8, false)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%s - invoice %s - page %d", invoice.Shop.Name, invoice.Number, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
 
-// 	err = c.writeInvoice(invoice)
-// 	if err != nil {
-// 		return err
-// 	}
+	pdf.AddPage()
+	c.header(invoice)
+	c.parties(invoice)
+	c.items(invoice.Items)
+	c.totals(invoice)
 
-// 	err = c.creator.WriteToFile(strings.ToLower(invoice.Name) + "_invoice.pdf")
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
-// }
+	if invoice.Notes != "" {
+		pdf.Ln(10)
+		c.font(9, false)
+		pdf.MultiCell(invoiceWidth, 5, c.tr(invoice.Notes), "", "L", false)
+	}
 
-// func (c *Client) newPara(text string, textStyle creator.TextStyle) *creator.StyledParagraph {
-// 	p := c.creator.NewStyledParagraph()
-// 	p.Append(text).Style = textStyle
-// 	p.SetEnableWrap(false)
-// 	return p
-// }
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	return pdf.Output(w)
+}
 
-// func drawCell(table *creator.Table, content creator.VectorDrawable, cellStyle cellStyle) error {
-// 	var cell *creator.TableCell
-// 	if cellStyle.ColSpan > 1 {
-// 		cell = table.MultiColCell(cellStyle.ColSpan)
-// 	} else {
-// 		cell = table.NewCell()
-// 	}
-// 	err := cell.SetContent(content)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	cell.SetHorizontalAlignment(cellStyle.HAlignment)
-// 	if cellStyle.BackgroundColor != nil {
-// 		cell.SetBackgroundColor(cellStyle.BackgroundColor)
-// 	}
-// 	cell.SetBorder(cellStyle.BorderSide, cellStyle.BorderStyle, cellStyle.BorderWidth)
-// 	if cellStyle.BorderColor != nil {
-// 		cell.SetBorderColor(cellStyle.BorderColor)
-// 	}
-// 	if cellStyle.Indent > 0 {
-// 		cell.SetIndent(cellStyle.Indent)
-// 	}
-// 	return nil
-// }
+type invoicePdf struct {
+	pdf   *fpdf.Fpdf
+	tr    func(string) string
+	color string
+}
 
-// func (c *Client) writeInvoice(invoice Invoice) error {
-// 	headerStyle := c.creator.NewTextStyle()
-// 	// Invoice Header info table.
-// 	table := c.creator.NewTable(2)
-// 	table.SetMargins(0, 0, 50, 0)
-// 	err := drawCell(table, c.newPara("Business: "+invoice.Name, headerStyle), cellStyles["left"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara("Address: "+invoice.Address, headerStyle), cellStyles["left"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = c.creator.Draw(table)
-// 	if err != nil {
-// 		return err
-// 	}
+func (c *invoicePdf) font(size float64, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	c.pdf.SetFont("Helvetica", style, size)
+}
 
-// 	// Invoice items table.
-// 	table = c.creator.NewTable(4)
-// 	table.SetMargins(0, 0, 20, 0)
-// 	err = table.SetColumnWidths(0.4, 0.2, 0.2, 0.2)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	headingStyle := c.creator.NewTextStyle()
-// 	headingStyle.FontSize = 20
-// 	headingStyle.Color = creator.ColorRGBFromHex("#fdfdfd")
-// 	regularStyle := c.creator.NewTextStyle()
+// header draws the band with the shop's logo, name and the invoice number.
+func (c *invoicePdf) header(invoice Invoice) {
+	r, g, b := hexColor(c.color)
+	c.pdf.SetFillColor(r, g, b)
+	c.pdf.Rect(0, 0, 210, 40, "F")
 
-// 	// Draw table header.
-// 	err = drawCell(table, c.newPara(" Title", headingStyle), cellStyles["heading-left"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara("Quantity", headingStyle), cellStyles["heading-centered"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara("Price", headingStyle), cellStyles["heading-centered"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara("Total", headingStyle), cellStyles["heading-centered"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	for _, datum := range invoice.InvoiceItems {
-// 		err = drawCell(table, c.newPara(" "+datum.Title, regularStyle), cellStyles["left-highlighted"])
-// 		if err != nil {
-// 			return err
-// 		}
-// 		err = drawCell(table, c.newPara(fmt.Sprintf("%v", datum.Quantity), regularStyle), cellStyles["centered-highlighted"])
-// 		if err != nil {
-// 			return err
-// 		}
-// 		err = drawCell(table, c.newPara(fmt.Sprintf("%v", datum.Price), regularStyle), cellStyles["centered-highlighted"])
-// 		if err != nil {
-// 			return err
-// 		}
-// 		err = drawCell(table, c.newPara(fmt.Sprintf("%v", datum.CalculateTotalAmount()), regularStyle), cellStyles["centered-highlighted"])
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
-// 	err = c.creator.Draw(table)
-// 	if err != nil {
-// 		return err
-// 	}
+	x := 15.0
+	if invoice.Shop.Logo != "" {
+		c.pdf.ImageOptions(invoice.Shop.Logo, x, 8, 0, 24, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+		x += 30
+	}
 
-// 	boldStyle := c.creator.NewTextStyle()
-// 	boldStyle.FontSize = 16
-// 	grid := c.creator.NewTable(12)
-// 	grid.SetMargins(0, 0, 50, 0)
-// 	gradeInfoStyle := c.creator.NewTextStyle()
+	c.pdf.SetTextColor(253, 253, 253)
+	c.pdf.SetXY(x, 12)
+	c.font(22, true)
+	c.pdf.CellFormat(100, 10, c.tr(invoice.Shop.Name), "", 0, "L", false, 0, "")
+	c.pdf.SetXY(x, 22)
+	c.font(9, false)
+	c.pdf.CellFormat(100, 5, c.tr(invoice.Shop.Email), "", 0, "L", false, 0, "")
 
-// 	table = c.creator.NewTable(2)
-// 	err = table.SetColumnWidths(0.6, 0.4)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara("Total Amount:", gradeInfoStyle), cellStyles["conduct-key"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = drawCell(table, c.newPara(fmt.Sprintf("%v", invoice.CalculateInvoiceTotalAmount()), gradeInfoStyle), cellStyles["conduct-val"])
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = grid.MultiColCell(5).SetContent(table)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	err = c.creator.Draw(grid)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
-// }
+	c.pdf.SetXY(115, 12)
+	c.font(20, true)
+	c.pdf.CellFormat(80, 10, "INVOICE", "", 0, "R", false, 0, "")
+	c.pdf.SetXY(115, 22)
+	c.font(10, false)
+	c.pdf.CellFormat(80, 5, c.tr(invoice.Number), "", 0, "R", false, 0, "")
+
+	c.pdf.SetTextColor(0, 0, 0)
+	c.pdf.SetY(50)
+}
+
+// parties draws who the invoice is from and to, and its dates.
+func (c *invoicePdf) parties(invoice Invoice) {
+	top := c.pdf.GetY()
+	c.font(9, true)
+	c.pdf.CellFormat(90, 5, "From", "", 2, "L", false, 0, "")
+	c.font(9, false)
+	c.pdf.MultiCell(90, 5, c.tr(strings.TrimSpace(invoice.Shop.Name+"\n"+invoice.Shop.Address)), "", "L", false)
+	left := c.pdf.GetY()
+
+	c.pdf.SetXY(105, top)
+	c.font(9, true)
+	c.pdf.CellFormat(90, 5, "Bill to", "", 2, "L", false, 0, "")
+	c.font(9, false)
+	lines := append([]string{invoice.Customer.Name, invoice.Customer.Email, invoice.Customer.Phone}, strings.Split(invoice.Customer.Address, "\n")...)
+	for _, line := range lines {
+		if line != "" {
+			c.pdf.CellFormat(90, 5, c.tr(line), "", 2, "L", false, 0, "")
+		}
+	}
+	c.pdf.Ln(3)
+	c.pdf.SetX(105)
+	c.pdf.CellFormat(90, 5, "Order: "+invoice.OrderID, "", 2, "L", false, 0, "")
+	c.pdf.CellFormat(90, 5, "Date: "+invoice.IssuedAt.Format("2 January 2006"), "", 2, "L", false, 0, "")
+
+	if right := c.pdf.GetY(); right > left {
+		left = right
+	}
+	c.pdf.SetXY(15, left+8)
+}
+
+func (c *invoicePdf) items(items []InvoiceItem) {
+	r, g, b := hexColor(c.color)
+	c.pdf.SetFillColor(r, g, b)
+	for i, column := range invoiceColumns {
+		style := cellStyles["heading-right"]
+		if i == 0 {
+			style = cellStyles["heading-left"]
+		}
+		c.cell(column.Width, column.Title, style, true)
+	}
+	c.pdf.Ln(-1)
+
+	for _, item := range items {
+		title := item.Title
+		if item.Seller != "" {
+			title += " (" + item.Seller + ")"
+		}
+		c.cell(invoiceColumns[0].Width, c.fit(title, invoiceColumns[0].Width-2), cellStyles["left-highlighted"], false)
+		c.cell(invoiceColumns[1].Width, strconv.FormatInt(item.Quantity, 10), cellStyles["centered-highlighted"], false)
+		c.cell(invoiceColumns[2].Width, money.Format(item.Price), cellStyles["right-highlighted"], false)
+		c.cell(invoiceColumns[3].Width, money.Format(item.Discount), cellStyles["right-highlighted"], false)
+		c.cell(invoiceColumns[4].Width, money.Format(item.Tax), cellStyles["right-highlighted"], false)
+		c.cell(invoiceColumns[5].Width, money.Format(item.Total), cellStyles["right-highlighted"], false)
+		c.pdf.Ln(-1)
+	}
+}
+
+func (c *invoicePdf) totals(invoice Invoice) {
+	c.pdf.Ln(6)
+	rows := []struct {
+		Key   string
+		Value models.Money
+		Style string
+	}{
+		{"Subtotal", invoice.Subtotal, "right"},
+		{"Discount", models.Money{Amount: -invoice.Discount.Amount, Currency: invoice.Discount.Currency}, "right"},
+		{"Tax", invoice.Tax, "right"},
+		{"Shipping", invoice.Shipping, "right"},
+		{"Total", invoice.Total, "total-val"},
+		{"Incl. tax", invoice.IncludedTax, "right"},
+	}
+	for _, row := range rows {
+		if (row.Key == "Discount" || row.Key == "Shipping" || row.Key == "Incl. tax") && row.Value.Amount == 0 {
+			continue
+		}
+		c.pdf.SetX(15 + invoiceWidth - 80)
+		c.cell(40, row.Key, cellStyles["total-key"], false)
+		c.cell(40, money.Format(row.Value), cellStyles[row.Style], false)
+		c.pdf.Ln(-1)
+	}
+}
+
+// cell draws one table cell, filled with the colour already set when keep_fill is true.
+func (c *invoicePdf) cell(width float64, text string, style cellStyle, keep_fill bool) {
+	c.font(9, style.Bold)
+	fill := keep_fill
+	if style.Fill != "" {
+		r, g, b := hexColor(style.Fill)
+		c.pdf.SetFillColor(r, g, b)
+		fill = true
+	}
+	if style.TextColor != "" {
+		r, g, b := hexColor(style.TextColor)
+		c.pdf.SetTextColor(r, g, b)
+	}
+	c.pdf.SetDrawColor(255, 255, 255)
+	c.pdf.CellFormat(width, 8, c.tr(text), "1", 0, style.Align, fill, 0, "")
+	c.pdf.SetTextColor(0, 0, 0)
+}
+
+// fit shortens text with an ellipsis until it fits in width.
+func (c *invoicePdf) fit(text string, width float64) string {
+	if c.pdf.GetStringWidth(c.tr(text)) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && c.pdf.GetStringWidth(c.tr(string(runes)+"...")) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// hexColor parses "#rrggbb", anything else is black.
+func hexColor(hex string) (int, int, int) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return 0, 0, 0
+	}
+	return int(value >> 16 & 0xff), int(value >> 8 & 0xff), int(value & 0xff)
+}
@@ -0,0 +1,65 @@
+package libs
+
+import (
+	"bytes"
+	"io"
+	"kamoushop/pkg/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateInvoicePdf(t *testing.T) {
+	ngn := func(amount int64) models.Money {
+		return models.Money{Amount: amount, Currency: "NGN"}
+	}
+	invoice := Invoice{
+		Number:   "INV-0001",
+		OrderID:  "64f1c0ffee0000000000abcd",
+		IssuedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Shop:     InvoiceShop{Name: "Kamou Shop", Address: "1 Marina, Lagos", Email: "orders@kamou.shop", Color: "#1d4ed8"},
+		Customer: InvoiceCustomer{Name: "Ada Obi", Email: "ada@example.com"},
+		Items: []InvoiceItem{
+			{Title: "Ankara shirt", Seller: "Ada Prints", Quantity: 2, Price: ngn(500000), Discount: ngn(0), Tax: ngn(75000), Total: ngn(1000000)},
+			{Title: "Clay mug", Quantity: 1, Price: ngn(150000), Discount: ngn(15000), Tax: ngn(0), Total: ngn(135000)},
+		},
+		Subtotal: ngn(1150000),
+		Discount: ngn(15000),
+		Tax:      ngn(75000),
+		Total:    ngn(1210000),
+		Notes:    "Thank you for shopping with us",
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, GenerateInvoicePdf(invoice, &buf))
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+
+	reader, err := pdf.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, 1, reader.NumPage())
+
+	plain, err := reader.GetPlainText()
+	require.NoError(t, err)
+	raw, err := io.ReadAll(plain)
+	require.NoError(t, err)
+	text := string(raw)
+
+	for _, want := range []string{
+		"Kamou Shop", "INVOICE", "INV-0001", "Ada Obi", "ada@example.com", "64f1c0ffee0000000000abcd",
+		"Ankara shirt (Ada Prints)", "Clay mug", "NGN 5,000.00", "NGN 750.00", "NGN -150.00", "NGN 12,100.00",
+		"Thank you for shopping with us",
+	} {
+		require.True(t, strings.Contains(text, want), "invoice is missing %q", want)
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	r, g, b := hexColor("#332f3f")
+	require.Equal(t, []int{0x33, 0x2f, 0x3f}, []int{r, g, b})
+
+	r, g, b = hexColor("blue")
+	require.Equal(t, []int{0, 0, 0}, []int{r, g, b})
+}
@@ -3,6 +3,8 @@ package middlewares
 import (
 	"errors"
 	"fmt"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/api"
 	"kamoushop/pkg/services/token"
 	"net/http"
 	"strings"
@@ -51,3 +53,23 @@ func AuthMiddleWare(token_maker token.Maker) gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+// AdminMiddleWare must run after AuthMiddleWare, it rejects callers whose account is not an admin.
+func AdminMiddleWare(users api.UserService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload, ok := ctx.MustGet(AuthorizationPayloadKey).(*token.Payload)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"Error:": token.ErrInvalidToken.Error()})
+			return
+		}
+
+		user, err := users.GetUserById(payload.UserID)
+		if err != nil || user.Role != models.RoleAdmin {
+			err := errors.New("only admins can perform this action")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error:": err.Error()})
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Cart struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID primitive.ObjectID `json:"user_id" bson:"userId"`
+	Lines  []CartLine         `json:"lines" bson:"lines"`
+	// sum of the lines per currency, filled in when the cart is read and never stored
+	Totals    []Money   `json:"totals" bson:"-"`
+	UpdatedAT time.Time `json:"updated_at" bson:"updatedAt"`
+}
+
+// CartLine is one product, in one variant, and how many of it the buyer wants.
+type CartLine struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	// free form, e.g. "size:M", empty when the product has no variants
+	Variant  string `json:"variant" bson:"variant"`
+	Quantity int64  `json:"quantity" bson:"quantity"`
+	// price in effect when the line was last added to or its quantity set, checkout compares it with the current price
+	UnitPrice Money              `json:"unit_price" bson:"unitPrice"`
+	Name      string             `json:"name" bson:"name"`
+	Image     string             `json:"image" bson:"image"`
+	SellerID  primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	AddedAT   time.Time          `json:"added_at" bson:"addedAt"`
+}
+
+// CartIssue flags a line that no longer matches the catalog.
+type CartIssue struct {
+	ProductID primitive.ObjectID `json:"product_id"`
+	Variant   string             `json:"variant"`
+	// one of price_changed, unavailable or insufficient_stock
+	Kind      string `json:"kind"`
+	OldPrice  *Money `json:"old_price,omitempty"`
+	NewPrice  *Money `json:"new_price,omitempty"`
+	Available *int64 `json:"available,omitempty"`
+}
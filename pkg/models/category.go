@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Category struct {
+	ID       primitive.ObjectID  `json:"id,omitempty" bson:"_id"`
+	Name     string              `json:"name" bson:"name"`
+	Slug     string              `json:"slug" bson:"slug"`
+	ParentID *primitive.ObjectID `json:"parent_id,omitempty" bson:"parentId"`
+	// ids of every category above this one, root first
+	Ancestors []primitive.ObjectID `json:"ancestors" bson:"ancestors"`
+	Position  int                  `json:"position" bson:"position"`
+	CreatedAT time.Time            `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time            `json:"updated_at" bson:"updatedAt"`
+}
+
+type CategoryNode struct {
+	Category `bson:",inline"`
+	Children []*CategoryNode `json:"children"`
+}
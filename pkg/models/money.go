@@ -0,0 +1,8 @@
+package models
+
+// Money is an amount in the minor unit of its currency (kobo, cents...) so it never goes through floats.
+type Money struct {
+	Amount int64 `json:"amount" bson:"amount"`
+	// ISO 4217 code, e.g. NGN or USD
+	Currency string `json:"currency" bson:"currency"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Notification struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID primitive.ObjectID `json:"user_id" bson:"userId"`
+	// what happened, e.g. "price_drop" or "back_in_stock", clients pick the icon and link from it
+	Kind      string              `json:"kind" bson:"kind"`
+	Title     string              `json:"title" bson:"title"`
+	Body      string              `json:"body" bson:"body"`
+	ProductID *primitive.ObjectID `json:"product_id,omitempty" bson:"productId,omitempty"`
+	OrderID   *primitive.ObjectID `json:"order_id,omitempty" bson:"orderId,omitempty"`
+	Read      bool                `json:"read" bson:"read"`
+	CreatedAT time.Time           `json:"created_at" bson:"createdAt"`
+}
@@ -6,10 +6,121 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Order is what the buyer placed, it is split into one SubOrder per seller that is fulfilled on its own.
 type Order struct {
-	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id"`
-	UserID     primitive.ObjectID `json:"user_id" bson:"userId"`
-	TotalPrice int64              `json:"total_price" bson:"totalPrice"`
-	CreatedAT  time.Time          `json:"created_at" bson:"createdAt"`
-	UpdatedAT  time.Time          `json:"updated_at" bson:"updatedAt"`
+	ID primitive.ObjectID `json:"id,omitempty" bson:"_id"`
+	// sequential numbers people read out, e.g. KS-2026-000123 and KS-INV-2026-000045
+	Number        string             `json:"number" bson:"number,omitempty"`
+	InvoiceNumber string             `json:"invoice_number" bson:"invoiceNumber,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"userId"`
+	// one of pending, paid, processing, shipped, delivered, cancelled or refunded,
+	// rolled up from the sub-orders once the order is split
+	Status string      `json:"status" bson:"status"`
+	Items  []OrderItem `json:"items" bson:"items"`
+	// what the buyer pays, the item totals added up plus shipping
+	TotalPrice Money `json:"total_price" bson:"totalPrice"`
+	// taken off by promotions, the items hold how it was spread over them
+	Discount   Money              `json:"discount" bson:"discount"`
+	Promotions []AppliedPromotion `json:"promotions,omitempty" bson:"promotions,omitempty"`
+	// the tax of the items added up, whether it came on top of their prices or was part of them
+	Tax Money `json:"tax" bson:"tax"`
+	// region the order was taxed for, e.g. NG-LA
+	TaxRegion string `json:"tax_region,omitempty" bson:"taxRegion,omitempty"`
+	// copy of the address the order is delivered to, later changes to the address book don't touch it
+	ShippingAddress *Address `json:"shipping_address,omitempty" bson:"shippingAddress,omitempty"`
+	// the rate each seller charges to deliver their part, Shipping adds them up
+	ShippingRates []ShippingOption `json:"shipping_rates,omitempty" bson:"shippingRates,omitempty"`
+	Shipping      Money            `json:"shipping" bson:"shipping"`
+	// sellers with a sub-order, set when the order is split
+	SellerIDs []primitive.ObjectID `json:"seller_ids" bson:"sellerIds"`
+	// filled in when the order is read for its buyer, never stored
+	SubOrders []SubOrder `json:"sub_orders,omitempty" bson:"-"`
+	// every status the order went through, oldest first
+	StatusHistory []OrderStatusChange `json:"status_history" bson:"statusHistory"`
+	// cancellations, returns and refunds of the order and its sub-orders, oldest first
+	Events []OrderEvent `json:"events,omitempty" bson:"events,omitempty"`
+	// key the client sent with the checkout request, retries with it get this order back
+	IdempotencyKey string    `json:"-" bson:"idempotencyKey,omitempty"`
+	CreatedAT      time.Time `json:"created_at" bson:"createdAt"`
+	UpdatedAT      time.Time `json:"updated_at" bson:"updatedAt"`
+}
+
+// OrderItem is a snapshot of a cart line at checkout, later catalog changes don't touch it.
+type OrderItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	SellerID  primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	Name      string             `json:"name" bson:"name"`
+	Image     string             `json:"image" bson:"image"`
+	Variant   string             `json:"variant,omitempty" bson:"variant,omitempty"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+	UnitPrice Money              `json:"unit_price" bson:"unitPrice"`
+	// taken off the line by promotions, Discounts breaks it down per promotion
+	Discount  Money          `json:"discount" bson:"discount"`
+	Discounts []LineDiscount `json:"discounts,omitempty" bson:"discounts,omitempty"`
+	// tax on the discounted line at TaxRate, in hundredths of a percent. It is part of the
+	// unit price when the seller's prices include tax and comes on top of it otherwise
+	TaxRate     int64 `json:"tax_rate" bson:"taxRate"`
+	Tax         Money `json:"tax" bson:"tax"`
+	TaxIncluded bool  `json:"tax_included" bson:"taxIncluded"`
+	// unit price times quantity, less the discount, plus tax that isn't included
+	Total Money `json:"total" bson:"total"`
+}
+
+type OrderStatusChange struct {
+	Status string    `json:"status" bson:"status"`
+	Note   string    `json:"note,omitempty" bson:"note,omitempty"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// SubOrder is the part of an order one seller ships.
+type SubOrder struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	OrderID primitive.ObjectID `json:"order_id" bson:"orderId"`
+	// the seller's own numbers for their part, from the seller's sequence
+	Number        string `json:"number" bson:"number,omitempty"`
+	InvoiceNumber string `json:"invoice_number" bson:"invoiceNumber,omitempty"`
+	// number of the order the sub-order belongs to
+	OrderNumber string             `json:"order_number" bson:"orderNumber,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"userId"`
+	SellerID    primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	// same statuses as Order
+	Status     string      `json:"status" bson:"status"`
+	Items      []OrderItem `json:"items" bson:"items"`
+	TotalPrice Money       `json:"total_price" bson:"totalPrice"`
+	// the discounts and taxes of the items added up
+	Discount Money `json:"discount" bson:"discount"`
+	Tax      Money `json:"tax" bson:"tax"`
+	// the part of Discount taken off by the marketplace's promotions, the marketplace pays it to the seller
+	// on top of TotalPrice. What the seller's own promotions took off comes out of their revenue
+	MarketplaceDiscount Money `json:"marketplace_discount" bson:"marketplaceDiscount"`
+	// where and how the seller delivers the sub-order, Shipping is the price of ShippingRate
+	ShippingAddress *Address        `json:"shipping_address,omitempty" bson:"shippingAddress,omitempty"`
+	ShippingRate    *ShippingOption `json:"shipping_rate,omitempty" bson:"shippingRate,omitempty"`
+	Shipping        Money           `json:"shipping" bson:"shipping"`
+	// given back so far, the sub-order is refunded once it reaches TotalPrice
+	Refunded      Money               `json:"refunded" bson:"refunded"`
+	Fulfilment    Fulfilment          `json:"fulfilment" bson:"fulfilment"`
+	StatusHistory []OrderStatusChange `json:"status_history" bson:"statusHistory"`
+	CreatedAT     time.Time           `json:"created_at" bson:"createdAt"`
+	UpdatedAT     time.Time           `json:"updated_at" bson:"updatedAt"`
+	// the keys of the refunds added to Refunded, a retried refund is added once
+	RefundKeys []string `json:"-" bson:"refundKeys,omitempty"`
+}
+
+type Fulfilment struct {
+	Carrier        string     `json:"carrier,omitempty" bson:"carrier,omitempty"`
+	TrackingNumber string     `json:"tracking_number,omitempty" bson:"trackingNumber,omitempty"`
+	ShippedAT      *time.Time `json:"shipped_at,omitempty" bson:"shippedAt,omitempty"`
+	DeliveredAT    *time.Time `json:"delivered_at,omitempty" bson:"deliveredAt,omitempty"`
+}
+
+// OrderEvent is a step of undoing part of an order.
+type OrderEvent struct {
+	// one of cancelled, return_requested, return_denied, refunded or refund_failed
+	Kind       string              `json:"kind" bson:"kind"`
+	SubOrderID *primitive.ObjectID `json:"sub_order_id,omitempty" bson:"subOrderId,omitempty"`
+	ReturnID   *primitive.ObjectID `json:"return_id,omitempty" bson:"returnId,omitempty"`
+	Amount     *Money              `json:"amount,omitempty" bson:"amount,omitempty"`
+	Note       string              `json:"note,omitempty" bson:"note,omitempty"`
+	At         time.Time           `json:"at" bson:"at"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment records one call to or from a payment provider, an attempt to pay an order
+// is its intent plus every capture, refund and webhook sharing its reference.
+type Payment struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	OrderID  primitive.ObjectID `json:"order_id" bson:"orderId"`
+	UserID   primitive.ObjectID `json:"user_id" bson:"userId"`
+	Provider string             `json:"provider" bson:"provider"`
+	// one of intent, capture, refund or webhook
+	Kind        string `json:"kind" bson:"kind"`
+	Reference   string `json:"reference" bson:"reference"`
+	ProviderRef string `json:"provider_ref,omitempty" bson:"providerRef,omitempty"`
+	// the provider's id and our type of a webhook event
+	EventID string `json:"event_id,omitempty" bson:"eventId,omitempty"`
+	Event   string `json:"event,omitempty" bson:"event,omitempty"`
+	// pending, succeeded or failed
+	Status string `json:"status" bson:"status"`
+	Amount Money  `json:"amount" bson:"amount"`
+	// what the buyer's client needs to finish paying an intent
+	ClientSecret     string `json:"client_secret,omitempty" bson:"clientSecret,omitempty"`
+	AuthorizationURL string `json:"authorization_url,omitempty" bson:"authorizationUrl,omitempty"`
+	Error            string `json:"error,omitempty" bson:"error,omitempty"`
+	// the caller's key for a refund, a refund is only sent to the provider once per key
+	RefundKey string `json:"refund_key,omitempty" bson:"refundKey,omitempty"`
+	// the provider's id of a refund, its webhooks settle the refund by it
+	RefundID string `json:"refund_id,omitempty" bson:"refundId,omitempty"`
+	// when a refund was last handed to the provider
+	ClaimedAT time.Time `json:"-" bson:"claimedAt,omitempty"`
+	// set on the intent the buyer can still pay, there is one per order
+	Open bool `json:"-" bson:"open,omitempty"`
+	// the provider's payload exactly as it was sent or received
+	Raw string `json:"-" bson:"raw"`
+	// set once a webhook was acted on, a redelivery of it is then ignored
+	Handled   bool      `json:"handled,omitempty" bson:"handled,omitempty"`
+	CreatedAT time.Time `json:"created_at" bson:"createdAt"`
+}
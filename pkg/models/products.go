@@ -7,12 +7,80 @@ import (
 )
 
 type Product struct {
-	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id"`
-	Price       int64              `json:"price" bson:"price"`
+	ID    primitive.ObjectID `json:"id,omitempty" bson:"_id"`
+	Price Money              `json:"price" bson:"price"`
+	// discounted price, only charged between SaleStartsAt and SaleEndsAt, Price is then shown as the compare-at price
+	SalePrice    *Money     `json:"sale_price,omitempty" bson:"salePrice,omitempty"`
+	SaleStartsAt *time.Time `json:"sale_starts_at,omitempty" bson:"saleStartsAt,omitempty"`
+	SaleEndsAt   *time.Time `json:"sale_ends_at,omitempty" bson:"saleEndsAt,omitempty"`
+	// price charged right now, filled in when the product is read and never stored
+	EffectivePrice Money `json:"effective_price" bson:"-"`
+	// EffectivePrice converted to the currency the caller asked for, for display only
+	DisplayPrice *Money `json:"display_price,omitempty" bson:"-"`
+	// text price of a product saved by an old version that could not be read, the product was unpublished
+	// with a price of 0 and this is cleared when the seller sets a price
+	LegacyPrice string             `json:"legacy_price,omitempty" bson:"legacyPrice,omitempty"`
 	Image       string             `json:"image,omitempty" bson:"image"`
 	Name        string             `json:"name,omitempty" bson:"name"`
 	UserID      primitive.ObjectID `json:"user_id,omitempty" bson:"userId"`
 	Description string             `json:"description,omitempty" bson:"description"`
-	CreatedAT   time.Time          `json:"created_at" bson:"createdAt"`
-	UpdatedAT   time.Time          `json:"updated_at" bson:"updatedAt"`
+	// seller's own stock keeping unit, unique per seller and used to match rows on bulk import
+	SKU   string `json:"sku,omitempty" bson:"sku,omitempty"`
+	Stock int64  `json:"stock" bson:"stock"`
+	// shipping weight of one unit in grams, used by weight based shipping rates
+	Weight int64 `json:"weight" bson:"weight"`
+	// average of the approved reviews, kept up to date with RatingCount, RatingSum and RatingHistogram
+	Rating      float64 `json:"rating" bson:"rating"`
+	RatingCount int64   `json:"rating_count" bson:"ratingCount"`
+	RatingSum   int64   `json:"-" bson:"ratingSum"`
+	// number of approved reviews per star, keyed "1" to "5"
+	RatingHistogram map[string]int64 `json:"rating_histogram" bson:"ratingHistogram,omitempty"`
+	// number of units ordered, used to sort by popularity
+	Sales int64 `json:"sales" bson:"sales"`
+	// one of draft, scheduled, published, unpublished or archived, only published products are shown to buyers
+	Status      string               `json:"status" bson:"status"`
+	PublishAt   *time.Time           `json:"publish_at,omitempty" bson:"publishAt,omitempty"`
+	PublishedAt *time.Time           `json:"published_at,omitempty" bson:"publishedAt,omitempty"`
+	CategoryIDs []primitive.ObjectID `json:"category_ids" bson:"categoryIds"`
+	// denormalized for the search index
+	Brand         string    `json:"brand,omitempty" bson:"brand"`
+	CategoryNames []string  `json:"category_names,omitempty" bson:"categoryNames"`
+	CreatedAT     time.Time `json:"created_at" bson:"createdAt"`
+	UpdatedAT     time.Time `json:"updated_at" bson:"updatedAt"`
+}
+
+// OnSaleAt reports whether the sale price applies at the given moment.
+func (p Product) OnSaleAt(at time.Time) bool {
+	if p.SalePrice == nil {
+		return false
+	}
+	if p.SaleStartsAt != nil && at.Before(*p.SaleStartsAt) {
+		return false
+	}
+	if p.SaleEndsAt != nil && !at.Before(*p.SaleEndsAt) {
+		return false
+	}
+	return true
+}
+
+// EffectivePriceAt is what a buyer pays at the given moment.
+func (p Product) EffectivePriceAt(at time.Time) Money {
+	if p.OnSaleAt(at) {
+		return *p.SalePrice
+	}
+	return p.Price
+}
+
+type PriceChange struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	SellerID  primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	// "price" for a change of the regular price, "sale" when a sale is set or cleared
+	Kind         string     `json:"kind" bson:"kind"`
+	OldPrice     Money      `json:"old_price" bson:"oldPrice"`
+	NewPrice     Money      `json:"new_price" bson:"newPrice"`
+	SalePrice    *Money     `json:"sale_price,omitempty" bson:"salePrice,omitempty"`
+	SaleStartsAt *time.Time `json:"sale_starts_at,omitempty" bson:"saleStartsAt,omitempty"`
+	SaleEndsAt   *time.Time `json:"sale_ends_at,omitempty" bson:"saleEndsAt,omitempty"`
+	ChangedAT    time.Time  `json:"changed_at" bson:"changedAt"`
 }
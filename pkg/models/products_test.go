@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectivePriceAt(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-time.Hour)
+	end := now.Add(time.Hour)
+	sale := Money{Amount: 800, Currency: "NGN"}
+
+	product := Product{Price: Money{Amount: 1000, Currency: "NGN"}}
+	require.Equal(t, int64(1000), product.EffectivePriceAt(now).Amount)
+
+	product.SalePrice = &sale
+	require.Equal(t, int64(800), product.EffectivePriceAt(now).Amount)
+
+	product.SaleStartsAt = &start
+	product.SaleEndsAt = &end
+	require.Equal(t, int64(800), product.EffectivePriceAt(now).Amount)
+	require.Equal(t, int64(1000), product.EffectivePriceAt(start.Add(-time.Second)).Amount)
+	require.Equal(t, int64(1000), product.EffectivePriceAt(end).Amount)
+	require.False(t, product.OnSaleAt(end.Add(time.Minute)))
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion is a discount given at checkout. With a code it is a coupon the buyer enters,
+// without one it applies by itself to every order it fits.
+type Promotion struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// upper case, empty for automatic promotions
+	Code string `json:"code,omitempty" bson:"code,omitempty"`
+	Name string `json:"name" bson:"name"`
+	// one of percentage, fixed or buy_x_get_y
+	Kind string `json:"kind" bson:"kind"`
+	// percent off the lines in scope, from 1 to 100
+	Percent int64 `json:"percent,omitempty" bson:"percent,omitempty"`
+	// amount off the lines in scope, spread over them
+	Amount *Money `json:"amount,omitempty" bson:"amount,omitempty"`
+	// for every Buy units of a line in scope the next Get units are free
+	Buy int64 `json:"buy,omitempty" bson:"buy,omitempty"`
+	Get int64 `json:"get,omitempty" bson:"get,omitempty"`
+	// shop for every product, products for ProductIDs only
+	Scope      string               `json:"scope" bson:"scope"`
+	ProductIDs []primitive.ObjectID `json:"product_ids,omitempty" bson:"productIds,omitempty"`
+	// the seller running and funding the promotion, it then only applies to their products.
+	// nil for the marketplace's own promotions, shop scope then covers every product
+	SellerID *primitive.ObjectID `json:"seller_id,omitempty" bson:"sellerId,omitempty"`
+	// the lines in scope must add up to at least this much
+	MinSpend *Money `json:"min_spend,omitempty" bson:"minSpend,omitempty"`
+	// orders the promotion can be used on in total and per buyer, 0 for no limit
+	UsageLimit       int64 `json:"usage_limit" bson:"usageLimit"`
+	PerCustomerLimit int64 `json:"per_customer_limit" bson:"perCustomerLimit"`
+	// orders placed with the promotion so far
+	Uses      int64      `json:"uses" bson:"uses"`
+	Active    bool       `json:"active" bson:"active"`
+	StartsAT  *time.Time `json:"starts_at,omitempty" bson:"startsAt,omitempty"`
+	EndsAT    *time.Time `json:"ends_at,omitempty" bson:"endsAt,omitempty"`
+	CreatedAT time.Time  `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time  `json:"updated_at" bson:"updatedAt"`
+}
+
+// PromotionRedemption counts the orders one buyer placed with a promotion.
+type PromotionRedemption struct {
+	ID          primitive.ObjectID   `json:"id" bson:"_id"`
+	PromotionID primitive.ObjectID   `json:"promotion_id" bson:"promotionId"`
+	UserID      primitive.ObjectID   `json:"user_id" bson:"userId"`
+	Count       int64                `json:"count" bson:"count"`
+	OrderIDs    []primitive.ObjectID `json:"order_ids" bson:"orderIds"`
+}
+
+// AppliedPromotion is a promotion as it was applied to an order.
+type AppliedPromotion struct {
+	PromotionID primitive.ObjectID `json:"promotion_id" bson:"promotionId"`
+	Code        string             `json:"code,omitempty" bson:"code,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	Kind        string             `json:"kind" bson:"kind"`
+	// taken off the order in total
+	Amount Money `json:"amount" bson:"amount"`
+}
+
+// LineDiscount is the part of a promotion taken off one order item.
+type LineDiscount struct {
+	PromotionID primitive.ObjectID `json:"promotion_id" bson:"promotionId"`
+	Code        string             `json:"code,omitempty" bson:"code,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	Amount      Money              `json:"amount" bson:"amount"`
+	// the seller funding it, nil when the marketplace does
+	SellerID *primitive.ObjectID `json:"seller_id,omitempty" bson:"sellerId,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return is a buyer's request to send back items of a delivered sub-order.
+type Return struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	OrderID    primitive.ObjectID `json:"order_id" bson:"orderId"`
+	SubOrderID primitive.ObjectID `json:"sub_order_id" bson:"subOrderId"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"userId"`
+	SellerID   primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	// one of requested, approved, refunded or denied
+	Status string       `json:"status" bson:"status"`
+	Reason string       `json:"reason" bson:"reason"`
+	Items  []ReturnItem `json:"items" bson:"items"`
+	Photos []string     `json:"photos" bson:"photos"`
+	// what the returned items were paid
+	Amount Money `json:"amount" bson:"amount"`
+	// what the seller refunded, it can be less than Amount
+	Refunded      Money               `json:"refunded" bson:"refunded"`
+	SellerNote    string              `json:"seller_note,omitempty" bson:"sellerNote,omitempty"`
+	StatusHistory []OrderStatusChange `json:"status_history" bson:"statusHistory"`
+	CreatedAT     time.Time           `json:"created_at" bson:"createdAt"`
+	UpdatedAT     time.Time           `json:"updated_at" bson:"updatedAt"`
+	// set once the returned items are back in stock, approving again doesn't add them twice
+	Restocked bool `json:"restocked" bson:"restocked,omitempty"`
+	// what the seller approved to refund, approving again retries this amount
+	Approved *Money `json:"approved,omitempty" bson:"approved,omitempty"`
+}
+
+type ReturnItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	Variant   string             `json:"variant,omitempty" bson:"variant,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+	// unit price times quantity
+	Amount Money `json:"amount" bson:"amount"`
+}
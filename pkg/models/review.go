@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Review struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	SellerID  primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"userId"`
+	OrderID   primitive.ObjectID `json:"order_id" bson:"orderId"`
+	// 1 to 5 stars
+	Rating int      `json:"rating" bson:"rating"`
+	Body   string   `json:"body" bson:"body"`
+	Photos []string `json:"photos" bson:"photos"`
+	// pending until a moderator approves or rejects it, only approved reviews are shown and counted
+	Status    string       `json:"status" bson:"status"`
+	Reply     *ReviewReply `json:"reply,omitempty" bson:"reply,omitempty"`
+	CreatedAT time.Time    `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time    `json:"updated_at" bson:"updatedAt"`
+}
+
+// ReviewReply is the seller's public answer to a review.
+type ReviewReply struct {
+	Body      string    `json:"body" bson:"body"`
+	CreatedAT time.Time `json:"created_at" bson:"createdAt"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeliveryZone is a set of regions a seller delivers to and the rates buyers there choose from.
+type DeliveryZone struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	SellerID primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	Name     string             `json:"name" bson:"name"`
+	// ISO 3166 country or subdivision codes, e.g. NG or NG-LA, a zone without any covers everywhere else
+	Regions   []string       `json:"regions" bson:"regions"`
+	Rates     []ShippingRate `json:"rates" bson:"rates"`
+	CreatedAT time.Time      `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time      `json:"updated_at" bson:"updatedAt"`
+}
+
+type ShippingRate struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id"`
+	Name string             `json:"name" bson:"name"`
+	// one of flat, weight or free_over
+	Kind string `json:"kind" bson:"kind"`
+	// what the rate costs, weight rates add PerKg for every started kilogram on top of it
+	Price Money  `json:"price" bson:"price"`
+	PerKg *Money `json:"per_kg,omitempty" bson:"perKg,omitempty"`
+	// free_over rates cost nothing once the items of the sub-order, before discounts, reach FreeOver
+	FreeOver *Money `json:"free_over,omitempty" bson:"freeOver,omitempty"`
+	// how many days delivery takes, both zero when the seller doesn't say
+	MinDays int64 `json:"min_days" bson:"minDays"`
+	MaxDays int64 `json:"max_days" bson:"maxDays"`
+}
+
+// ShippingOption is a rate priced for one sub-order, it is what the buyer picks from and what the order keeps.
+type ShippingOption struct {
+	SellerID primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	// both nil when the seller has no delivery zones and ships for free
+	ZoneID  *primitive.ObjectID `json:"zone_id,omitempty" bson:"zoneId,omitempty"`
+	RateID  *primitive.ObjectID `json:"rate_id,omitempty" bson:"rateId,omitempty"`
+	Name    string              `json:"name" bson:"name"`
+	Kind    string              `json:"kind" bson:"kind"`
+	Price   Money               `json:"price" bson:"price"`
+	MinDays int64               `json:"min_days" bson:"minDays"`
+	MaxDays int64               `json:"max_days" bson:"maxDays"`
+}
+
+// ShippingQuote holds the options one seller offers for their part of an order, cheapest first.
+type ShippingQuote struct {
+	SellerID primitive.ObjectID `json:"seller_id" bson:"sellerId"`
+	Options  []ShippingOption   `json:"options" bson:"options"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TaxRule is the rate charged on products of a category delivered to a region. The most specific
+// rule for a line wins, the region counting before the category.
+type TaxRule struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id"`
+	Name string             `json:"name" bson:"name"`
+	// ISO 3166 country or subdivision code, e.g. NG or NG-LA, empty for everywhere
+	Region string `json:"region" bson:"region"`
+	// nil for every category
+	CategoryID *primitive.ObjectID `json:"category_id,omitempty" bson:"categoryId"`
+	// in hundredths of a percent, 750 is 7.5%
+	Rate int64 `json:"rate" bson:"rate"`
+	// one of half_up, half_even, up or down, applied to the tax of each line
+	Rounding  string    `json:"rounding" bson:"rounding"`
+	CreatedAT time.Time `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time `json:"updated_at" bson:"updatedAt"`
+}
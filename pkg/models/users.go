@@ -6,6 +6,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id"`
 	FirstName string             `json:"first_name,omitempty" bson:"firstname"`
@@ -22,18 +27,50 @@ type User struct {
 	Stars      int64                `json:"stars" bson:"stars" default:"0"`
 	StarredBy  []primitive.ObjectID `json:"starred_by" bson:"starredBy" default:"[]"`
 	IsVerified bool                 `json:"is_verified" bson:"isVerified" default:"false"`
-	CreatedAT  time.Time            `json:"created_at" bson:"createdAt"`
-	UpdatedAT  time.Time            `json:"updated_at" bson:"updatedAt"`
-	UserCart   UserCart             `json:"user_cart" bson:"userCart"`
+	Role       string               `json:"role" bson:"role" default:"user"`
+	// currency the shop sells in, new products are priced in it
+	Currency string `json:"currency" bson:"currency"`
+	// whether the shop's prices already include tax or tax is added at checkout
+	PricesIncludeTax bool `json:"prices_include_tax" bson:"pricesIncludeTax"`
+	// whether the shop delivers for free where none of its delivery zones does
+	FreeShipping bool `json:"free_shipping" bson:"freeShipping"`
+	// address book, exactly one address is the default once there is any
+	Addresses []Address `json:"addresses,omitempty" bson:"addresses,omitempty"`
+	CreatedAT time.Time `json:"created_at" bson:"createdAt"`
+	UpdatedAT time.Time `json:"updated_at" bson:"updatedAt"`
+}
+
+// Address is a place the user gets orders delivered to.
+type Address struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// how the user tells their addresses apart, e.g. Home or Office
+	Label      string `json:"label,omitempty" bson:"label,omitempty"`
+	Name       string `json:"name" bson:"name"`
+	Phone      string `json:"phone" bson:"phone"`
+	Line1      string `json:"line1" bson:"line1"`
+	Line2      string `json:"line2,omitempty" bson:"line2,omitempty"`
+	City       string `json:"city" bson:"city"`
+	PostalCode string `json:"postal_code,omitempty" bson:"postalCode,omitempty"`
+	// ISO 3166 country and, optionally, subdivision codes, e.g. NG and NG-LA
+	Country   string `json:"country" bson:"country"`
+	Region    string `json:"region,omitempty" bson:"region,omitempty"`
+	IsDefault bool   `json:"is_default" bson:"isDefault"`
 }
 
-type UserCart struct {
-	Products []Prod `json:"products" bson:"products"`
+// Zone is the most precise region of the address, the one shipping zones and tax rules are matched with.
+func (a Address) Zone() string {
+	if a.Region != "" {
+		return a.Region
+	}
+	return a.Country
 }
 
 type Prod struct {
 	ID    primitive.ObjectID `json:"id" bson:"_id"`
 	Name  string             `json:"name"  bson:"name"`
-	Price int64              `json:"price" bson:"price"`
+	Price Money              `json:"price" bson:"price"`
 	Image string             `json:"image" bson:"image"`
+	// legacy orders have one unit per entry and no variant
+	Variant  string `json:"variant,omitempty" bson:"variant,omitempty"`
+	Quantity int64  `json:"quantity,omitempty" bson:"quantity,omitempty"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Wishlist struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID primitive.ObjectID `json:"user_id" bson:"userId"`
+	Name   string             `json:"name" bson:"name"`
+	// shared lists can be read by anyone holding ShareToken, private ones only by their owner
+	Shared     bool   `json:"shared" bson:"shared"`
+	ShareToken string `json:"share_token,omitempty" bson:"shareToken,omitempty"`
+	// the user's single "saved for later" list, items moved out of the cart land here
+	SavedForLater bool           `json:"saved_for_later" bson:"savedForLater"`
+	Items         []WishlistItem `json:"items" bson:"items"`
+	CreatedAT     time.Time      `json:"created_at" bson:"createdAt"`
+	UpdatedAT     time.Time      `json:"updated_at" bson:"updatedAt"`
+}
+
+type WishlistItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"productId"`
+	Name      string             `json:"name" bson:"name"`
+	Image     string             `json:"image" bson:"image"`
+	// price and availability last seen, price drops and restocks are detected against them
+	Price   Money     `json:"price" bson:"price"`
+	InStock bool      `json:"in_stock" bson:"inStock"`
+	AddedAT time.Time `json:"added_at" bson:"addedAt"`
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CartRoutes(router *gin.Engine, c controllers.CartController, token_maker token.Maker) {
+	cart := router.Group("/v1/cart").Use(middlewares.AuthMiddleWare(token_maker))
+	cart.GET("/", c.GetCart())
+	cart.DELETE("/", c.ClearCart())
+	cart.GET("/check", c.CheckCart())
+	cart.POST("/items", c.AddItem())
+	cart.PATCH("/items", c.SetQuantity())
+	cart.DELETE("/items/:product_id", c.RemoveLine())
+
+	// the cart used to live under the product routes
+	legacy := router.Group("/v1/product").Use(middlewares.AuthMiddleWare(token_maker))
+	legacy.POST("/add-to-cart", c.AddToCart())
+	legacy.PATCH("/remove-from-cart/:id", c.RemoveFromCart())
+}
+
+// GuestCartRoutes are open to visitors who aren't signed in, the cart token travels in the x-cart-token header.
+func GuestCartRoutes(router *gin.Engine, c controllers.GuestCartController) {
+	guest := router.Group("/v1/guest-cart")
+	guest.POST("/", c.CreateGuestCart())
+	guest.GET("/", c.GetGuestCart())
+	guest.POST("/items", c.AddGuestItem())
+	guest.PATCH("/items", c.SetGuestQuantity())
+	guest.DELETE("/items/:product_id", c.RemoveGuestLine())
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CatalogRoutes is the read-only part of the shop anyone can browse without an account.
+func CatalogRoutes(router *gin.Engine, products controllers.ProductController, categories controllers.CategoryController, reviews controllers.ReviewController) {
+	catalog := router.Group("/v1/catalog")
+	catalog.GET("/products", products.ListProducts())
+	catalog.GET("/products/search", products.SearchProducts())
+	catalog.GET("/products/:id", products.GetProdById())
+	catalog.GET("/products/:id/reviews", reviews.GetProductReviews())
+	catalog.GET("/categories", categories.GetCategories())
+	catalog.GET("/categories/:slug/products", categories.GetCategoryProducts())
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CategoryRoutes(router *gin.Engine, c controllers.CategoryController, token_maker token.Maker, users api.UserService) {
+	categories := router.Group("/v1/categories").Use(middlewares.AuthMiddleWare(token_maker))
+	categories.GET("/", c.GetCategories())
+	categories.GET("/:slug/products", c.GetCategoryProducts())
+
+	admin := router.Group("/v1/categories").Use(middlewares.AuthMiddleWare(token_maker), middlewares.AdminMiddleWare(users))
+	admin.POST("/", c.CreateCategory())
+	admin.PATCH("/:id", c.UpdateCategory())
+	admin.DELETE("/:id", c.DeleteCategory())
+}
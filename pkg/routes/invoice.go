@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InvoiceRoutes(router *gin.Engine, c controllers.InvoiceController, token_maker token.Maker) {
+	orders := router.Group("/v1/orders").Use(middlewares.AuthMiddleWare(token_maker))
+	orders.GET("/:id/invoice.pdf", c.GetInvoice())
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NotificationRoutes(router *gin.Engine, c controllers.NotificationController, token_maker token.Maker) {
+	notifications := router.Group("/v1/notifications").Use(middlewares.AuthMiddleWare(token_maker))
+	notifications.GET("/", c.GetNotifications())
+	notifications.PATCH("/read-all", c.MarkAllRead())
+	notifications.PATCH("/:id/read", c.MarkRead())
+}
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func OrderRoutes(router *gin.Engine, c controllers.OrderController, token_maker token.Maker, users api.UserService) {
+	buyer := router.Group("/v1/orders").Use(middlewares.AuthMiddleWare(token_maker))
+	buyer.GET("/", c.GetOrders())
+	buyer.GET("/number/:number", c.GetOrderByNumber())
+	buyer.GET("/:id", c.GetOrder())
+	buyer.POST("/:id/reorder", c.Reorder())
+	buyer.POST("/:id/cancel", c.CancelOrder())
+
+	admin := router.Group("/v1/orders").Use(middlewares.AuthMiddleWare(token_maker), middlewares.AdminMiddleWare(users))
+	admin.PATCH("/:id/status", c.UpdateOrderStatus())
+
+	// sellers only ever see their own part of an order
+	seller := router.Group("/v1/seller/orders").Use(middlewares.AuthMiddleWare(token_maker))
+	seller.GET("/", c.GetSellerOrders())
+	seller.GET("/export", c.ExportSellerOrders())
+	seller.GET("/number/:number", c.GetSellerOrderByNumber())
+	seller.GET("/:id", c.GetSellerOrder())
+	seller.POST("/:id/accept", c.AcceptOrder())
+	seller.POST("/:id/reject", c.RejectOrder())
+	seller.POST("/:id/ship", c.ShipOrder())
+	seller.POST("/:id/deliver", c.DeliverOrder())
+}
+
+func CheckoutRoutes(router *gin.Engine, c controllers.CheckoutController, token_maker token.Maker) {
+	checkout := router.Group("/v1/checkout").Use(middlewares.AuthMiddleWare(token_maker))
+	checkout.POST("/", c.Checkout())
+	checkout.POST("/quote", c.Quote())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PaymentRoutes(router *gin.Engine, c controllers.PaymentController, token_maker token.Maker) {
+	orders := router.Group("/v1/orders").Use(middlewares.AuthMiddleWare(token_maker))
+	orders.POST("/:id/pay", c.Pay())
+	orders.GET("/:id/payments", c.GetPayments())
+
+	// providers authenticate with the webhook signature instead of a token
+	webhooks := router.Group("/v1/payments/webhooks")
+	webhooks.POST("/:provider", c.Webhook())
+}
@@ -10,14 +10,22 @@ import (
 
 func PoductRoutes(router *gin.Engine, c controllers.ProductController, token_maker token.Maker) {
 	products := router.Group("/v1/product").Use(middlewares.AuthMiddleWare(token_maker))
+	products.GET("/", c.ListProducts())
+	products.GET("/search", c.SearchProducts())
+	products.GET("/export", c.ExportProducts())
+	products.GET("/feed", c.Feed())
+	products.POST("/import", c.ImportProducts())
 	products.GET("/:id", c.GetProdById())
 	products.GET("/products/by-id", c.GetProductsByUserId())
 	products.GET("/products/by-name", c.QueryProductsByName())
 	products.PATCH("/update", c.UpdateProduct())
 	products.POST("/", c.CreateProduct())
 	products.DELETE("/:id", c.DeleteProduct())
-	products.POST("/add-to-cart", c.AddToCart())
-	products.PATCH("/remove-from-cart/:id", c.RemoveFromCart())
-	products.GET("/order", c.MakeOrder())
+	products.PUT("/:id/categories", c.AssignCategories())
+	products.PATCH("/:id/status", c.ChangeStatus())
+	products.PATCH("/:id/price", c.UpdatePrice())
+	products.PUT("/:id/sale", c.SetSale())
+	products.DELETE("/:id/sale", c.ClearSale())
+	products.GET("/:id/price-history", c.PriceHistory())
 
 }
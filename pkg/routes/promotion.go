@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PromotionRoutes(router *gin.Engine, c controllers.PromotionController, token_maker token.Maker, users api.UserService) {
+	admin := router.Group("/v1/promotions").Use(middlewares.AuthMiddleWare(token_maker), middlewares.AdminMiddleWare(users))
+	admin.GET("/", c.GetPromotions())
+	admin.POST("/", c.CreatePromotion())
+	admin.GET("/:id", c.GetPromotion())
+	admin.PATCH("/:id", c.UpdatePromotion())
+}
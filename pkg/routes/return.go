@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReturnRoutes(router *gin.Engine, c controllers.ReturnController, token_maker token.Maker) {
+	buyer := router.Group("/v1/orders").Use(middlewares.AuthMiddleWare(token_maker))
+	buyer.POST("/:id/returns", c.RequestReturn())
+	buyer.GET("/:id/returns", c.GetOrderReturns())
+
+	seller := router.Group("/v1/seller/returns").Use(middlewares.AuthMiddleWare(token_maker))
+	seller.GET("/", c.GetSellerReturns())
+	seller.POST("/:id/approve", c.ApproveReturn())
+	seller.POST("/:id/deny", c.DenyReturn())
+}
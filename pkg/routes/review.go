@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReviewRoutes(router *gin.Engine, c controllers.ReviewController, token_maker token.Maker, users api.UserService) {
+	product := router.Group("/v1/product").Use(middlewares.AuthMiddleWare(token_maker))
+	product.GET("/:id/reviews", c.GetProductReviews())
+	product.POST("/:id/reviews", c.CreateReview())
+
+	reviews := router.Group("/v1/reviews").Use(middlewares.AuthMiddleWare(token_maker))
+	reviews.PATCH("/:id", c.UpdateReview())
+	reviews.DELETE("/:id", c.DeleteReview())
+	reviews.PUT("/:id/reply", c.ReplyToReview())
+
+	admin := router.Group("/v1/reviews").Use(middlewares.AuthMiddleWare(token_maker), middlewares.AdminMiddleWare(users))
+	admin.GET("/pending", c.GetPendingReviews())
+	admin.PATCH("/:id/moderation", c.ModerateReview())
+}
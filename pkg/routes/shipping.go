@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ShippingRoutes(router *gin.Engine, c controllers.ShippingController, token_maker token.Maker) {
+	seller := router.Group("/v1/seller/shipping/zones").Use(middlewares.AuthMiddleWare(token_maker))
+	seller.GET("/", c.GetDeliveryZones())
+	seller.POST("/", c.CreateDeliveryZone())
+	seller.PUT("/:id", c.UpdateDeliveryZone())
+	seller.DELETE("/:id", c.DeleteDeliveryZone())
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TaxRoutes(router *gin.Engine, c controllers.TaxController, token_maker token.Maker, users api.UserService) {
+	admin := router.Group("/v1/tax/rules").Use(middlewares.AuthMiddleWare(token_maker), middlewares.AdminMiddleWare(users))
+	admin.GET("/", c.GetTaxRules())
+	admin.POST("/", c.CreateTaxRule())
+	admin.PATCH("/:id", c.UpdateTaxRule())
+	admin.DELETE("/:id", c.DeleteTaxRule())
+}
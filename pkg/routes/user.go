@@ -18,6 +18,16 @@ func UserRoutes(router *gin.Engine, c controllers.UserController, token_maker to
 	user.PATCH("/update/image", c.UpdateImage())
 	user.PATCH("/update/profile", c.UpdateProfile())
 	user.PATCH("/update/brand-name", c.UpdateBrandName())
+	user.PATCH("/update/currency", c.UpdateCurrency())
+	user.PATCH("/update/tax-pricing", c.UpdateTaxPricing())
+	user.PATCH("/update/free-shipping", c.UpdateFreeShipping())
+	user.GET("/following", c.GetFollowing())
 	user.PATCH("/star/:id", c.StarUserShop())
+	user.DELETE("/star/:id", c.UnstarUserShop())
+	user.GET("/addresses", c.GetAddresses())
+	user.POST("/addresses", c.AddAddress())
+	user.PUT("/addresses/:id", c.UpdateAddress())
+	user.DELETE("/addresses/:id", c.DeleteAddress())
+	user.PATCH("/addresses/:id/default", c.SetDefaultAddress())
 	user.DELETE("/:password", c.DeleteUser())
 }
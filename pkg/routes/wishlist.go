@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/middlewares"
+	"kamoushop/pkg/services/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WishlistRoutes(router *gin.Engine, c controllers.WishlistController, token_maker token.Maker) {
+	// anyone holding the link of a shared list can read it
+	router.GET("/v1/wishlists/shared/:token", c.GetSharedWishlist())
+
+	wishlists := router.Group("/v1/wishlists").Use(middlewares.AuthMiddleWare(token_maker))
+	wishlists.GET("/", c.GetWishlists())
+	wishlists.POST("/", c.CreateWishlist())
+	wishlists.POST("/save-for-later", c.SaveForLater())
+	wishlists.GET("/:id", c.GetWishlist())
+	wishlists.PATCH("/:id", c.UpdateWishlist())
+	wishlists.DELETE("/:id", c.DeleteWishlist())
+	wishlists.POST("/:id/items", c.AddItem())
+	wishlists.DELETE("/:id/items/:product_id", c.RemoveItem())
+	wishlists.POST("/:id/items/:product_id/move-to-cart", c.MoveToCart())
+}
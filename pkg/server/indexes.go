@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"kamoushop/pkg/services/search"
+	"kamoushop/pkg/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the services rely on, creating an index that already exists is a no-op.
+func EnsureIndexes(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	indexes := map[string][]mongo.IndexModel{
+		config.CategoryCol: {
+			{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+			{Keys: bson.D{{Key: "parentId", Value: 1}}},
+		},
+		config.PriceHistoryCol: {
+			{Keys: bson.D{{Key: "productId", Value: 1}, {Key: "_id", Value: -1}}},
+		},
+		config.ProductCol: {
+			{Keys: bson.D{{Key: "categoryIds", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "rating", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "sales", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publishAt", Value: 1}}},
+			{
+				Keys: bson.D{{Key: "userId", Value: 1}, {Key: "sku", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "sku", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			search.TextIndex(),
+		},
+		config.UserCol: {
+			// shops a user follows
+			{Keys: bson.D{{Key: "starredBy", Value: 1}}},
+		},
+		config.ReviewCol: {
+			// one review per buyer and product
+			{Keys: bson.D{{Key: "productId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "productId", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+		},
+		config.WishlistCol: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}}},
+			{Keys: bson.D{{Key: "items.productId", Value: 1}}},
+			{
+				Keys:    bson.D{{Key: "shareToken", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "shareToken", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			{
+				// one saved for later list per user
+				Keys:    bson.D{{Key: "userId", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "savedForLater", Value: true}}),
+			},
+		},
+		config.NotificationCol: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "read", Value: 1}}},
+		},
+		config.CartCol: {
+			// one cart per user, adding the first line relies on it
+			{Keys: bson.D{{Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		config.OrderCol: {
+			// order history
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+			{
+				// a checkout retried with the same key finds the order instead of placing another
+				Keys: bson.D{{Key: "userId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "idempotencyKey", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			// lookup by number, a number is never given to two orders
+			{
+				Keys: bson.D{{Key: "number", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "number", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			{
+				Keys: bson.D{{Key: "invoiceNumber", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "invoiceNumber", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+		},
+		config.PromotionCol: {
+			{
+				// automatic promotions have no code
+				Keys: bson.D{{Key: "code", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "code", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			{Keys: bson.D{{Key: "active", Value: 1}}},
+		},
+		config.RedemptionCol: {
+			{Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		config.TaxRuleCol: {
+			{Keys: bson.D{{Key: "region", Value: 1}, {Key: "categoryId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		config.DeliveryZoneCol: {
+			// a region, or everywhere for zones without any, belongs to one zone of a seller
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "regions", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		config.ReturnCol: {
+			{Keys: bson.D{{Key: "orderId", Value: 1}, {Key: "userId", Value: 1}}},
+			{Keys: bson.D{{Key: "subOrderId", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: -1}}},
+		},
+		config.PaymentCol: {
+			{Keys: bson.D{{Key: "orderId", Value: 1}, {Key: "createdAt", Value: 1}}},
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "reference", Value: 1}}},
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "providerRef", Value: 1}}},
+			{
+				// a redelivered webhook is recognised by its event id
+				Keys: bson.D{{Key: "provider", Value: 1}, {Key: "eventId", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "eventId", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+			{
+				// concurrent attempts to pay an order share its open intent
+				Keys: bson.D{{Key: "orderId", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "open", Value: true}}),
+			},
+			{
+				// a refund is sent once per key
+				Keys: bson.D{{Key: "orderId", Value: 1}, {Key: "refundKey", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+					bson.D{{Key: "refundKey", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+			},
+		},
+		config.SubOrderCol: {
+			// one sub-order per seller and order, the migration upserts on it
+			{Keys: bson.D{{Key: "orderId", Value: 1}, {Key: "sellerId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "number", Value: 1}}},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "invoiceNumber", Value: 1}}},
+			{Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "orderNumber", Value: 1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "number", Value: 1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "invoiceNumber", Value: 1}}},
+			// a review needs a delivered sub-order with the product
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "items.productId", Value: 1}, {Key: "status", Value: 1}}},
+		},
+	}
+
+	for col, models := range indexes {
+		if _, err := db.Collection(col).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,614 @@
+package server
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/utils"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migrate brings documents written by older versions up to date, every step must be safe to run on each start.
+func Migrate(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	// products created before the draft/publish lifecycle were live straight away
+	filter := bson.D{{Key: "status", Value: bson.D{{Key: "$exists", Value: false}}}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: api.StatusPublished}}}}
+	if _, err := db.Collection(config.ProductCol).UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+
+	if err := migrateProductCounters(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateSearchFields(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateMoney(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateCarts(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateOrders(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateSubOrders(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateOrderNumbers(ctx, db, config); err != nil {
+		return err
+	}
+	if err := migrateSubOrderNumbers(ctx, db, config); err != nil {
+		return err
+	}
+	return migrateStars(ctx, db, config)
+}
+
+// migrateCarts moves the carts embedded in user documents, where every unit was its own entry,
+// into the carts collection with one line per product.
+func migrateCarts(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	users := db.Collection(config.UserCol)
+
+	filter := bson.D{{Key: "userCart.products.0", Value: bson.D{{Key: "$exists", Value: true}}}}
+	cursor, err := users.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "userCart", Value: 1}}))
+	if err != nil {
+		return err
+	}
+
+	var legacy []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		UserCart struct {
+			Products []models.Prod `bson:"products"`
+		} `bson:"userCart"`
+	}
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+
+	for _, user := range legacy {
+		lines := []models.CartLine{}
+		index := map[primitive.ObjectID]int{}
+		ids := []primitive.ObjectID{}
+		for _, prod := range user.UserCart.Products {
+			if i, ok := index[prod.ID]; ok {
+				lines[i].Quantity++
+				continue
+			}
+			index[prod.ID] = len(lines)
+			ids = append(ids, prod.ID)
+			lines = append(lines, models.CartLine{
+				ProductID: prod.ID,
+				Quantity:  1,
+				UnitPrice: prod.Price,
+				Name:      prod.Name,
+				Image:     prod.Image,
+				AddedAT:   time.Now(),
+			})
+		}
+
+		sellers, err := db.Collection(config.ProductCol).Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+		if err != nil {
+			return err
+		}
+		var products []models.Product
+		if err = sellers.All(ctx, &products); err != nil {
+			return err
+		}
+		for _, product := range products {
+			lines[index[product.ID]].SellerID = product.UserID
+		}
+
+		// a cart left by an interrupted earlier run is kept as it is
+		cart := models.Cart{ID: primitive.NewObjectID(), UserID: user.ID, Lines: lines, UpdatedAT: time.Now()}
+		updateObj := bson.D{{Key: "$setOnInsert", Value: cart}}
+		opts := options.Update().SetUpsert(true)
+		if _, err = db.Collection(config.CartCol).UpdateOne(ctx, bson.D{{Key: "userId", Value: user.ID}}, updateObj, opts); err != nil {
+			return err
+		}
+	}
+
+	filter = bson.D{{Key: "userCart", Value: bson.D{{Key: "$exists", Value: true}}}}
+	updateObj := bson.D{{Key: "$unset", Value: bson.D{{Key: "userCart", Value: ""}}}}
+	if _, err = users.UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrateOrders turns the product list of orders placed before line items into items and
+// starts their status history, they are left pending as nothing recorded a payment. Orders
+// that end up without items are closed as legacy so they can't be paid.
+func migrateOrders(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	orders := db.Collection(config.OrderCol)
+
+	filter := bson.D{{Key: "items", Value: bson.D{{Key: "$exists", Value: false}}}}
+	cursor, err := orders.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var legacy []struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		Status    string             `bson:"status"`
+		Products  []models.Prod      `bson:"products"`
+		CreatedAT time.Time          `bson:"createdAt"`
+	}
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+
+	for _, order := range legacy {
+		items := []models.OrderItem{}
+		index := map[string]int{}
+		ids := []primitive.ObjectID{}
+		for _, prod := range order.Products {
+			quantity := prod.Quantity
+			if quantity == 0 {
+				quantity = 1
+			}
+			key := prod.ID.Hex() + "/" + prod.Variant
+			if i, ok := index[key]; ok {
+				items[i].Quantity += quantity
+				items[i].Total = money.Multiply(items[i].UnitPrice, items[i].Quantity)
+				continue
+			}
+			index[key] = len(items)
+			ids = append(ids, prod.ID)
+			items = append(items, models.OrderItem{
+				ProductID: prod.ID,
+				Name:      prod.Name,
+				Image:     prod.Image,
+				Variant:   prod.Variant,
+				Quantity:  quantity,
+				UnitPrice: prod.Price,
+				Total:     money.Multiply(prod.Price, quantity),
+			})
+		}
+
+		sellers, err := db.Collection(config.ProductCol).Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+		if err != nil {
+			return err
+		}
+		var products []models.Product
+		if err = sellers.All(ctx, &products); err != nil {
+			return err
+		}
+		for _, product := range products {
+			for i := range items {
+				if items[i].ProductID == product.ID {
+					items[i].SellerID = product.UserID
+				}
+			}
+		}
+
+		status := order.Status
+		if status == "" {
+			status = api.OrderPending
+		}
+		history := []models.OrderStatusChange{{Status: status, Note: "placed before order statuses were tracked", At: order.CreatedAT}}
+
+		updateObj := bson.D{
+			{Key: "$set", Value: bson.D{{Key: "items", Value: items}, {Key: "status", Value: status}, {Key: "statusHistory", Value: history}}},
+			{Key: "$unset", Value: bson.D{{Key: "products", Value: ""}}},
+		}
+		if _, err = orders.UpdateByID(ctx, order.ID, updateObj); err != nil {
+			return err
+		}
+	}
+
+	filter = bson.D{{Key: "items", Value: bson.D{{Key: "$size", Value: 0}}}, {Key: "status", Value: bson.D{{Key: "$ne", Value: api.OrderLegacy}}}}
+	change := models.OrderStatusChange{Status: api.OrderLegacy, Note: "placed before orders had items", At: time.Now()}
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: api.OrderLegacy}}},
+		{Key: "$push", Value: bson.D{{Key: "statusHistory", Value: change}}},
+	}
+	if _, err = orders.UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrateSubOrders splits orders placed before sellers handled their own part of an order into
+// per-seller sub-orders, sellerIds is set last so an interrupted run picks the order up again.
+func migrateSubOrders(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	orders := db.Collection(config.OrderCol)
+
+	filter := bson.D{{Key: "sellerIds", Value: bson.D{{Key: "$exists", Value: false}}}}
+	cursor, err := orders.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var legacy []models.Order
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+
+	for _, order := range legacy {
+		subs, err := api.SplitOrder(order)
+		if err != nil {
+			return err
+		}
+
+		seller_ids := []primitive.ObjectID{}
+		for _, sub := range subs {
+			seller_ids = append(seller_ids, sub.SellerID)
+			// the sub-order starts from the order's current status and history
+			sub.StatusHistory = order.StatusHistory
+			sub.UpdatedAT = order.UpdatedAT
+
+			filter := bson.D{{Key: "orderId", Value: order.ID}, {Key: "sellerId", Value: sub.SellerID}}
+			updateObj := bson.D{{Key: "$setOnInsert", Value: sub}}
+			opts := options.Update().SetUpsert(true)
+			if _, err = db.Collection(config.SubOrderCol).UpdateOne(ctx, filter, updateObj, opts); err != nil {
+				return err
+			}
+		}
+
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "sellerIds", Value: seller_ids}}}}
+		if _, err = orders.UpdateByID(ctx, order.ID, updateObj); err != nil {
+			return err
+		}
+	}
+
+	// every discount so far came from the marketplace's promotions
+	filter = bson.D{{Key: "marketplaceDiscount", Value: bson.D{{Key: "$exists", Value: false}}}}
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "marketplaceDiscount", Value: "$discount"}}}}}
+	_, err = db.Collection(config.SubOrderCol).UpdateMany(ctx, filter, pipeline)
+	return err
+}
+
+// migrateOrderNumbers numbers orders placed before orders had numbers, oldest first and in the year
+// they were placed. Each order is numbered in a transaction so a failed run leaves no gaps.
+func migrateOrderNumbers(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	orders := db.Collection(config.OrderCol)
+	numbers := api.NewNumbers(ctx, db.Collection(config.CounterCol), config.ShopCode)
+
+	filter := bson.D{{Key: "number", Value: bson.D{{Key: "$exists", Value: false}}}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := orders.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	var legacy []models.Order
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	for _, order := range legacy {
+		_, err = session.WithTransaction(ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+			number, err := numbers.Next(sess_ctx, api.NumberOrder, order.CreatedAT)
+			if err != nil {
+				return nil, err
+			}
+			invoice_number, err := numbers.Next(sess_ctx, api.NumberInvoice, order.CreatedAT)
+			if err != nil {
+				return nil, err
+			}
+
+			set := bson.D{{Key: "$set", Value: bson.D{{Key: "number", Value: number}, {Key: "invoiceNumber", Value: invoice_number}}}}
+			if _, err = orders.UpdateOne(sess_ctx, bson.D{{Key: "_id", Value: order.ID}}, set); err != nil {
+				return nil, err
+			}
+			set = bson.D{{Key: "$set", Value: bson.D{{Key: "orderNumber", Value: number}}}}
+			_, err = db.Collection(config.SubOrderCol).UpdateMany(sess_ctx, bson.D{{Key: "orderId", Value: order.ID}}, set)
+			return nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSubOrderNumbers gives sub-orders their seller's numbers, oldest first and in the year they
+// were placed. Sub-orders used to carry their order's numbers, the order number moves to orderNumber
+// so it still finds them.
+func migrateSubOrderNumbers(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	subs := db.Collection(config.SubOrderCol)
+	numbers := api.NewNumbers(ctx, db.Collection(config.CounterCol), config.ShopCode)
+
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "number", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "orderNumber", Value: bson.D{{Key: "$exists", Value: false}}}},
+	}}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "sellerId", Value: 1}, {Key: "number", Value: 1}, {Key: "orderNumber", Value: 1}, {Key: "createdAt", Value: 1}})
+	cursor, err := subs.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	var legacy []models.SubOrder
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	for _, sub := range legacy {
+		_, err = session.WithTransaction(ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+			number, err := numbers.NextForSeller(sess_ctx, sub.SellerID, api.NumberOrder, sub.CreatedAT)
+			if err != nil {
+				return nil, err
+			}
+			invoice_number, err := numbers.NextForSeller(sess_ctx, sub.SellerID, api.NumberInvoice, sub.CreatedAT)
+			if err != nil {
+				return nil, err
+			}
+
+			order_number := sub.OrderNumber
+			if order_number == "" {
+				order_number = sub.Number
+			}
+			set := bson.D{{Key: "$set", Value: bson.D{
+				{Key: "number", Value: number},
+				{Key: "invoiceNumber", Value: invoice_number},
+				{Key: "orderNumber", Value: order_number},
+			}}}
+			_, err = subs.UpdateOne(sess_ctx, append(bson.D{{Key: "_id", Value: sub.ID}}, filter...), set)
+			return nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateStars drops the zero ids new accounts used to be seeded with and recounts stars from
+// starredBy, repeated stars used to be counted more than once.
+func migrateStars(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	users := db.Collection(config.UserCol)
+
+	filter := bson.D{{Key: "starredBy", Value: nil}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "starredBy", Value: bson.A{}}}}}
+	if _, err := users.UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+
+	filter = bson.D{{Key: "starredBy", Value: primitive.NilObjectID}}
+	updateObj = bson.D{{Key: "$pull", Value: bson.D{{Key: "starredBy", Value: primitive.NilObjectID}}}}
+	if _, err := users.UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+
+	count := bson.D{{Key: "$size", Value: "$starredBy"}}
+	filter = bson.D{{Key: "$expr", Value: bson.D{{Key: "$ne", Value: bson.A{"$stars", count}}}}}
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "stars", Value: count}}}}}
+	if _, err := users.UpdateMany(ctx, filter, pipeline); err != nil {
+		return err
+	}
+	return nil
+}
+
+// legacyPriceTypes are the bson types prices had before they were {amount, currency}, the old
+// UpdateProduct stored them as text.
+var legacyPriceTypes = bson.A{"int", "long", "double", "decimal", "string"}
+
+// migrateMoney wraps the bare prices written before shops had a currency into {amount, currency}.
+// Those prices were whole units, they become minor units of the default currency.
+func migrateMoney(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	currency := config.DefaultCurrency
+	exp, err := money.Exponent(currency)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{Key: "currency", Value: bson.D{{Key: "$exists", Value: false}}}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "currency", Value: currency}}}}
+	if _, err = db.Collection(config.UserCol).UpdateMany(ctx, filter, updateObj); err != nil {
+		return err
+	}
+
+	// products whose price is text that is not a number are unpublished with a price of 0, the text
+	// is kept in legacyPrice until the seller sets the price again
+	unreadable := bson.D{{Key: "$eq", Value: bson.A{decimalExpr("$price", nil), nil}}}
+	filter = bson.D{{Key: "price", Value: bson.D{{Key: "$type", Value: "string"}}}, {Key: "$expr", Value: unreadable}}
+	quarantine := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "legacyPrice", Value: "$price"},
+		{Key: "price", Value: int64(0)},
+		{Key: "status", Value: api.StatusUnpublished},
+	}}}}
+	if _, err = db.Collection(config.ProductCol).UpdateMany(ctx, filter, quarantine); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		col    string
+		fields []string
+	}{
+		{config.ProductCol, []string{"price", "salePrice"}},
+		{config.OrderCol, []string{"totalPrice"}},
+		{config.PriceHistoryCol, []string{"oldPrice", "newPrice", "salePrice"}},
+	}
+	for _, step := range steps {
+		for _, field := range step.fields {
+			filter := bson.D{{Key: field, Value: bson.D{{Key: "$type", Value: legacyPriceTypes}}}}
+			pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: field, Value: moneyExpr(field, currency, exp)}}}}}
+			if _, err := db.Collection(step.col).UpdateMany(ctx, filter, pipeline); err != nil {
+				return err
+			}
+		}
+	}
+
+	// legacy cart lines and order products keep a snapshot of the price they were added at, one that
+	// can't be read becomes 0 and the cart check reports the line as changed
+	lists := []struct {
+		col  string
+		path string
+	}{
+		{config.UserCol, "userCart.products"},
+		{config.OrderCol, "products"},
+	}
+	line_price := bson.D{{Key: "$cond", Value: bson.A{
+		bson.D{{Key: "$in", Value: bson.A{bson.D{{Key: "$type", Value: "$$line.price"}}, legacyPriceTypes}}},
+		moneyExpr("$line.price", currency, exp),
+		"$$line.price",
+	}}}
+	for _, list := range lists {
+		filter := bson.D{{Key: list.path + ".price", Value: bson.D{{Key: "$type", Value: legacyPriceTypes}}}}
+		lines := bson.D{{Key: "$map", Value: bson.D{
+			{Key: "input", Value: "$" + list.path},
+			{Key: "as", Value: "line"},
+			{Key: "in", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{"$$line", bson.D{{Key: "price", Value: line_price}}}}}},
+		}}}
+		pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: list.path, Value: lines}}}}}
+		if _, err := db.Collection(list.col).UpdateMany(ctx, filter, pipeline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moneyExpr builds the {amount, currency} expression for the whole units, as a number or numeric
+// text, at path. The amount is in minor units, exp digits, and text that is not a number becomes 0.
+func moneyExpr(path string, currency string, exp int) bson.D {
+	minor := bson.D{{Key: "$multiply", Value: bson.A{decimalExpr("$"+path, int64(0)), int64(math.Pow10(exp))}}}
+	return bson.D{
+		{Key: "amount", Value: bson.D{{Key: "$toLong", Value: bson.D{{Key: "$round", Value: bson.A{minor, 0}}}}}},
+		{Key: "currency", Value: currency},
+	}
+}
+
+// decimalExpr converts the value of expr to a decimal, on_error is used when it is not a number.
+func decimalExpr(expr string, on_error interface{}) bson.D {
+	return bson.D{{Key: "$convert", Value: bson.D{
+		{Key: "input", Value: expr},
+		{Key: "to", Value: "decimal"},
+		{Key: "onError", Value: on_error},
+		{Key: "onNull", Value: on_error},
+	}}}
+}
+
+// migrateSearchFields fills brand and categoryNames, which the text index searches, on products
+// created before they were copied onto the product. Category names include the ancestors' names
+// like they do for new products.
+func migrateSearchFields(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	products := db.Collection(config.ProductCol)
+
+	filter := bson.D{{Key: "brand", Value: bson.D{{Key: "$exists", Value: false}}}}
+	seller_ids, err := products.Distinct(ctx, "userId", filter)
+	if err != nil {
+		return err
+	}
+	for _, id := range seller_ids {
+		var seller models.User
+		err := db.Collection(config.UserCol).FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&seller)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		filter := bson.D{{Key: "userId", Value: id}, {Key: "brand", Value: bson.D{{Key: "$exists", Value: false}}}}
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "brand", Value: seller.BrandName}}}}
+		if _, err = products.UpdateMany(ctx, filter, updateObj); err != nil {
+			return err
+		}
+	}
+
+	filter = bson.D{{Key: "categoryNames", Value: bson.D{{Key: "$exists", Value: false}}}}
+	cursor, err := products.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "categoryIds", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var legacy []models.Product
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	cursor, err = db.Collection(config.CategoryCol).Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	var categories []models.Category
+	if err = cursor.All(ctx, &categories); err != nil {
+		return err
+	}
+	by_id := make(map[primitive.ObjectID]models.Category, len(categories))
+	for _, category := range categories {
+		by_id[category.ID] = category
+	}
+
+	for _, product := range legacy {
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "categoryNames", Value: categoryNames(by_id, product.CategoryIDs)}}}}
+		if _, err = products.UpdateByID(ctx, product.ID, updateObj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryNames lists the names of the given categories and their ancestors, each once.
+func categoryNames(categories map[primitive.ObjectID]models.Category, ids []primitive.ObjectID) []string {
+	names := []string{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		category, ok := categories[id]
+		if !ok {
+			continue
+		}
+		for _, id := range append(category.Ancestors, category.ID) {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if ancestor, ok := categories[id]; ok {
+				names = append(names, ancestor.Name)
+			}
+		}
+	}
+	return names
+}
+
+// migrateProductCounters sets the stock, rating and sales counters products created before they
+// were tracked lack, so the in_stock filter and the sorts see them. Such products start out of
+// stock, as checkout could not sell them either, until their seller sets the stock.
+func migrateProductCounters(ctx context.Context, db *mongo.Database, config utils.Config) error {
+	products := db.Collection(config.ProductCol)
+
+	defaults := bson.D{
+		{Key: "stock", Value: int64(0)},
+		{Key: "sales", Value: int64(0)},
+		{Key: "rating", Value: float64(0)},
+		{Key: "ratingCount", Value: int64(0)},
+		{Key: "ratingSum", Value: int64(0)},
+		{Key: "createdAt", Value: bson.D{{Key: "$toDate", Value: "$_id"}}},
+	}
+	for _, field := range defaults {
+		filter := bson.D{{Key: field.Key, Value: bson.D{{Key: "$exists", Value: false}}}}
+		pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.D{field}}}}
+		if _, err := products.UpdateMany(ctx, filter, pipeline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"kamoushop/pkg/controllers"
+	"kamoushop/pkg/libs"
 	"kamoushop/pkg/routes"
 	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/payment"
+	"kamoushop/pkg/services/scheduler"
+	"kamoushop/pkg/services/search"
 	"kamoushop/pkg/services/token"
 	"kamoushop/pkg/utils"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -20,10 +26,27 @@ import (
 
 var (
 	// tokenMaker      token.Maker
-	auth_controller controllers.AuthController
-	user_controller controllers.UserController
-	prod_controller controllers.ProductController
-	redis_client    *redis.Client
+	auth_controller     controllers.AuthController
+	user_controller     controllers.UserController
+	prod_controller     controllers.ProductController
+	cat_controller      controllers.CategoryController
+	rev_controller      controllers.ReviewController
+	wish_controller     controllers.WishlistController
+	noti_controller     controllers.NotificationController
+	cart_controller     controllers.CartController
+	gcart_controller    controllers.GuestCartController
+	order_controller    controllers.OrderController
+	checkout_controller controllers.CheckoutController
+	payment_controller  controllers.PaymentController
+	return_controller   controllers.ReturnController
+	invoice_controller  controllers.InvoiceController
+	promo_controller    controllers.PromotionController
+	tax_controller      controllers.TaxController
+	ship_controller     controllers.ShippingController
+	user_service        api.UserService
+	prod_service        api.ProductService
+	wish_service        api.WishlistService
+	redis_client        *redis.Client
 )
 
 func InitTokenMaker(config utils.Config) (token.Maker, error) {
@@ -41,17 +64,100 @@ func InitCols(client *mongo.Client, config utils.Config, ctx context.Context, to
 	token_col := client.Database(config.DbName).Collection(config.TokenCol)
 	prod_col := client.Database(config.DbName).Collection(config.ProductCol)
 	order_col := client.Database(config.DbName).Collection(config.OrderCol)
+	cat_col := client.Database(config.DbName).Collection(config.CategoryCol)
+	history_col := client.Database(config.DbName).Collection(config.PriceHistoryCol)
+	review_col := client.Database(config.DbName).Collection(config.ReviewCol)
+	wishlist_col := client.Database(config.DbName).Collection(config.WishlistCol)
+	notification_col := client.Database(config.DbName).Collection(config.NotificationCol)
+	cart_col := client.Database(config.DbName).Collection(config.CartCol)
+	sub_col := client.Database(config.DbName).Collection(config.SubOrderCol)
+	payment_col := client.Database(config.DbName).Collection(config.PaymentCol)
+	return_col := client.Database(config.DbName).Collection(config.ReturnCol)
+	counter_col := client.Database(config.DbName).Collection(config.CounterCol)
+	promotion_col := client.Database(config.DbName).Collection(config.PromotionCol)
+	redemption_col := client.Database(config.DbName).Collection(config.RedemptionCol)
+	tax_col := client.Database(config.DbName).Collection(config.TaxRuleCol)
+	zone_col := client.Database(config.DbName).Collection(config.DeliveryZoneCol)
 
 	auth_service := api.NewAuthService(users_col, ctx)
-	user_service := api.NewUserService(users_col, ctx)
-	prod_service := api.NewProductService(ctx, prod_col, users_col, order_col)
+	user_service = api.NewUserService(users_col, prod_col, ctx)
+	cart_service := api.NewCartService(ctx, cart_col, prod_col)
+	guest_cart_service := api.NewGuestCartService(ctx, redis_client, prod_col, cart_service, config.TokenKey, config.GuestCartTTL)
+	prod_service = api.NewProductService(ctx, prod_col, users_col, history_col)
+	cat_service := api.NewCategoryService(ctx, client, cat_col, prod_col)
+	search_backend := search.NewMongoBackend(ctx, prod_col, cat_col)
+	import_service := api.NewImportService(ctx, prod_col, users_col, history_col, cat_service, libs.UploadFromURL)
+	promotion_service := api.NewPromotionService(ctx, promotion_col, redemption_col)
+	tax_service := api.NewTaxService(ctx, tax_col, users_col, cat_service)
+	shipping_service := api.NewShippingService(ctx, zone_col, users_col)
+	checkout_service := api.NewCheckoutService(ctx, client, order_col, sub_col, prod_col, cart_col, api.NewNumbers(ctx, counter_col, config.ShopCode), promotion_service, tax_service, shipping_service)
+	review_service := api.NewReviewService(ctx, review_col, prod_col, sub_col)
+	notification_service := api.NewNotificationService(ctx, notification_col)
+	order_service := api.NewOrderService(ctx, client, order_col, sub_col, prod_col, cart_service, promotion_service, notification_service)
+	payment_service := api.NewPaymentService(ctx, payment_col, order_col, users_col, order_service, PaymentProviders(config), config.PaymentProvider)
+	return_service := api.NewReturnService(ctx, return_col, order_service, payment_service, notification_service)
+	invoice_service := api.NewInvoiceService(ctx, users_col, order_service, InvoiceShop(config), Mailer(config))
+	wish_service = api.NewWishlistService(ctx, wishlist_col, prod_col, cart_service, notification_service)
 
-	auth_controller = controllers.NewAuthController(auth_service, tokenMaker, config, *token_col, redis_client)
+	rates, err := money.NewConverter(config.ExchangeRates)
+	if err != nil {
+		log.Panic(err.Error())
+	}
+
+	auth_controller = controllers.NewAuthController(auth_service, tokenMaker, config, *token_col, redis_client, guest_cart_service)
 	user_controller = controllers.NewUserController(user_service, tokenMaker, config)
-	prod_controller = controllers.NewProductController(prod_service, tokenMaker, config)
+	prod_controller = controllers.NewProductController(prod_service, cat_service, search_backend, import_service, rates, tokenMaker, config)
+	cat_controller = controllers.NewCategoryController(cat_service, tokenMaker, config)
+	rev_controller = controllers.NewReviewController(review_service, tokenMaker, config)
+	wish_controller = controllers.NewWishlistController(wish_service, tokenMaker, config)
+	noti_controller = controllers.NewNotificationController(notification_service, tokenMaker, config)
+	cart_controller = controllers.NewCartController(cart_service, tokenMaker, config)
+	gcart_controller = controllers.NewGuestCartController(guest_cart_service, tokenMaker, config)
+	order_controller = controllers.NewOrderController(order_service, return_service, tokenMaker, config)
+	checkout_controller = controllers.NewCheckoutController(checkout_service, cart_service, invoice_service, tokenMaker, config)
+	payment_controller = controllers.NewPaymentController(payment_service, tokenMaker, config)
+	return_controller = controllers.NewReturnController(return_service, tokenMaker, config)
+	invoice_controller = controllers.NewInvoiceController(invoice_service, tokenMaker, config)
+	promo_controller = controllers.NewPromotionController(promotion_service, tokenMaker, config)
+	tax_controller = controllers.NewTaxController(tax_service, tokenMaker, config)
+	ship_controller = controllers.NewShippingController(shipping_service, tokenMaker, config)
 	return &auth_controller, &user_controller, &prod_controller
 }
 
+// PaymentProviders sets up every provider with credentials in the config, the fake one
+// only when FAKE_PAYMENTS is on and it has a webhook secret so it can't be enabled by accident.
+func PaymentProviders(config utils.Config) payment.Providers {
+	providers := []payment.Provider{}
+	if config.PaystackSecretKey != "" {
+		providers = append(providers, payment.NewPaystack(config.PaystackSecretKey, ""))
+	}
+	if config.StripeSecretKey != "" {
+		providers = append(providers, payment.NewStripe(config.StripeSecretKey, config.StripeWebhookSecret, ""))
+	}
+	if config.FakePayments && config.FakePaymentSecret != "" {
+		providers = append(providers, payment.NewFake(config.FakePaymentSecret))
+	}
+	return payment.NewProviders(providers...)
+}
+
+func InvoiceShop(config utils.Config) libs.InvoiceShop {
+	return libs.InvoiceShop{
+		Name:    config.ShopName,
+		Address: config.ShopAddress,
+		Email:   config.ShopEmail,
+		Color:   config.ShopBrandColor,
+		Logo:    config.ShopLogo,
+	}
+}
+
+// Mailer is nil when no smtp server is configured, mail is then not sent at all.
+func Mailer(config utils.Config) *libs.Mailer {
+	if config.SMTPHost == "" {
+		return nil
+	}
+	return libs.NewMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+}
+
 func Run() *gin.Engine {
 	config, err := utils.LoadConfig(".")
 
@@ -59,6 +165,28 @@ func Run() *gin.Engine {
 		log.Fatal("cannot load env", err)
 	}
 
+	if config.ShopName == "" {
+		config.ShopName = "Kamou Shop"
+	}
+	if config.ShopCode == "" {
+		config.ShopCode = "KS"
+	}
+	if config.DefaultCurrency == "" {
+		config.DefaultCurrency = "NGN"
+	}
+	if !money.Valid(config.DefaultCurrency) {
+		log.Fatal("DEFAULT_CURRENCY is not a supported currency: ", config.DefaultCurrency)
+	}
+	if config.AppEnv == "" {
+		config.AppEnv = "production"
+	}
+	if config.FakePayments && config.AppEnv != "development" && config.AppEnv != "test" {
+		log.Fatal("FAKE_PAYMENTS marks orders paid without charging anyone, it is only allowed with APP_ENV development or test, not ", config.AppEnv)
+	}
+	if _, err := PaymentProviders(config).Get(config.PaymentProvider); err != nil {
+		log.Fatal("PAYMENT_PROVIDER has no credentials configured: ", config.PaymentProvider)
+	}
+
 	ctx := context.TODO()
 	tokenMaker, err := InitTokenMaker(config)
 
@@ -95,7 +223,33 @@ func Run() *gin.Engine {
 
 	fmt.Println("MongoDB connection succesful!")
 
+	if err := EnsureIndexes(ctx, mongoClient.Database(config.DbName), config); err != nil {
+		log.Panic(err.Error())
+	}
+
+	if err := Migrate(ctx, mongoClient.Database(config.DbName), config); err != nil {
+		log.Panic(err.Error())
+	}
+
 	auth_col, users_col, prod_col := InitCols(mongoClient, config, ctx, tokenMaker, redis_client)
+
+	interval := config.SchedulerInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	go scheduler.Every(ctx, interval, "publish scheduled products", func(now time.Time) error {
+		_, err := prod_service.PublishDue(now)
+		return err
+	})
+	// the first run after a start looks at every wishlisted product, later runs at the ones changed since
+	var watched time.Time
+	go scheduler.Every(ctx, interval, "notify wishlist watchers", func(now time.Time) error {
+		if _, err := wish_service.NotifyWatchers(watched, now); err != nil {
+			return err
+		}
+		watched = now
+		return nil
+	})
 	server := gin.Default()
 	server.Use(cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -110,6 +264,21 @@ func Run() *gin.Engine {
 	routes.AuthRoutes(server, *auth_col, tokenMaker)
 	routes.UserRoutes(server, *users_col, tokenMaker)
 	routes.PoductRoutes(server, *prod_col, tokenMaker)
+	routes.CategoryRoutes(server, cat_controller, tokenMaker, user_service)
+	routes.ReviewRoutes(server, rev_controller, tokenMaker, user_service)
+	routes.WishlistRoutes(server, wish_controller, tokenMaker)
+	routes.NotificationRoutes(server, noti_controller, tokenMaker)
+	routes.CartRoutes(server, cart_controller, tokenMaker)
+	routes.GuestCartRoutes(server, gcart_controller)
+	routes.CatalogRoutes(server, prod_controller, cat_controller, rev_controller)
+	routes.OrderRoutes(server, order_controller, tokenMaker, user_service)
+	routes.CheckoutRoutes(server, checkout_controller, tokenMaker)
+	routes.PaymentRoutes(server, payment_controller, tokenMaker)
+	routes.ReturnRoutes(server, return_controller, tokenMaker)
+	routes.InvoiceRoutes(server, invoice_controller, tokenMaker)
+	routes.PromotionRoutes(server, promo_controller, tokenMaker, user_service)
+	routes.TaxRoutes(server, tax_controller, tokenMaker, user_service)
+	routes.ShippingRoutes(server, ship_controller, tokenMaker)
 
 	return server
 }
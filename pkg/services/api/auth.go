@@ -15,7 +15,7 @@ import (
 )
 
 type AuthService interface {
-	CreateUser(data models.User) error
+	CreateUser(data models.User) (models.User, error)
 	Login(data types.Login) (models.User, error)
 	ValidateAcc(email string) error
 }
@@ -32,17 +32,17 @@ func NewAuthService(col *mongo.Collection, ctx context.Context) AuthService {
 	}
 }
 
-func (a *authService) CreateUser(data models.User) error {
+func (a *authService) CreateUser(data models.User) (models.User, error) {
 	id := primitive.NewObjectID()
 	hashedPass, err := password.HashPassword(data.Password)
 
 	if err != nil {
-		return err
+		return models.User{}, err
 	}
 
 	if user, _ := GetUserByEmail(a, data.Email); user.Email == data.Email {
 		err = errors.New("user already exists")
-		return err
+		return models.User{}, err
 	}
 
 	new_user := models.User{
@@ -52,15 +52,18 @@ func (a *authService) CreateUser(data models.User) error {
 		Password:  hashedPass,
 		Email:     data.Email,
 		LoginType: "password",
+		Role:      models.RoleUser,
+		Currency:  data.Currency,
+		StarredBy: []primitive.ObjectID{},
 		CreatedAT: time.Now(),
 		UpdatedAT: time.Now(),
 	}
 
 	_, err = a.col.InsertOne(a.ctx, new_user)
 	if err != nil {
-		return err
+		return models.User{}, err
 	}
-	return nil
+	return new_user, nil
 }
 
 func (a *authService) Login(data types.Login) (models.User, error) {
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	CartIssuePriceChanged      = "price_changed"
+	CartIssueUnavailable       = "unavailable"
+	CartIssueInsufficientStock = "insufficient_stock"
+)
+
+var (
+	ErrInvalidQuantity = errors.New("quantity must be at least 1")
+	ErrLineNotFound    = errors.New("product is not in the cart")
+	ErrUnknownVariant  = errors.New("product has no such variant")
+	ErrNotEnoughStock  = errors.New("not enough stock left for this quantity")
+)
+
+type CartService interface {
+	GetCart(user_id primitive.ObjectID) (models.Cart, error)
+	AddItem(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error)
+	SetQuantity(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error)
+	RemoveLine(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string) (models.Cart, error)
+	RemoveProduct(user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Cart, error)
+	Clear(user_id primitive.ObjectID) error
+	Check(user_id primitive.ObjectID) ([]models.CartIssue, error)
+}
+
+type cartService struct {
+	col      *mongo.Collection
+	prod_col *mongo.Collection
+	ctx      context.Context
+}
+
+func NewCartService(ctx context.Context, col *mongo.Collection, prod_col *mongo.Collection) CartService {
+	return &cartService{
+		col:      col,
+		prod_col: prod_col,
+		ctx:      ctx,
+	}
+}
+
+// GetCart returns the user's cart, users who never added anything get an empty one.
+func (c *cartService) GetCart(user_id primitive.ObjectID) (models.Cart, error) {
+	var cart models.Cart
+	err := c.col.FindOne(c.ctx, bson.D{{Key: "userId", Value: user_id}}).Decode(&cart)
+	if err == mongo.ErrNoDocuments {
+		cart = models.Cart{UserID: user_id}
+	} else if err != nil {
+		return models.Cart{}, err
+	}
+
+	if cart.Lines == nil {
+		cart.Lines = []models.CartLine{}
+	}
+	cart.Totals = cartTotals(cart.Lines)
+	return cart, nil
+}
+
+// AddItem adds quantity units of a product to the cart, adding a product and variant that is
+// already in the cart raises the quantity of its line and takes its current price. A line never
+// holds more than is in stock.
+func (c *cartService) AddItem(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error) {
+	if quantity < 1 {
+		return models.Cart{}, ErrInvalidQuantity
+	}
+
+	product, err := findPublished(c.ctx, c.prod_col, product_id)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if err = checkLine(product, variant, quantity); err != nil {
+		return models.Cart{}, err
+	}
+	line := cartLine(product, variant, quantity, time.Now())
+
+	// a second attempt covers the line being added by a concurrent request in between
+	for attempt := 0; attempt < 2; attempt++ {
+		added, err := c.addLine(user_id, line, product.Stock)
+		if err != nil {
+			return models.Cart{}, err
+		}
+		if added {
+			return c.GetCart(user_id)
+		}
+	}
+	return models.Cart{}, ErrCantUpdateUser
+}
+
+func (c *cartService) addLine(user_id primitive.ObjectID, line models.CartLine, stock int64) (bool, error) {
+	match := bson.D{{Key: "productId", Value: line.ProductID}, {Key: "variant", Value: line.Variant}}
+
+	room := bson.D{
+		{Key: "productId", Value: line.ProductID},
+		{Key: "variant", Value: line.Variant},
+		{Key: "quantity", Value: bson.D{{Key: "$lte", Value: stock - line.Quantity}}},
+	}
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "lines", Value: bson.D{{Key: "$elemMatch", Value: room}}}}
+	updateObj := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "lines.$.quantity", Value: line.Quantity}}},
+		{Key: "$set", Value: bson.D{{Key: "lines.$.unitPrice", Value: line.UnitPrice}, {Key: "updatedAt", Value: time.Now()}}},
+	}
+	result, err := c.col.UpdateOne(c.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	// the line is there but the extra units would take it over the stock
+	filter = bson.D{{Key: "userId", Value: user_id}, {Key: "lines", Value: bson.D{{Key: "$elemMatch", Value: match}}}}
+	count, err := c.col.CountDocuments(c.ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, ErrNotEnoughStock
+	}
+
+	filter = bson.D{{Key: "userId", Value: user_id}, {Key: "lines", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$elemMatch", Value: match}}}}}}
+	updateObj = bson.D{
+		{Key: "$push", Value: bson.D{{Key: "lines", Value: line}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "_id", Value: primitive.NewObjectID()}}},
+	}
+	if _, err = c.col.UpdateOne(c.ctx, filter, updateObj, options.Update().SetUpsert(true)); err != nil {
+		// the cart gained the line after the first update, the unique userId index rejects the insert
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SetQuantity sets how many units of a line the buyer wants at the product's current price, zero removes the line.
+func (c *cartService) SetQuantity(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error) {
+	if quantity < 0 {
+		return models.Cart{}, ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return c.RemoveLine(user_id, product_id, variant)
+	}
+
+	product, err := findPublished(c.ctx, c.prod_col, product_id)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if err = checkLine(product, variant, quantity); err != nil {
+		return models.Cart{}, err
+	}
+
+	now := time.Now()
+	match := bson.D{{Key: "productId", Value: product_id}, {Key: "variant", Value: variant}}
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "lines", Value: bson.D{{Key: "$elemMatch", Value: match}}}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "lines.$.quantity", Value: quantity},
+		{Key: "lines.$.unitPrice", Value: product.EffectivePriceAt(now)},
+		{Key: "updatedAt", Value: now}}}}
+	return c.update(filter, updateObj)
+}
+
+func (c *cartService) RemoveLine(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string) (models.Cart, error) {
+	match := bson.D{{Key: "productId", Value: product_id}, {Key: "variant", Value: variant}}
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "lines", Value: bson.D{{Key: "$elemMatch", Value: match}}}}
+	updateObj := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "lines", Value: match}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+	return c.update(filter, updateObj)
+}
+
+// RemoveProduct removes every variant of a product from the cart.
+func (c *cartService) RemoveProduct(user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Cart, error) {
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "lines.productId", Value: product_id}}
+	updateObj := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "lines", Value: bson.D{{Key: "productId", Value: product_id}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+	return c.update(filter, updateObj)
+}
+
+func (c *cartService) Clear(user_id primitive.ObjectID) error {
+	filter := bson.D{{Key: "userId", Value: user_id}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "lines", Value: bson.A{}}, {Key: "updatedAt", Value: time.Now()}}}}
+	_, err := c.col.UpdateOne(c.ctx, filter, updateObj, options.Update())
+	return err
+}
+
+// Check compares every line with the catalog and flags lines whose price changed since they were
+// added, whose product was deleted or taken off sale, or that ask for more than is in stock.
+func (c *cartService) Check(user_id primitive.ObjectID) ([]models.CartIssue, error) {
+	cart, err := c.GetCart(user_id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Lines) == 0 {
+		return []models.CartIssue{}, nil
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, line := range cart.Lines {
+		ids = append(ids, line.ProductID)
+	}
+
+	cursor, err := c.prod_col.Find(c.ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.Product{}
+	if err = cursor.All(c.ctx, &found); err != nil {
+		return nil, err
+	}
+
+	products := map[primitive.ObjectID]models.Product{}
+	for _, product := range found {
+		products[product.ID] = product
+	}
+	return cartIssues(cart.Lines, products, time.Now()), nil
+}
+
+func (c *cartService) update(filter bson.D, updateObj bson.D) (models.Cart, error) {
+	var cart models.Cart
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := c.col.FindOneAndUpdate(c.ctx, filter, updateObj, opts).Decode(&cart); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Cart{}, ErrLineNotFound
+		}
+		return models.Cart{}, err
+	}
+
+	if cart.Lines == nil {
+		cart.Lines = []models.CartLine{}
+	}
+	cart.Totals = cartTotals(cart.Lines)
+	return cart, nil
+}
+
+func findPublished(ctx context.Context, prod_col *mongo.Collection, product_id primitive.ObjectID) (models.Product, error) {
+	var product models.Product
+	filter := bson.D{{Key: "_id", Value: product_id}, {Key: "status", Value: StatusPublished}}
+	if err := prod_col.FindOne(ctx, filter).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Product{}, ErrCantFindProduct
+		}
+		return models.Product{}, err
+	}
+	return product, nil
+}
+
+// checkLine makes sure quantity units of product can be sold as variant. Products have no
+// variants yet, so the empty variant is the only one there is.
+func checkLine(product models.Product, variant string, quantity int64) error {
+	if variant != "" {
+		return ErrUnknownVariant
+	}
+	if quantity > product.Stock {
+		return ErrNotEnoughStock
+	}
+	return nil
+}
+
+// unsellable reports whether adding an item failed because of the product rather than the cart,
+// merges and reorders skip such items.
+func unsellable(err error) bool {
+	return err == ErrCantFindProduct || err == ErrUnknownVariant || err == ErrNotEnoughStock
+}
+
+// cartLine snapshots the product as it is sold at now.
+func cartLine(product models.Product, variant string, quantity int64, now time.Time) models.CartLine {
+	return models.CartLine{
+		ProductID: product.ID,
+		Variant:   variant,
+		Quantity:  quantity,
+		UnitPrice: product.EffectivePriceAt(now),
+		Name:      product.Name,
+		Image:     product.Image,
+		SellerID:  product.UserID,
+		AddedAT:   now,
+	}
+}
+
+// cartTotals sums the lines per currency, in the order each currency first appears.
+func cartTotals(lines []models.CartLine) []models.Money {
+	totals := []models.Money{}
+	index := map[string]int{}
+
+	for _, line := range lines {
+		subtotal := money.Multiply(line.UnitPrice, line.Quantity)
+		i, ok := index[subtotal.Currency]
+		if !ok {
+			index[subtotal.Currency] = len(totals)
+			totals = append(totals, subtotal)
+			continue
+		}
+		totals[i].Amount += subtotal.Amount
+	}
+	return totals
+}
+
+func cartIssues(lines []models.CartLine, products map[primitive.ObjectID]models.Product, now time.Time) []models.CartIssue {
+	issues := []models.CartIssue{}
+
+	for _, line := range lines {
+		product, ok := products[line.ProductID]
+		if !ok || product.Status != StatusPublished {
+			issues = append(issues, models.CartIssue{ProductID: line.ProductID, Variant: line.Variant, Kind: CartIssueUnavailable})
+			continue
+		}
+
+		if price := product.EffectivePriceAt(now); price != line.UnitPrice {
+			old_price := line.UnitPrice
+			issues = append(issues, models.CartIssue{
+				ProductID: line.ProductID,
+				Variant:   line.Variant,
+				Kind:      CartIssuePriceChanged,
+				OldPrice:  &old_price,
+				NewPrice:  &price,
+			})
+		}
+
+		if product.Stock < line.Quantity {
+			available := product.Stock
+			issues = append(issues, models.CartIssue{
+				ProductID: line.ProductID,
+				Variant:   line.Variant,
+				Kind:      CartIssueInsufficientStock,
+				Available: &available,
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartTotals(t *testing.T) {
+	lines := []models.CartLine{
+		{Quantity: 2, UnitPrice: models.Money{Amount: 1500, Currency: "NGN"}},
+		{Quantity: 1, UnitPrice: models.Money{Amount: 999, Currency: "USD"}},
+		{Quantity: 3, UnitPrice: models.Money{Amount: 100, Currency: "NGN"}},
+	}
+
+	require.Equal(t, []models.Money{{Amount: 3300, Currency: "NGN"}, {Amount: 999, Currency: "USD"}}, cartTotals(lines))
+	require.Empty(t, cartTotals(nil))
+}
+
+func TestCartIssues(t *testing.T) {
+	now := time.Now()
+	same, repriced, gone, draft := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	price := models.Money{Amount: 1000, Currency: "NGN"}
+
+	lines := []models.CartLine{
+		{ProductID: same, Quantity: 2, UnitPrice: price},
+		{ProductID: repriced, Variant: "size:M", Quantity: 4, UnitPrice: price},
+		{ProductID: gone, Quantity: 1, UnitPrice: price},
+		{ProductID: draft, Quantity: 1, UnitPrice: price},
+	}
+	products := map[primitive.ObjectID]models.Product{
+		same:     {ID: same, Price: price, Stock: 2, Status: StatusPublished},
+		repriced: {ID: repriced, Price: models.Money{Amount: 1200, Currency: "NGN"}, Stock: 1, Status: StatusPublished},
+		draft:    {ID: draft, Price: price, Stock: 5, Status: StatusDraft},
+	}
+
+	issues := cartIssues(lines, products, now)
+	require.Len(t, issues, 4)
+
+	require.Equal(t, CartIssuePriceChanged, issues[0].Kind)
+	require.Equal(t, "size:M", issues[0].Variant)
+	require.Equal(t, int64(1000), issues[0].OldPrice.Amount)
+	require.Equal(t, int64(1200), issues[0].NewPrice.Amount)
+
+	require.Equal(t, CartIssueInsufficientStock, issues[1].Kind)
+	require.Equal(t, int64(1), *issues[1].Available)
+
+	require.Equal(t, models.CartIssue{ProductID: gone, Kind: CartIssueUnavailable}, issues[2])
+	require.Equal(t, models.CartIssue{ProductID: draft, Kind: CartIssueUnavailable}, issues[3])
+}
+
+func TestCheckLine(t *testing.T) {
+	product := models.Product{Stock: 3}
+	require.NoError(t, checkLine(product, "", 3))
+	require.ErrorIs(t, checkLine(product, "", 4), ErrNotEnoughStock)
+	require.ErrorIs(t, checkLine(product, "red", 1), ErrUnknownVariant)
+}
+
+func TestAddItemStaysWithinStock(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+	carts := NewCartService(ctx, db.Collection("carts"), db.Collection("products"))
+
+	product := models.Product{ID: primitive.NewObjectID(), Price: models.Money{Amount: 500, Currency: "NGN"}, Stock: 3, Status: StatusPublished}
+	_, err := db.Collection("products").InsertOne(ctx, product)
+	require.NoError(t, err)
+
+	user_id := primitive.NewObjectID()
+	_, err = carts.AddItem(user_id, product.ID, "", 2)
+	require.NoError(t, err)
+
+	_, err = carts.AddItem(user_id, product.ID, "", 2)
+	require.ErrorIs(t, err, ErrNotEnoughStock)
+
+	// adding more takes the current price
+	_, err = db.Collection("products").UpdateByID(ctx, product.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "price.amount", Value: 600}}}})
+	require.NoError(t, err)
+	cart, err := carts.AddItem(user_id, product.ID, "", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), cart.Lines[0].Quantity)
+	require.Equal(t, int64(600), cart.Lines[0].UnitPrice.Amount)
+
+	_, err = carts.SetQuantity(user_id, product.ID, "", 4)
+	require.ErrorIs(t, err, ErrNotEnoughStock)
+}
@@ -0,0 +1,540 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/types"
+	"kamoushop/pkg/utils"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CategoryService interface {
+	CreateCategory(data types.AddCategory) (models.Category, error)
+	UpdateCategory(id primitive.ObjectID, data types.UpdateCategory) (models.Category, error)
+	DeleteCategory(id primitive.ObjectID) error
+	GetBySlug(slug string) (models.Category, error)
+	GetByIDs(ids []primitive.ObjectID) ([]models.Category, error)
+	GetTree() ([]*models.CategoryNode, error)
+	SubtreeIDs(slug string) ([]primitive.ObjectID, error)
+	ResolveSlugs(slugs []string) ([]primitive.ObjectID, error)
+	SearchNames(ids []primitive.ObjectID) ([]string, error)
+	SlugsByID() (map[primitive.ObjectID]string, error)
+	GetProducts(slug string, req pagination.Request) (models.Category, pagination.Page[models.Product], error)
+	AssignProduct(product_id primitive.ObjectID, user_id primitive.ObjectID, slugs []string) error
+}
+
+type categoryService struct {
+	client   *mongo.Client
+	col      *mongo.Collection
+	prod_col *mongo.Collection
+	ctx      context.Context
+}
+
+func NewCategoryService(ctx context.Context, client *mongo.Client, col *mongo.Collection, prod_col *mongo.Collection) CategoryService {
+	return &categoryService{
+		client:   client,
+		col:      col,
+		prod_col: prod_col,
+		ctx:      ctx,
+	}
+}
+
+var (
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrCategoryExists      = errors.New("a category with this slug already exists")
+	ErrCategoryHasChildren = errors.New("category still has subcategories")
+	ErrCategoryCycle       = errors.New("a category cannot be moved under itself or one of its subcategories")
+	ErrInvalidSlug         = errors.New("the category name or slug needs at least one letter or digit")
+)
+
+func (c *categoryService) CreateCategory(data types.AddCategory) (models.Category, error) {
+	slug := utils.Slugify(data.Slug)
+	if slug == "" {
+		slug = utils.Slugify(data.Name)
+	}
+	if slug == "" {
+		return models.Category{}, ErrInvalidSlug
+	}
+
+	if _, err := c.GetBySlug(slug); err == nil {
+		return models.Category{}, ErrCategoryExists
+	} else if err != ErrCategoryNotFound {
+		return models.Category{}, err
+	}
+
+	category := models.Category{
+		ID:        primitive.NewObjectID(),
+		Name:      data.Name,
+		Slug:      slug,
+		Ancestors: []primitive.ObjectID{},
+		Position:  data.Position,
+		CreatedAT: time.Now(),
+		UpdatedAT: time.Now(),
+	}
+
+	if data.Parent != "" {
+		parent, err := c.GetBySlug(data.Parent)
+		if err != nil {
+			return models.Category{}, err
+		}
+		category.ParentID = &parent.ID
+		category.Ancestors = append(append(category.Ancestors, parent.Ancestors...), parent.ID)
+	}
+
+	if _, err := c.col.InsertOne(c.ctx, category, options.InsertOne()); err != nil {
+		return models.Category{}, err
+	}
+	return category, nil
+}
+
+func (c *categoryService) UpdateCategory(id primitive.ObjectID, data types.UpdateCategory) (models.Category, error) {
+	category, err := c.findOne(bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	set := bson.D{{Key: "updatedAt", Value: time.Now()}}
+
+	if data.Name != nil {
+		set = append(set, bson.E{Key: "name", Value: *data.Name})
+	}
+
+	if data.Position != nil {
+		set = append(set, bson.E{Key: "position", Value: *data.Position})
+	}
+
+	if data.Slug != nil {
+		slug := utils.Slugify(*data.Slug)
+		if slug == "" {
+			return models.Category{}, ErrInvalidSlug
+		}
+		if existing, err := c.GetBySlug(slug); err == nil && existing.ID != id {
+			return models.Category{}, ErrCategoryExists
+		} else if err != nil && err != ErrCategoryNotFound {
+			return models.Category{}, err
+		}
+		set = append(set, bson.E{Key: "slug", Value: slug})
+	}
+
+	// a move rewrites the ancestors of the whole subtree and the category names of its products,
+	// they land together with the rest of the update or not at all
+	err = c.transact(func(sess_ctx mongo.SessionContext) error {
+		if data.Parent != nil {
+			if err := c.move(sess_ctx, category, *data.Parent); err != nil {
+				return err
+			}
+		}
+		if _, err := c.col.UpdateByID(sess_ctx, id, bson.D{{Key: "$set", Value: set}}, options.Update()); err != nil {
+			return err
+		}
+		if data.Name != nil || data.Parent != nil {
+			return c.resyncProducts(sess_ctx, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Category{}, err
+	}
+
+	return c.findOne(bson.D{{Key: "_id", Value: id}})
+}
+
+// move re-parents category under the category with parent_slug (or the root when it is empty)
+// and rewrites the ancestor list of every category below it. ctx should be the session context of a transaction.
+func (c *categoryService) move(ctx context.Context, category models.Category, parent_slug string) error {
+	var parent_id *primitive.ObjectID
+	ancestors := []primitive.ObjectID{}
+
+	if parent_slug != "" {
+		var parent models.Category
+		if err := c.col.FindOne(ctx, bson.D{{Key: "slug", Value: parent_slug}}).Decode(&parent); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+		if parent.ID == category.ID || containsID(parent.Ancestors, category.ID) {
+			return ErrCategoryCycle
+		}
+		parent_id = &parent.ID
+		ancestors = append(append(ancestors, parent.Ancestors...), parent.ID)
+	}
+
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "parentId", Value: parent_id}, {Key: "ancestors", Value: ancestors}}}}
+	if _, err := c.col.UpdateByID(ctx, category.ID, updateObj, options.Update()); err != nil {
+		return err
+	}
+
+	cursor, err := c.col.Find(ctx, bson.D{{Key: "ancestors", Value: category.ID}})
+	if err != nil {
+		return err
+	}
+	descendants := []models.Category{}
+	if err = cursor.All(ctx, &descendants); err != nil {
+		return err
+	}
+
+	for _, d := range descendants {
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "ancestors", Value: reparent(d.Ancestors, category.ID, ancestors)}}}}
+		if _, err := c.col.UpdateByID(ctx, d.ID, updateObj, options.Update()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reparent gives a category below moved the ancestors it has once moved sits under above: everything
+// below moved is kept and the part above it is swapped.
+func reparent(ancestors []primitive.ObjectID, moved primitive.ObjectID, above []primitive.ObjectID) []primitive.ObjectID {
+	idx := indexOfID(ancestors, moved)
+	return append(append(append([]primitive.ObjectID{}, above...), moved), ancestors[idx+1:]...)
+}
+
+// DeleteCategory removes a category without subcategories and takes it off its products in the same transaction.
+func (c *categoryService) DeleteCategory(id primitive.ObjectID) error {
+	return c.transact(func(sess_ctx mongo.SessionContext) error {
+		count, err := c.col.CountDocuments(sess_ctx, bson.D{{Key: "parentId", Value: id}})
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		result, err := c.col.DeleteOne(sess_ctx, bson.D{{Key: "_id", Value: id}}, options.Delete())
+		if err != nil {
+			return err
+		}
+
+		if result.DeletedCount == 0 {
+			return ErrCategoryNotFound
+		}
+
+		filter := bson.M{"categoryIds": id}
+		cursor, err := c.prod_col.Find(sess_ctx, filter, options.Find().SetProjection(bson.M{"categoryIds": 1}))
+		if err != nil {
+			return err
+		}
+
+		products := []models.Product{}
+		if err = cursor.All(sess_ctx, &products); err != nil {
+			return err
+		}
+
+		for _, product := range products {
+			ids := []primitive.ObjectID{}
+			for _, v := range product.CategoryIDs {
+				if v != id {
+					ids = append(ids, v)
+				}
+			}
+			names, err := c.searchNames(sess_ctx, ids)
+			if err != nil {
+				return err
+			}
+			updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "categoryIds", Value: ids}, {Key: "categoryNames", Value: names}}}}
+			if _, err = c.prod_col.UpdateByID(sess_ctx, product.ID, updateObj, options.Update()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *categoryService) transact(fn func(sess_ctx mongo.SessionContext) error) error {
+	session, err := c.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(c.ctx)
+
+	_, err = session.WithTransaction(c.ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sess_ctx)
+	})
+	return err
+}
+
+func (c *categoryService) GetBySlug(slug string) (models.Category, error) {
+	return c.findOne(bson.D{{Key: "slug", Value: slug}})
+}
+
+func (c *categoryService) GetByIDs(ids []primitive.ObjectID) ([]models.Category, error) {
+	if len(ids) == 0 {
+		return []models.Category{}, nil
+	}
+	return c.find(c.ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+}
+
+func (c *categoryService) GetTree() ([]*models.CategoryNode, error) {
+	categories, err := c.find(c.ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	return buildTree(categories), nil
+}
+
+// buildTree nests categories under their parents, siblings ordered by position then name.
+func buildTree(categories []models.Category) []*models.CategoryNode {
+	nodes := make(map[primitive.ObjectID]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*category.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	sortNodes(roots)
+	return roots
+}
+
+func (c *categoryService) SubtreeIDs(slug string) ([]primitive.ObjectID, error) {
+	category, err := c.GetBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	return c.subtree(c.ctx, category.ID)
+}
+
+func (c *categoryService) subtree(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	descendants, err := c.find(ctx, bson.D{{Key: "ancestors", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []primitive.ObjectID{id}
+	for _, d := range descendants {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// SearchNames returns the names of the given categories and of all their ancestors,
+// so searching for a parent category also matches products filed under its children.
+func (c *categoryService) SearchNames(ids []primitive.ObjectID) ([]string, error) {
+	return c.searchNames(c.ctx, ids)
+}
+
+func (c *categoryService) searchNames(ctx context.Context, ids []primitive.ObjectID) ([]string, error) {
+	names := []string{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	categories, err := c.find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	all := []primitive.ObjectID{}
+	for _, category := range categories {
+		for _, id := range append(category.Ancestors, category.ID) {
+			if !containsID(all, id) {
+				all = append(all, id)
+			}
+		}
+	}
+
+	categories, err = c.find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: all}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, category := range categories {
+		names = append(names, category.Name)
+	}
+	return names, nil
+}
+
+func (c *categoryService) SlugsByID() (map[primitive.ObjectID]string, error) {
+	categories, err := c.find(c.ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	slugs := make(map[primitive.ObjectID]string, len(categories))
+	for _, category := range categories {
+		slugs[category.ID] = category.Slug
+	}
+	return slugs, nil
+}
+
+// resyncProducts refreshes the denormalized category names of every product filed under the category's subtree.
+// ctx should be the session context of the transaction changing the category.
+func (c *categoryService) resyncProducts(ctx context.Context, id primitive.ObjectID) error {
+	ids, err := c.subtree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{Key: "categoryIds", Value: bson.D{{Key: "$in", Value: ids}}}}
+	opts := options.Find().SetProjection(bson.D{{Key: "categoryIds", Value: 1}})
+	cursor, err := c.prod_col.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	products := []models.Product{}
+	if err = cursor.All(ctx, &products); err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		names, err := c.searchNames(ctx, product.CategoryIDs)
+		if err != nil {
+			return err
+		}
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "categoryNames", Value: names}}}}
+		if _, err = c.prod_col.UpdateByID(ctx, product.ID, updateObj, options.Update()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *categoryService) ResolveSlugs(slugs []string) ([]primitive.ObjectID, error) {
+	ids := []primitive.ObjectID{}
+	if len(slugs) == 0 {
+		return ids, nil
+	}
+
+	categories, err := c.find(c.ctx, bson.D{{Key: "slug", Value: bson.D{{Key: "$in", Value: slugs}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]primitive.ObjectID{}
+	for _, category := range categories {
+		found[category.Slug] = category.ID
+	}
+
+	for _, slug := range slugs {
+		id, ok := found[slug]
+		if !ok {
+			return nil, ErrCategoryNotFound
+		}
+		if !containsID(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (c *categoryService) GetProducts(slug string, req pagination.Request) (models.Category, pagination.Page[models.Product], error) {
+	category, err := c.GetBySlug(slug)
+	if err != nil {
+		return models.Category{}, pagination.Page[models.Product]{}, err
+	}
+
+	ids, err := c.subtree(c.ctx, category.ID)
+	if err != nil {
+		return models.Category{}, pagination.Page[models.Product]{}, err
+	}
+
+	query := ProductQuery{CategoryIDs: ids, Limit: req.Limit, Cursor: req.Cursor}
+	if err = query.Validate(); err != nil {
+		return models.Category{}, pagination.Page[models.Product]{}, err
+	}
+
+	products, err := pagination.Aggregate(c.ctx, c.prod_col, query.Stages(), query.Request(), query.SortKey(), query.Key)
+	if err != nil {
+		return models.Category{}, pagination.Page[models.Product]{}, err
+	}
+
+	return category, pricedPage(products, query.At), nil
+}
+
+func (c *categoryService) AssignProduct(product_id primitive.ObjectID, user_id primitive.ObjectID, slugs []string) error {
+	ids, err := c.ResolveSlugs(slugs)
+	if err != nil {
+		return err
+	}
+
+	names, err := c.SearchNames(ids)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{Key: "_id", Value: product_id}, {Key: "userId", Value: user_id}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "categoryIds", Value: ids},
+		{Key: "categoryNames", Value: names},
+		{Key: "updatedAt", Value: time.Now()}}}}
+
+	result, err := c.prod_col.UpdateOne(c.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindProduct
+	}
+	return nil
+}
+
+func (c *categoryService) findOne(filter bson.D) (models.Category, error) {
+	var category models.Category
+	if err := c.col.FindOne(c.ctx, filter).Decode(&category); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Category{}, ErrCategoryNotFound
+		}
+		return models.Category{}, err
+	}
+	return category, nil
+}
+
+func (c *categoryService) find(ctx context.Context, filter bson.D) ([]models.Category, error) {
+	cursor, err := c.col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []models.Category{}
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func sortNodes(nodes []*models.CategoryNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Position == nodes[j].Position {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Position < nodes[j].Position
+	})
+
+	for _, node := range nodes {
+		sortNodes(node.Children)
+	}
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	return indexOfID(ids, id) >= 0
+}
+
+func indexOfID(ids []primitive.ObjectID, id primitive.ObjectID) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
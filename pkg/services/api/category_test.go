@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/types"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCategorySlugRequired(t *testing.T) {
+	c := NewCategoryService(context.Background(), nil, nil, nil)
+	_, err := c.CreateCategory(types.AddCategory{Name: "!!"})
+	require.ErrorIs(t, err, ErrInvalidSlug)
+}
+
+func TestReparent(t *testing.T) {
+	root, moved, child, target := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	// root > moved > child > here, moved goes under target
+	ancestors := reparent([]primitive.ObjectID{root, moved, child}, moved, []primitive.ObjectID{target})
+	require.Equal(t, []primitive.ObjectID{target, moved, child}, ancestors)
+
+	// and back to the top
+	ancestors = reparent(ancestors, moved, []primitive.ObjectID{})
+	require.Equal(t, []primitive.ObjectID{moved, child}, ancestors)
+}
+
+func TestBuildTree(t *testing.T) {
+	men, women, shoes := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tree := buildTree([]models.Category{
+		{ID: shoes, Name: "Shoes", ParentID: &women, Ancestors: []primitive.ObjectID{women}},
+		{ID: women, Name: "Women", Position: 1},
+		{ID: men, Name: "Men", Position: 1},
+		{ID: primitive.NewObjectID(), Name: "Sale"},
+	})
+
+	require.Len(t, tree, 3)
+	require.Equal(t, []string{"Sale", "Men", "Women"}, []string{tree[0].Name, tree[1].Name, tree[2].Name})
+	require.Len(t, tree[2].Children, 1)
+	require.Equal(t, "Shoes", tree[2].Children[0].Name)
+}
+
+func TestMoveCategory(t *testing.T) {
+	client, db := testDatabase(t)
+	c := NewCategoryService(context.Background(), client, db.Collection("categories"), db.Collection("products"))
+
+	clothing, err := c.CreateCategory(types.AddCategory{Name: "Clothing"})
+	require.NoError(t, err)
+	shirts, err := c.CreateCategory(types.AddCategory{Name: "Shirts", Parent: "clothing"})
+	require.NoError(t, err)
+	polos, err := c.CreateCategory(types.AddCategory{Name: "Polos", Parent: "shirts"})
+	require.NoError(t, err)
+	men, err := c.CreateCategory(types.AddCategory{Name: "Men"})
+	require.NoError(t, err)
+
+	parent := "men"
+	moved, err := c.UpdateCategory(shirts.ID, types.UpdateCategory{Parent: &parent})
+	require.NoError(t, err)
+	require.Equal(t, []primitive.ObjectID{men.ID}, moved.Ancestors)
+	polos, err = c.GetBySlug("polos")
+	require.NoError(t, err)
+	require.Equal(t, []primitive.ObjectID{men.ID, shirts.ID}, polos.Ancestors)
+
+	// nothing changes when the move is refused
+	parent = "polos"
+	name := "Tops"
+	_, err = c.UpdateCategory(shirts.ID, types.UpdateCategory{Name: &name, Parent: &parent})
+	require.ErrorIs(t, err, ErrCategoryCycle)
+	shirts, err = c.GetBySlug("shirts")
+	require.NoError(t, err)
+	require.Equal(t, "Shirts", shirts.Name)
+
+	slug := "!!"
+	_, err = c.UpdateCategory(clothing.ID, types.UpdateCategory{Slug: &slug})
+	require.ErrorIs(t, err, ErrInvalidSlug)
+
+	// a deleted category is taken off its products with it
+	product := models.Product{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+	_, err = db.Collection("products").InsertOne(context.Background(), product)
+	require.NoError(t, err)
+	require.NoError(t, c.AssignProduct(product.ID, product.UserID, []string{"polos", "men"}))
+	require.ErrorIs(t, c.DeleteCategory(shirts.ID), ErrCategoryHasChildren)
+	require.NoError(t, c.DeleteCategory(polos.ID))
+	require.NoError(t, db.Collection("products").FindOne(context.Background(), bson.D{{Key: "_id", Value: product.ID}}).Decode(&product))
+	require.Equal(t, []primitive.ObjectID{men.ID}, product.CategoryIDs)
+	require.Equal(t, []string{"Men"}, product.CategoryNames)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxIdempotencyKeyLength bounds the client supplied idempotency key.
+const MaxIdempotencyKeyLength = 255
+
+var (
+	ErrIdempotencyKeyRequired = errors.New("an Idempotency-Key header of at most 255 characters is required")
+	ErrCartChanged            = errors.New("cart no longer matches the catalog, check it before placing the order")
+	ErrOutOfStock             = errors.New("not enough stock left for a product in the cart")
+)
+
+type CheckoutService interface {
+	// Checkout places an order for the user's cart with the automatic promotions and the coupon, if any, delivered
+	// to the address of data and taxed for its region. Repeating a call with the same idempotency key returns the
+	// order placed by the first call, created is false in that case.
+	Checkout(user_id primitive.ObjectID, idempotency_key string, data types.Checkout) (order models.Order, created bool, err error)
+	// Quote lists the shipping options every seller in the user's cart offers for the address of data.
+	Quote(user_id primitive.ObjectID, data types.ShippingQuote) ([]models.ShippingQuote, error)
+}
+
+type checkoutService struct {
+	client     *mongo.Client
+	order_col  *mongo.Collection
+	sub_col    *mongo.Collection
+	prod_col   *mongo.Collection
+	cart_col   *mongo.Collection
+	numbers    *Numbers
+	promotions PromotionService
+	taxes      TaxService
+	shipping   ShippingService
+	ctx        context.Context
+}
+
+func NewCheckoutService(ctx context.Context, client *mongo.Client, order_col *mongo.Collection, sub_col *mongo.Collection, prod_col *mongo.Collection, cart_col *mongo.Collection, numbers *Numbers, promotions PromotionService, taxes TaxService, shipping ShippingService) CheckoutService {
+	return &checkoutService{
+		client:     client,
+		order_col:  order_col,
+		sub_col:    sub_col,
+		prod_col:   prod_col,
+		cart_col:   cart_col,
+		numbers:    numbers,
+		promotions: promotions,
+		taxes:      taxes,
+		shipping:   shipping,
+		ctx:        ctx,
+	}
+}
+
+// Checkout creates the order and its per-seller sub-orders, discounts, taxes, ships and numbers it, takes the ordered quantities out of
+// stock and empties the cart in one transaction, so either all of it happens or none of it does.
+func (c *checkoutService) Checkout(user_id primitive.ObjectID, idempotency_key string, data types.Checkout) (models.Order, bool, error) {
+	if idempotency_key == "" || len(idempotency_key) > MaxIdempotencyKeyLength {
+		return models.Order{}, false, ErrIdempotencyKeyRequired
+	}
+
+	session, err := c.client.StartSession()
+	if err != nil {
+		return models.Order{}, false, err
+	}
+	defer session.EndSession(c.ctx)
+
+	var order models.Order
+	var created bool
+	_, err = session.WithTransaction(c.ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+		order, created, err = c.placeOrder(sess_ctx, user_id, idempotency_key, data)
+		return nil, err
+	})
+
+	// a concurrent request with the same key committed first
+	if mongo.IsDuplicateKeyError(err) {
+		order, err = c.findOrder(c.ctx, user_id, idempotency_key)
+		return order, false, err
+	}
+	if err != nil {
+		return models.Order{}, false, err
+	}
+	return order, created, nil
+}
+
+func (c *checkoutService) placeOrder(ctx mongo.SessionContext, user_id primitive.ObjectID, idempotency_key string, data types.Checkout) (models.Order, bool, error) {
+	order, err := c.findOrder(ctx, user_id, idempotency_key)
+	if err == nil {
+		return order, false, nil
+	} else if err != ErrOrderNotFound {
+		return models.Order{}, false, err
+	}
+
+	address, err := c.shipping.Address(ctx, user_id, data.AddressID)
+	if err != nil {
+		return models.Order{}, false, err
+	}
+
+	now := time.Now()
+	cart, products, err := c.cart(ctx, user_id, now)
+	if err != nil {
+		return models.Order{}, false, err
+	}
+
+	order, err = newOrder(user_id, cart.Lines, now)
+	if err != nil {
+		return models.Order{}, false, err
+	}
+	order.IdempotencyKey = idempotency_key
+
+	if err = c.promotions.Apply(ctx, &order, data.Coupon, now); err != nil {
+		return models.Order{}, false, err
+	}
+	// taxed after the discounts, on what the buyer actually pays
+	if err = c.taxes.Apply(ctx, &order, products, address.Zone()); err != nil {
+		return models.Order{}, false, err
+	}
+	if err = c.shipping.Apply(ctx, &order, products, address, data.ShippingRates); err != nil {
+		return models.Order{}, false, err
+	}
+
+	for _, item := range order.Items {
+		// the stock filter keeps two checkouts from selling the same last unit
+		filter := bson.D{{Key: "_id", Value: item.ProductID}, {Key: "stock", Value: bson.D{{Key: "$gte", Value: item.Quantity}}}}
+		updateObj := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "stock", Value: -item.Quantity}, {Key: "sales", Value: item.Quantity}}},
+			{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+		}
+		result, err := c.prod_col.UpdateOne(ctx, filter, updateObj)
+		if err != nil {
+			return models.Order{}, false, err
+		}
+		if result.MatchedCount == 0 {
+			return models.Order{}, false, ErrOutOfStock
+		}
+	}
+
+	// taken last so the counters are locked for as short as possible
+	if order.Number, err = c.numbers.Next(ctx, NumberOrder, now); err != nil {
+		return models.Order{}, false, err
+	}
+	if order.InvoiceNumber, err = c.numbers.Next(ctx, NumberInvoice, now); err != nil {
+		return models.Order{}, false, err
+	}
+
+	subs, err := SplitOrder(order)
+	if err != nil {
+		return models.Order{}, false, err
+	}
+	for i := range subs {
+		if subs[i].Number, err = c.numbers.NextForSeller(ctx, subs[i].SellerID, NumberOrder, now); err != nil {
+			return models.Order{}, false, err
+		}
+		if subs[i].InvoiceNumber, err = c.numbers.NextForSeller(ctx, subs[i].SellerID, NumberInvoice, now); err != nil {
+			return models.Order{}, false, err
+		}
+	}
+
+	if _, err = c.order_col.InsertOne(ctx, order); err != nil {
+		return models.Order{}, false, err
+	}
+
+	docs := []interface{}{}
+	for _, sub := range subs {
+		docs = append(docs, sub)
+	}
+	if _, err = c.sub_col.InsertMany(ctx, docs); err != nil {
+		return models.Order{}, false, err
+	}
+	order.SubOrders = subs
+
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "lines", Value: bson.A{}}, {Key: "updatedAt", Value: now}}}}
+	if _, err = c.cart_col.UpdateOne(ctx, bson.D{{Key: "_id", Value: cart.ID}}, updateObj); err != nil {
+		return models.Order{}, false, err
+	}
+	return order, true, nil
+}
+
+func (c *checkoutService) Quote(user_id primitive.ObjectID, data types.ShippingQuote) ([]models.ShippingQuote, error) {
+	address, err := c.shipping.Address(c.ctx, user_id, data.AddressID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cart, products, err := c.cart(c.ctx, user_id, now)
+	if err != nil {
+		return nil, err
+	}
+	order, err := newOrder(user_id, cart.Lines, now)
+	if err != nil {
+		return nil, err
+	}
+	return c.shipping.Quote(c.ctx, order, products, address)
+}
+
+// cart reads the user's cart and the products in it, the cart has to match the catalog at now.
+func (c *checkoutService) cart(ctx context.Context, user_id primitive.ObjectID, now time.Time) (models.Cart, map[primitive.ObjectID]models.Product, error) {
+	var cart models.Cart
+	if err := c.cart_col.FindOne(ctx, bson.D{{Key: "userId", Value: user_id}}).Decode(&cart); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Cart{}, nil, ErrEmptyCart
+		}
+		return models.Cart{}, nil, err
+	}
+	if len(cart.Lines) == 0 {
+		return models.Cart{}, nil, ErrEmptyCart
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, line := range cart.Lines {
+		ids = append(ids, line.ProductID)
+	}
+	cursor, err := c.prod_col.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return models.Cart{}, nil, err
+	}
+	found := []models.Product{}
+	if err = cursor.All(ctx, &found); err != nil {
+		return models.Cart{}, nil, err
+	}
+	products := map[primitive.ObjectID]models.Product{}
+	for _, product := range found {
+		products[product.ID] = product
+	}
+
+	if issues := cartIssues(cart.Lines, products, now); len(issues) > 0 {
+		return models.Cart{}, nil, ErrCartChanged
+	}
+	return cart, products, nil
+}
+
+func (c *checkoutService) findOrder(ctx context.Context, user_id primitive.ObjectID, idempotency_key string) (models.Order, error) {
+	var order models.Order
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "idempotencyKey", Value: idempotency_key}}
+	if err := c.order_col.FindOne(ctx, filter).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Order{}, ErrOrderNotFound
+		}
+		return models.Order{}, err
+	}
+	return order, nil
+}
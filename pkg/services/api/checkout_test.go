@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type checkoutFixture struct {
+	s      CheckoutService
+	orders *mongo.Collection
+	subs   *mongo.Collection
+	prods  *mongo.Collection
+	carts  *mongo.Collection
+	users  *mongo.Collection
+}
+
+func newCheckoutFixture(t *testing.T) checkoutFixture {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+
+	orders := db.Collection("orders")
+	_, err := orders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+			bson.D{{Key: "idempotencyKey", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+	})
+	require.NoError(t, err)
+
+	carts := db.Collection("carts")
+	_, err = carts.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true)})
+	require.NoError(t, err)
+
+	prods := db.Collection("products")
+	subs := db.Collection("sub_orders")
+	users := db.Collection("users")
+	promotions := NewPromotionService(ctx, db.Collection("promotions"), db.Collection("promotion_redemptions"))
+	taxes := NewTaxService(ctx, db.Collection("tax_rules"), users, NewCategoryService(ctx, client, db.Collection("categories"), prods))
+	shipping := NewShippingService(ctx, db.Collection("delivery_zones"), users)
+	return checkoutFixture{
+		s:      NewCheckoutService(ctx, client, orders, subs, prods, carts, NewNumbers(ctx, db.Collection("counters"), "KS"), promotions, taxes, shipping),
+		orders: orders,
+		subs:   subs,
+		prods:  prods,
+		carts:  carts,
+		users:  users,
+	}
+}
+
+func (f checkoutFixture) product(t *testing.T, amount int64, stock int64) models.Product {
+	product := models.Product{
+		ID:     primitive.NewObjectID(),
+		UserID: primitive.NewObjectID(),
+		Name:   "Ankara shirt",
+		Price:  models.Money{Amount: amount, Currency: "NGN"},
+		Stock:  stock,
+		Status: StatusPublished,
+	}
+	_, err := f.prods.InsertOne(context.Background(), product)
+	require.NoError(t, err)
+
+	// the seller has no delivery zones and ships for free
+	_, err = f.users.InsertOne(context.Background(), models.User{ID: product.UserID, Currency: "NGN", FreeShipping: true})
+	require.NoError(t, err)
+	return product
+}
+
+func (f checkoutFixture) cart(t *testing.T, user_id primitive.ObjectID, product models.Product, quantity int64, unit_amount int64) {
+	line := cartLine(product, "", quantity, time.Now())
+	line.UnitPrice.Amount = unit_amount
+	_, err := f.carts.InsertOne(context.Background(), models.Cart{ID: primitive.NewObjectID(), UserID: user_id, Lines: []models.CartLine{line}})
+	require.NoError(t, err)
+
+	// the buyer needs somewhere to have the order delivered
+	address := models.Address{ID: primitive.NewObjectID(), Name: "Ada Obi", Line1: "1 Marina", City: "Lagos", Country: "NG", Region: "NG-LA", IsDefault: true}
+	updateObj := bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "addresses", Value: []models.Address{address}}}}}
+	_, err = f.users.UpdateOne(context.Background(), bson.D{{Key: "_id", Value: user_id}}, updateObj, options.Update().SetUpsert(true))
+	require.NoError(t, err)
+}
+
+func (f checkoutFixture) stock(t *testing.T, id primitive.ObjectID) (int64, int64) {
+	var product models.Product
+	require.NoError(t, f.prods.FindOne(context.Background(), bson.D{{Key: "_id", Value: id}}).Decode(&product))
+	return product.Stock, product.Sales
+}
+
+func (f checkoutFixture) countOrders(t *testing.T) int64 {
+	count, err := f.orders.CountDocuments(context.Background(), bson.D{})
+	require.NoError(t, err)
+	return count
+}
+
+func TestCheckoutIsIdempotent(t *testing.T) {
+	f := newCheckoutFixture(t)
+	user_id := primitive.NewObjectID()
+	product := f.product(t, 1000, 5)
+	f.cart(t, user_id, product, 2, 1000)
+
+	_, _, err := f.s.Checkout(user_id, "", types.Checkout{})
+	require.ErrorIs(t, err, ErrIdempotencyKeyRequired)
+
+	order, created, err := f.s.Checkout(user_id, "key-1", types.Checkout{})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, OrderPending, order.Status)
+	require.Equal(t, models.Money{Amount: 2000, Currency: "NGN"}, order.TotalPrice)
+
+	again, created, err := f.s.Checkout(user_id, "key-1", types.Checkout{})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, order.ID, again.ID)
+
+	require.Equal(t, int64(1), f.countOrders(t))
+	require.Len(t, order.SubOrders, 1)
+	require.Equal(t, product.UserID, order.SubOrders[0].SellerID)
+	count, err := f.subs.CountDocuments(context.Background(), bson.D{{Key: "orderId", Value: order.ID}})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	// the seller's part has numbers of its own, either finds the order
+	sub := order.SubOrders[0]
+	require.Equal(t, order.Number, sub.OrderNumber)
+	require.Regexp(t, `^KS-S\d+-\d{4}-000001$`, sub.Number)
+	require.Regexp(t, `^KS-S\d+-INV-\d{4}-000001$`, sub.InvoiceNumber)
+	orders := NewOrderService(context.Background(), nil, f.orders, f.subs, f.prods, nil, nil, nil)
+	for _, number := range []string{order.Number, order.InvoiceNumber, sub.Number, sub.InvoiceNumber} {
+		found, err := orders.BuyerOrderByNumber(number, user_id)
+		require.NoError(t, err)
+		require.Equal(t, order.ID, found.ID)
+	}
+	for _, number := range []string{order.Number, sub.Number, sub.InvoiceNumber} {
+		found, err := orders.SellerOrderByNumber(number, sub.SellerID)
+		require.NoError(t, err)
+		require.Equal(t, sub.ID, found.ID)
+	}
+
+	stock, sales := f.stock(t, product.ID)
+	require.Equal(t, int64(3), stock)
+	require.Equal(t, int64(2), sales)
+
+	var cart models.Cart
+	require.NoError(t, f.carts.FindOne(context.Background(), bson.D{{Key: "userId", Value: user_id}}).Decode(&cart))
+	require.Empty(t, cart.Lines)
+
+	_, _, err = f.s.Checkout(user_id, "key-2", types.Checkout{})
+	require.ErrorIs(t, err, ErrEmptyCart)
+}
+
+func TestCheckoutRejectsChangedCart(t *testing.T) {
+	f := newCheckoutFixture(t)
+	user_id := primitive.NewObjectID()
+	product := f.product(t, 1000, 5)
+	// the price went up after the line was added
+	f.cart(t, user_id, product, 1, 900)
+
+	_, _, err := f.s.Checkout(user_id, "key-1", types.Checkout{})
+	require.ErrorIs(t, err, ErrCartChanged)
+
+	require.Zero(t, f.countOrders(t))
+	stock, _ := f.stock(t, product.ID)
+	require.Equal(t, int64(5), stock)
+
+	var cart models.Cart
+	require.NoError(t, f.carts.FindOne(context.Background(), bson.D{{Key: "userId", Value: user_id}}).Decode(&cart))
+	require.Len(t, cart.Lines, 1)
+
+	// setting the quantity again takes the new price and the checkout goes through
+	carts := NewCartService(context.Background(), f.carts, f.prods)
+	cart, err = carts.SetQuantity(user_id, product.ID, "", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), cart.Lines[0].UnitPrice.Amount)
+
+	order, _, err := f.s.Checkout(user_id, "key-2", types.Checkout{})
+	require.NoError(t, err)
+	require.Equal(t, models.Money{Amount: 1000, Currency: "NGN"}, order.TotalPrice)
+}
+
+func TestCheckoutConcurrentRetries(t *testing.T) {
+	f := newCheckoutFixture(t)
+	user_id := primitive.NewObjectID()
+	product := f.product(t, 1000, 5)
+	f.cart(t, user_id, product, 1, 1000)
+
+	ids := make([]primitive.ObjectID, 5)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			order, _, err := f.s.Checkout(user_id, "key-1", types.Checkout{})
+			require.NoError(t, err)
+			ids[i] = order.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		require.Equal(t, ids[0], id)
+	}
+	require.Equal(t, int64(1), f.countOrders(t))
+	stock, _ := f.stock(t, product.ID)
+	require.Equal(t, int64(4), stock)
+}
+
+func TestCheckoutLastUnit(t *testing.T) {
+	f := newCheckoutFixture(t)
+	product := f.product(t, 1000, 1)
+	buyers := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	for _, buyer := range buyers {
+		f.cart(t, buyer, product, 1, 1000)
+	}
+
+	var mu sync.Mutex
+	placed := 0
+	var wg sync.WaitGroup
+	for _, buyer := range buyers {
+		wg.Add(1)
+		go func(buyer primitive.ObjectID) {
+			defer wg.Done()
+			_, _, err := f.s.Checkout(buyer, "key-1", types.Checkout{})
+			if err == nil {
+				mu.Lock()
+				placed++
+				mu.Unlock()
+				return
+			}
+			// losers either fail the stock update or already see the product sold out
+			require.Contains(t, []error{ErrOutOfStock, ErrCartChanged}, err)
+		}(buyer)
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, placed)
+	stock, _ := f.stock(t, product.ID)
+	require.Zero(t, stock)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Transactions need a replica set, e.g. `make mongo-replset` and
+// KAMOUSHOP_TEST_MONGO_URI=mongodb://localhost:27017/?replicaSet=rs0 go test ./pkg/services/api/
+const testMongoURIEnv = "KAMOUSHOP_TEST_MONGO_URI"
+
+// testDatabase gives the test a database of its own on the replica set, dropped once the test is done.
+// The test is skipped when no replica set is configured.
+func testDatabase(t *testing.T) (*mongo.Client, *mongo.Database) {
+	uri := os.Getenv(testMongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, skipping tests against a replica set", testMongoURIEnv)
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+
+	db := client.Database("kamoushop_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		require.NoError(t, db.Drop(ctx))
+		require.NoError(t, client.Disconnect(ctx))
+	})
+	return client, db
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"kamoushop/pkg/models"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultGuestCartTTL is how long an untouched guest cart is kept when no TTL is configured.
+const DefaultGuestCartTTL = 7 * 24 * time.Hour
+
+var ErrInvalidCartToken = errors.New("invalid cart token")
+
+// GuestCartService keeps the carts of visitors who are not signed in. A guest cart is
+// identified by a signed token the client sends back, and expires when left untouched.
+type GuestCartService interface {
+	NewToken() (string, error)
+	GetCart(cart_token string) (models.Cart, error)
+	AddItem(cart_token string, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error)
+	SetQuantity(cart_token string, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error)
+	RemoveLine(cart_token string, product_id primitive.ObjectID, variant string) (models.Cart, error)
+	Merge(cart_token string, user_id primitive.ObjectID) (models.Cart, error)
+}
+
+type guestCartService struct {
+	redis_client *redis.Client
+	prod_col     *mongo.Collection
+	carts        CartService
+	key          []byte
+	ttl          time.Duration
+	ctx          context.Context
+}
+
+func NewGuestCartService(ctx context.Context, redis_client *redis.Client, prod_col *mongo.Collection, carts CartService, key string, ttl time.Duration) GuestCartService {
+	if ttl <= 0 {
+		ttl = DefaultGuestCartTTL
+	}
+	return &guestCartService{
+		redis_client: redis_client,
+		prod_col:     prod_col,
+		carts:        carts,
+		key:          []byte(key),
+		ttl:          ttl,
+		ctx:          ctx,
+	}
+}
+
+// NewToken issues the token of a new, empty guest cart.
+func (g *guestCartService) NewToken() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return signCartID(g.key, hex.EncodeToString(id)), nil
+}
+
+func (g *guestCartService) GetCart(cart_token string) (models.Cart, error) {
+	id, err := verifyCartToken(g.key, cart_token)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	lines, err := g.load(g.redis_client, guestCartKey(id))
+	if err != nil {
+		return models.Cart{}, err
+	}
+	return guestCart(lines), nil
+}
+
+func (g *guestCartService) AddItem(cart_token string, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error) {
+	if quantity < 1 {
+		return models.Cart{}, ErrInvalidQuantity
+	}
+
+	product, err := findPublished(g.ctx, g.prod_col, product_id)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if err = checkLine(product, variant, quantity); err != nil {
+		return models.Cart{}, err
+	}
+
+	line := cartLine(product, variant, quantity, time.Now())
+	return g.modify(cart_token, func(lines []models.CartLine) ([]models.CartLine, error) {
+		lines = addCartLine(lines, line)
+		return lines, checkLine(product, variant, lineQuantity(lines, product_id, variant))
+	})
+}
+
+// SetQuantity sets how many units of a line the guest wants, zero removes the line.
+func (g *guestCartService) SetQuantity(cart_token string, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error) {
+	if quantity < 0 {
+		return models.Cart{}, ErrInvalidQuantity
+	}
+	if quantity > 0 {
+		product, err := findPublished(g.ctx, g.prod_col, product_id)
+		if err != nil {
+			return models.Cart{}, err
+		}
+		if err = checkLine(product, variant, quantity); err != nil {
+			return models.Cart{}, err
+		}
+	}
+	return g.modify(cart_token, func(lines []models.CartLine) ([]models.CartLine, error) {
+		return setCartLine(lines, product_id, variant, quantity)
+	})
+}
+
+func (g *guestCartService) RemoveLine(cart_token string, product_id primitive.ObjectID, variant string) (models.Cart, error) {
+	return g.SetQuantity(cart_token, product_id, variant, 0)
+}
+
+// Merge moves the guest cart into the user's cart and forgets it. Lines are re-priced on the
+// way and lines whose product is no longer sold are dropped. The guest cart is taken out of
+// redis before anything is added, so a merge sent twice moves the lines once.
+func (g *guestCartService) Merge(cart_token string, user_id primitive.ObjectID) (models.Cart, error) {
+	id, err := verifyCartToken(g.key, cart_token)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	key := guestCartKey(id)
+	lines := []models.CartLine{}
+	data, err := g.redis_client.GetDel(g.ctx, key).Bytes()
+	if err != nil && err != redis.Nil {
+		return models.Cart{}, err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &lines); err != nil {
+			return models.Cart{}, err
+		}
+	}
+
+	for i, line := range lines {
+		_, err := g.carts.AddItem(user_id, line.ProductID, line.Variant, line.Quantity)
+		if err != nil && !unsellable(err) {
+			g.restore(key, lines[i:])
+			return models.Cart{}, err
+		}
+	}
+
+	return g.carts.GetCart(user_id)
+}
+
+// restore puts back the lines a failed merge did not move, unless the guest cart was used again meanwhile.
+func (g *guestCartService) restore(key string, lines []models.CartLine) {
+	data, err := json.Marshal(lines)
+	if err != nil {
+		log.Printf("cannot restore guest cart %s: %v", key, err)
+		return
+	}
+	if err = g.redis_client.SetNX(g.ctx, key, data, g.ttl).Err(); err != nil {
+		log.Printf("cannot restore guest cart %s: %v", key, err)
+	}
+}
+
+// modify applies change to the stored lines, retrying when another request changed the cart meanwhile.
+func (g *guestCartService) modify(cart_token string, change func([]models.CartLine) ([]models.CartLine, error)) (models.Cart, error) {
+	id, err := verifyCartToken(g.key, cart_token)
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	key := guestCartKey(id)
+	var lines []models.CartLine
+	update := func(tx *redis.Tx) error {
+		current, err := g.load(tx, key)
+		if err != nil {
+			return err
+		}
+		if lines, err = change(current); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(lines)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(g.ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(g.ctx, key, data, g.ttl)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		err = g.redis_client.Watch(g.ctx, update, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return models.Cart{}, err
+	}
+	return guestCart(lines), nil
+}
+
+func (g *guestCartService) load(client redis.Cmdable, key string) ([]models.CartLine, error) {
+	lines := []models.CartLine{}
+	data, err := client.Get(g.ctx, key).Bytes()
+	if err == redis.Nil {
+		return lines, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func guestCartKey(id string) string {
+	return "guest_cart:" + id
+}
+
+func guestCart(lines []models.CartLine) models.Cart {
+	if lines == nil {
+		lines = []models.CartLine{}
+	}
+	return models.Cart{Lines: lines, Totals: cartTotals(lines)}
+}
+
+// signCartID returns the token for a cart id, the id followed by its HMAC so clients can't guess other carts.
+func signCartID(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyCartToken(key []byte, cart_token string) (string, error) {
+	id, _, ok := strings.Cut(cart_token, ".")
+	if !ok || id == "" {
+		return "", ErrInvalidCartToken
+	}
+	if !hmac.Equal([]byte(signCartID(key, id)), []byte(cart_token)) {
+		return "", ErrInvalidCartToken
+	}
+	return id, nil
+}
+
+// addCartLine adds line to lines, raising the quantity when the product and variant are already there.
+func addCartLine(lines []models.CartLine, line models.CartLine) []models.CartLine {
+	for i := range lines {
+		if lines[i].ProductID == line.ProductID && lines[i].Variant == line.Variant {
+			lines[i].Quantity += line.Quantity
+			return lines
+		}
+	}
+	return append(lines, line)
+}
+
+// lineQuantity is the quantity of the line for the product and variant, 0 when there is none.
+func lineQuantity(lines []models.CartLine, product_id primitive.ObjectID, variant string) int64 {
+	for _, line := range lines {
+		if line.ProductID == product_id && line.Variant == variant {
+			return line.Quantity
+		}
+	}
+	return 0
+}
+
+// setCartLine sets the quantity of a line, zero removes it.
+func setCartLine(lines []models.CartLine, product_id primitive.ObjectID, variant string, quantity int64) ([]models.CartLine, error) {
+	for i := range lines {
+		if lines[i].ProductID != product_id || lines[i].Variant != variant {
+			continue
+		}
+		if quantity == 0 {
+			return append(lines[:i], lines[i+1:]...), nil
+		}
+		lines[i].Quantity = quantity
+		return lines, nil
+	}
+	return nil, ErrLineNotFound
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"kamoushop/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartToken(t *testing.T) {
+	key := []byte("secret")
+	cart_token := signCartID(key, "abc123")
+
+	id, err := verifyCartToken(key, cart_token)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", id)
+
+	for _, forged := range []string{"", "abc123", "abc123.", ".abc", signCartID([]byte("other"), "abc123"), "abc124" + cart_token[6:]} {
+		_, err = verifyCartToken(key, forged)
+		require.ErrorIs(t, err, ErrInvalidCartToken, forged)
+	}
+}
+
+func TestGuestCartLines(t *testing.T) {
+	shirt, mug := primitive.NewObjectID(), primitive.NewObjectID()
+
+	lines := addCartLine(nil, models.CartLine{ProductID: shirt, Variant: "size:M", Quantity: 1})
+	lines = addCartLine(lines, models.CartLine{ProductID: shirt, Variant: "size:L", Quantity: 1})
+	lines = addCartLine(lines, models.CartLine{ProductID: shirt, Variant: "size:M", Quantity: 2})
+	lines = addCartLine(lines, models.CartLine{ProductID: mug, Quantity: 1})
+	require.Len(t, lines, 3)
+	require.Equal(t, int64(3), lines[0].Quantity)
+
+	lines, err := setCartLine(lines, mug, "", 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), lines[2].Quantity)
+
+	lines, err = setCartLine(lines, shirt, "size:L", 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	require.Equal(t, mug, lines[1].ProductID)
+
+	_, err = setCartLine(lines, shirt, "size:L", 1)
+	require.ErrorIs(t, err, ErrLineNotFound)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"kamoushop/pkg/libs"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type InvoiceService interface {
+	// Invoice writes the pdf invoice of one of the buyer's orders to buf.
+	Invoice(order_id primitive.ObjectID, user_id primitive.ObjectID, buf *bytes.Buffer) (models.Order, error)
+	// SendConfirmation emails the buyer that their order was placed, with the invoice attached.
+	// Nothing is sent when no mailer is configured.
+	SendConfirmation(order_id primitive.ObjectID) error
+}
+
+type invoiceService struct {
+	user_col *mongo.Collection
+	orders   OrderService
+	shop     libs.InvoiceShop
+	mailer   *libs.Mailer
+	ctx      context.Context
+}
+
+func NewInvoiceService(ctx context.Context, user_col *mongo.Collection, orders OrderService, shop libs.InvoiceShop, mailer *libs.Mailer) InvoiceService {
+	return &invoiceService{
+		user_col: user_col,
+		orders:   orders,
+		shop:     shop,
+		mailer:   mailer,
+		ctx:      ctx,
+	}
+}
+
+func (i *invoiceService) Invoice(order_id primitive.ObjectID, user_id primitive.ObjectID, buf *bytes.Buffer) (models.Order, error) {
+	order, err := i.orders.BuyerOrder(order_id, user_id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if err = i.render(order, buf); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+func (i *invoiceService) SendConfirmation(order_id primitive.ObjectID) error {
+	if i.mailer == nil {
+		return nil
+	}
+
+	order, err := i.orders.GetOrder(order_id)
+	if err != nil {
+		return err
+	}
+	buyer, err := i.user(order.UserID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = i.render(order, &buf); err != nil {
+		return err
+	}
+
+	return i.mailer.Send(libs.Mail{
+		To:      buyer.Email,
+		Subject: fmt.Sprintf("Your %s order %s", i.shop.Name, orderReference(order)),
+		Body: fmt.Sprintf("Hi %s,\n\nthanks for your order. We received it on %s, the total is %s.\nYour invoice is attached.\n\n%s\n",
+			strings.TrimSpace(buyer.FirstName), order.CreatedAT.Format("2 January 2006"), money.Format(order.TotalPrice), i.shop.Name),
+		Attachments: []libs.Attachment{{Name: InvoiceFilename(order), ContentType: "application/pdf", Data: buf.Bytes()}},
+	})
+}
+
+func (i *invoiceService) render(order models.Order, buf *bytes.Buffer) error {
+	buyer, err := i.user(order.UserID)
+	if err != nil {
+		return err
+	}
+	sellers, err := i.brands(order.SellerIDs)
+	if err != nil {
+		return err
+	}
+
+	invoice, err := newInvoice(order, buyer, sellers, i.shop)
+	if err != nil {
+		return err
+	}
+	return libs.GenerateInvoicePdf(invoice, buf)
+}
+
+func (i *invoiceService) user(id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	if err := i.user_col.FindOne(i.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&user); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// brands looks up the brand names of sellers, sellers without one are left out.
+func (i *invoiceService) brands(seller_ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	brands := map[primitive.ObjectID]string{}
+	if len(seller_ids) == 0 {
+		return brands, nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: seller_ids}}}}
+	cursor, err := i.user_col.Find(i.ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	sellers := []models.User{}
+	if err = cursor.All(i.ctx, &sellers); err != nil {
+		return nil, err
+	}
+	for _, seller := range sellers {
+		if seller.BrandName != "" {
+			brands[seller.ID] = seller.BrandName
+		}
+	}
+	return brands, nil
+}
+
+// InvoiceNumber is the number printed on the invoice of an order, orders the numbering
+// migration hasn't reached yet fall back to their id.
+func InvoiceNumber(order models.Order) string {
+	if order.InvoiceNumber != "" {
+		return order.InvoiceNumber
+	}
+	return "INV-" + strings.ToUpper(order.ID.Hex())
+}
+
+// orderReference is how the order is referred to on paper, its number once it has one.
+func orderReference(order models.Order) string {
+	if order.Number != "" {
+		return order.Number
+	}
+	return order.ID.Hex()
+}
+
+func InvoiceFilename(order models.Order) string {
+	return "invoice-" + strings.ToLower(InvoiceNumber(order)) + ".pdf"
+}
+
+// newInvoice lays out an order as an invoice, sellers maps seller ids to their brand names.
+func newInvoice(order models.Order, buyer models.User, sellers map[primitive.ObjectID]string, shop libs.InvoiceShop) (libs.Invoice, error) {
+	currency := order.TotalPrice.Currency
+	items := []libs.InvoiceItem{}
+	totals := []models.Money{}
+	// orders placed before promotions and taxes have no currency on these
+	discount, tax, included := int64(0), int64(0), int64(0)
+	for _, item := range order.Items {
+		title := item.Name
+		if item.Variant != "" {
+			title += " - " + item.Variant
+		}
+		items = append(items, libs.InvoiceItem{
+			Title:    title,
+			Seller:   sellers[item.SellerID],
+			Quantity: item.Quantity,
+			Price:    item.UnitPrice,
+			Discount: money.New(item.Discount.Amount, currency),
+			Tax:      money.New(item.Tax.Amount, currency),
+			Total:    item.Total,
+		})
+		totals = append(totals, money.Multiply(item.UnitPrice, item.Quantity))
+		discount += item.Discount.Amount
+		if item.TaxIncluded {
+			included += item.Tax.Amount
+		} else {
+			tax += item.Tax.Amount
+		}
+	}
+
+	subtotal, err := money.Sum(currency, totals...)
+	if err != nil {
+		return libs.Invoice{}, err
+	}
+
+	return libs.Invoice{
+		Number:   InvoiceNumber(order),
+		OrderID:  orderReference(order),
+		IssuedAt: order.CreatedAT,
+		Shop:     shop,
+		Customer: libs.InvoiceCustomer{
+			Name:    strings.TrimSpace(buyer.FirstName + " " + buyer.LastName),
+			Email:   buyer.Email,
+			Phone:   buyer.PhoneNO,
+			Address: addressLines(order.ShippingAddress),
+		},
+		Items:       items,
+		Subtotal:    subtotal,
+		Discount:    money.New(discount, currency),
+		Tax:         money.New(tax, currency),
+		IncludedTax: money.New(included, currency),
+		Shipping:    money.New(order.Shipping.Amount, currency),
+		Total:       order.TotalPrice,
+	}, nil
+}
+
+// addressLines prints address the way it goes on a parcel, orders placed before the address book have none.
+func addressLines(address *models.Address) string {
+	if address == nil {
+		return ""
+	}
+	lines := []string{}
+	for _, line := range []string{address.Name, address.Line1, address.Line2, strings.TrimSpace(address.City + " " + address.PostalCode), address.Zone()} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"kamoushop/pkg/libs"
+	"kamoushop/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewInvoice(t *testing.T) {
+	seller := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	order := models.Order{
+		ID: primitive.NewObjectID(),
+		Items: []models.OrderItem{
+			{SellerID: seller, Name: "Shirt", Variant: "L", Quantity: 2, UnitPrice: models.Money{Amount: 5000, Currency: "NGN"},
+				Tax: models.Money{Amount: 750, Currency: "NGN"}, Total: models.Money{Amount: 10750, Currency: "NGN"}},
+			// the mug's seller prices include tax
+			{SellerID: other, Name: "Mug", Quantity: 1, UnitPrice: models.Money{Amount: 1500, Currency: "NGN"},
+				Tax: models.Money{Amount: 105, Currency: "NGN"}, TaxIncluded: true, Total: models.Money{Amount: 1500, Currency: "NGN"}},
+		},
+		TotalPrice: models.Money{Amount: 12250, Currency: "NGN"},
+		CreatedAT:  time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	buyer := models.User{FirstName: "Ada", LastName: "Obi", Email: "ada@example.com"}
+	shop := libs.InvoiceShop{Name: "Kamou Shop"}
+
+	invoice, err := newInvoice(order, buyer, map[primitive.ObjectID]string{seller: "Ada Prints"}, shop)
+	require.NoError(t, err)
+	require.Equal(t, InvoiceNumber(order), invoice.Number)
+	require.Equal(t, order.CreatedAT, invoice.IssuedAt)
+	require.Equal(t, "Ada Obi", invoice.Customer.Name)
+	require.Len(t, invoice.Items, 2)
+	require.Equal(t, "Shirt - L", invoice.Items[0].Title)
+	require.Equal(t, "Ada Prints", invoice.Items[0].Seller)
+	require.Empty(t, invoice.Items[1].Seller)
+	require.Equal(t, models.Money{Amount: 11500, Currency: "NGN"}, invoice.Subtotal)
+	require.Equal(t, models.Money{Amount: 750, Currency: "NGN"}, invoice.Tax)
+	require.Equal(t, models.Money{Amount: 105, Currency: "NGN"}, invoice.IncludedTax)
+	require.Equal(t, order.TotalPrice, invoice.Total)
+}
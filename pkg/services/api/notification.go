@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/pagination"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	NotifyPriceDrop   = "price_drop"
+	NotifyBackInStock = "back_in_stock"
+	NotifyOrderStatus = "order_status"
+	NotifyReturn      = "return"
+)
+
+var ErrNotificationNotFound = errors.New("can't find notification")
+
+type NotificationService interface {
+	Notify(notifications ...models.Notification) error
+	List(user_id primitive.ObjectID, unread_only bool, req pagination.Request) (pagination.Page[models.Notification], error)
+	MarkRead(id primitive.ObjectID, user_id primitive.ObjectID) error
+	MarkAllRead(user_id primitive.ObjectID) (int64, error)
+}
+
+type notificationService struct {
+	col *mongo.Collection
+	ctx context.Context
+}
+
+func NewNotificationService(ctx context.Context, col *mongo.Collection) NotificationService {
+	return &notificationService{
+		col: col,
+		ctx: ctx,
+	}
+}
+
+// Notify stores notifications for their users, ID and CreatedAT are filled in when missing.
+func (n *notificationService) Notify(notifications ...models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(notifications))
+	for _, notification := range notifications {
+		if notification.ID.IsZero() {
+			notification.ID = primitive.NewObjectID()
+		}
+		if notification.CreatedAT.IsZero() {
+			notification.CreatedAT = time.Now()
+		}
+		docs = append(docs, notification)
+	}
+
+	_, err := n.col.InsertMany(n.ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// List returns the user's notifications, newest first.
+func (n *notificationService) List(user_id primitive.ObjectID, unread_only bool, req pagination.Request) (pagination.Page[models.Notification], error) {
+	filter := bson.D{{Key: "userId", Value: user_id}}
+	if unread_only {
+		filter = append(filter, bson.E{Key: "read", Value: false})
+	}
+
+	key := func(notification models.Notification) (interface{}, primitive.ObjectID) {
+		return notification.ID, notification.ID
+	}
+	return pagination.Find(n.ctx, n.col, filter, req, pagination.Sort{Field: "_id", Desc: true}, key)
+}
+
+func (n *notificationService) MarkRead(id primitive.ObjectID, user_id primitive.ObjectID) error {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}}
+
+	result, err := n.col.UpdateOne(n.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (n *notificationService) MarkAllRead(user_id primitive.ObjectID) (int64, error) {
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "read", Value: false}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}}
+
+	result, err := n.col.UpdateMany(n.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
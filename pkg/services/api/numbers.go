@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	NumberOrder   = "orders"
+	NumberInvoice = "invoices"
+)
+
+// Numbers hands out the human readable order and invoice numbers of a shop, e.g. KS-2026-000123,
+// and of each seller's part of an order, e.g. KS-S12-2026-000045 for the seller coded S12.
+// The shop and every seller have their own sequence per kind and year in the counters collection.
+// A number is only gap-free when it is taken in the transaction that stores it: aborting the
+// transaction gives it back and concurrent transactions conflict on the counter instead of sharing a number.
+type Numbers struct {
+	col  *mongo.Collection
+	shop string
+	ctx  context.Context
+}
+
+func NewNumbers(ctx context.Context, col *mongo.Collection, shop string) *Numbers {
+	return &Numbers{col: col, shop: shop, ctx: ctx}
+}
+
+// Next takes the next number of kind of the shop for the year of now, ctx should be a session context.
+func (n *Numbers) Next(ctx context.Context, kind string, now time.Time) (string, error) {
+	return n.next(ctx, n.shop, n.shop, kind, now)
+}
+
+// NextForSeller takes the next number of kind in the seller's own sequence, ctx should be a session context.
+func (n *Numbers) NextForSeller(ctx context.Context, seller_id primitive.ObjectID, kind string, now time.Time) (string, error) {
+	code, err := n.sellerCode(seller_id)
+	if err != nil {
+		return "", err
+	}
+	return n.next(ctx, n.shop+":"+seller_id.Hex(), n.shop+"-"+code, kind, now)
+}
+
+// next takes the next number of the sequence of kind under counter, numbers start with prefix.
+func (n *Numbers) next(ctx context.Context, counter string, prefix string, kind string, now time.Time) (string, error) {
+	year := now.UTC().Year()
+	filter := bson.D{{Key: "_id", Value: fmt.Sprintf("%s:%s:%d", counter, kind, year)}}
+
+	seq, err := n.increment(ctx, filter)
+	if err != nil {
+		return "", err
+	}
+	if kind == NumberInvoice {
+		prefix += "-INV"
+	}
+	return FormatNumber(prefix, year, seq), nil
+}
+
+func (n *Numbers) increment(ctx context.Context, filter bson.D) (int64, error) {
+	// the counter is created outside the transaction: two transactions creating it would fail
+	// on its key, while two incrementing it conflict and are retried
+	create := bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "seq", Value: 0}}}}
+	if _, err := n.col.UpdateOne(n.ctx, filter, create, options.Update().SetUpsert(true)); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return 0, err
+	}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	updateObj := bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: 1}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := n.col.FindOneAndUpdate(ctx, filter, updateObj, opts).Decode(&counter); err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
+
+// sellerCode is the short code a seller's numbers start with, sellers are coded S1, S2, ... the
+// first time they are numbered. It is given outside any transaction, a code taken by a
+// transaction that aborts is kept.
+func (n *Numbers) sellerCode(seller_id primitive.ObjectID) (string, error) {
+	key := fmt.Sprintf("%s:seller:%s", n.shop, seller_id.Hex())
+	var seller struct {
+		Code int64 `bson:"code"`
+	}
+	err := n.col.FindOne(n.ctx, bson.D{{Key: "_id", Value: key}}).Decode(&seller)
+	if err == nil {
+		return fmt.Sprintf("S%d", seller.Code), nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return "", err
+	}
+
+	code, err := n.increment(n.ctx, bson.D{{Key: "_id", Value: n.shop + ":sellers"}})
+	if err != nil {
+		return "", err
+	}
+	_, err = n.col.InsertOne(n.ctx, bson.D{{Key: "_id", Value: key}, {Key: "code", Value: code}})
+	if mongo.IsDuplicateKeyError(err) {
+		// coded by a concurrent call, the code taken here is skipped
+		return n.sellerCode(seller_id)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("S%d", code), nil
+}
+
+// FormatNumber renders the seq-th number of a year, padded to six digits so numbers sort as text.
+func FormatNumber(prefix string, year int, seq int64) string {
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, seq)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFormatNumber(t *testing.T) {
+	require.Equal(t, "KS-2026-000123", FormatNumber("KS", 2026, 123))
+	require.Equal(t, "KS-INV-2026-000001", FormatNumber("KS-INV", 2026, 1))
+	// past a million the number just grows
+	require.Equal(t, "KS-2026-1234567", FormatNumber("KS", 2026, 1234567))
+}
+
+func TestNumbersAreGapFree(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	numbers := NewNumbers(ctx, db.Collection("counters"), "KS")
+	now := time.Now()
+
+	// every third transaction is aborted after taking its number
+	errAbort := errors.New("abort")
+	take := func(i int) (string, error) {
+		session, err := client.StartSession()
+		if err != nil {
+			return "", err
+		}
+		defer session.EndSession(ctx)
+
+		number, err := session.WithTransaction(ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+			number, err := numbers.Next(sess_ctx, NumberOrder, now)
+			if err != nil {
+				return nil, err
+			}
+			if i%3 == 0 {
+				return nil, errAbort
+			}
+			return number, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return number.(string), nil
+	}
+
+	var mu sync.Mutex
+	taken := []string{}
+	var wg sync.WaitGroup
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			number, err := take(i)
+			if i%3 == 0 {
+				require.ErrorIs(t, err, errAbort)
+				return
+			}
+			require.NoError(t, err)
+			mu.Lock()
+			taken = append(taken, number)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	// concurrent transactions neither share a number nor skip one, aborted ones give theirs back
+	sort.Strings(taken)
+	require.Len(t, taken, 6)
+	for i := range taken {
+		require.Equal(t, fmt.Sprintf("KS-%d-%06d", now.UTC().Year(), i+1), taken[i])
+	}
+}
+
+func TestSellerNumbers(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+	numbers := NewNumbers(ctx, db.Collection("counters"), "KS")
+	year := time.Now().UTC().Year()
+	shop_a, shop_b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	// every seller counts their own orders and invoices, apart from the shop's
+	take := func(seller_id primitive.ObjectID, kind string) string {
+		number, err := numbers.NextForSeller(ctx, seller_id, kind, time.Now())
+		require.NoError(t, err)
+		return number
+	}
+	require.Equal(t, fmt.Sprintf("KS-S1-%d-000001", year), take(shop_a, NumberOrder))
+	require.Equal(t, fmt.Sprintf("KS-S2-%d-000001", year), take(shop_b, NumberOrder))
+	require.Equal(t, fmt.Sprintf("KS-S1-%d-000002", year), take(shop_a, NumberOrder))
+	require.Equal(t, fmt.Sprintf("KS-S2-INV-%d-000001", year), take(shop_b, NumberInvoice))
+
+	number, err := numbers.Next(ctx, NumberOrder, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("KS-%d-000001", year), number)
+}
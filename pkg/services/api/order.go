@@ -0,0 +1,536 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OrderPending    = "pending"
+	OrderPaid       = "paid"
+	OrderProcessing = "processing"
+	OrderShipped    = "shipped"
+	OrderDelivered  = "delivered"
+	OrderCancelled  = "cancelled"
+	OrderRefunded   = "refunded"
+	// orders placed before orders had items, they can't be paid or fulfilled
+	OrderLegacy = "legacy"
+)
+
+var (
+	ErrOrderNotFound          = errors.New("can't find order")
+	ErrInvalidOrderStatus     = errors.New("status must be one of pending, paid, processing, shipped, delivered, cancelled, refunded or legacy")
+	ErrInvalidOrderTransition = errors.New("order cannot move to that status from its current one")
+	ErrSubOrderNotFound       = errors.New("can't find sub-order")
+)
+
+// orderTransitions lists the statuses an order may move to from each status,
+// cancelled, refunded and legacy orders are final.
+var orderTransitions = map[string][]string{
+	OrderPending:    {OrderPaid, OrderCancelled},
+	OrderPaid:       {OrderProcessing, OrderCancelled, OrderRefunded},
+	OrderProcessing: {OrderShipped, OrderCancelled, OrderRefunded},
+	OrderShipped:    {OrderDelivered, OrderRefunded},
+	OrderDelivered:  {OrderRefunded},
+	OrderCancelled:  {},
+	OrderRefunded:   {},
+	OrderLegacy:     {},
+}
+
+func CanOrderTransition(from string, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func checkOrderTransition(from string, to string) error {
+	if _, ok := orderTransitions[to]; !ok {
+		return ErrInvalidOrderStatus
+	}
+	if !CanOrderTransition(from, to) {
+		return ErrInvalidOrderTransition
+	}
+	return nil
+}
+
+// orderProgress ranks the statuses an order moves through on its way to the buyer.
+var orderProgress = map[string]int{
+	OrderPending:    0,
+	OrderPaid:       1,
+	OrderProcessing: 2,
+	OrderShipped:    3,
+	OrderDelivered:  4,
+}
+
+type OrderService interface {
+	GetOrder(id primitive.ObjectID) (models.Order, error)
+	UpdateStatus(id primitive.ObjectID, status string, note string) (models.Order, error)
+	AcceptOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error)
+	RejectOrder(id primitive.ObjectID, seller_id primitive.ObjectID, reason string) (models.SubOrder, error)
+	ShipOrder(id primitive.ObjectID, seller_id primitive.ObjectID, carrier string, tracking_number string) (models.SubOrder, error)
+	DeliverOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error)
+	ExportSellerOrders(seller_id primitive.ObjectID, query OrderQuery, w io.Writer) error
+	SellerOrders(seller_id primitive.ObjectID, query OrderQuery) (pagination.Page[models.SubOrder], error)
+	SellerOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error)
+	BuyerOrders(user_id primitive.ObjectID, query OrderQuery) (pagination.Page[models.Order], error)
+	BuyerOrder(id primitive.ObjectID, user_id primitive.ObjectID) (models.Order, error)
+	// BuyerOrderByNumber finds one of the buyer's orders by its numbers or those of a seller's part of it.
+	BuyerOrderByNumber(number string, user_id primitive.ObjectID) (models.Order, error)
+	SellerOrderByNumber(number string, seller_id primitive.ObjectID) (models.SubOrder, error)
+	Reorder(id primitive.ObjectID, user_id primitive.ObjectID) (cart models.Cart, skipped []models.OrderItem, err error)
+	CancelOrder(id primitive.ObjectID, user_id primitive.ObjectID, reason string) ([]models.SubOrder, error)
+	// RefundSubOrder books a refund the provider made, calls with the same key book it once.
+	RefundSubOrder(id primitive.ObjectID, amount models.Money, key string, return_id *primitive.ObjectID, note string) (models.SubOrder, error)
+	Restock(items []models.OrderItem) error
+	Record(order_id primitive.ObjectID, events ...models.OrderEvent) error
+}
+
+type orderService struct {
+	client     *mongo.Client
+	col        *mongo.Collection
+	sub_col    *mongo.Collection
+	prod_col   *mongo.Collection
+	cart       Cart
+	promotions PromotionService
+	notify     NotificationService
+	ctx        context.Context
+}
+
+func NewOrderService(ctx context.Context, client *mongo.Client, col *mongo.Collection, sub_col *mongo.Collection, prod_col *mongo.Collection, cart Cart, promotions PromotionService, notify NotificationService) OrderService {
+	return &orderService{
+		client:     client,
+		col:        col,
+		sub_col:    sub_col,
+		prod_col:   prod_col,
+		cart:       cart,
+		promotions: promotions,
+		notify:     notify,
+		ctx:        ctx,
+	}
+}
+
+// GetOrder returns the whole order with every seller's sub-order.
+func (o *orderService) GetOrder(id primitive.ObjectID) (models.Order, error) {
+	return o.findOrder(bson.D{{Key: "_id", Value: id}})
+}
+
+// BuyerOrder returns one of the buyer's orders, orders of other buyers are not found.
+func (o *orderService) BuyerOrder(id primitive.ObjectID, user_id primitive.ObjectID) (models.Order, error) {
+	return o.findOrder(bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}})
+}
+
+func (o *orderService) BuyerOrderByNumber(number string, user_id primitive.ObjectID) (models.Order, error) {
+	order, err := o.findOrder(append(numberFilter(number, "number", "invoiceNumber"), bson.E{Key: "userId", Value: user_id}))
+	if err != ErrOrderNotFound {
+		return order, err
+	}
+
+	// the number of one seller's part of the order
+	var sub models.SubOrder
+	filter := append(numberFilter(number, "number", "invoiceNumber"), bson.E{Key: "userId", Value: user_id})
+	if err = o.sub_col.FindOne(o.ctx, filter).Decode(&sub); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Order{}, ErrOrderNotFound
+		}
+		return models.Order{}, err
+	}
+	return o.BuyerOrder(sub.OrderID, user_id)
+}
+
+// SellerOrderByNumber finds the seller's part of an order by its own numbers or the order's number.
+func (o *orderService) SellerOrderByNumber(number string, seller_id primitive.ObjectID) (models.SubOrder, error) {
+	var sub models.SubOrder
+	filter := append(numberFilter(number, "number", "invoiceNumber", "orderNumber"), bson.E{Key: "sellerId", Value: seller_id})
+	if err := o.sub_col.FindOne(o.ctx, filter).Decode(&sub); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.SubOrder{}, ErrSubOrderNotFound
+		}
+		return models.SubOrder{}, err
+	}
+	return sub, nil
+}
+
+// numberFilter matches a number against any of fields, numbers of different kinds are told apart by their prefix.
+func numberFilter(number string, fields ...string) bson.D {
+	number = strings.ToUpper(strings.TrimSpace(number))
+	or := bson.A{}
+	for _, field := range fields {
+		or = append(or, bson.D{{Key: field, Value: number}})
+	}
+	return bson.D{{Key: "$or", Value: or}}
+}
+
+// BuyerOrders lists the buyer's orders newest first, sub-orders are only filled in by BuyerOrder.
+func (o *orderService) BuyerOrders(user_id primitive.ObjectID, query OrderQuery) (pagination.Page[models.Order], error) {
+	if err := query.Validate(); err != nil {
+		return pagination.Page[models.Order]{}, err
+	}
+
+	key := func(order models.Order) (interface{}, primitive.ObjectID) {
+		return order.CreatedAT, order.ID
+	}
+	return pagination.Find(o.ctx, o.col, query.Filter("userId", user_id), query.Page(), orderSort, key)
+}
+
+// Reorder adds the items of one of the buyer's orders to their cart at today's prices.
+// Items whose product is no longer on sale, or not in the quantity ordered, are skipped and returned.
+func (o *orderService) Reorder(id primitive.ObjectID, user_id primitive.ObjectID) (models.Cart, []models.OrderItem, error) {
+	var order models.Order
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	if err := o.col.FindOne(o.ctx, filter).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Cart{}, nil, ErrOrderNotFound
+		}
+		return models.Cart{}, nil, err
+	}
+
+	skipped := []models.OrderItem{}
+	for _, item := range order.Items {
+		if _, err := o.cart.AddItem(user_id, item.ProductID, item.Variant, item.Quantity); err != nil {
+			if unsellable(err) {
+				skipped = append(skipped, item)
+				continue
+			}
+			return models.Cart{}, nil, err
+		}
+	}
+
+	cart, err := o.cart.GetCart(user_id)
+	if err != nil {
+		return models.Cart{}, nil, err
+	}
+	return cart, skipped, nil
+}
+
+func (o *orderService) findOrder(filter bson.D) (models.Order, error) {
+	var order models.Order
+	if err := o.col.FindOne(o.ctx, filter).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Order{}, ErrOrderNotFound
+		}
+		return models.Order{}, err
+	}
+
+	subs, err := o.subOrders(o.ctx, order.ID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order.SubOrders = subs
+	return order, nil
+}
+
+// UpdateStatus moves every sub-order of an order to status, e.g. when the buyer paid.
+// Sub-orders already in status are left alone, the change is refused if any other can't make it.
+func (o *orderService) UpdateStatus(id primitive.ObjectID, status string, note string) (models.Order, error) {
+	err := o.transact(func(sess_ctx mongo.SessionContext) error {
+		if err := o.col.FindOne(sess_ctx, bson.D{{Key: "_id", Value: id}}).Err(); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		subs, err := o.subOrders(sess_ctx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, sub := range subs {
+			if sub.Status == status {
+				continue
+			}
+			if err = checkOrderTransition(sub.Status, status); err != nil {
+				return err
+			}
+		}
+
+		for _, sub := range subs {
+			if sub.Status == status {
+				continue
+			}
+			if _, err = o.moveSubOrder(sess_ctx, bson.D{{Key: "_id", Value: sub.ID}}, sub.Status, status, note, nil); err != nil {
+				return err
+			}
+		}
+		return o.rollup(sess_ctx, id, note)
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	return o.GetOrder(id)
+}
+
+// transact runs fn in a transaction, fn may run more than once when the transaction is retried.
+func (o *orderService) transact(fn func(sess_ctx mongo.SessionContext) error) error {
+	session, err := o.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(o.ctx)
+
+	_, err = session.WithTransaction(o.ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sess_ctx)
+	})
+	return err
+}
+
+// SellerOrders lists a seller's sub-orders newest first.
+func (o *orderService) SellerOrders(seller_id primitive.ObjectID, query OrderQuery) (pagination.Page[models.SubOrder], error) {
+	if err := query.Validate(); err != nil {
+		return pagination.Page[models.SubOrder]{}, err
+	}
+
+	key := func(sub models.SubOrder) (interface{}, primitive.ObjectID) {
+		return sub.CreatedAT, sub.ID
+	}
+	return pagination.Find(o.ctx, o.sub_col, query.Filter("sellerId", seller_id), query.Page(), orderSort, key)
+}
+
+func (o *orderService) SellerOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error) {
+	var sub models.SubOrder
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}}
+	if err := o.sub_col.FindOne(o.ctx, filter).Decode(&sub); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.SubOrder{}, ErrSubOrderNotFound
+		}
+		return models.SubOrder{}, err
+	}
+	return sub, nil
+}
+
+func (o *orderService) subOrders(ctx context.Context, order_id primitive.ObjectID) ([]models.SubOrder, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := o.sub_col.Find(ctx, bson.D{{Key: "orderId", Value: order_id}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := []models.SubOrder{}
+	if err = cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// moveSubOrder records a status change on the sub-order matching filter, from is the status it was read in.
+// set holds further fields to change along with the status.
+func (o *orderService) moveSubOrder(ctx context.Context, filter bson.D, from string, status string, note string, set bson.D) (models.SubOrder, error) {
+	now := time.Now()
+	change := models.OrderStatusChange{Status: status, Note: note, At: now}
+
+	// the status filter makes a concurrent change lose instead of being overwritten
+	filter = append(filter, bson.E{Key: "status", Value: from})
+	set = append(bson.D{{Key: "status", Value: status}, {Key: "updatedAt", Value: now}}, set...)
+	updateObj := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$push", Value: bson.D{{Key: "statusHistory", Value: change}}},
+	}
+
+	var sub models.SubOrder
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := o.sub_col.FindOneAndUpdate(ctx, filter, updateObj, opts).Decode(&sub); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.SubOrder{}, ErrInvalidOrderTransition
+		}
+		return models.SubOrder{}, err
+	}
+	return sub, nil
+}
+
+// rollup sets the order's status from its sub-orders and records it when it changed.
+// It must run in the transaction that moved the sub-orders: the order is written even when its
+// status stays, so two transactions rolling up the same order conflict and the loser is retried
+// with the other's sub-order statuses instead of overwriting them with what it read before.
+func (o *orderService) rollup(ctx mongo.SessionContext, order_id primitive.ObjectID, note string) error {
+	subs, err := o.subOrders(ctx, order_id)
+	if err != nil {
+		return err
+	}
+
+	statuses := []string{}
+	for _, sub := range subs {
+		statuses = append(statuses, sub.Status)
+	}
+	status := rollupStatus(statuses)
+
+	var order models.Order
+	if err = o.col.FindOne(ctx, bson.D{{Key: "_id", Value: order_id}}).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrOrderNotFound
+		}
+		return err
+	}
+
+	// nothing of a cancelled order reaches the buyer, the promotions it used can be used again
+	if status == OrderCancelled && status != order.Status && len(order.Promotions) > 0 {
+		if err = o.promotions.Release(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: now}}}}
+	if status != "" && status != order.Status {
+		change := models.OrderStatusChange{Status: status, Note: note, At: now}
+		updateObj = bson.D{
+			{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "updatedAt", Value: now}}},
+			{Key: "$push", Value: bson.D{{Key: "statusHistory", Value: change}}},
+		}
+	}
+	_, err = o.col.UpdateOne(ctx, bson.D{{Key: "_id", Value: order_id}}, updateObj)
+	return err
+}
+
+// rollupStatus is the status of an order whose sub-orders are in statuses: the least advanced
+// status of the sub-orders still going to the buyer, or cancelled or refunded once none are.
+func rollupStatus(statuses []string) string {
+	status := ""
+	refunded := false
+	for _, sub := range statuses {
+		rank, live := orderProgress[sub]
+		if !live {
+			refunded = refunded || sub == OrderRefunded
+			continue
+		}
+		if status == "" || rank < orderProgress[status] {
+			status = sub
+		}
+	}
+
+	if status != "" || len(statuses) == 0 {
+		return status
+	}
+	if refunded {
+		return OrderRefunded
+	}
+	return OrderCancelled
+}
+
+// SplitOrder divides an order into one sub-order per seller, in the order sellers first appear.
+func SplitOrder(order models.Order) ([]models.SubOrder, error) {
+	subs := []models.SubOrder{}
+	index := map[primitive.ObjectID]int{}
+	for _, item := range order.Items {
+		i, ok := index[item.SellerID]
+		if !ok {
+			i = len(subs)
+			index[item.SellerID] = i
+			subs = append(subs, models.SubOrder{
+				ID:              primitive.NewObjectID(),
+				OrderID:         order.ID,
+				OrderNumber:     order.Number,
+				UserID:          order.UserID,
+				SellerID:        item.SellerID,
+				Status:          order.Status,
+				ShippingAddress: order.ShippingAddress,
+				StatusHistory:   []models.OrderStatusChange{{Status: order.Status, At: order.CreatedAT}},
+				CreatedAT:       order.CreatedAT,
+				UpdatedAT:       order.UpdatedAT,
+			})
+		}
+		subs[i].Items = append(subs[i].Items, item)
+	}
+
+	for i := range subs {
+		totals := []models.Money{}
+		// orders placed before promotions and taxes have no currency on these
+		discount, marketplace, tax := int64(0), int64(0), int64(0)
+		for _, item := range subs[i].Items {
+			totals = append(totals, item.Total)
+			discount += item.Discount.Amount
+			tax += item.Tax.Amount
+			for _, d := range item.Discounts {
+				if d.SellerID == nil {
+					marketplace += d.Amount.Amount
+				}
+			}
+		}
+		total, err := money.Sum(order.TotalPrice.Currency, totals...)
+		if err != nil {
+			return nil, err
+		}
+		subs[i].TotalPrice = total
+		subs[i].Discount = money.New(discount, order.TotalPrice.Currency)
+		// what the seller's own promotions took off comes out of their revenue
+		subs[i].MarketplaceDiscount = money.New(marketplace, order.TotalPrice.Currency)
+		subs[i].Tax = money.New(tax, order.TotalPrice.Currency)
+		subs[i].Shipping = money.New(0, order.TotalPrice.Currency)
+
+		// each seller charges for delivering their own part
+		for _, rate := range order.ShippingRates {
+			if rate.SellerID == subs[i].SellerID {
+				rate := rate
+				subs[i].ShippingRate = &rate
+				subs[i].Shipping = rate.Price
+				subs[i].TotalPrice.Amount += rate.Price.Amount
+			}
+		}
+	}
+	return subs, nil
+}
+
+// newOrder builds a pending order from cart lines, every line must be priced in the same currency.
+func newOrder(user_id primitive.ObjectID, lines []models.CartLine, now time.Time) (models.Order, error) {
+	if len(lines) == 0 {
+		return models.Order{}, ErrEmptyCart
+	}
+
+	items := []models.OrderItem{}
+	totals := []models.Money{}
+	seller_ids := []primitive.ObjectID{}
+	sellers := map[primitive.ObjectID]bool{}
+	for _, line := range lines {
+		if !sellers[line.SellerID] {
+			sellers[line.SellerID] = true
+			seller_ids = append(seller_ids, line.SellerID)
+		}
+		total := money.Multiply(line.UnitPrice, line.Quantity)
+		items = append(items, models.OrderItem{
+			ProductID: line.ProductID,
+			SellerID:  line.SellerID,
+			Name:      line.Name,
+			Image:     line.Image,
+			Variant:   line.Variant,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			Discount:  money.New(0, line.UnitPrice.Currency),
+			Tax:       money.New(0, line.UnitPrice.Currency),
+			Total:     total,
+		})
+		totals = append(totals, total)
+	}
+
+	total, err := money.Sum(totals[0].Currency, totals...)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return models.Order{
+		ID:            primitive.NewObjectID(),
+		UserID:        user_id,
+		Status:        OrderPending,
+		Items:         items,
+		TotalPrice:    total,
+		Discount:      money.New(0, total.Currency),
+		Tax:           money.New(0, total.Currency),
+		Shipping:      money.New(0, total.Currency),
+		SellerIDs:     seller_ids,
+		StatusHistory: []models.OrderStatusChange{{Status: OrderPending, At: now}},
+		CreatedAT:     now,
+		UpdatedAT:     now,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"kamoushop/pkg/services/pagination"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidDateRange = errors.New("from cannot be after to")
+
+// OrderQuery filters the orders a buyer or seller lists, both ends of the date range are optional.
+type OrderQuery struct {
+	Status string
+	// placed at or after From and before To
+	From   time.Time
+	To     time.Time
+	Limit  int64
+	Cursor string
+}
+
+func (q OrderQuery) Validate() error {
+	if q.Status != "" {
+		if _, ok := orderTransitions[q.Status]; !ok {
+			return ErrInvalidOrderStatus
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return ErrInvalidDateRange
+	}
+	return nil
+}
+
+// Filter is the mongo filter for the query, owner is the field and id of whoever lists the orders.
+func (q OrderQuery) Filter(owner string, id primitive.ObjectID) bson.D {
+	filter := bson.D{{Key: owner, Value: id}}
+	if q.Status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: q.Status})
+	}
+
+	placed := bson.D{}
+	if !q.From.IsZero() {
+		placed = append(placed, bson.E{Key: "$gte", Value: q.From})
+	}
+	if !q.To.IsZero() {
+		placed = append(placed, bson.E{Key: "$lt", Value: q.To})
+	}
+	if len(placed) > 0 {
+		filter = append(filter, bson.E{Key: "createdAt", Value: placed})
+	}
+	return filter
+}
+
+func (q OrderQuery) Page() pagination.Request {
+	return pagination.Request{Limit: q.Limit, Cursor: q.Cursor}
+}
+
+// orderSort lists orders newest first.
+var orderSort = pagination.Sort{Field: "createdAt", Desc: true}
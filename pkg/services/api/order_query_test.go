@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderQueryValidate(t *testing.T) {
+	require.NoError(t, OrderQuery{}.Validate())
+	require.NoError(t, OrderQuery{Status: OrderShipped}.Validate())
+	require.ErrorIs(t, OrderQuery{Status: "lost"}.Validate(), ErrInvalidOrderStatus)
+
+	now := time.Now()
+	require.NoError(t, OrderQuery{From: now.Add(-time.Hour), To: now}.Validate())
+	require.ErrorIs(t, OrderQuery{From: now, To: now.Add(-time.Hour)}.Validate(), ErrInvalidDateRange)
+}
+
+func TestOrderQueryFilter(t *testing.T) {
+	user_id := primitive.NewObjectID()
+	require.Equal(t, bson.D{{Key: "userId", Value: user_id}}, OrderQuery{}.Filter("userId", user_id))
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	q := OrderQuery{Status: OrderPaid, From: from, To: to}
+	require.Equal(t, bson.D{
+		{Key: "sellerId", Value: user_id},
+		{Key: "status", Value: OrderPaid},
+		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}, q.Filter("sellerId", user_id))
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/payment"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OrderEventCancelled       = "cancelled"
+	OrderEventReturnRequested = "return_requested"
+	OrderEventReturnDenied    = "return_denied"
+	OrderEventRefunded        = "refunded"
+	OrderEventRefundFailed    = "refund_failed"
+	// a payment that came in after the order was cancelled, it is refunded right away
+	OrderEventPaidAfterCancel = "paid_after_cancel"
+)
+
+var ErrCannotCancel = errors.New("every part of the order has shipped or is already closed")
+
+// CancelOrder cancels the buyer's sub-orders that haven't shipped and puts their items back in stock,
+// it returns the sub-orders it cancelled.
+func (o *orderService) CancelOrder(id primitive.ObjectID, user_id primitive.ObjectID, reason string) ([]models.SubOrder, error) {
+	order, err := o.BuyerOrder(id, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var cancelled []models.SubOrder
+	err = o.transact(func(sess_ctx mongo.SessionContext) error {
+		cancelled = []models.SubOrder{}
+		for _, sub := range order.SubOrders {
+			if !CanOrderTransition(sub.Status, OrderCancelled) {
+				continue
+			}
+			moved, err := o.moveSubOrder(sess_ctx, bson.D{{Key: "_id", Value: sub.ID}}, sub.Status, OrderCancelled, reason, nil)
+			if err == ErrInvalidOrderTransition {
+				// the seller shipped it in the meantime
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			cancelled = append(cancelled, moved)
+		}
+		if len(cancelled) == 0 {
+			return ErrCannotCancel
+		}
+		return o.rollup(sess_ctx, id, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.OrderEvent{}
+	for _, moved := range cancelled {
+		sub_id := moved.ID
+		events = append(events, models.OrderEvent{Kind: OrderEventCancelled, SubOrderID: &sub_id, Note: reason, At: now})
+		if err = o.Restock(moved.Items); err != nil {
+			log.Printf("cannot restock items of sub-order %s: %v", moved.ID.Hex(), err)
+		}
+		if err = o.notify.Notify(cancelNotification(moved, reason, now)); err != nil {
+			log.Printf("cannot notify seller of sub-order %s: %v", moved.ID.Hex(), err)
+		}
+	}
+
+	if err = o.Record(id, events...); err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// RefundSubOrder adds amount to what was given back for a sub-order, it can never exceed the total.
+// The refunded event goes on the order in the same transaction, and a sub-order refunded in full
+// moves to refunded unless it was cancelled before.
+func (o *orderService) RefundSubOrder(id primitive.ObjectID, amount models.Money, key string, return_id *primitive.ObjectID, note string) (models.SubOrder, error) {
+	var sub models.SubOrder
+	err := o.transact(func(sess_ctx mongo.SessionContext) error {
+		var booked bool
+		var err error
+		if sub, booked, err = o.bookRefund(sess_ctx, id, amount, key); err != nil {
+			return err
+		}
+
+		if booked {
+			sub_id := sub.ID
+			event := models.OrderEvent{Kind: OrderEventRefunded, SubOrderID: &sub_id, ReturnID: return_id, Amount: &amount, Note: note, At: time.Now()}
+			if err = o.record(sess_ctx, sub.OrderID, event); err != nil {
+				return err
+			}
+		}
+
+		// also reached by a retry whose booking went through before
+		if sub.Refunded.Amount < sub.TotalPrice.Amount || !CanOrderTransition(sub.Status, OrderRefunded) {
+			return nil
+		}
+		if sub, err = o.moveSubOrder(sess_ctx, bson.D{{Key: "_id", Value: id}}, sub.Status, OrderRefunded, note, nil); err != nil {
+			return err
+		}
+		return o.rollup(sess_ctx, sub.OrderID, note)
+	})
+	if err != nil {
+		return models.SubOrder{}, err
+	}
+	return sub, nil
+}
+
+// bookRefund adds amount to the sub-order's refunded amount under key, booked is false when key was added before.
+func (o *orderService) bookRefund(ctx context.Context, id primitive.ObjectID, amount models.Money, key string) (sub models.SubOrder, booked bool, err error) {
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "refundKeys", Value: bson.D{{Key: "$ne", Value: key}}},
+		{Key: "totalPrice.currency", Value: amount.Currency},
+		{Key: "$expr", Value: bson.D{{Key: "$lte", Value: bson.A{
+			bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$refunded.amount", 0}}}, amount.Amount}}},
+			"$totalPrice.amount",
+		}}}},
+	}
+	updateObj := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "refunded.amount", Value: amount.Amount}}},
+		{Key: "$set", Value: bson.D{{Key: "refunded.currency", Value: amount.Currency}, {Key: "updatedAt", Value: time.Now()}}},
+		{Key: "$push", Value: bson.D{{Key: "refundKeys", Value: key}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = o.sub_col.FindOneAndUpdate(ctx, filter, updateObj, opts).Decode(&sub)
+	if err == nil {
+		return sub, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.SubOrder{}, false, err
+	}
+
+	err = o.sub_col.FindOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "refundKeys", Value: key}}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return models.SubOrder{}, false, payment.ErrRefundTooLarge
+	}
+	return sub, false, err
+}
+
+// Record adds events to the order's history of cancellations, returns and refunds.
+func (o *orderService) Record(order_id primitive.ObjectID, events ...models.OrderEvent) error {
+	return o.record(o.ctx, order_id, events...)
+}
+
+func (o *orderService) record(ctx context.Context, order_id primitive.ObjectID, events ...models.OrderEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	updateObj := bson.D{
+		{Key: "$push", Value: bson.D{{Key: "events", Value: bson.D{{Key: "$each", Value: events}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+	result, err := o.col.UpdateOne(ctx, bson.D{{Key: "_id", Value: order_id}}, updateObj)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+// cancelNotification tells a seller the buyer cancelled their part of an order.
+func cancelNotification(sub models.SubOrder, reason string, now time.Time) models.Notification {
+	order_id := sub.OrderID
+	body := fmt.Sprintf("The buyer cancelled order %s, its items are back in stock", order_id.Hex())
+	if reason != "" {
+		body += ": " + reason
+	}
+	return models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    sub.SellerID,
+		Kind:      NotifyOrderStatus,
+		Title:     "Order cancelled",
+		Body:      body,
+		OrderID:   &order_id,
+		CreatedAT: now,
+	}
+}
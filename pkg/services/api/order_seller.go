@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"kamoushop/pkg/models"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTrackingRequired = errors.New("carrier and tracking number are required to ship an order")
+
+// OrderExportHeader is the column order of seller order exports, there is one row per item.
+var OrderExportHeader = []string{
+	"order_id", "sub_order_id", "placed_at", "status", "buyer_id",
+	"product_id", "name", "variant", "quantity", "unit_price", "discount", "tax", "total", "currency",
+	"carrier", "tracking_number", "shipped_at", "delivered_at",
+}
+
+// AcceptOrder starts preparing a paid sub-order.
+func (o *orderService) AcceptOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error) {
+	return o.sellerMove(id, seller_id, OrderProcessing, "accepted by the seller", nil)
+}
+
+// RejectOrder cancels a sub-order the seller can't fulfil and puts its items back in stock.
+func (o *orderService) RejectOrder(id primitive.ObjectID, seller_id primitive.ObjectID, reason string) (models.SubOrder, error) {
+	sub, err := o.sellerMove(id, seller_id, OrderCancelled, reason, nil)
+	if err != nil {
+		return models.SubOrder{}, err
+	}
+
+	// the sub-order is already cancelled, a failure here needs fixing by hand rather than a retry
+	if err = o.Restock(sub.Items); err != nil {
+		log.Printf("cannot restock items of sub-order %s: %v", sub.ID.Hex(), err)
+	}
+	return sub, nil
+}
+
+func (o *orderService) ShipOrder(id primitive.ObjectID, seller_id primitive.ObjectID, carrier string, tracking_number string) (models.SubOrder, error) {
+	if carrier == "" || tracking_number == "" {
+		return models.SubOrder{}, ErrTrackingRequired
+	}
+
+	set := bson.D{
+		{Key: "fulfilment.carrier", Value: carrier},
+		{Key: "fulfilment.trackingNumber", Value: tracking_number},
+		{Key: "fulfilment.shippedAt", Value: time.Now()},
+	}
+	return o.sellerMove(id, seller_id, OrderShipped, "", set)
+}
+
+func (o *orderService) DeliverOrder(id primitive.ObjectID, seller_id primitive.ObjectID) (models.SubOrder, error) {
+	set := bson.D{{Key: "fulfilment.deliveredAt", Value: time.Now()}}
+	return o.sellerMove(id, seller_id, OrderDelivered, "", set)
+}
+
+// ExportSellerOrders writes the seller's sub-orders matching query to w as csv, oldest first.
+func (o *orderService) ExportSellerOrders(seller_id primitive.ObjectID, query OrderQuery, w io.Writer) error {
+	if err := query.Validate(); err != nil {
+		return err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := o.sub_col.Find(o.ctx, query.Filter("sellerId", seller_id), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(o.ctx)
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(OrderExportHeader); err != nil {
+		return err
+	}
+	for cursor.Next(o.ctx) {
+		var sub models.SubOrder
+		if err = cursor.Decode(&sub); err != nil {
+			return err
+		}
+		if err = cw.WriteAll(orderExportRows(sub)); err != nil {
+			return err
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// sellerMove moves one of the seller's sub-orders to status and tells the buyer about it.
+func (o *orderService) sellerMove(id primitive.ObjectID, seller_id primitive.ObjectID, status string, note string, set bson.D) (models.SubOrder, error) {
+	sub, err := o.SellerOrder(id, seller_id)
+	if err != nil {
+		return models.SubOrder{}, err
+	}
+
+	if err = checkOrderTransition(sub.Status, status); err != nil {
+		return models.SubOrder{}, err
+	}
+
+	from := sub.Status
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}}
+	err = o.transact(func(sess_ctx mongo.SessionContext) error {
+		if sub, err = o.moveSubOrder(sess_ctx, filter, from, status, note, set); err != nil {
+			return err
+		}
+		return o.rollup(sess_ctx, sub.OrderID, "")
+	})
+	if err != nil {
+		return models.SubOrder{}, err
+	}
+
+	// the change is made, a lost notification isn't worth failing the request over
+	if err = o.notify.Notify(orderNotification(sub, note, time.Now())); err != nil {
+		log.Printf("cannot notify buyer of sub-order %s: %v", sub.ID.Hex(), err)
+	}
+	return sub, nil
+}
+
+// Restock puts the quantities of items back on the shelf, updatedAt moves so wishlist watchers
+// hear about products that are back in stock.
+func (o *orderService) Restock(items []models.OrderItem) error {
+	for _, item := range items {
+		updateObj := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "stock", Value: item.Quantity}, {Key: "sales", Value: -item.Quantity}}},
+			{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+		}
+		if _, err := o.prod_col.UpdateOne(o.ctx, bson.D{{Key: "_id", Value: item.ProductID}}, updateObj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderNotification tells the buyer their part of an order from one seller moved to a new status.
+func orderNotification(sub models.SubOrder, note string, now time.Time) models.Notification {
+	order_id := sub.OrderID
+	notification := models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    sub.UserID,
+		Kind:      NotifyOrderStatus,
+		OrderID:   &order_id,
+		CreatedAT: now,
+	}
+
+	switch sub.Status {
+	case OrderProcessing:
+		notification.Title = "Order accepted"
+		notification.Body = fmt.Sprintf("The seller accepted your order %s and is preparing it", order_id.Hex())
+	case OrderCancelled:
+		notification.Title = "Order cancelled"
+		notification.Body = fmt.Sprintf("The seller cancelled their part of your order %s", order_id.Hex())
+		if note != "" {
+			notification.Body += ": " + note
+		}
+	case OrderShipped:
+		notification.Title = "Order shipped"
+		notification.Body = fmt.Sprintf("Your order %s was shipped with %s, tracking number %s", order_id.Hex(), sub.Fulfilment.Carrier, sub.Fulfilment.TrackingNumber)
+	case OrderDelivered:
+		notification.Title = "Order delivered"
+		notification.Body = fmt.Sprintf("Your order %s was delivered", order_id.Hex())
+	default:
+		notification.Title = "Order updated"
+		notification.Body = fmt.Sprintf("Your order %s is now %s", order_id.Hex(), sub.Status)
+	}
+	return notification
+}
+
+// orderExportRows turns a sub-order into export rows, prices are minor units as in product exports.
+func orderExportRows(sub models.SubOrder) [][]string {
+	optional := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	rows := [][]string{}
+	for _, item := range sub.Items {
+		rows = append(rows, []string{
+			sub.OrderID.Hex(),
+			sub.ID.Hex(),
+			sub.CreatedAT.UTC().Format(time.RFC3339),
+			sub.Status,
+			sub.UserID.Hex(),
+			item.ProductID.Hex(),
+			item.Name,
+			item.Variant,
+			strconv.FormatInt(item.Quantity, 10),
+			strconv.FormatInt(item.UnitPrice.Amount, 10),
+			strconv.FormatInt(item.Discount.Amount, 10),
+			strconv.FormatInt(item.Tax.Amount, 10),
+			strconv.FormatInt(item.Total.Amount, 10),
+			item.Total.Currency,
+			sub.Fulfilment.Carrier,
+			sub.Fulfilment.TrackingNumber,
+			optional(sub.Fulfilment.ShippedAT),
+			optional(sub.Fulfilment.DeliveredAT),
+		})
+	}
+	return rows
+}
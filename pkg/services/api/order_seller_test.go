@@ -0,0 +1,62 @@
+package api
+
+import (
+	"kamoushop/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrderNotification(t *testing.T) {
+	now := time.Now()
+	sub := models.SubOrder{
+		ID:         primitive.NewObjectID(),
+		OrderID:    primitive.NewObjectID(),
+		UserID:     primitive.NewObjectID(),
+		Status:     OrderShipped,
+		Fulfilment: models.Fulfilment{Carrier: "GIG Logistics", TrackingNumber: "GIG123"},
+	}
+
+	notification := orderNotification(sub, "", now)
+	require.Equal(t, sub.UserID, notification.UserID)
+	require.Equal(t, NotifyOrderStatus, notification.Kind)
+	require.Equal(t, sub.OrderID, *notification.OrderID)
+	require.Equal(t, "Order shipped", notification.Title)
+	require.Contains(t, notification.Body, "GIG Logistics")
+	require.Contains(t, notification.Body, "GIG123")
+
+	sub.Status = OrderCancelled
+	notification = orderNotification(sub, "out of stock", now)
+	require.Equal(t, "Order cancelled", notification.Title)
+	require.Contains(t, notification.Body, "out of stock")
+}
+
+func TestOrderExportRows(t *testing.T) {
+	placed := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	shipped := placed.Add(24 * time.Hour)
+	sub := models.SubOrder{
+		ID:        primitive.NewObjectID(),
+		OrderID:   primitive.NewObjectID(),
+		UserID:    primitive.NewObjectID(),
+		Status:    OrderShipped,
+		CreatedAT: placed,
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Name: "Ankara shirt", Variant: "size:M", Quantity: 2, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}, Total: models.Money{Amount: 1000, Currency: "NGN"}},
+			{ProductID: primitive.NewObjectID(), Name: "Mug", Quantity: 1, UnitPrice: models.Money{Amount: 300, Currency: "NGN"}, Total: models.Money{Amount: 300, Currency: "NGN"}},
+		},
+		Fulfilment: models.Fulfilment{Carrier: "DHL", TrackingNumber: "1Z", ShippedAT: &shipped},
+	}
+
+	rows := orderExportRows(sub)
+	require.Len(t, rows, 2)
+	for _, row := range rows {
+		require.Len(t, row, len(OrderExportHeader))
+	}
+	require.Equal(t, []string{
+		sub.OrderID.Hex(), sub.ID.Hex(), "2024-03-01T10:00:00Z", OrderShipped, sub.UserID.Hex(),
+		sub.Items[0].ProductID.Hex(), "Ankara shirt", "size:M", "2", "500", "0", "0", "1000", "NGN",
+		"DHL", "1Z", "2024-03-02T10:00:00Z", "",
+	}, rows[0])
+}
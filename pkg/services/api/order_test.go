@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckOrderTransition(t *testing.T) {
+	require.NoError(t, checkOrderTransition(OrderPending, OrderPaid))
+	require.NoError(t, checkOrderTransition(OrderPaid, OrderProcessing))
+	require.NoError(t, checkOrderTransition(OrderShipped, OrderDelivered))
+	require.NoError(t, checkOrderTransition(OrderDelivered, OrderRefunded))
+
+	require.ErrorIs(t, checkOrderTransition(OrderPending, "lost"), ErrInvalidOrderStatus)
+	require.ErrorIs(t, checkOrderTransition(OrderPending, OrderShipped), ErrInvalidOrderTransition)
+	require.ErrorIs(t, checkOrderTransition(OrderShipped, OrderCancelled), ErrInvalidOrderTransition)
+	require.ErrorIs(t, checkOrderTransition(OrderCancelled, OrderPaid), ErrInvalidOrderTransition)
+	require.ErrorIs(t, checkOrderTransition(OrderRefunded, OrderPending), ErrInvalidOrderTransition)
+	require.ErrorIs(t, checkOrderTransition(OrderLegacy, OrderPaid), ErrInvalidOrderTransition)
+	require.ErrorIs(t, checkOrderTransition(OrderLegacy, OrderCancelled), ErrInvalidOrderTransition)
+}
+
+func TestNewOrder(t *testing.T) {
+	now := time.Now()
+	user_id, seller_id := primitive.NewObjectID(), primitive.NewObjectID()
+	lines := []models.CartLine{
+		{ProductID: primitive.NewObjectID(), SellerID: seller_id, Quantity: 3, UnitPrice: models.Money{Amount: 250, Currency: "NGN"}},
+		{ProductID: primitive.NewObjectID(), SellerID: seller_id, Variant: "red", Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}},
+	}
+
+	order, err := newOrder(user_id, lines, now)
+	require.NoError(t, err)
+	require.Equal(t, OrderPending, order.Status)
+	require.Equal(t, []models.OrderStatusChange{{Status: OrderPending, At: now}}, order.StatusHistory)
+	require.Len(t, order.Items, 2)
+	require.Equal(t, models.Money{Amount: 750, Currency: "NGN"}, order.Items[0].Total)
+	require.Equal(t, seller_id, order.Items[1].SellerID)
+	require.Equal(t, models.Money{Amount: 1750, Currency: "NGN"}, order.TotalPrice)
+
+	_, err = newOrder(user_id, nil, now)
+	require.ErrorIs(t, err, ErrEmptyCart)
+
+	lines[1].UnitPrice.Currency = "USD"
+	_, err = newOrder(user_id, lines, now)
+	require.ErrorIs(t, err, money.ErrCurrencyMismatch)
+}
+
+func TestSplitOrder(t *testing.T) {
+	now := time.Now()
+	shop_a, shop_b := primitive.NewObjectID(), primitive.NewObjectID()
+	lines := []models.CartLine{
+		{ProductID: primitive.NewObjectID(), SellerID: shop_a, Quantity: 2, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}},
+		{ProductID: primitive.NewObjectID(), SellerID: shop_b, Quantity: 1, UnitPrice: models.Money{Amount: 300, Currency: "NGN"}},
+		{ProductID: primitive.NewObjectID(), SellerID: shop_a, Quantity: 1, UnitPrice: models.Money{Amount: 200, Currency: "NGN"}},
+	}
+	order, err := newOrder(primitive.NewObjectID(), lines, now)
+	require.NoError(t, err)
+	require.Equal(t, []primitive.ObjectID{shop_a, shop_b}, order.SellerIDs)
+
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+
+	require.Equal(t, shop_a, subs[0].SellerID)
+	require.Equal(t, order.ID, subs[0].OrderID)
+	require.Equal(t, order.UserID, subs[0].UserID)
+	require.Equal(t, OrderPending, subs[0].Status)
+	require.Len(t, subs[0].Items, 2)
+	require.Equal(t, models.Money{Amount: 1200, Currency: "NGN"}, subs[0].TotalPrice)
+
+	require.Equal(t, shop_b, subs[1].SellerID)
+	require.Len(t, subs[1].Items, 1)
+	require.Equal(t, models.Money{Amount: 300, Currency: "NGN"}, subs[1].TotalPrice)
+	require.NotEqual(t, subs[0].ID, subs[1].ID)
+}
+
+func TestRollupStatus(t *testing.T) {
+	require.Equal(t, "", rollupStatus(nil))
+	require.Equal(t, OrderPaid, rollupStatus([]string{OrderPaid, OrderPaid}))
+	require.Equal(t, OrderProcessing, rollupStatus([]string{OrderShipped, OrderProcessing}))
+	// a cancelled part doesn't hold the rest of the order back
+	require.Equal(t, OrderDelivered, rollupStatus([]string{OrderCancelled, OrderDelivered}))
+	require.Equal(t, OrderShipped, rollupStatus([]string{OrderRefunded, OrderShipped, OrderDelivered}))
+	require.Equal(t, OrderCancelled, rollupStatus([]string{OrderCancelled, OrderCancelled}))
+	require.Equal(t, OrderRefunded, rollupStatus([]string{OrderCancelled, OrderRefunded}))
+}
+
+func TestSellerMovesRollUpTogether(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	orders := NewOrderService(ctx, client, db.Collection("orders"), db.Collection("sub_orders"), db.Collection("products"), nil, nil, NewNotificationService(ctx, db.Collection("notifications")))
+
+	// two sellers ship their parts of one order at the same time, the last to commit must see the other's
+	for round := 0; round < 10; round++ {
+		shop_a, shop_b := primitive.NewObjectID(), primitive.NewObjectID()
+		lines := []models.CartLine{
+			{ProductID: primitive.NewObjectID(), SellerID: shop_a, Quantity: 1, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}},
+			{ProductID: primitive.NewObjectID(), SellerID: shop_b, Quantity: 1, UnitPrice: models.Money{Amount: 300, Currency: "NGN"}},
+		}
+		order, err := newOrder(primitive.NewObjectID(), lines, time.Now())
+		require.NoError(t, err)
+		order.Status = OrderProcessing
+		subs, err := SplitOrder(order)
+		require.NoError(t, err)
+		_, err = db.Collection("orders").InsertOne(ctx, order)
+		require.NoError(t, err)
+		for _, sub := range subs {
+			_, err = db.Collection("sub_orders").InsertOne(ctx, sub)
+			require.NoError(t, err)
+		}
+
+		var wg sync.WaitGroup
+		for _, sub := range subs {
+			wg.Add(1)
+			go func(sub models.SubOrder) {
+				defer wg.Done()
+				_, err := orders.ShipOrder(sub.ID, sub.SellerID, "DHL", "1Z")
+				require.NoError(t, err)
+			}(sub)
+		}
+		wg.Wait()
+
+		shipped, err := orders.GetOrder(order.ID)
+		require.NoError(t, err)
+		require.Equal(t, OrderShipped, shipped.Status)
+		require.Equal(t, OrderShipped, shipped.StatusHistory[len(shipped.StatusHistory)-1].Status)
+	}
+
+	_, err := orders.UpdateStatus(primitive.NewObjectID(), OrderPaid, "")
+	require.ErrorIs(t, err, ErrOrderNotFound)
+}
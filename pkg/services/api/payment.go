@@ -0,0 +1,562 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/payment"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PaymentIntent  = "intent"
+	PaymentCapture = "capture"
+	PaymentRefund  = "refund"
+	PaymentWebhook = "webhook"
+
+	// a refund claimed this long ago that the provider never confirmed is taken to have never reached it
+	refundClaimTimeout = 10 * time.Minute
+)
+
+var (
+	ErrOrderNotPayable = errors.New("only pending orders can be paid")
+	ErrPaymentNotFound = errors.New("can't find the payment the webhook is about")
+	ErrOrderNotPaid    = errors.New("order has no successful payment to refund")
+	ErrRefundPending   = errors.New("the refund is still on its way to the payment provider, try again in a few minutes")
+)
+
+type PaymentService interface {
+	// Pay starts a payment of one of the buyer's pending orders with the default provider.
+	Pay(order_id primitive.ObjectID, user_id primitive.ObjectID) (models.Payment, error)
+	// HandleWebhook verifies and acts on a webhook of the named provider, redelivered events are ignored.
+	HandleWebhook(provider string, header http.Header, body []byte) error
+	// Refund gives amount of an order's payment back, calls with the same key refund it once. It only
+	// succeeds once the provider took the refund, ErrRefundPending means the caller should try again later.
+	Refund(order_id primitive.ObjectID, amount models.Money, key string) (models.Payment, error)
+	// CloseIntents closes the intent of an order that can't be paid any more, a payment that
+	// still comes in for it is refunded.
+	CloseIntents(order_id primitive.ObjectID) error
+	Payments(order_id primitive.ObjectID, user_id primitive.ObjectID) ([]models.Payment, error)
+}
+
+type paymentService struct {
+	col       *mongo.Collection
+	order_col *mongo.Collection
+	user_col  *mongo.Collection
+	orders    OrderService
+	providers payment.Providers
+	// new payments go to this provider
+	provider string
+	ctx      context.Context
+}
+
+func NewPaymentService(ctx context.Context, col *mongo.Collection, order_col *mongo.Collection, user_col *mongo.Collection, orders OrderService, providers payment.Providers, provider string) PaymentService {
+	return &paymentService{
+		col:       col,
+		order_col: order_col,
+		user_col:  user_col,
+		orders:    orders,
+		providers: providers,
+		provider:  provider,
+		ctx:       ctx,
+	}
+}
+
+func (p *paymentService) Pay(order_id primitive.ObjectID, user_id primitive.ObjectID) (models.Payment, error) {
+	provider, err := p.providers.Get(p.provider)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	var order models.Order
+	if err = p.order_col.FindOne(p.ctx, bson.D{{Key: "_id", Value: order_id}, {Key: "userId", Value: user_id}}).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Payment{}, ErrOrderNotFound
+		}
+		return models.Payment{}, err
+	}
+	if order.Status != OrderPending {
+		return models.Payment{}, ErrOrderNotPayable
+	}
+
+	// the buyer finishes paying the attempt they already started
+	open, err := p.openIntent(order.ID)
+	if err != ErrPaymentNotFound {
+		return open, err
+	}
+
+	var user models.User
+	if err = p.user_col.FindOne(p.ctx, bson.D{{Key: "_id", Value: user_id}}).Decode(&user); err != nil {
+		return models.Payment{}, err
+	}
+
+	attempt := models.Payment{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		UserID:    user_id,
+		Provider:  provider.Name(),
+		Kind:      PaymentIntent,
+		Amount:    order.TotalPrice,
+		CreatedAT: time.Now(),
+	}
+	// every attempt gets its own reference, providers refuse to reuse one
+	attempt.Reference = attempt.ID.Hex()
+
+	intent := payment.Intent{Reference: attempt.Reference, Amount: order.TotalPrice, Email: user.Email, OrderID: order.ID.Hex()}
+	result, call_err := provider.CreateIntent(p.ctx, intent)
+	recordCall(&attempt, result, call_err)
+	attempt.Open = call_err == nil
+
+	if _, err = p.col.InsertOne(p.ctx, attempt); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return models.Payment{}, err
+		}
+		// a concurrent call opened one first, the intent made here is left to expire unpaid
+		return p.openIntent(order.ID)
+	}
+	if call_err != nil {
+		return models.Payment{}, call_err
+	}
+	return attempt, nil
+}
+
+func (p *paymentService) HandleWebhook(name string, header http.Header, body []byte) error {
+	provider, err := p.providers.Get(name)
+	if err != nil {
+		return err
+	}
+
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		return err
+	}
+
+	intent, err := p.findIntent(provider.Name(), event)
+	if err == ErrPaymentNotFound && event.Type == payment.EventOther {
+		// providers send events about things other than our payments too
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	webhook := models.Payment{
+		ID:          primitive.NewObjectID(),
+		OrderID:     intent.OrderID,
+		UserID:      intent.UserID,
+		Provider:    provider.Name(),
+		Kind:        PaymentWebhook,
+		Reference:   intent.Reference,
+		ProviderRef: event.ProviderRef,
+		EventID:     event.ID,
+		Event:       event.Type,
+		Status:      payment.StatusPending,
+		Amount:      event.Amount,
+		Raw:         string(event.Raw),
+		CreatedAT:   time.Now(),
+	}
+	if _, err = p.col.InsertOne(p.ctx, webhook); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		// a redelivery, it is only acted on again when the first delivery didn't get through
+		filter := bson.D{{Key: "provider", Value: provider.Name()}, {Key: "eventId", Value: event.ID}}
+		if err = p.col.FindOne(p.ctx, filter).Decode(&webhook); err != nil {
+			return err
+		}
+		if webhook.Handled {
+			return nil
+		}
+	}
+
+	status, handle_err := p.handle(provider, intent, event)
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "handled", Value: handle_err == nil}}}}
+	if handle_err != nil {
+		updateObj = bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "error", Value: handle_err.Error()}}}}
+	}
+	if _, err = p.col.UpdateByID(p.ctx, webhook.ID, updateObj); err != nil {
+		return err
+	}
+	return handle_err
+}
+
+// handle acts on a verified event and returns the status to record for it.
+func (p *paymentService) handle(provider payment.Provider, intent models.Payment, event payment.Event) (string, error) {
+	switch event.Type {
+	case payment.EventAuthorized:
+		capture := models.Payment{
+			ID:          primitive.NewObjectID(),
+			OrderID:     intent.OrderID,
+			UserID:      intent.UserID,
+			Provider:    provider.Name(),
+			Kind:        PaymentCapture,
+			Reference:   intent.Reference,
+			ProviderRef: event.ProviderRef,
+			Amount:      intent.Amount,
+			CreatedAT:   time.Now(),
+		}
+		result, call_err := provider.Capture(p.ctx, event.ProviderRef, intent.Amount)
+		recordCall(&capture, result, call_err)
+		if _, err := p.col.InsertOne(p.ctx, capture); err != nil {
+			return payment.StatusFailed, err
+		}
+		if call_err != nil {
+			return payment.StatusFailed, call_err
+		}
+		// the order is paid when the succeeded event for the capture arrives
+		return payment.StatusSucceeded, nil
+
+	case payment.EventSucceeded:
+		if event.Amount != intent.Amount {
+			log.Printf("payment %s of order %s paid %d %s instead of %d %s", intent.Reference, intent.OrderID.Hex(),
+				event.Amount.Amount, event.Amount.Currency, intent.Amount.Amount, intent.Amount.Currency)
+			// retrying won't change the amount, the webhook is recorded as handled but failed
+			return payment.StatusFailed, nil
+		}
+		if err := p.markPaid(intent, "paid with "+provider.Name()); err != nil {
+			return payment.StatusFailed, err
+		}
+		if err := p.closeIntent(intent, payment.StatusSucceeded); err != nil {
+			return payment.StatusFailed, err
+		}
+		return payment.StatusSucceeded, nil
+
+	case payment.EventFailed:
+		// the order stays pending, the buyer can start another attempt
+		if err := p.closeIntent(intent, payment.StatusFailed); err != nil {
+			return payment.StatusFailed, err
+		}
+		return payment.StatusFailed, nil
+
+	case payment.EventRefunded, payment.EventRefundFailed:
+		if event.RefundID == "" {
+			// e.g. stripe's summary of everything refunded on a charge, each refund settles by its own event
+			return payment.StatusSucceeded, nil
+		}
+		if err := p.settleRefund(intent, event); err != nil {
+			return payment.StatusFailed, err
+		}
+		if event.Type == payment.EventRefundFailed {
+			return payment.StatusFailed, nil
+		}
+		return payment.StatusSucceeded, nil
+
+	default:
+		return payment.StatusSucceeded, nil
+	}
+}
+
+func (p *paymentService) Refund(order_id primitive.ObjectID, amount models.Money, key string) (models.Payment, error) {
+	paid, err := p.paidIntent(order_id)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return p.refund(paid, amount, key)
+}
+
+// refund gives amount of the payment of the paid intent back, once per key.
+func (p *paymentService) refund(paid models.Payment, amount models.Money, key string) (models.Payment, error) {
+	order_id := paid.OrderID
+	provider, err := p.providers.Get(paid.Provider)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if amount.Currency != paid.Amount.Currency {
+		return models.Payment{}, money.ErrCurrencyMismatch
+	}
+
+	refund := models.Payment{
+		ID:          primitive.NewObjectID(),
+		OrderID:     order_id,
+		UserID:      paid.UserID,
+		Provider:    provider.Name(),
+		Kind:        PaymentRefund,
+		Reference:   paid.Reference,
+		ProviderRef: paid.ProviderRef,
+		Status:      payment.StatusPending,
+		Amount:      amount,
+		RefundKey:   key,
+		ClaimedAT:   time.Now(),
+		CreatedAT:   time.Now(),
+	}
+	// the record is claimed before the provider is called so a repeated call can't refund twice
+	if _, err = p.col.InsertOne(p.ctx, refund); err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			return models.Payment{}, err
+		}
+		var existing models.Payment
+		filter := bson.D{{Key: "orderId", Value: order_id}, {Key: "refundKey", Value: key}}
+		if err = p.col.FindOne(p.ctx, filter).Decode(&existing); err != nil {
+			return models.Payment{}, err
+		}
+		if existing.Status != payment.StatusFailed {
+			if existing.RefundID != "" {
+				// the provider took it
+				return existing, nil
+			}
+			if time.Since(existing.ClaimedAT) < refundClaimTimeout {
+				// another call is still at the provider, or stopped before saving what it answered
+				return models.Payment{}, ErrRefundPending
+			}
+		}
+
+		// a failed refund or an abandoned claim is sent again, by the one call that claims it anew
+		var claimed interface{} = existing.ClaimedAT
+		if existing.ClaimedAT.IsZero() {
+			// refunds claimed before claims were timed
+			claimed = bson.D{{Key: "$exists", Value: false}}
+		}
+		filter = bson.D{{Key: "_id", Value: existing.ID}, {Key: "status", Value: existing.Status}, {Key: "claimedAt", Value: claimed}}
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: payment.StatusPending}, {Key: "claimedAt", Value: refund.ClaimedAT}}}}
+		result, err := p.col.UpdateOne(p.ctx, filter, updateObj)
+		if err != nil {
+			return models.Payment{}, err
+		}
+		if result.ModifiedCount == 0 {
+			return models.Payment{}, ErrRefundPending
+		}
+		refund.ID, refund.CreatedAT = existing.ID, existing.CreatedAT
+	}
+
+	refunded, err := p.refunded(paid, refund.ID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	var result payment.Result
+	call_err := payment.ErrRefundTooLarge
+	if refunded+amount.Amount <= paid.Amount.Amount {
+		result, call_err = provider.Refund(p.ctx, paid.ProviderRef, amount)
+	}
+	recordCall(&refund, result, call_err)
+	if refund.ProviderRef == "" {
+		refund.ProviderRef = paid.ProviderRef
+	}
+
+	if _, err = p.col.ReplaceOne(p.ctx, bson.D{{Key: "_id", Value: refund.ID}}, refund); err != nil {
+		return models.Payment{}, err
+	}
+	if call_err != nil {
+		return models.Payment{}, call_err
+	}
+	return refund, nil
+}
+
+// settleRefund records what became of a refund the provider accepted, failed refunds are
+// added to the order's events so they are followed up: the amount can be refunded again.
+func (p *paymentService) settleRefund(intent models.Payment, event payment.Event) error {
+	status := payment.StatusSucceeded
+	set := bson.D{{Key: "status", Value: status}}
+	if event.Type == payment.EventRefundFailed {
+		status = payment.StatusFailed
+		set = bson.D{{Key: "status", Value: status}, {Key: "error", Value: "the provider couldn't pay the refund out"}}
+	}
+
+	filter := bson.D{
+		{Key: "provider", Value: intent.Provider},
+		{Key: "reference", Value: intent.Reference},
+		{Key: "kind", Value: PaymentRefund},
+		{Key: "refundId", Value: event.RefundID},
+	}
+	var refund models.Payment
+	if err := p.col.FindOneAndUpdate(p.ctx, filter, bson.D{{Key: "$set", Value: set}}).Decode(&refund); err != nil {
+		if err == mongo.ErrNoDocuments {
+			// the refund isn't saved yet, the provider delivers the event again
+			return ErrPaymentNotFound
+		}
+		return err
+	}
+	if status != payment.StatusFailed || refund.Status == payment.StatusFailed {
+		return nil
+	}
+
+	log.Printf("refund %s of order %s failed at %s", event.RefundID, intent.OrderID.Hex(), intent.Provider)
+	amount := refund.Amount
+	failed := models.OrderEvent{Kind: OrderEventRefundFailed, Amount: &amount, Note: "the payment provider couldn't pay the refund out", At: time.Now()}
+	return p.orders.Record(intent.OrderID, failed)
+}
+
+// openIntent is the intent of the order the buyer can still pay.
+func (p *paymentService) openIntent(order_id primitive.ObjectID) (models.Payment, error) {
+	var intent models.Payment
+	filter := bson.D{{Key: "orderId", Value: order_id}, {Key: "open", Value: true}}
+	if err := p.col.FindOne(p.ctx, filter).Decode(&intent); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Payment{}, ErrPaymentNotFound
+		}
+		return models.Payment{}, err
+	}
+	return intent, nil
+}
+
+func (p *paymentService) CloseIntents(order_id primitive.ObjectID) error {
+	intent, err := p.openIntent(order_id)
+	if err == ErrPaymentNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return p.closeIntent(intent, payment.StatusFailed)
+}
+
+// closeIntent settles an intent, the next payment of its order starts a new one.
+func (p *paymentService) closeIntent(intent models.Payment, status string) error {
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: status}}},
+		{Key: "$unset", Value: bson.D{{Key: "open", Value: ""}}},
+	}
+	_, err := p.col.UpdateByID(p.ctx, intent.ID, updateObj)
+	return err
+}
+
+// paidIntent is the intent whose payment moved the order to paid.
+func (p *paymentService) paidIntent(order_id primitive.ObjectID) (models.Payment, error) {
+	var paid models.Payment
+	filter := bson.D{
+		{Key: "orderId", Value: order_id},
+		{Key: "kind", Value: PaymentWebhook},
+		{Key: "event", Value: payment.EventSucceeded},
+		{Key: "status", Value: payment.StatusSucceeded},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if err := p.col.FindOne(p.ctx, filter, opts).Decode(&paid); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Payment{}, ErrOrderNotPaid
+		}
+		return models.Payment{}, err
+	}
+
+	intent, err := p.findIntent(paid.Provider, payment.Event{Reference: paid.Reference})
+	if err == ErrPaymentNotFound {
+		return models.Payment{}, ErrOrderNotPaid
+	}
+	return intent, err
+}
+
+// refunded sums the refunds of the intent that didn't fail, except the one being made.
+func (p *paymentService) refunded(intent models.Payment, except primitive.ObjectID) (int64, error) {
+	filter := bson.D{
+		{Key: "provider", Value: intent.Provider},
+		{Key: "reference", Value: intent.Reference},
+		{Key: "kind", Value: PaymentRefund},
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: payment.StatusFailed}}},
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: except}}},
+	}
+	cursor, err := p.col.Find(p.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	refunds := []models.Payment{}
+	if err = cursor.All(p.ctx, &refunds); err != nil {
+		return 0, err
+	}
+	total := int64(0)
+	for _, refund := range refunds {
+		total += refund.Amount.Amount
+	}
+	return total, nil
+}
+
+// markPaid moves the pending order of a paid intent to paid, orders that already moved on are left
+// alone except cancelled ones: their payment is refunded.
+func (p *paymentService) markPaid(intent models.Payment, note string) error {
+	order_id := intent.OrderID
+	order, err := p.orders.GetOrder(order_id)
+	if err != nil {
+		return err
+	}
+	if order.Status == OrderCancelled {
+		return p.refundLate(intent)
+	}
+	if order.Status != OrderPending {
+		return nil
+	}
+
+	_, err = p.orders.UpdateStatus(order_id, OrderPaid, note)
+	if err == ErrInvalidOrderTransition {
+		// another delivery moved it first
+		return nil
+	}
+	return err
+}
+
+// refundLate gives back a payment that came in after its order was cancelled and records both on the order.
+// A refund that didn't go through fails the webhook, so the provider's redelivery tries it again.
+func (p *paymentService) refundLate(intent models.Payment) error {
+	amount := intent.Amount
+	refund, err := p.refund(intent, amount, "late-"+intent.ID.Hex())
+	if err == ErrRefundPending {
+		return err
+	} else if err != nil {
+		log.Printf("cannot refund payment %s of cancelled order %s: %v", intent.Reference, intent.OrderID.Hex(), err)
+		failed := models.OrderEvent{Kind: OrderEventRefundFailed, Amount: &amount, Note: err.Error(), At: time.Now()}
+		if record_err := p.orders.Record(intent.OrderID, failed); record_err != nil {
+			log.Printf("cannot record failed refund of order %s: %v", intent.OrderID.Hex(), record_err)
+		}
+		return err
+	}
+
+	now := time.Now()
+	return p.orders.Record(intent.OrderID,
+		models.OrderEvent{Kind: OrderEventPaidAfterCancel, Amount: &amount, Note: "paid with " + intent.Provider + " after the order was cancelled", At: now},
+		models.OrderEvent{Kind: OrderEventRefunded, Amount: &refund.Amount, Note: "refund of the payment made after the order was cancelled", At: now},
+	)
+}
+
+// findIntent finds the intent an event belongs to by our reference, or the provider's when the event lacks ours.
+func (p *paymentService) findIntent(provider string, event payment.Event) (models.Payment, error) {
+	filter := bson.D{{Key: "provider", Value: provider}, {Key: "kind", Value: PaymentIntent}}
+	if event.Reference != "" {
+		filter = append(filter, bson.E{Key: "reference", Value: event.Reference})
+	} else {
+		filter = append(filter, bson.E{Key: "providerRef", Value: event.ProviderRef})
+	}
+
+	var intent models.Payment
+	if err := p.col.FindOne(p.ctx, filter).Decode(&intent); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Payment{}, ErrPaymentNotFound
+		}
+		return models.Payment{}, err
+	}
+	return intent, nil
+}
+
+// Payments lists every record of the payments of one of the buyer's orders, oldest first.
+func (p *paymentService) Payments(order_id primitive.ObjectID, user_id primitive.ObjectID) ([]models.Payment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	filter := bson.D{{Key: "orderId", Value: order_id}, {Key: "userId", Value: user_id}}
+	cursor, err := p.col.Find(p.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []models.Payment{}
+	if err = cursor.All(p.ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// recordCall fills in what a provider call returned, failed calls are recorded too.
+func recordCall(attempt *models.Payment, result payment.Result, err error) {
+	attempt.Raw = string(result.Raw)
+	if err != nil {
+		attempt.Status = payment.StatusFailed
+		attempt.Error = err.Error()
+		return
+	}
+	attempt.Status = result.Status
+	attempt.ProviderRef = result.ProviderRef
+	attempt.RefundID = result.RefundID
+	attempt.ClientSecret = result.ClientSecret
+	attempt.AuthorizationURL = result.AuthorizationURL
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/payment"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPaymentIntentAndRefundFailure(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	_, err := db.Collection("payments").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "orderId", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "open", Value: true}})},
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "eventId", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "eventId", Value: bson.D{{Key: "$type", Value: "string"}}}})},
+		{Keys: bson.D{{Key: "orderId", Value: 1}, {Key: "refundKey", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "refundKey", Value: bson.D{{Key: "$type", Value: "string"}}}})},
+	})
+	require.NoError(t, err)
+
+	user := models.User{ID: primitive.NewObjectID(), Email: "buyer@example.com"}
+	_, err = db.Collection("users").InsertOne(ctx, user)
+	require.NoError(t, err)
+	lines := []models.CartLine{{ProductID: primitive.NewObjectID(), SellerID: primitive.NewObjectID(), Quantity: 1, UnitPrice: models.Money{Amount: 250000, Currency: "NGN"}}}
+	order, err := newOrder(user.ID, lines, time.Now())
+	require.NoError(t, err)
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	_, err = db.Collection("orders").InsertOne(ctx, order)
+	require.NoError(t, err)
+	_, err = db.Collection("sub_orders").InsertOne(ctx, subs[0])
+	require.NoError(t, err)
+
+	fake := payment.NewFake("secret")
+	orders := NewOrderService(ctx, client, db.Collection("orders"), db.Collection("sub_orders"), db.Collection("products"), nil, nil, NewNotificationService(ctx, db.Collection("notifications")))
+	payments := NewPaymentService(ctx, db.Collection("payments"), db.Collection("orders"), db.Collection("users"), orders, payment.NewProviders(fake), fake.Name())
+
+	// a double click on pay gets one intent
+	intents := make([]models.Payment, 5)
+	var wg sync.WaitGroup
+	for i := range intents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			intent, err := payments.Pay(order.ID, user.ID)
+			require.NoError(t, err)
+			intents[i] = intent
+		}(i)
+	}
+	wg.Wait()
+	for _, intent := range intents {
+		require.Equal(t, intents[0].ID, intent.ID)
+	}
+
+	header, body, err := fake.Webhook(payment.EventSucceeded, intents[0].ProviderRef, order.TotalPrice)
+	require.NoError(t, err)
+	require.NoError(t, payments.HandleWebhook(fake.Name(), header, body))
+	paid, err := orders.GetOrder(order.ID)
+	require.NoError(t, err)
+	require.Equal(t, OrderPaid, paid.Status)
+
+	refund, err := payments.Refund(order.ID, models.Money{Amount: 100000, Currency: "NGN"}, "return-1")
+	require.NoError(t, err)
+	require.NotEmpty(t, refund.RefundID)
+
+	// the provider gives up on paying it out later
+	header, body, err = fake.RefundWebhook(payment.EventRefundFailed, intents[0].ProviderRef, refund.RefundID, refund.Amount)
+	require.NoError(t, err)
+	require.NoError(t, payments.HandleWebhook(fake.Name(), header, body))
+
+	var failed models.Payment
+	require.NoError(t, db.Collection("payments").FindOne(ctx, bson.D{{Key: "_id", Value: refund.ID}}).Decode(&failed))
+	require.Equal(t, payment.StatusFailed, failed.Status)
+	paid, err = orders.GetOrder(order.ID)
+	require.NoError(t, err)
+	require.Len(t, paid.Events, 1)
+	require.Equal(t, OrderEventRefundFailed, paid.Events[0].Kind)
+
+	// a claim the provider never answered isn't a refund, it is sent once it has been left long enough
+	claim := models.Payment{ID: primitive.NewObjectID(), OrderID: order.ID, Provider: fake.Name(), Kind: PaymentRefund, Reference: intents[0].Reference,
+		Status: payment.StatusPending, Amount: models.Money{Amount: 50000, Currency: "NGN"}, RefundKey: "return-2", ClaimedAT: time.Now(), CreatedAT: time.Now()}
+	_, err = db.Collection("payments").InsertOne(ctx, claim)
+	require.NoError(t, err)
+	_, err = payments.Refund(order.ID, claim.Amount, "return-2")
+	require.ErrorIs(t, err, ErrRefundPending)
+
+	_, err = db.Collection("payments").UpdateByID(ctx, claim.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "claimedAt", Value: time.Now().Add(-time.Hour)}}}})
+	require.NoError(t, err)
+	refund, err = payments.Refund(order.ID, claim.Amount, "return-2")
+	require.NoError(t, err)
+	require.Equal(t, claim.ID, refund.ID)
+	require.NotEmpty(t, refund.RefundID)
+
+	again, err := payments.Refund(order.ID, claim.Amount, "return-2")
+	require.NoError(t, err)
+	require.Equal(t, refund.RefundID, again.RefundID)
+
+	// an order cancelled while its payment is on the way gets the payment back
+	late, err := newOrder(user.ID, lines, time.Now())
+	require.NoError(t, err)
+	subs, err = SplitOrder(late)
+	require.NoError(t, err)
+	_, err = db.Collection("orders").InsertOne(ctx, late)
+	require.NoError(t, err)
+	_, err = db.Collection("sub_orders").InsertOne(ctx, subs[0])
+	require.NoError(t, err)
+	intent, err := payments.Pay(late.ID, user.ID)
+	require.NoError(t, err)
+
+	returns := NewReturnService(ctx, db.Collection("returns"), orders, payments, NewNotificationService(ctx, db.Collection("notifications")))
+	cancelled, err := returns.CancelOrder(late.ID, user.ID, "changed my mind")
+	require.NoError(t, err)
+	require.Equal(t, OrderCancelled, cancelled.Status)
+	_, err = payments.Pay(late.ID, user.ID)
+	require.ErrorIs(t, err, ErrOrderNotPayable)
+
+	header, body, err = fake.Webhook(payment.EventSucceeded, intent.ProviderRef, late.TotalPrice)
+	require.NoError(t, err)
+	require.NoError(t, payments.HandleWebhook(fake.Name(), header, body))
+
+	var back models.Payment
+	require.NoError(t, db.Collection("payments").FindOne(ctx, bson.D{{Key: "orderId", Value: late.ID}, {Key: "refundKey", Value: "late-" + intent.ID.Hex()}}).Decode(&back))
+	require.Equal(t, late.TotalPrice, back.Amount)
+	require.NotEmpty(t, back.RefundID)
+	cancelled, err = orders.GetOrder(late.ID)
+	require.NoError(t, err)
+	require.Equal(t, OrderCancelled, cancelled.Status)
+	kinds := []string{}
+	for _, event := range cancelled.Events {
+		kinds = append(kinds, event.Kind)
+	}
+	require.Equal(t, []string{OrderEventCancelled, OrderEventPaidAfterCancel, OrderEventRefunded}, kinds)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
 	"kamoushop/pkg/services/types"
 	"time"
 
@@ -14,29 +16,33 @@ import (
 )
 
 type ProductService interface {
-	CreateProduct(prod types.Product, userId primitive.ObjectID) (*mongo.InsertOneResult, error)
-	GetProducts(filter bson.D, options *options.FindOptions) ([]models.Product, int64, error)
+	CreateProduct(prod types.Product, userId primitive.ObjectID, categoryIds []primitive.ObjectID) (*mongo.InsertOneResult, error)
+	ListProducts(query ProductQuery) (pagination.Page[models.Product], error)
+	Feed(user_id primitive.ObjectID, req pagination.Request) (pagination.Page[models.Product], error)
 	GetProdById(id primitive.ObjectID) (models.Product, error)
 	DeleteProduct(id primitive.ObjectID) error
 	UpdateOne(filter bson.D, updateObj bson.D) error
-	AddToCart(product_id primitive.ObjectID, user_id primitive.ObjectID) error
-	RemoveFromCart(product_id primitive.ObjectID, user_id primitive.ObjectID) error
-	MakeOrder(user_id primitive.ObjectID) (models.Order, error)
+	ChangeStatus(id primitive.ObjectID, user_id primitive.ObjectID, status string, publish_at *time.Time) (models.Product, error)
+	PublishDue(now time.Time) (int64, error)
+	UpdatePrice(id primitive.ObjectID, user_id primitive.ObjectID, amount int64) (models.Product, error)
+	SetSale(id primitive.ObjectID, user_id primitive.ObjectID, sale_amount int64, starts_at *time.Time, ends_at *time.Time) (models.Product, error)
+	ClearSale(id primitive.ObjectID, user_id primitive.ObjectID) (models.Product, error)
+	PriceHistory(id primitive.ObjectID, req pagination.Request) (pagination.Page[models.PriceChange], error)
 }
 
 type productService struct {
-	col       *mongo.Collection
-	ctx       context.Context
-	user_col  *mongo.Collection
-	order_col *mongo.Collection
+	col         *mongo.Collection
+	ctx         context.Context
+	user_col    *mongo.Collection
+	history_col *mongo.Collection
 }
 
-func NewProductService(ctx context.Context, col *mongo.Collection, user_col *mongo.Collection, order_col *mongo.Collection) ProductService {
+func NewProductService(ctx context.Context, col *mongo.Collection, user_col *mongo.Collection, history_col *mongo.Collection) ProductService {
 	return &productService{
-		col:       col,
-		ctx:       ctx,
-		user_col:  user_col,
-		order_col: order_col,
+		col:         col,
+		ctx:         ctx,
+		user_col:    user_col,
+		history_col: history_col,
 	}
 }
 
@@ -45,20 +51,44 @@ var (
 	ErrCantUpdateUser  = errors.New("cannot add product to cart")
 	ErrCantRemoveItem  = errors.New("cannot remove item from cart")
 	ErrCantGetItem     = errors.New("cannot get item from cart ")
+	ErrEmptyCart       = errors.New("cart is empty")
 )
 
-func (p *productService) CreateProduct(prod types.Product, userId primitive.ObjectID) (*mongo.InsertOneResult, error) {
+func (p *productService) CreateProduct(prod types.Product, userId primitive.ObjectID, categoryIds []primitive.ObjectID) (*mongo.InsertOneResult, error) {
 	id := primitive.NewObjectID()
 
+	var seller models.User
+	if err := p.user_col.FindOne(p.ctx, bson.D{{Key: "_id", Value: userId}}).Decode(&seller); err != nil {
+		return &mongo.InsertOneResult{}, err
+	}
+
+	status := StatusDraft
+	var published_at *time.Time
+	if prod.PublishAt != nil && prod.PublishAt.After(time.Now()) {
+		status = StatusScheduled
+	} else if prod.Status == StatusPublished {
+		status = StatusPublished
+		now := time.Now()
+		published_at = &now
+	}
+
 	product := models.Product{
-		ID:          id,
-		Price:       int64(prod.Price),
-		Image:       prod.Image,
-		Name:        prod.Name,
-		Description: prod.Description,
-		UserID:      userId,
-		CreatedAT:   time.Now(),
-		UpdatedAT:   time.Now(),
+		ID:            id,
+		Price:         money.New(int64(prod.Price), seller.Currency),
+		Image:         prod.Image,
+		Name:          prod.Name,
+		Description:   prod.Description,
+		Stock:         prod.Stock,
+		Weight:        prod.Weight,
+		UserID:        userId,
+		CategoryIDs:   categoryIds,
+		Brand:         seller.BrandName,
+		CategoryNames: prod.CategoryNames,
+		Status:        status,
+		PublishAt:     prod.PublishAt,
+		PublishedAt:   published_at,
+		CreatedAT:     time.Now(),
+		UpdatedAT:     time.Now(),
 	}
 
 	result, err := p.col.InsertOne(p.ctx, &product, options.InsertOne())
@@ -69,24 +99,40 @@ func (p *productService) CreateProduct(prod types.Product, userId primitive.Obje
 	return result, nil
 }
 
-func (p *productService) GetProducts(filter bson.D, options *options.FindOptions) ([]models.Product, int64, error) {
-	products := []models.Product{}
-	cursor, err := p.col.Find(p.ctx, filter, options)
+func (p *productService) ListProducts(query ProductQuery) (pagination.Page[models.Product], error) {
+	if err := query.Validate(); err != nil {
+		return pagination.Page[models.Product]{}, err
+	}
 
+	page, err := pagination.Aggregate(p.ctx, p.col, query.Stages(), query.Request(), query.SortKey(), query.Key)
 	if err != nil {
-		return nil, 0, err
+		return pagination.Page[models.Product]{}, err
 	}
+	return pricedPage(page, query.At), nil
+}
 
-	if err = cursor.All(p.ctx, &products); err != nil {
-		return nil, 0, err
+// Feed lists the newest published products of the shops the user has starred.
+func (p *productService) Feed(user_id primitive.ObjectID, req pagination.Request) (pagination.Page[models.Product], error) {
+	plan, err := pagination.NewPlan(req, pagination.Sort{})
+	if err != nil {
+		return pagination.Page[models.Product]{}, err
 	}
 
-	count, err := p.col.CountDocuments(p.ctx, filter)
+	shop_ids, err := p.user_col.Distinct(p.ctx, "_id", bson.D{{Key: "starredBy", Value: user_id}})
 	if err != nil {
-		return nil, 0, err
+		return pagination.Page[models.Product]{}, err
+	}
+	if len(shop_ids) == 0 {
+		return pagination.Page[models.Product]{Items: []models.Product{}, Limit: plan.Limit}, nil
 	}
 
-	return products, count, nil
+	query := ProductQuery{Sort: SortNewest, Limit: req.Limit, Cursor: req.Cursor}
+	for _, id := range shop_ids {
+		if shop_id, ok := id.(primitive.ObjectID); ok {
+			query.ShopIDs = append(query.ShopIDs, shop_id)
+		}
+	}
+	return p.ListProducts(query)
 }
 
 func (p *productService) GetProdById(id primitive.ObjectID) (models.Product, error) {
@@ -95,7 +141,7 @@ func (p *productService) GetProdById(id primitive.ObjectID) (models.Product, err
 	if err := p.col.FindOne(p.ctx, filter, options.FindOne()).Decode(&product); err != nil {
 		return models.Product{}, err
 	}
-	return product, nil
+	return priced(product, time.Now()), nil
 }
 
 func (p *productService) DeleteProduct(id primitive.ObjectID) error {
@@ -113,73 +159,62 @@ func (p *productService) UpdateOne(filter bson.D, updateObj bson.D) error {
 	return nil
 }
 
-func (p *productService) AddToCart(product_id primitive.ObjectID, user_id primitive.ObjectID) error {
-	cursor, err := p.col.Find(p.ctx, bson.D{primitive.E{Key: "_id", Value: product_id}})
-
-	if err != nil {
-		return ErrCantFindProduct
+func (p *productService) ChangeStatus(id primitive.ObjectID, user_id primitive.ObjectID, status string, publish_at *time.Time) (models.Product, error) {
+	var product models.Product
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	if err := p.col.FindOne(p.ctx, filter).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Product{}, ErrCantFindProduct
+		}
+		return models.Product{}, err
 	}
 
-	var cart_prod []models.Prod
-
-	if err = cursor.All(p.ctx, &cart_prod); err != nil {
-		return err
+	if err := checkTransition(product.Status, status, publish_at); err != nil {
+		return models.Product{}, err
 	}
 
-	updateObj := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "userCart.products", Value: bson.D{{Key: "$each", Value: cart_prod}}}}}}
+	now := time.Now()
+	set := bson.D{{Key: "status", Value: status}, {Key: "updatedAt", Value: now}}
+	unset := bson.D{}
 
-	filter := bson.D{primitive.E{Key: "_id", Value: user_id}}
-	if _, err := p.user_col.UpdateOne(p.ctx, filter, updateObj); err != nil {
-		return ErrCantUpdateUser
+	switch status {
+	case StatusScheduled:
+		set = append(set, bson.E{Key: "publishAt", Value: publish_at})
+	case StatusPublished:
+		set = append(set, bson.E{Key: "publishedAt", Value: now})
+		unset = append(unset, bson.E{Key: "publishAt", Value: ""})
+	default:
+		unset = append(unset, bson.E{Key: "publishAt", Value: ""})
 	}
-	return nil
-}
 
-func (p *productService) RemoveFromCart(product_id primitive.ObjectID, user_id primitive.ObjectID) error {
-	filter := bson.D{primitive.E{Key: "_id", Value: user_id}}
-	update := bson.M{"$pull": bson.M{"userCart.products": bson.M{"_id": product_id}}}
-	if _, err := p.user_col.UpdateMany(p.ctx, filter, update); err != nil {
-		return err
+	// the status filter makes a concurrent change (e.g. the scheduler publishing) lose instead of being overwritten
+	filter = append(filter, bson.E{Key: "status", Value: product.Status})
+	updateObj := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		updateObj = append(updateObj, bson.E{Key: "$unset", Value: unset})
 	}
-	return nil
-}
 
-func (p *productService) MakeOrder(user_id primitive.ObjectID) (models.Order, error) {
-	var user models.User
-	filter := bson.D{primitive.E{Key: "_id", Value: user_id}}
-
-	if err := p.user_col.FindOne(p.ctx, filter, options.FindOne()).Decode(&user); err != nil {
-		return models.Order{}, err
-	}
-
-	var price int64 = 0
-	for _, prod := range user.UserCart.Products {
-		p := prod.Price * 100
-		price += p
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := p.col.FindOneAndUpdate(p.ctx, filter, updateObj, opts).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Product{}, ErrInvalidTransition
+		}
+		return models.Product{}, err
 	}
+	return priced(product, now), nil
+}
 
-	order := models.Order{
-		ID:         primitive.NewObjectID(),
-		UserID:     user_id,
-		TotalPrice: price / 100,
-		CreatedAT:  time.Now(),
-		UpdatedAT:  time.Now(),
+// PublishDue publishes every scheduled product whose publish time has passed.
+func (p *productService) PublishDue(now time.Time) (int64, error) {
+	filter := bson.D{{Key: "status", Value: StatusScheduled}, {Key: "publishAt", Value: bson.D{{Key: "$lte", Value: now}}}}
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: StatusPublished}, {Key: "publishedAt", Value: now}, {Key: "updatedAt", Value: now}}},
+		{Key: "$unset", Value: bson.D{{Key: "publishAt", Value: ""}}},
 	}
 
-	// Add to the order model
-	_, err := p.order_col.InsertOne(p.ctx, order, options.InsertOne())
+	result, err := p.col.UpdateMany(p.ctx, filter, updateObj)
 	if err != nil {
-		return models.Order{}, err
+		return 0, err
 	}
-
-	user_empty_cart := models.UserCart{
-		Products: []models.Prod{},
-	}
-	// Delete user cart
-	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "userCart", Value: user_empty_cart}}}}
-	if _, err = p.user_col.UpdateByID(p.ctx, user_id, updateObj, options.Update()); err != nil {
-		return models.Order{}, err
-	}
-
-	return order, nil
+	return result.ModifiedCount, nil
 }
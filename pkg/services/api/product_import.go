@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/catalog"
+	"kamoushop/pkg/services/money"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ImageFetcher copies a remote image into our own storage and returns its new url.
+type ImageFetcher func(ctx context.Context, url string) (string, error)
+
+type ImportService interface {
+	Import(user_id primitive.ObjectID, rows []catalog.Row, row_errors []catalog.RowError, dry_run bool) (catalog.Report, error)
+	Export(user_id primitive.ObjectID, w catalog.Writer) error
+}
+
+type importService struct {
+	col         *mongo.Collection
+	user_col    *mongo.Collection
+	history_col *mongo.Collection
+	cats        CategoryService
+	fetch       ImageFetcher
+	ctx         context.Context
+}
+
+func NewImportService(ctx context.Context, col *mongo.Collection, user_col *mongo.Collection, history_col *mongo.Collection, cats CategoryService, fetch ImageFetcher) ImportService {
+	return &importService{
+		col:         col,
+		user_col:    user_col,
+		history_col: history_col,
+		cats:        cats,
+		fetch:       fetch,
+		ctx:         ctx,
+	}
+}
+
+type imageJob struct {
+	product_id primitive.ObjectID
+	url        string
+}
+
+// Import validates every row and, unless it is a dry run, upserts the valid ones by the seller's sku.
+// Images are fetched in the background once the rows are saved.
+func (i *importService) Import(user_id primitive.ObjectID, rows []catalog.Row, row_errors []catalog.RowError, dry_run bool) (catalog.Report, error) {
+	report := catalog.Report{DryRun: dry_run, Total: len(rows) + len(row_errors), Errors: append([]catalog.RowError{}, row_errors...)}
+
+	var seller models.User
+	if err := i.user_col.FindOne(i.ctx, bson.D{{Key: "_id", Value: user_id}}).Decode(&seller); err != nil {
+		return catalog.Report{}, err
+	}
+
+	seen := map[string]int{}
+	jobs := []imageJob{}
+
+	for _, row := range rows {
+		problems := catalog.Validate(row)
+		if row.Currency != "" && row.Currency != seller.Currency {
+			problems = append(problems, fmt.Sprintf("currency must be the shop currency %s", seller.Currency))
+		}
+
+		if line, ok := seen[row.SKU]; ok && row.SKU != "" {
+			problems = append(problems, fmt.Sprintf("sku already used on line %d", line))
+		}
+		seen[row.SKU] = row.Line
+
+		category_ids, err := i.cats.ResolveSlugs(row.Categories)
+		if err == ErrCategoryNotFound {
+			problems = append(problems, "unknown category")
+		} else if err != nil {
+			return catalog.Report{}, err
+		}
+
+		if len(problems) > 0 {
+			report.Errors = append(report.Errors, catalog.RowError{Line: row.Line, SKU: row.SKU, Errors: problems})
+			continue
+		}
+		report.Valid++
+
+		if dry_run {
+			continue
+		}
+
+		category_names, err := i.cats.SearchNames(category_ids)
+		if err != nil {
+			return catalog.Report{}, err
+		}
+
+		id, created, err := i.upsert(seller, row, category_ids, category_names)
+		if err != nil {
+			report.Errors = append(report.Errors, catalog.RowError{Line: row.Line, SKU: row.SKU, Errors: []string{err.Error()}})
+			report.Valid--
+			continue
+		}
+
+		if created {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+
+		if row.ImageURL != "" {
+			jobs = append(jobs, imageJob{product_id: id, url: row.ImageURL})
+		}
+	}
+
+	if len(jobs) > 0 {
+		go i.fetchImages(jobs)
+	}
+
+	return report, nil
+}
+
+// upsert writes row onto the seller's product with the same sku, status is only taken from the row
+// when the product is created, after that it moves through ChangeStatus like any other product.
+func (i *importService) upsert(seller models.User, row catalog.Row, category_ids []primitive.ObjectID, category_names []string) (primitive.ObjectID, bool, error) {
+	now := time.Now()
+	id := primitive.NewObjectID()
+	price := money.New(row.Price, seller.Currency)
+
+	status := StatusDraft
+	insert := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "userId", Value: seller.ID},
+		{Key: "sku", Value: row.SKU},
+		{Key: "rating", Value: 0},
+		{Key: "sales", Value: 0},
+		{Key: "createdAt", Value: now},
+	}
+	if row.Status == StatusPublished {
+		status = StatusPublished
+		insert = append(insert, bson.E{Key: "publishedAt", Value: now})
+	}
+	insert = append(insert, bson.E{Key: "status", Value: status})
+
+	// a product whose sale price is not below the new price is left alone, the upsert then runs into
+	// the unique sku index instead of creating a second product
+	filter := bson.D{
+		{Key: "userId", Value: seller.ID},
+		{Key: "sku", Value: row.SKU},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "salePrice", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "salePrice.amount", Value: bson.D{{Key: "$lt", Value: row.Price}}}},
+		}},
+	}
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: row.Name},
+			{Key: "description", Value: row.Description},
+			{Key: "price", Value: price},
+			{Key: "stock", Value: row.Stock},
+			{Key: "categoryIds", Value: category_ids},
+			{Key: "categoryNames", Value: category_names},
+			{Key: "brand", Value: seller.BrandName},
+			{Key: "updatedAt", Value: now},
+		}},
+		{Key: "$setOnInsert", Value: insert},
+	}
+
+	// the document before the update tells apart a new product from a changed one and gives the old price
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	var product models.Product
+	if err := i.col.FindOneAndUpdate(i.ctx, filter, updateObj, opts).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return id, true, nil
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return primitive.NilObjectID, false, ErrInvalidSalePrice
+		}
+		return primitive.NilObjectID, false, err
+	}
+
+	if product.Price != price {
+		change := models.PriceChange{
+			ID:        primitive.NewObjectID(),
+			ProductID: product.ID,
+			SellerID:  seller.ID,
+			Kind:      PriceChangePrice,
+			OldPrice:  product.Price,
+			NewPrice:  price,
+			ChangedAT: now,
+		}
+		if _, err := i.history_col.InsertOne(i.ctx, change, options.InsertOne()); err != nil {
+			return primitive.NilObjectID, false, err
+		}
+	}
+
+	return product.ID, false, nil
+}
+
+func (i *importService) fetchImages(jobs []imageJob) {
+	for _, job := range jobs {
+		image, err := i.fetch(i.ctx, job.url)
+		if err != nil {
+			log.Printf("import: cannot fetch image %s for product %s: %v", job.url, job.product_id.Hex(), err)
+			continue
+		}
+
+		updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "image", Value: image}}}}
+		if _, err = i.col.UpdateByID(i.ctx, job.product_id, updateObj, options.Update()); err != nil {
+			log.Printf("import: cannot save image for product %s: %v", job.product_id.Hex(), err)
+		}
+	}
+}
+
+// Export streams every product of the seller, whatever its status, to w.
+func (i *importService) Export(user_id primitive.ObjectID, w catalog.Writer) error {
+	slugs, err := i.cats.SlugsByID()
+	if err != nil {
+		return err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := i.col.Find(i.ctx, bson.D{{Key: "userId", Value: user_id}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(i.ctx)
+
+	for cursor.Next(i.ctx) {
+		var product models.Product
+		if err = cursor.Decode(&product); err != nil {
+			return err
+		}
+
+		categories := []string{}
+		for _, id := range product.CategoryIDs {
+			if slug, ok := slugs[id]; ok {
+				categories = append(categories, slug)
+			}
+		}
+
+		row := catalog.Row{
+			SKU:         product.SKU,
+			Name:        product.Name,
+			Description: product.Description,
+			Price:       product.Price.Amount,
+			Currency:    product.Price.Currency,
+			Stock:       product.Stock,
+			Categories:  categories,
+			ImageURL:    product.Image,
+			Status:      product.Status,
+		}
+		if err = w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
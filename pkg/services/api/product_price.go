@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PriceChangePrice = "price"
+	PriceChangeSale  = "sale"
+)
+
+var (
+	ErrInvalidPrice     = errors.New("price must be greater than 0")
+	ErrInvalidSalePrice = errors.New("sale price must be greater than 0 and lower than the regular price")
+	ErrInvalidSaleDates = errors.New("a sale must end after it starts and cannot end in the past")
+)
+
+// UpdatePrice changes the regular price of one of the seller's products and records the change,
+// amount is in the minor unit of the product's currency.
+func (p *productService) UpdatePrice(id primitive.ObjectID, user_id primitive.ObjectID, amount int64) (models.Product, error) {
+	if amount <= 0 {
+		return models.Product{}, ErrInvalidPrice
+	}
+
+	product, err := p.ownProduct(id, user_id)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if product.SalePrice != nil && product.SalePrice.Amount >= amount {
+		return models.Product{}, ErrInvalidSalePrice
+	}
+
+	if product.Price.Amount == amount {
+		return priced(product, time.Now()), nil
+	}
+
+	now := time.Now()
+	price := money.New(amount, product.Price.Currency)
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}, {Key: "price.amount", Value: product.Price.Amount}}
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "price", Value: price}, {Key: "updatedAt", Value: now}}},
+		{Key: "$unset", Value: bson.D{{Key: "legacyPrice", Value: ""}}},
+	}
+
+	updated, err := p.updateProduct(filter, updateObj)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	change := models.PriceChange{
+		ID:        primitive.NewObjectID(),
+		ProductID: id,
+		SellerID:  user_id,
+		Kind:      PriceChangePrice,
+		OldPrice:  product.Price,
+		NewPrice:  price,
+		ChangedAT: now,
+	}
+	if _, err = p.history_col.InsertOne(p.ctx, change, options.InsertOne()); err != nil {
+		return models.Product{}, err
+	}
+
+	return priced(updated, now), nil
+}
+
+// SetSale puts one of the seller's products on sale, with no dates the sale runs until it is cleared.
+func (p *productService) SetSale(id primitive.ObjectID, user_id primitive.ObjectID, sale_amount int64, starts_at *time.Time, ends_at *time.Time) (models.Product, error) {
+	product, err := p.ownProduct(id, user_id)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if sale_amount <= 0 || sale_amount >= product.Price.Amount {
+		return models.Product{}, ErrInvalidSalePrice
+	}
+	sale_price := money.New(sale_amount, product.Price.Currency)
+
+	now := time.Now()
+	if ends_at != nil && (!ends_at.After(now) || (starts_at != nil && !ends_at.After(*starts_at))) {
+		return models.Product{}, ErrInvalidSaleDates
+	}
+
+	set := bson.D{{Key: "salePrice", Value: sale_price}, {Key: "updatedAt", Value: now}}
+	unset := bson.D{}
+
+	if starts_at != nil {
+		set = append(set, bson.E{Key: "saleStartsAt", Value: starts_at})
+	} else {
+		unset = append(unset, bson.E{Key: "saleStartsAt", Value: ""})
+	}
+	if ends_at != nil {
+		set = append(set, bson.E{Key: "saleEndsAt", Value: ends_at})
+	} else {
+		unset = append(unset, bson.E{Key: "saleEndsAt", Value: ""})
+	}
+
+	updateObj := bson.D{{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		updateObj = append(updateObj, bson.E{Key: "$unset", Value: unset})
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	updated, err := p.updateProduct(filter, updateObj)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	change := models.PriceChange{
+		ID:           primitive.NewObjectID(),
+		ProductID:    id,
+		SellerID:     user_id,
+		Kind:         PriceChangeSale,
+		OldPrice:     product.Price,
+		NewPrice:     product.Price,
+		SalePrice:    &sale_price,
+		SaleStartsAt: starts_at,
+		SaleEndsAt:   ends_at,
+		ChangedAT:    now,
+	}
+	if _, err = p.history_col.InsertOne(p.ctx, change, options.InsertOne()); err != nil {
+		return models.Product{}, err
+	}
+
+	return priced(updated, now), nil
+}
+
+func (p *productService) ClearSale(id primitive.ObjectID, user_id primitive.ObjectID) (models.Product, error) {
+	product, err := p.ownProduct(id, user_id)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	now := time.Now()
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	updateObj := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: now}}},
+		{Key: "$unset", Value: bson.D{{Key: "salePrice", Value: ""}, {Key: "saleStartsAt", Value: ""}, {Key: "saleEndsAt", Value: ""}}},
+	}
+
+	updated, err := p.updateProduct(filter, updateObj)
+	if err != nil {
+		return models.Product{}, err
+	}
+
+	if product.SalePrice != nil {
+		change := models.PriceChange{
+			ID:        primitive.NewObjectID(),
+			ProductID: id,
+			SellerID:  user_id,
+			Kind:      PriceChangeSale,
+			OldPrice:  product.Price,
+			NewPrice:  product.Price,
+			ChangedAT: now,
+		}
+		if _, err = p.history_col.InsertOne(p.ctx, change, options.InsertOne()); err != nil {
+			return models.Product{}, err
+		}
+	}
+
+	return priced(updated, now), nil
+}
+
+func (p *productService) PriceHistory(id primitive.ObjectID, req pagination.Request) (pagination.Page[models.PriceChange], error) {
+	filter := bson.D{{Key: "productId", Value: id}}
+	key := func(change models.PriceChange) (interface{}, primitive.ObjectID) {
+		return change.ID, change.ID
+	}
+	return pagination.Find(p.ctx, p.history_col, filter, req, pagination.Sort{Field: "_id", Desc: true}, key)
+}
+
+func (p *productService) ownProduct(id primitive.ObjectID, user_id primitive.ObjectID) (models.Product, error) {
+	var product models.Product
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	if err := p.col.FindOne(p.ctx, filter).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Product{}, ErrCantFindProduct
+		}
+		return models.Product{}, err
+	}
+	return product, nil
+}
+
+func (p *productService) updateProduct(filter bson.D, updateObj bson.D) (models.Product, error) {
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := p.col.FindOneAndUpdate(p.ctx, filter, updateObj, opts).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Product{}, ErrCantFindProduct
+		}
+		return models.Product{}, err
+	}
+	return product, nil
+}
+
+// EffectiveAmountExpr is EffectivePriceAt as an aggregation expression, the amount a product
+// sells for at the given moment.
+func EffectiveAmountExpr(at time.Time) bson.D {
+	on_sale := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$ne", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$salePrice", nil}}}, nil}}},
+		bson.D{{Key: "$lte", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$saleStartsAt", at}}}, at}}},
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$saleEndsAt", nil}}}, nil}}},
+			bson.D{{Key: "$gt", Value: bson.A{"$saleEndsAt", at}}},
+		}}},
+	}}}
+	return bson.D{{Key: "$cond", Value: bson.A{on_sale, "$salePrice.amount", "$price.amount"}}}
+}
+
+// priced fills in the price the product sells for at the given moment.
+func priced(product models.Product, at time.Time) models.Product {
+	product.EffectivePrice = product.EffectivePriceAt(at)
+	return product
+}
+
+func pricedPage(page pagination.Page[models.Product], at time.Time) pagination.Page[models.Product] {
+	for i := range page.Items {
+		page.Items[i] = priced(page.Items[i], at)
+	}
+	return page
+}
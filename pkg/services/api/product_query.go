@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	SortNewest     = "newest"
+	SortPriceAsc   = "price_asc"
+	SortPriceDesc  = "price_desc"
+	SortRating     = "rating"
+	SortPopularity = "popularity"
+)
+
+var (
+	ErrInvalidPriceRange = errors.New("min_price cannot be greater than max_price")
+	ErrInvalidSort       = errors.New("sort must be one of newest, price_asc, price_desc, rating or popularity")
+)
+
+// ProductQuery is the typed form of every product listing, controllers fill it in
+// and ListProducts validates it and turns it into a mongo query.
+type ProductQuery struct {
+	// price bounds are minor units of the listing currency and apply to the price a product sells for
+	// at At, sales included, shops in other currencies are not converted
+	MinPrice    int64
+	MaxPrice    int64
+	Currency    string
+	CategoryIDs []primitive.ObjectID
+	ShopID      *primitive.ObjectID
+	// any of these shops, used for the feed of followed shops
+	ShopIDs      []primitive.ObjectID
+	InStock      bool
+	CreatedAfter time.Time
+	// defaults to published only, sellers looking at their own shop pass ProductStatuses
+	Statuses []string
+	Sort     string
+	Limit    int64
+	Cursor   string
+	// moment prices are compared at, Validate sets it to now
+	At time.Time
+}
+
+// Validate checks the query and fills in the default sort, the limit and cursor are checked by the pagination plan.
+func (q *ProductQuery) Validate() error {
+	if q.MinPrice < 0 || q.MaxPrice < 0 || (q.MaxPrice > 0 && q.MinPrice > q.MaxPrice) {
+		return ErrInvalidPriceRange
+	}
+
+	if q.Currency != "" && !money.Valid(q.Currency) {
+		return money.ErrUnknownCurrency
+	}
+
+	if q.At.IsZero() {
+		q.At = time.Now()
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = SortNewest
+	case SortNewest, SortPriceAsc, SortPriceDesc, SortRating, SortPopularity:
+	default:
+		return ErrInvalidSort
+	}
+	return nil
+}
+
+func (q ProductQuery) Filter() bson.D {
+	statuses := q.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{StatusPublished}
+	}
+	filter := bson.D{{Key: "status", Value: bson.D{{Key: "$in", Value: statuses}}}}
+
+	if q.Currency != "" {
+		filter = append(filter, bson.E{Key: "price.currency", Value: q.Currency})
+	}
+
+	if len(q.CategoryIDs) > 0 {
+		filter = append(filter, bson.E{Key: "categoryIds", Value: bson.D{{Key: "$in", Value: q.CategoryIDs}}})
+	}
+
+	if q.ShopID != nil {
+		filter = append(filter, bson.E{Key: "userId", Value: *q.ShopID})
+	}
+	if len(q.ShopIDs) > 0 {
+		filter = append(filter, bson.E{Key: "userId", Value: bson.D{{Key: "$in", Value: q.ShopIDs}}})
+	}
+
+	if q.InStock {
+		filter = append(filter, bson.E{Key: "stock", Value: bson.D{{Key: "$gt", Value: 0}}})
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		filter = append(filter, bson.E{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: q.CreatedAfter}}})
+	}
+
+	return filter
+}
+
+// Stages selects the products of the query and adds effectiveAmount, the amount they sell for at At,
+// which the price bounds and the price sorts use.
+func (q ProductQuery) Stages() mongo.Pipeline {
+	stages := mongo.Pipeline{
+		{{Key: "$match", Value: q.Filter()}},
+		{{Key: "$addFields", Value: bson.D{{Key: "effectiveAmount", Value: EffectiveAmountExpr(q.At)}}}},
+	}
+
+	price := bson.D{}
+	if q.MinPrice > 0 {
+		price = append(price, bson.E{Key: "$gte", Value: q.MinPrice})
+	}
+	if q.MaxPrice > 0 {
+		price = append(price, bson.E{Key: "$lte", Value: q.MaxPrice})
+	}
+	if len(price) > 0 {
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.D{{Key: "effectiveAmount", Value: price}}}})
+	}
+	return stages
+}
+
+func (q ProductQuery) SortKey() pagination.Sort {
+	switch q.Sort {
+	case SortPriceAsc:
+		return pagination.Sort{Field: "effectiveAmount"}
+	case SortPriceDesc:
+		return pagination.Sort{Field: "effectiveAmount", Desc: true}
+	case SortRating:
+		return pagination.Sort{Field: "rating", Desc: true}
+	case SortPopularity:
+		return pagination.Sort{Field: "sales", Desc: true}
+	default:
+		return pagination.Sort{Field: "createdAt", Desc: true}
+	}
+}
+
+// Key returns the value of the sort key of product, cursors are built from it.
+func (q ProductQuery) Key(product models.Product) (interface{}, primitive.ObjectID) {
+	switch q.Sort {
+	case SortPriceAsc, SortPriceDesc:
+		return product.EffectivePriceAt(q.At).Amount, product.ID
+	case SortRating:
+		return product.Rating, product.ID
+	case SortPopularity:
+		return product.Sales, product.ID
+	default:
+		return product.CreatedAT, product.ID
+	}
+}
+
+func (q ProductQuery) Request() pagination.Request {
+	return pagination.Request{Limit: q.Limit, Cursor: q.Cursor}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/pagination"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductQueryValidate(t *testing.T) {
+	q := ProductQuery{}
+	require.NoError(t, q.Validate())
+	require.Equal(t, SortNewest, q.Sort)
+
+	q = ProductQuery{MinPrice: 500, MaxPrice: 100}
+	require.ErrorIs(t, q.Validate(), ErrInvalidPriceRange)
+
+	q = ProductQuery{Sort: "cheapest"}
+	require.ErrorIs(t, q.Validate(), ErrInvalidSort)
+}
+
+func TestProductQueryFilter(t *testing.T) {
+	shop := primitive.NewObjectID()
+	category := primitive.NewObjectID()
+	after := time.Now().Add(-time.Hour)
+
+	q := ProductQuery{
+		MinPrice:     100,
+		MaxPrice:     900,
+		CategoryIDs:  []primitive.ObjectID{category},
+		ShopID:       &shop,
+		InStock:      true,
+		CreatedAfter: after,
+		Currency:     "NGN",
+		Sort:         SortPriceAsc,
+	}
+	require.NoError(t, q.Validate())
+
+	require.Equal(t, bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []string{StatusPublished}}}},
+		{Key: "price.currency", Value: "NGN"},
+		{Key: "categoryIds", Value: bson.D{{Key: "$in", Value: []primitive.ObjectID{category}}}},
+		{Key: "userId", Value: shop},
+		{Key: "stock", Value: bson.D{{Key: "$gt", Value: 0}}},
+		{Key: "createdAt", Value: bson.D{{Key: "$gt", Value: after}}},
+	}, q.Filter())
+
+	require.Equal(t, pagination.Sort{Field: "effectiveAmount"}, q.SortKey())
+
+	stages := q.Stages()
+	require.Len(t, stages, 3)
+	require.Equal(t, bson.D{{Key: "$match", Value: bson.D{
+		{Key: "effectiveAmount", Value: bson.D{{Key: "$gte", Value: int64(100)}, {Key: "$lte", Value: int64(900)}}},
+	}}}, stages[2])
+	require.Len(t, ProductQuery{}.Stages(), 2)
+	require.Len(t, ProductQuery{}.Filter(), 1)
+
+	shops := []primitive.ObjectID{shop}
+	require.Equal(t, bson.E{Key: "userId", Value: bson.D{{Key: "$in", Value: shops}}}, ProductQuery{ShopIDs: shops}.Filter()[1])
+}
+
+func TestProductQueryKeyUsesSalePrice(t *testing.T) {
+	now := time.Now()
+	ends := now.Add(time.Hour)
+	sale := models.Money{Amount: 700, Currency: "NGN"}
+	product := models.Product{ID: primitive.NewObjectID(), Price: models.Money{Amount: 1000, Currency: "NGN"}, SalePrice: &sale, SaleEndsAt: &ends}
+
+	q := ProductQuery{Sort: SortPriceAsc, At: now}
+	key, _ := q.Key(product)
+	require.Equal(t, int64(700), key)
+
+	q.At = ends
+	key, _ = q.Key(product)
+	require.Equal(t, int64(1000), key)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusDraft       = "draft"
+	StatusScheduled   = "scheduled"
+	StatusPublished   = "published"
+	StatusUnpublished = "unpublished"
+	StatusArchived    = "archived"
+)
+
+var (
+	ErrInvalidStatus     = errors.New("status must be one of draft, scheduled, published, unpublished or archived")
+	ErrInvalidTransition = errors.New("product cannot move to that status from its current one")
+	ErrPublishAtRequired = errors.New("publish_at must be set in the future to schedule a product")
+)
+
+// productTransitions lists the statuses a product may move to from each status.
+var productTransitions = map[string][]string{
+	StatusDraft:       {StatusScheduled, StatusPublished, StatusArchived},
+	StatusScheduled:   {StatusDraft, StatusPublished, StatusArchived},
+	StatusPublished:   {StatusUnpublished, StatusArchived},
+	StatusUnpublished: {StatusDraft, StatusScheduled, StatusPublished, StatusArchived},
+	StatusArchived:    {StatusDraft},
+}
+
+// ProductStatuses are all the statuses a product can be in.
+var ProductStatuses = []string{StatusDraft, StatusScheduled, StatusPublished, StatusUnpublished, StatusArchived}
+
+func CanTransition(from string, to string) bool {
+	for _, next := range productTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTransition validates a status change, publish_at is only used when scheduling.
+func checkTransition(from string, to string, publish_at *time.Time) error {
+	if _, ok := productTransitions[to]; !ok {
+		return ErrInvalidStatus
+	}
+
+	if !CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+
+	if to == StatusScheduled && (publish_at == nil || !publish_at.After(time.Now())) {
+		return ErrPublishAtRequired
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTransition(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+
+	require.NoError(t, checkTransition(StatusDraft, StatusPublished, nil))
+	require.NoError(t, checkTransition(StatusDraft, StatusScheduled, &later))
+	require.NoError(t, checkTransition(StatusPublished, StatusArchived, nil))
+	require.NoError(t, checkTransition(StatusArchived, StatusDraft, nil))
+
+	require.ErrorIs(t, checkTransition(StatusDraft, "live", nil), ErrInvalidStatus)
+	require.ErrorIs(t, checkTransition(StatusArchived, StatusPublished, nil), ErrInvalidTransition)
+	require.ErrorIs(t, checkTransition(StatusPublished, StatusDraft, nil), ErrInvalidTransition)
+	require.ErrorIs(t, checkTransition(StatusDraft, StatusScheduled, nil), ErrPublishAtRequired)
+	require.ErrorIs(t, checkTransition(StatusDraft, StatusScheduled, &earlier), ErrPublishAtRequired)
+}
@@ -0,0 +1,619 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/types"
+	"math/big"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PromotionPercentage = "percentage"
+	PromotionFixed      = "fixed"
+	PromotionBuyXGetY   = "buy_x_get_y"
+
+	PromotionScopeShop     = "shop"
+	PromotionScopeProducts = "products"
+)
+
+var (
+	ErrPromotionNotFound      = errors.New("promotion not found")
+	ErrPromotionExists        = errors.New("a promotion with this code already exists")
+	ErrInvalidPromotionKind   = errors.New("promotion kind must be percentage, fixed or buy_x_get_y")
+	ErrInvalidPercent         = errors.New("percent must be between 1 and 100")
+	ErrInvalidDiscount        = errors.New("a fixed promotion needs an amount greater than 0")
+	ErrInvalidBuyXGetY        = errors.New("buy and get must both be at least 1")
+	ErrInvalidPromotionScope  = errors.New("scope must be shop, or products with at least one valid product id")
+	ErrInvalidPromotionSeller = errors.New("seller_id must be the id of the seller running the promotion")
+	ErrInvalidPromotionDates  = errors.New("a promotion must end after it starts")
+	ErrInvalidPromotionLimits = errors.New("usage limits cannot be negative")
+	ErrCouponNotFound         = errors.New("coupon not found")
+	ErrCouponExpired          = errors.New("coupon is not valid at this time")
+	ErrCouponMinSpend         = errors.New("the items the coupon applies to don't reach its minimum spend")
+	ErrCouponNotApplicable    = errors.New("coupon doesn't apply to anything in the cart")
+	ErrPromotionUsedUp        = errors.New("promotion has reached its usage limit")
+)
+
+type PromotionService interface {
+	CreatePromotion(data types.AddPromotion) (models.Promotion, error)
+	// UpdatePromotion changes how long and how often a promotion can be used, what it takes off is fixed once created.
+	UpdatePromotion(id primitive.ObjectID, data types.UpdatePromotion) (models.Promotion, error)
+	GetPromotion(id primitive.ObjectID) (models.Promotion, error)
+	GetPromotions(req pagination.Request) (pagination.Page[models.Promotion], error)
+	// Apply takes the automatic promotions and the coupon with code, if any, off a new order and records
+	// that its buyer used them. ctx should be the session context of the checkout placing the order.
+	Apply(ctx context.Context, order *models.Order, code string, now time.Time) error
+	// Release gives back the uses of the promotions an order was placed with once it is cancelled,
+	// ctx should be the session context of the cancellation.
+	Release(ctx context.Context, order models.Order) error
+}
+
+type promotionService struct {
+	col            *mongo.Collection
+	redemption_col *mongo.Collection
+	ctx            context.Context
+}
+
+func NewPromotionService(ctx context.Context, col *mongo.Collection, redemption_col *mongo.Collection) PromotionService {
+	return &promotionService{
+		col:            col,
+		redemption_col: redemption_col,
+		ctx:            ctx,
+	}
+}
+
+func (p *promotionService) CreatePromotion(data types.AddPromotion) (models.Promotion, error) {
+	now := time.Now()
+	promotion := models.Promotion{
+		ID:               primitive.NewObjectID(),
+		Code:             normalizeCode(data.Code),
+		Name:             strings.TrimSpace(data.Name),
+		Kind:             data.Kind,
+		Scope:            data.Scope,
+		UsageLimit:       data.UsageLimit,
+		PerCustomerLimit: data.PerCustomerLimit,
+		Active:           true,
+		StartsAT:         data.StartsAt,
+		EndsAT:           data.EndsAt,
+		CreatedAT:        now,
+		UpdatedAT:        now,
+	}
+
+	switch data.Kind {
+	case PromotionPercentage:
+		promotion.Percent = data.Percent
+	case PromotionFixed:
+		amount := money.New(data.Amount, data.Currency)
+		promotion.Amount = &amount
+	case PromotionBuyXGetY:
+		promotion.Buy, promotion.Get = data.Buy, data.Get
+	}
+	if data.MinSpend > 0 {
+		min_spend := money.New(data.MinSpend, data.Currency)
+		promotion.MinSpend = &min_spend
+	}
+	if data.SellerID != "" {
+		seller_id, err := primitive.ObjectIDFromHex(data.SellerID)
+		if err != nil {
+			return models.Promotion{}, ErrInvalidPromotionSeller
+		}
+		promotion.SellerID = &seller_id
+	}
+	if data.Scope == PromotionScopeProducts {
+		for _, hex := range data.ProductIDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return models.Promotion{}, ErrInvalidPromotionScope
+			}
+			promotion.ProductIDs = append(promotion.ProductIDs, id)
+		}
+	}
+
+	if err := checkPromotion(promotion); err != nil {
+		return models.Promotion{}, err
+	}
+
+	if _, err := p.col.InsertOne(p.ctx, promotion); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Promotion{}, ErrPromotionExists
+		}
+		return models.Promotion{}, err
+	}
+	return promotion, nil
+}
+
+func (p *promotionService) UpdatePromotion(id primitive.ObjectID, data types.UpdatePromotion) (models.Promotion, error) {
+	promotion, err := p.GetPromotion(id)
+	if err != nil {
+		return models.Promotion{}, err
+	}
+
+	if data.Name != nil {
+		promotion.Name = strings.TrimSpace(*data.Name)
+	}
+	if data.Active != nil {
+		promotion.Active = *data.Active
+	}
+	if data.UsageLimit != nil {
+		promotion.UsageLimit = *data.UsageLimit
+	}
+	if data.PerCustomerLimit != nil {
+		promotion.PerCustomerLimit = *data.PerCustomerLimit
+	}
+	if data.StartsAt != nil {
+		promotion.StartsAT = data.StartsAt
+	}
+	if data.EndsAt != nil {
+		promotion.EndsAT = data.EndsAt
+	}
+	if err = checkPromotion(promotion); err != nil {
+		return models.Promotion{}, err
+	}
+
+	// uses is left alone, checkouts keep counting while the promotion is edited
+	updateObj := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "name", Value: promotion.Name},
+		{Key: "active", Value: promotion.Active},
+		{Key: "usageLimit", Value: promotion.UsageLimit},
+		{Key: "perCustomerLimit", Value: promotion.PerCustomerLimit},
+		{Key: "startsAt", Value: promotion.StartsAT},
+		{Key: "endsAt", Value: promotion.EndsAT},
+		{Key: "updatedAt", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.Promotion
+	if err = p.col.FindOneAndUpdate(p.ctx, bson.D{{Key: "_id", Value: id}}, updateObj, opts).Decode(&updated); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Promotion{}, ErrPromotionNotFound
+		}
+		return models.Promotion{}, err
+	}
+	return updated, nil
+}
+
+func (p *promotionService) GetPromotion(id primitive.ObjectID) (models.Promotion, error) {
+	var promotion models.Promotion
+	if err := p.col.FindOne(p.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&promotion); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Promotion{}, ErrPromotionNotFound
+		}
+		return models.Promotion{}, err
+	}
+	return promotion, nil
+}
+
+// GetPromotions lists every promotion, newest first.
+func (p *promotionService) GetPromotions(req pagination.Request) (pagination.Page[models.Promotion], error) {
+	return pagination.Find(p.ctx, p.col, bson.D{}, req, pagination.Sort{Field: "_id", Desc: true}, promotionKey)
+}
+
+func (p *promotionService) Apply(ctx context.Context, order *models.Order, code string, now time.Time) error {
+	automatic, err := p.find(ctx, bson.D{{Key: "active", Value: true}, {Key: "code", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return err
+	}
+
+	var coupon *models.Promotion
+	if code = normalizeCode(code); code != "" {
+		found, err := p.find(ctx, bson.D{{Key: "code", Value: code}, {Key: "active", Value: true}})
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return ErrCouponNotFound
+		}
+		if !promotionLive(found[0], now) {
+			return ErrCouponExpired
+		}
+		coupon = &found[0]
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, promotion := range automatic {
+		ids = append(ids, promotion.ID)
+	}
+	if coupon != nil {
+		ids = append(ids, coupon.ID)
+	}
+	used, err := p.redemptions(ctx, order.UserID, ids)
+	if err != nil {
+		return err
+	}
+
+	// automatic promotions the buyer can't have are left out, a coupon they can't have is an error
+	available := []models.Promotion{}
+	for _, promotion := range automatic {
+		if promotionLive(promotion, now) && !usedUp(promotion, used[promotion.ID]) {
+			available = append(available, promotion)
+		}
+	}
+	if coupon != nil && usedUp(*coupon, used[coupon.ID]) {
+		return ErrPromotionUsedUp
+	}
+
+	redeemed := map[primitive.ObjectID]bool{}
+	for {
+		attempt := *order
+		attempt.Items = append([]models.OrderItem{}, order.Items...)
+		applied, err := applyPromotions(&attempt, available, coupon)
+		if err != nil {
+			return err
+		}
+
+		lost := false
+		for _, promotion := range applied {
+			if redeemed[promotion.ID] {
+				continue
+			}
+			err = p.redeem(ctx, promotion, order.UserID, order.ID)
+			if err == ErrPromotionUsedUp && promotion.Code == "" {
+				// another checkout took its last use, the order is worked out again without it. Leaving
+				// a promotion out only leaves more to the others, so the ones redeemed still apply.
+				available = withoutPromotion(available, promotion.ID)
+				lost = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			redeemed[promotion.ID] = true
+		}
+		if !lost {
+			*order = attempt
+			return nil
+		}
+	}
+}
+
+func (p *promotionService) Release(ctx context.Context, order models.Order) error {
+	for _, applied := range order.Promotions {
+		// keyed by the order, so a promotion is given back once however often this runs
+		filter := bson.D{{Key: "promotionId", Value: applied.PromotionID}, {Key: "userId", Value: order.UserID}, {Key: "orderIds", Value: order.ID}}
+		updateObj := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}},
+			{Key: "$pull", Value: bson.D{{Key: "orderIds", Value: order.ID}}},
+		}
+		result, err := p.redemption_col.UpdateOne(ctx, filter, updateObj)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		filter = bson.D{{Key: "_id", Value: applied.PromotionID}, {Key: "uses", Value: bson.D{{Key: "$gt", Value: 0}}}}
+		if _, err = p.col.UpdateOne(ctx, filter, bson.D{{Key: "$inc", Value: bson.D{{Key: "uses", Value: -1}}}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *promotionService) find(ctx context.Context, filter bson.D) ([]models.Promotion, error) {
+	cursor, err := p.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	promotions := []models.Promotion{}
+	if err = cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// redemptions counts the orders user_id placed with each of the promotions.
+func (p *promotionService) redemptions(ctx context.Context, user_id primitive.ObjectID, promotion_ids []primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	used := map[primitive.ObjectID]int64{}
+	if len(promotion_ids) == 0 {
+		return used, nil
+	}
+
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "promotionId", Value: bson.D{{Key: "$in", Value: promotion_ids}}}}
+	cursor, err := p.redemption_col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	redemptions := []models.PromotionRedemption{}
+	if err = cursor.All(ctx, &redemptions); err != nil {
+		return nil, err
+	}
+	for _, redemption := range redemptions {
+		used[redemption.PromotionID] = redemption.Count
+	}
+	return used, nil
+}
+
+// redeem counts one more use of promotion. The limits are checked again by the writes: of two checkouts
+// racing for the last use one conflicts with the other and is retried, and then finds it used up.
+// Nothing is counted when it returns ErrPromotionUsedUp, so the checkout can go on without the promotion.
+func (p *promotionService) redeem(ctx context.Context, promotion models.Promotion, user_id primitive.ObjectID, order_id primitive.ObjectID) error {
+	// the buyer's counter is created outside the transaction, like the order number counters
+	filter := bson.D{{Key: "promotionId", Value: promotion.ID}, {Key: "userId", Value: user_id}}
+	create := bson.D{{Key: "$setOnInsert", Value: bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "count", Value: 0},
+		{Key: "orderIds", Value: bson.A{}},
+	}}}
+	if _, err := p.redemption_col.UpdateOne(p.ctx, filter, create, options.Update().SetUpsert(true)); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	customer := append(bson.D{}, filter...)
+	if promotion.PerCustomerLimit > 0 {
+		customer = append(customer, bson.E{Key: "count", Value: bson.D{{Key: "$lt", Value: promotion.PerCustomerLimit}}})
+	}
+	updateObj := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}},
+		{Key: "$push", Value: bson.D{{Key: "orderIds", Value: order_id}}},
+	}
+	result, err := p.redemption_col.UpdateOne(ctx, customer, updateObj)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPromotionUsedUp
+	}
+
+	total := bson.D{{Key: "_id", Value: promotion.ID}}
+	if promotion.UsageLimit > 0 {
+		total = append(total, bson.E{Key: "uses", Value: bson.D{{Key: "$lt", Value: promotion.UsageLimit}}})
+	}
+	if result, err = p.col.UpdateOne(ctx, total, bson.D{{Key: "$inc", Value: bson.D{{Key: "uses", Value: 1}}}}); err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// the buyer's count goes back to what it was
+		updateObj = bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}},
+			{Key: "$pull", Value: bson.D{{Key: "orderIds", Value: order_id}}},
+		}
+		if _, err = p.redemption_col.UpdateOne(ctx, filter, updateObj); err != nil {
+			return err
+		}
+		return ErrPromotionUsedUp
+	}
+	return nil
+}
+
+// withoutPromotion is promotions with the one with id left out.
+func withoutPromotion(promotions []models.Promotion, id primitive.ObjectID) []models.Promotion {
+	left := []models.Promotion{}
+	for _, promotion := range promotions {
+		if promotion.ID != id {
+			left = append(left, promotion)
+		}
+	}
+	return left
+}
+
+func promotionKey(promotion models.Promotion) (interface{}, primitive.ObjectID) {
+	return promotion.ID, promotion.ID
+}
+
+// normalizeCode makes coupon codes case insensitive.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func checkPromotion(promotion models.Promotion) error {
+	switch promotion.Kind {
+	case PromotionPercentage:
+		if promotion.Percent < 1 || promotion.Percent > 100 {
+			return ErrInvalidPercent
+		}
+	case PromotionFixed:
+		if promotion.Amount == nil || promotion.Amount.Amount <= 0 {
+			return ErrInvalidDiscount
+		}
+		if !money.Valid(promotion.Amount.Currency) {
+			return money.ErrUnknownCurrency
+		}
+	case PromotionBuyXGetY:
+		if promotion.Buy < 1 || promotion.Get < 1 {
+			return ErrInvalidBuyXGetY
+		}
+	default:
+		return ErrInvalidPromotionKind
+	}
+
+	if promotion.MinSpend != nil && !money.Valid(promotion.MinSpend.Currency) {
+		return money.ErrUnknownCurrency
+	}
+	switch promotion.Scope {
+	case PromotionScopeShop:
+	case PromotionScopeProducts:
+		if len(promotion.ProductIDs) == 0 {
+			return ErrInvalidPromotionScope
+		}
+	default:
+		return ErrInvalidPromotionScope
+	}
+	if promotion.StartsAT != nil && promotion.EndsAT != nil && !promotion.EndsAT.After(*promotion.StartsAT) {
+		return ErrInvalidPromotionDates
+	}
+	if promotion.UsageLimit < 0 || promotion.PerCustomerLimit < 0 {
+		return ErrInvalidPromotionLimits
+	}
+	return nil
+}
+
+// promotionLive reports whether promotion can be used at now, limits aside.
+func promotionLive(promotion models.Promotion, now time.Time) bool {
+	if !promotion.Active {
+		return false
+	}
+	if promotion.StartsAT != nil && now.Before(*promotion.StartsAT) {
+		return false
+	}
+	return promotion.EndsAT == nil || now.Before(*promotion.EndsAT)
+}
+
+// usedUp reports whether promotion reached either of its limits, used is how often the buyer used it.
+func usedUp(promotion models.Promotion, used int64) bool {
+	if promotion.UsageLimit > 0 && promotion.Uses >= promotion.UsageLimit {
+		return true
+	}
+	return promotion.PerCustomerLimit > 0 && used >= promotion.PerCustomerLimit
+}
+
+// applyPromotions takes the automatic promotions and then the coupon off the order's items, each working on
+// what the ones before it left. Automatic promotions that don't fit the order are skipped, a coupon that
+// doesn't is an error. It returns the promotions that took something off.
+func applyPromotions(order *models.Order, automatic []models.Promotion, coupon *models.Promotion) ([]models.Promotion, error) {
+	promotions := automatic
+	if coupon != nil {
+		promotions = append(promotions[:len(promotions):len(promotions)], *coupon)
+	}
+
+	currency := order.TotalPrice.Currency
+	applied := []models.Promotion{}
+	for i, promotion := range promotions {
+		amounts, err := discountLines(promotion, order.Items)
+		if err != nil {
+			if coupon != nil && i == len(promotions)-1 {
+				return nil, err
+			}
+			continue
+		}
+
+		total := int64(0)
+		for j, amount := range amounts {
+			if amount == 0 {
+				continue
+			}
+			item := &order.Items[j]
+			item.Discount.Amount += amount
+			item.Total.Amount -= amount
+			item.Discounts = append(item.Discounts, models.LineDiscount{
+				PromotionID: promotion.ID,
+				Code:        promotion.Code,
+				Name:        promotion.Name,
+				Amount:      money.New(amount, currency),
+				SellerID:    promotion.SellerID,
+			})
+			total += amount
+		}
+
+		order.Promotions = append(order.Promotions, models.AppliedPromotion{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Name:        promotion.Name,
+			Kind:        promotion.Kind,
+			Amount:      money.New(total, currency),
+		})
+		order.Discount.Amount += total
+		order.TotalPrice.Amount -= total
+		applied = append(applied, promotion)
+	}
+	return applied, nil
+}
+
+// discountLines works out what promotion takes off each item, given what is still left to pay for them.
+func discountLines(promotion models.Promotion, items []models.OrderItem) ([]int64, error) {
+	if len(items) == 0 {
+		return nil, ErrCouponNotApplicable
+	}
+	currency := items[0].Total.Currency
+
+	products := map[primitive.ObjectID]bool{}
+	for _, id := range promotion.ProductIDs {
+		products[id] = true
+	}
+	in_scope := func(item models.OrderItem) bool {
+		// a seller's promotion never touches what other sellers sell
+		if promotion.SellerID != nil && item.SellerID != *promotion.SellerID {
+			return false
+		}
+		return promotion.Scope == PromotionScopeShop || products[item.ProductID]
+	}
+
+	eligible := int64(0)
+	for _, item := range items {
+		if in_scope(item) {
+			eligible += item.Total.Amount
+		}
+	}
+	if eligible <= 0 {
+		return nil, ErrCouponNotApplicable
+	}
+	if promotion.MinSpend != nil {
+		if promotion.MinSpend.Currency != currency {
+			return nil, ErrCouponNotApplicable
+		}
+		if eligible < promotion.MinSpend.Amount {
+			return nil, ErrCouponMinSpend
+		}
+	}
+
+	amounts := make([]int64, len(items))
+	switch promotion.Kind {
+	case PromotionPercentage:
+		for i, item := range items {
+			if in_scope(item) {
+				// rounded half up to the minor unit
+				amounts[i] = (item.Total.Amount*promotion.Percent + 50) / 100
+			}
+		}
+	case PromotionFixed:
+		if promotion.Amount == nil || promotion.Amount.Currency != currency {
+			return nil, ErrCouponNotApplicable
+		}
+		off := promotion.Amount.Amount
+		if off > eligible {
+			off = eligible
+		}
+		// spread in proportion to what is left of each line, the rounding goes to the first lines
+		given := int64(0)
+		for i, item := range items {
+			if in_scope(item) {
+				amounts[i] = mulDiv(off, item.Total.Amount, eligible)
+				given += amounts[i]
+			}
+		}
+		for i, item := range items {
+			if given == off {
+				break
+			}
+			if in_scope(item) && amounts[i] < item.Total.Amount {
+				amounts[i]++
+				given++
+			}
+		}
+	case PromotionBuyXGetY:
+		for i, item := range items {
+			if !in_scope(item) {
+				continue
+			}
+			free := item.Quantity / (promotion.Buy + promotion.Get) * promotion.Get
+			amounts[i] = free * item.UnitPrice.Amount
+			if amounts[i] > item.Total.Amount {
+				amounts[i] = item.Total.Amount
+			}
+		}
+	default:
+		return nil, ErrInvalidPromotionKind
+	}
+
+	for _, amount := range amounts {
+		if amount > 0 {
+			return amounts, nil
+		}
+	}
+	return nil, ErrCouponNotApplicable
+}
+
+// mulDiv is a * b / c rounded down, without overflowing on the way.
+func mulDiv(a int64, b int64, c int64) int64 {
+	v := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return v.Quo(v, big.NewInt(c)).Int64()
+}
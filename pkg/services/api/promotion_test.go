@@ -0,0 +1,269 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func promotionOrder(t *testing.T, lines ...models.CartLine) models.Order {
+	order, err := newOrder(primitive.NewObjectID(), lines, time.Now())
+	require.NoError(t, err)
+	return order
+}
+
+func TestDiscountLines(t *testing.T) {
+	shirt, mug := primitive.NewObjectID(), primitive.NewObjectID()
+	order := promotionOrder(t,
+		models.CartLine{ProductID: shirt, Quantity: 5, UnitPrice: models.Money{Amount: 333, Currency: "NGN"}},
+		models.CartLine{ProductID: mug, Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}},
+	)
+
+	// 15% of 1665 is 249.75
+	amounts, err := discountLines(models.Promotion{Kind: PromotionPercentage, Percent: 15, Scope: PromotionScopeShop}, order.Items)
+	require.NoError(t, err)
+	require.Equal(t, []int64{250, 150}, amounts)
+
+	// 1000 off 2665 spread over the lines, the rounding goes to the first one
+	fixed := models.Money{Amount: 1000, Currency: "NGN"}
+	amounts, err = discountLines(models.Promotion{Kind: PromotionFixed, Amount: &fixed, Scope: PromotionScopeShop}, order.Items)
+	require.NoError(t, err)
+	require.Equal(t, []int64{625, 375}, amounts)
+
+	// buy 2 get 1 free: 5 shirts get 1 free
+	amounts, err = discountLines(models.Promotion{Kind: PromotionBuyXGetY, Buy: 2, Get: 1, Scope: PromotionScopeProducts, ProductIDs: []primitive.ObjectID{shirt}}, order.Items)
+	require.NoError(t, err)
+	require.Equal(t, []int64{333, 0}, amounts)
+
+	min_spend := models.Money{Amount: 1500, Currency: "NGN"}
+	_, err = discountLines(models.Promotion{Kind: PromotionPercentage, Percent: 10, Scope: PromotionScopeProducts, ProductIDs: []primitive.ObjectID{mug}, MinSpend: &min_spend}, order.Items)
+	require.ErrorIs(t, err, ErrCouponMinSpend)
+
+	_, err = discountLines(models.Promotion{Kind: PromotionPercentage, Percent: 10, Scope: PromotionScopeProducts, ProductIDs: []primitive.ObjectID{primitive.NewObjectID()}}, order.Items)
+	require.ErrorIs(t, err, ErrCouponNotApplicable)
+
+	usd := models.Money{Amount: 100, Currency: "USD"}
+	_, err = discountLines(models.Promotion{Kind: PromotionFixed, Amount: &usd, Scope: PromotionScopeShop}, order.Items)
+	require.ErrorIs(t, err, ErrCouponNotApplicable)
+}
+
+func TestApplyPromotions(t *testing.T) {
+	shirt := primitive.NewObjectID()
+	order := promotionOrder(t,
+		models.CartLine{ProductID: shirt, SellerID: primitive.NewObjectID(), Quantity: 3, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}},
+		models.CartLine{ProductID: primitive.NewObjectID(), SellerID: primitive.NewObjectID(), Quantity: 1, UnitPrice: models.Money{Amount: 2000, Currency: "NGN"}},
+	)
+
+	automatic := []models.Promotion{
+		{ID: primitive.NewObjectID(), Name: "Shirts 3 for 2", Kind: PromotionBuyXGetY, Buy: 2, Get: 1, Scope: PromotionScopeProducts, ProductIDs: []primitive.ObjectID{shirt}},
+		// skipped, the order doesn't reach it
+		{ID: primitive.NewObjectID(), Name: "Big baskets", Kind: PromotionPercentage, Percent: 50, Scope: PromotionScopeShop, MinSpend: &models.Money{Amount: 100000, Currency: "NGN"}},
+	}
+	coupon := models.Promotion{ID: primitive.NewObjectID(), Code: "TEN", Name: "Ten off", Kind: PromotionPercentage, Percent: 10, Scope: PromotionScopeShop}
+
+	applied, err := applyPromotions(&order, automatic, &coupon)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	// the coupon works on what the automatic promotion left: 2000 and 2000
+	require.Equal(t, models.Money{Amount: 1200, Currency: "NGN"}, order.Items[0].Discount)
+	require.Equal(t, models.Money{Amount: 1800, Currency: "NGN"}, order.Items[0].Total)
+	require.Len(t, order.Items[0].Discounts, 2)
+	require.Equal(t, "TEN", order.Items[0].Discounts[1].Code)
+	require.Equal(t, models.Money{Amount: 200, Currency: "NGN"}, order.Items[1].Discount)
+
+	require.Equal(t, models.Money{Amount: 1400, Currency: "NGN"}, order.Discount)
+	require.Equal(t, models.Money{Amount: 3600, Currency: "NGN"}, order.TotalPrice)
+	require.Equal(t, []models.Money{{Amount: 1000, Currency: "NGN"}, {Amount: 400, Currency: "NGN"}},
+		[]models.Money{order.Promotions[0].Amount, order.Promotions[1].Amount})
+
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	require.Equal(t, models.Money{Amount: 1200, Currency: "NGN"}, subs[0].Discount)
+	require.Equal(t, models.Money{Amount: 1800, Currency: "NGN"}, subs[0].TotalPrice)
+
+	// a coupon that doesn't fit fails the checkout instead of being skipped
+	order = promotionOrder(t, models.CartLine{ProductID: shirt, Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}})
+	_, err = applyPromotions(&order, nil, &automatic[1])
+	require.ErrorIs(t, err, ErrCouponMinSpend)
+}
+
+func TestSellerPromotion(t *testing.T) {
+	tailor, potter := primitive.NewObjectID(), primitive.NewObjectID()
+	order := promotionOrder(t,
+		models.CartLine{ProductID: primitive.NewObjectID(), SellerID: tailor, Quantity: 1, UnitPrice: models.Money{Amount: 4000, Currency: "NGN"}},
+		models.CartLine{ProductID: primitive.NewObjectID(), SellerID: potter, Quantity: 1, UnitPrice: models.Money{Amount: 2000, Currency: "NGN"}},
+	)
+
+	automatic := []models.Promotion{
+		// the tailor's shop wide sale leaves the potter's mug alone
+		{ID: primitive.NewObjectID(), Name: "Tailor's sale", Kind: PromotionPercentage, Percent: 25, Scope: PromotionScopeShop, SellerID: &tailor},
+		{ID: primitive.NewObjectID(), Name: "Marketplace week", Kind: PromotionPercentage, Percent: 10, Scope: PromotionScopeShop},
+	}
+	applied, err := applyPromotions(&order, automatic, nil)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	require.Equal(t, models.Money{Amount: 1300, Currency: "NGN"}, order.Items[0].Discount)
+	require.Equal(t, models.Money{Amount: 200, Currency: "NGN"}, order.Items[1].Discount)
+
+	// only what the marketplace's promotion took off is owed to the sellers
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	require.Equal(t, models.Money{Amount: 1300, Currency: "NGN"}, subs[0].Discount)
+	require.Equal(t, models.Money{Amount: 300, Currency: "NGN"}, subs[0].MarketplaceDiscount)
+	require.Equal(t, models.Money{Amount: 200, Currency: "NGN"}, subs[1].MarketplaceDiscount)
+
+	// a seller's coupon fits nothing of the others
+	coupon := models.Promotion{ID: primitive.NewObjectID(), Code: "POTS", Kind: PromotionPercentage, Percent: 10, Scope: PromotionScopeShop, SellerID: &potter}
+	order = promotionOrder(t, models.CartLine{ProductID: primitive.NewObjectID(), SellerID: tailor, Quantity: 1, UnitPrice: models.Money{Amount: 4000, Currency: "NGN"}})
+	_, err = applyPromotions(&order, nil, &coupon)
+	require.ErrorIs(t, err, ErrCouponNotApplicable)
+}
+
+func TestPromotionLimits(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	promotion := models.Promotion{Active: true, UsageLimit: 10, PerCustomerLimit: 1, Uses: 3}
+
+	require.True(t, promotionLive(promotion, now))
+	promotion.StartsAT = &later
+	require.False(t, promotionLive(promotion, now))
+	promotion.StartsAT, promotion.EndsAT = nil, &now
+	require.False(t, promotionLive(promotion, now))
+
+	require.False(t, usedUp(promotion, 0))
+	require.True(t, usedUp(promotion, 1))
+	promotion.Uses = 10
+	require.True(t, usedUp(promotion, 0))
+}
+
+func TestCouponUsageLimit(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	redemptions := db.Collection("promotion_redemptions")
+	_, err := redemptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	require.NoError(t, err)
+	promotions := NewPromotionService(ctx, db.Collection("promotions"), redemptions)
+
+	_, err = promotions.CreatePromotion(types.AddPromotion{
+		Code: "launch", Name: "Launch", Kind: PromotionPercentage, Percent: 10, Currency: "NGN",
+		Scope: PromotionScopeShop, UsageLimit: 2,
+	})
+	require.NoError(t, err)
+
+	apply := func() (models.Order, error) {
+		session, err := client.StartSession()
+		if err != nil {
+			return models.Order{}, err
+		}
+		defer session.EndSession(ctx)
+
+		order, err := session.WithTransaction(ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+			order := promotionOrder(t, models.CartLine{ProductID: primitive.NewObjectID(), Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}})
+			return order, promotions.Apply(sess_ctx, &order, "LAUNCH", time.Now())
+		})
+		if err != nil {
+			return models.Order{}, err
+		}
+		return order.(models.Order), nil
+	}
+
+	var mu sync.Mutex
+	discounted := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order, err := apply()
+			if err != nil {
+				require.ErrorIs(t, err, ErrPromotionUsedUp)
+				return
+			}
+			require.Equal(t, models.Money{Amount: 900, Currency: "NGN"}, order.TotalPrice)
+			mu.Lock()
+			discounted++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// the coupon is never used more often than its limit, however the checkouts interleave
+	require.Equal(t, 2, discounted)
+}
+
+func TestAutomaticPromotionLastUseAndRelease(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	redemptions := db.Collection("promotion_redemptions")
+	_, err := redemptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "promotionId", Value: 1}, {Key: "userId", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	require.NoError(t, err)
+	promotions := NewPromotionService(ctx, db.Collection("promotions"), redemptions)
+
+	promotion, err := promotions.CreatePromotion(types.AddPromotion{
+		Name: "First order", Kind: PromotionFixed, Amount: 100, Currency: "NGN", Scope: PromotionScopeShop, UsageLimit: 1,
+	})
+	require.NoError(t, err)
+
+	apply := func() (models.Order, error) {
+		session, err := client.StartSession()
+		if err != nil {
+			return models.Order{}, err
+		}
+		defer session.EndSession(ctx)
+
+		order, err := session.WithTransaction(ctx, func(sess_ctx mongo.SessionContext) (interface{}, error) {
+			order := promotionOrder(t, models.CartLine{ProductID: primitive.NewObjectID(), Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}})
+			return order, promotions.Apply(sess_ctx, &order, "", time.Now())
+		})
+		if err != nil {
+			return models.Order{}, err
+		}
+		return order.(models.Order), nil
+	}
+
+	// the checkouts that miss the last use go through at full price
+	var mu sync.Mutex
+	discounted := []models.Order{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order, err := apply()
+			require.NoError(t, err)
+			if len(order.Promotions) > 0 {
+				mu.Lock()
+				discounted = append(discounted, order)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, discounted, 1)
+
+	// cancelling gives the use back, once
+	for i := 0; i < 2; i++ {
+		require.NoError(t, promotions.Release(ctx, discounted[0]))
+	}
+	promotion, err = promotions.GetPromotion(promotion.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), promotion.Uses)
+	var redemption models.PromotionRedemption
+	require.NoError(t, redemptions.FindOne(ctx, bson.D{{Key: "userId", Value: discounted[0].UserID}}).Decode(&redemption))
+	require.Equal(t, int64(0), redemption.Count)
+	require.Empty(t, redemption.OrderIDs)
+}
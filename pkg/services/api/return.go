@@ -0,0 +1,491 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRefunded  = "refunded"
+	ReturnDenied    = "denied"
+)
+
+var (
+	ErrReturnNotFound          = errors.New("can't find return")
+	ErrNotReturnable           = errors.New("only delivered orders can be returned")
+	ErrInvalidReturnItems      = errors.New("returned items must be items of the order, at most the quantity not returned yet")
+	ErrInvalidReturnTransition = errors.New("return cannot move to that status from its current one")
+	ErrInvalidRefund           = errors.New("refund must be more than zero and at most what the returned items were paid")
+	ErrRefundAmountChanged     = errors.New("the return was approved for another amount, approving again can only retry that refund")
+)
+
+// ReturnService undoes orders: buyer cancellations, seller rejections and returns, refunding what was paid.
+type ReturnService interface {
+	CancelOrder(id primitive.ObjectID, user_id primitive.ObjectID, reason string) (models.Order, error)
+	RejectOrder(id primitive.ObjectID, seller_id primitive.ObjectID, reason string) (models.SubOrder, error)
+	RequestReturn(order_id primitive.ObjectID, user_id primitive.ObjectID, sub_order_id primitive.ObjectID, reason string, items []models.ReturnItem, photos []string) (models.Return, error)
+	OrderReturns(order_id primitive.ObjectID, user_id primitive.ObjectID) ([]models.Return, error)
+	SellerReturns(seller_id primitive.ObjectID, status string, req pagination.Request) (pagination.Page[models.Return], error)
+	// ApproveReturn refunds the return, amount is given for a partial refund and nil for a full one.
+	ApproveReturn(id primitive.ObjectID, seller_id primitive.ObjectID, amount *int64, note string) (models.Return, error)
+	DenyReturn(id primitive.ObjectID, seller_id primitive.ObjectID, note string) (models.Return, error)
+}
+
+type returnService struct {
+	col      *mongo.Collection
+	orders   OrderService
+	payments PaymentService
+	notify   NotificationService
+	ctx      context.Context
+}
+
+func NewReturnService(ctx context.Context, col *mongo.Collection, orders OrderService, payments PaymentService, notify NotificationService) ReturnService {
+	return &returnService{
+		col:      col,
+		orders:   orders,
+		payments: payments,
+		notify:   notify,
+		ctx:      ctx,
+	}
+}
+
+// CancelOrder cancels what hasn't shipped of the buyer's order and refunds the paid parts.
+func (r *returnService) CancelOrder(id primitive.ObjectID, user_id primitive.ObjectID, reason string) (models.Order, error) {
+	cancelled, err := r.orders.CancelOrder(id, user_id, reason)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	for _, sub := range cancelled {
+		// the cancellation stands either way, a failed refund is on the order to be retried by hand
+		if err = r.refundCancelled(sub, reason); err != nil {
+			log.Printf("cannot refund cancelled sub-order %s: %v", sub.ID.Hex(), err)
+		}
+	}
+
+	order, err := r.orders.BuyerOrder(id, user_id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if order.Status == OrderCancelled {
+		// the buyer can't pay it any more, a payment already on its way is refunded when it arrives
+		if err = r.payments.CloseIntents(id); err != nil {
+			log.Printf("cannot close the payment of cancelled order %s: %v", id.Hex(), err)
+		}
+	}
+	return order, nil
+}
+
+// RejectOrder lets the seller cancel a sub-order they can't fulfil, the buyer gets back what they paid for it.
+func (r *returnService) RejectOrder(id primitive.ObjectID, seller_id primitive.ObjectID, reason string) (models.SubOrder, error) {
+	sub, err := r.orders.RejectOrder(id, seller_id, reason)
+	if err != nil {
+		return models.SubOrder{}, err
+	}
+
+	sub_id := sub.ID
+	event := models.OrderEvent{Kind: OrderEventCancelled, SubOrderID: &sub_id, Note: reason, At: time.Now()}
+	if err = r.orders.Record(sub.OrderID, event); err != nil {
+		log.Printf("cannot record rejection of sub-order %s: %v", sub.ID.Hex(), err)
+	}
+	if err = r.refundCancelled(sub, reason); err != nil {
+		log.Printf("cannot refund rejected sub-order %s: %v", sub.ID.Hex(), err)
+	}
+	return r.orders.SellerOrder(id, seller_id)
+}
+
+func (r *returnService) refundCancelled(sub models.SubOrder, note string) error {
+	if !wasPaid(sub) {
+		return nil
+	}
+	outstanding := money.New(sub.TotalPrice.Amount-sub.Refunded.Amount, sub.TotalPrice.Currency)
+	if outstanding.Amount <= 0 {
+		return nil
+	}
+	_, err := r.refund(sub, outstanding, "cancel-"+sub.ID.Hex(), nil, note)
+	return err
+}
+
+// refund gives amount back for a sub-order through the payment of its order and books it on the sub-order.
+// Calls with the same key refund and book it once, a refund paid out but not booked is booked by a retry.
+// What is booked, and returned, is what the provider was asked to pay out under key, which is amount
+// unless an earlier call used the key.
+func (r *returnService) refund(sub models.SubOrder, amount models.Money, key string, return_id *primitive.ObjectID, note string) (models.Money, error) {
+	paid, err := r.payments.Refund(sub.OrderID, amount, key)
+	if err != nil {
+		if err == ErrRefundPending {
+			// nothing failed yet, the caller tries again
+			return models.Money{}, err
+		}
+		sub_id := sub.ID
+		event := models.OrderEvent{Kind: OrderEventRefundFailed, SubOrderID: &sub_id, ReturnID: return_id, Amount: &amount, Note: err.Error(), At: time.Now()}
+		if record_err := r.orders.Record(sub.OrderID, event); record_err != nil {
+			log.Printf("cannot record failed refund of sub-order %s: %v", sub.ID.Hex(), record_err)
+		}
+		return models.Money{}, err
+	}
+
+	// the refunded event is recorded along with the booking
+	if _, err := r.orders.RefundSubOrder(sub.ID, paid.Amount, key, return_id, note); err != nil {
+		log.Printf("refund %s of sub-order %s was paid out but not booked: %v", key, sub.ID.Hex(), err)
+		return models.Money{}, err
+	}
+	return paid.Amount, nil
+}
+
+// RequestReturn asks the seller of a delivered sub-order to take items back, only product, variant
+// and quantity of the requested items are read.
+func (r *returnService) RequestReturn(order_id primitive.ObjectID, user_id primitive.ObjectID, sub_order_id primitive.ObjectID, reason string, items []models.ReturnItem, photos []string) (models.Return, error) {
+	order, err := r.orders.BuyerOrder(order_id, user_id)
+	if err != nil {
+		return models.Return{}, err
+	}
+
+	var sub *models.SubOrder
+	for i := range order.SubOrders {
+		if order.SubOrders[i].ID == sub_order_id {
+			sub = &order.SubOrders[i]
+		}
+	}
+	if sub == nil {
+		return models.Return{}, ErrSubOrderNotFound
+	}
+	if sub.Status != OrderDelivered {
+		return models.Return{}, ErrNotReturnable
+	}
+
+	returned, err := r.returnedQuantities(sub.ID)
+	if err != nil {
+		return models.Return{}, err
+	}
+	items, amount, err := returnItems(*sub, items, returned)
+	if err != nil {
+		return models.Return{}, err
+	}
+
+	now := time.Now()
+	ret := models.Return{
+		ID:            primitive.NewObjectID(),
+		OrderID:       order_id,
+		SubOrderID:    sub.ID,
+		UserID:        user_id,
+		SellerID:      sub.SellerID,
+		Status:        ReturnRequested,
+		Reason:        reason,
+		Items:         items,
+		Photos:        photos,
+		Amount:        amount,
+		Refunded:      money.New(0, amount.Currency),
+		StatusHistory: []models.OrderStatusChange{{Status: ReturnRequested, Note: reason, At: now}},
+		CreatedAT:     now,
+		UpdatedAT:     now,
+	}
+	if ret.Photos == nil {
+		ret.Photos = []string{}
+	}
+	if _, err = r.col.InsertOne(r.ctx, ret); err != nil {
+		return models.Return{}, err
+	}
+
+	event := models.OrderEvent{Kind: OrderEventReturnRequested, SubOrderID: &ret.SubOrderID, ReturnID: &ret.ID, Amount: &amount, Note: reason, At: now}
+	if err = r.orders.Record(order_id, event); err != nil {
+		log.Printf("cannot record return %s: %v", ret.ID.Hex(), err)
+	}
+	if err = r.notify.Notify(returnNotification(ret, now)); err != nil {
+		log.Printf("cannot notify seller of return %s: %v", ret.ID.Hex(), err)
+	}
+	return ret, nil
+}
+
+// returnedQuantities sums the quantities of each item of a sub-order in returns that weren't denied.
+func (r *returnService) returnedQuantities(sub_order_id primitive.ObjectID) (map[string]int64, error) {
+	filter := bson.D{
+		{Key: "subOrderId", Value: sub_order_id},
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: ReturnDenied}}},
+	}
+	cursor, err := r.col.Find(r.ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	returns := []models.Return{}
+	if err = cursor.All(r.ctx, &returns); err != nil {
+		return nil, err
+	}
+	returned := map[string]int64{}
+	for _, ret := range returns {
+		for _, item := range ret.Items {
+			returned[returnKey(item.ProductID, item.Variant)] += item.Quantity
+		}
+	}
+	return returned, nil
+}
+
+// OrderReturns lists the returns of one of the buyer's orders, oldest first.
+func (r *returnService) OrderReturns(order_id primitive.ObjectID, user_id primitive.ObjectID) ([]models.Return, error) {
+	filter := bson.D{{Key: "orderId", Value: order_id}, {Key: "userId", Value: user_id}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := r.col.Find(r.ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	returns := []models.Return{}
+	if err = cursor.All(r.ctx, &returns); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// SellerReturns lists the returns of the seller's sub-orders newest first, optionally only those in status.
+func (r *returnService) SellerReturns(seller_id primitive.ObjectID, status string, req pagination.Request) (pagination.Page[models.Return], error) {
+	filter := bson.D{{Key: "sellerId", Value: seller_id}}
+	if status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: status})
+	}
+
+	key := func(ret models.Return) (interface{}, primitive.ObjectID) {
+		return ret.ID, ret.ID
+	}
+	return pagination.Find(r.ctx, r.col, filter, req, pagination.Sort{Field: "_id", Desc: true}, key)
+}
+
+func (r *returnService) ApproveReturn(id primitive.ObjectID, seller_id primitive.ObjectID, amount *int64, note string) (models.Return, error) {
+	ret, err := r.sellerReturn(id, seller_id)
+	if err != nil {
+		return models.Return{}, err
+	}
+
+	refund := ret.Amount
+	if amount != nil {
+		refund.Amount = *amount
+	}
+	if refund.Amount <= 0 || refund.Amount > ret.Amount.Amount {
+		return models.Return{}, ErrInvalidRefund
+	}
+
+	// approving is recorded before the refund, so a refund that failed is retried by approving again
+	switch ret.Status {
+	case ReturnRequested:
+		if ret, err = r.move(ret, ReturnApproved, note, bson.D{{Key: "approved", Value: refund}}); err != nil {
+			return models.Return{}, err
+		}
+	case ReturnApproved:
+		if ret.Approved != nil {
+			if amount != nil && *amount != ret.Approved.Amount {
+				return models.Return{}, ErrRefundAmountChanged
+			}
+			refund = *ret.Approved
+		}
+	default:
+		return models.Return{}, ErrInvalidReturnTransition
+	}
+
+	sub, err := r.orders.SellerOrder(ret.SubOrderID, seller_id)
+	if err != nil {
+		return models.Return{}, err
+	}
+	if refund, err = r.refund(sub, refund, "return-"+ret.ID.Hex(), &ret.ID, note); err != nil {
+		return models.Return{}, err
+	}
+
+	// the money is back with the buyer, stock that didn't follow is fixed by hand
+	if err = r.restock(ret); err != nil {
+		log.Printf("cannot restock items of return %s: %v", ret.ID.Hex(), err)
+	}
+
+	if ret, err = r.move(ret, ReturnRefunded, note, bson.D{{Key: "refunded", Value: refund}}); err != nil {
+		return models.Return{}, err
+	}
+	if err = r.notify.Notify(returnNotification(ret, time.Now())); err != nil {
+		log.Printf("cannot notify buyer of return %s: %v", ret.ID.Hex(), err)
+	}
+	return ret, nil
+}
+
+// restock puts the returned items back in stock once, however often the return is approved.
+func (r *returnService) restock(ret models.Return) error {
+	filter := bson.D{{Key: "_id", Value: ret.ID}, {Key: "restocked", Value: bson.D{{Key: "$ne", Value: true}}}}
+	result, err := r.col.UpdateOne(r.ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "restocked", Value: true}}}})
+	if err != nil || result.ModifiedCount == 0 {
+		return err
+	}
+
+	items := []models.OrderItem{}
+	for _, item := range ret.Items {
+		items = append(items, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	return r.orders.Restock(items)
+}
+
+func (r *returnService) DenyReturn(id primitive.ObjectID, seller_id primitive.ObjectID, note string) (models.Return, error) {
+	ret, err := r.sellerReturn(id, seller_id)
+	if err != nil {
+		return models.Return{}, err
+	}
+	if ret.Status != ReturnRequested {
+		return models.Return{}, ErrInvalidReturnTransition
+	}
+
+	if ret, err = r.move(ret, ReturnDenied, note, nil); err != nil {
+		return models.Return{}, err
+	}
+
+	now := time.Now()
+	event := models.OrderEvent{Kind: OrderEventReturnDenied, SubOrderID: &ret.SubOrderID, ReturnID: &ret.ID, Note: note, At: now}
+	if err = r.orders.Record(ret.OrderID, event); err != nil {
+		log.Printf("cannot record return %s: %v", ret.ID.Hex(), err)
+	}
+	if err = r.notify.Notify(returnNotification(ret, now)); err != nil {
+		log.Printf("cannot notify buyer of return %s: %v", ret.ID.Hex(), err)
+	}
+	return ret, nil
+}
+
+func (r *returnService) sellerReturn(id primitive.ObjectID, seller_id primitive.ObjectID) (models.Return, error) {
+	var ret models.Return
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}}
+	if err := r.col.FindOne(r.ctx, filter).Decode(&ret); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Return{}, ErrReturnNotFound
+		}
+		return models.Return{}, err
+	}
+	return ret, nil
+}
+
+// move records a status change of a return read in ret, set holds further fields to change along with it.
+func (r *returnService) move(ret models.Return, status string, note string, set bson.D) (models.Return, error) {
+	now := time.Now()
+	change := models.OrderStatusChange{Status: status, Note: note, At: now}
+
+	filter := bson.D{{Key: "_id", Value: ret.ID}, {Key: "status", Value: ret.Status}}
+	set = append(bson.D{{Key: "status", Value: status}, {Key: "sellerNote", Value: note}, {Key: "updatedAt", Value: now}}, set...)
+	updateObj := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$push", Value: bson.D{{Key: "statusHistory", Value: change}}},
+	}
+
+	var moved models.Return
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.col.FindOneAndUpdate(r.ctx, filter, updateObj, opts).Decode(&moved); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Return{}, ErrInvalidReturnTransition
+		}
+		return models.Return{}, err
+	}
+	return moved, nil
+}
+
+// wasPaid tells whether the buyer paid for a sub-order, whatever happened to it since.
+func wasPaid(sub models.SubOrder) bool {
+	for _, change := range sub.StatusHistory {
+		if change.Status == OrderPaid {
+			return true
+		}
+	}
+	return false
+}
+
+func returnKey(product_id primitive.ObjectID, variant string) string {
+	return product_id.Hex() + "/" + variant
+}
+
+// returnItems prices the items a buyer wants to send back at what they paid after discounts and tax, returned holds
+// the quantities of each item already in other returns, keyed by returnKey.
+func returnItems(sub models.SubOrder, requested []models.ReturnItem, returned map[string]int64) ([]models.ReturnItem, models.Money, error) {
+	if len(requested) == 0 {
+		return nil, models.Money{}, ErrInvalidReturnItems
+	}
+
+	items := []models.ReturnItem{}
+	totals := []models.Money{}
+	wanted := map[string]int64{}
+	for _, request := range requested {
+		if request.Quantity <= 0 {
+			return nil, models.Money{}, ErrInvalidReturnItems
+		}
+
+		var ordered *models.OrderItem
+		for i := range sub.Items {
+			if sub.Items[i].ProductID == request.ProductID && sub.Items[i].Variant == request.Variant {
+				ordered = &sub.Items[i]
+			}
+		}
+		if ordered == nil {
+			return nil, models.Money{}, ErrInvalidReturnItems
+		}
+
+		key := returnKey(request.ProductID, request.Variant)
+		wanted[key] += request.Quantity
+		if wanted[key]+returned[key] > ordered.Quantity {
+			return nil, models.Money{}, ErrInvalidReturnItems
+		}
+
+		// the line's discount, and tax that came on top of its price, go back in proportion to the units sent back
+		amount := money.Multiply(ordered.UnitPrice, request.Quantity)
+		amount.Amount -= mulDiv(ordered.Discount.Amount, request.Quantity, ordered.Quantity)
+		if !ordered.TaxIncluded {
+			amount.Amount += mulDiv(ordered.Tax.Amount, request.Quantity, ordered.Quantity)
+		}
+		items = append(items, models.ReturnItem{
+			ProductID: ordered.ProductID,
+			Variant:   ordered.Variant,
+			Name:      ordered.Name,
+			Quantity:  request.Quantity,
+			Amount:    amount,
+		})
+		totals = append(totals, amount)
+	}
+
+	total, err := money.Sum(sub.TotalPrice.Currency, totals...)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	return items, total, nil
+}
+
+// returnNotification tells the seller about a new return and the buyer about the seller's answer.
+func returnNotification(ret models.Return, now time.Time) models.Notification {
+	order_id := ret.OrderID
+	notification := models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    ret.UserID,
+		Kind:      NotifyReturn,
+		OrderID:   &order_id,
+		CreatedAT: now,
+	}
+
+	switch ret.Status {
+	case ReturnRequested:
+		notification.UserID = ret.SellerID
+		notification.Title = "Return requested"
+		notification.Body = fmt.Sprintf("The buyer wants to return items of order %s: %s", order_id.Hex(), ret.Reason)
+	case ReturnRefunded:
+		notification.Title = "Return refunded"
+		notification.Body = fmt.Sprintf("The seller refunded %s for your return on order %s", money.Format(ret.Refunded), order_id.Hex())
+	case ReturnDenied:
+		notification.Title = "Return denied"
+		notification.Body = fmt.Sprintf("The seller denied your return on order %s", order_id.Hex())
+		if ret.SellerNote != "" {
+			notification.Body += ": " + ret.SellerNote
+		}
+	default:
+		notification.Title = "Return updated"
+		notification.Body = fmt.Sprintf("Your return on order %s is now %s", order_id.Hex(), ret.Status)
+	}
+	return notification
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/payment"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWasPaid(t *testing.T) {
+	sub := models.SubOrder{StatusHistory: []models.OrderStatusChange{{Status: OrderPending}, {Status: OrderCancelled}}}
+	require.False(t, wasPaid(sub))
+
+	sub.StatusHistory = []models.OrderStatusChange{{Status: OrderPending}, {Status: OrderPaid}, {Status: OrderCancelled}}
+	require.True(t, wasPaid(sub))
+}
+
+func TestReturnItems(t *testing.T) {
+	shirt := primitive.NewObjectID()
+	mug := primitive.NewObjectID()
+	sub := models.SubOrder{
+		Items: []models.OrderItem{
+			{ProductID: shirt, Variant: "L", Name: "Shirt", Quantity: 3, UnitPrice: models.Money{Amount: 500000, Currency: "NGN"}},
+			{ProductID: mug, Name: "Mug", Quantity: 1, UnitPrice: models.Money{Amount: 150000, Currency: "NGN"}},
+		},
+		TotalPrice: models.Money{Amount: 1650000, Currency: "NGN"},
+	}
+
+	items, amount, err := returnItems(sub, []models.ReturnItem{
+		{ProductID: shirt, Variant: "L", Quantity: 2},
+		{ProductID: mug, Quantity: 1},
+	}, map[string]int64{})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "Shirt", items[0].Name)
+	require.Equal(t, int64(1000000), items[0].Amount.Amount)
+	require.Equal(t, models.Money{Amount: 1150000, Currency: "NGN"}, amount)
+
+	// one shirt is already on its way back
+	returned := map[string]int64{returnKey(shirt, "L"): 1}
+	_, _, err = returnItems(sub, []models.ReturnItem{{ProductID: shirt, Variant: "L", Quantity: 3}}, returned)
+	require.ErrorIs(t, err, ErrInvalidReturnItems)
+	_, _, err = returnItems(sub, []models.ReturnItem{{ProductID: shirt, Variant: "L", Quantity: 1}, {ProductID: shirt, Variant: "L", Quantity: 2}}, returned)
+	require.ErrorIs(t, err, ErrInvalidReturnItems)
+
+	_, _, err = returnItems(sub, []models.ReturnItem{{ProductID: shirt, Variant: "M", Quantity: 1}}, nil)
+	require.ErrorIs(t, err, ErrInvalidReturnItems)
+	_, _, err = returnItems(sub, []models.ReturnItem{{ProductID: mug, Quantity: 0}}, nil)
+	require.ErrorIs(t, err, ErrInvalidReturnItems)
+	_, _, err = returnItems(sub, nil, nil)
+	require.ErrorIs(t, err, ErrInvalidReturnItems)
+}
+
+// countingPayments refunds everything once per key, like the payment service, and counts how often it was asked to.
+// While failing is set it fails every refund.
+type countingPayments struct {
+	PaymentService
+	refunds int
+	failing bool
+	amounts map[string]models.Money
+}
+
+func (c *countingPayments) Refund(order_id primitive.ObjectID, amount models.Money, key string) (models.Payment, error) {
+	c.refunds++
+	if c.failing {
+		return models.Payment{}, payment.ErrRefundTooLarge
+	}
+	if c.amounts == nil {
+		c.amounts = map[string]models.Money{}
+	}
+	if first, ok := c.amounts[key]; ok {
+		amount = first
+	}
+	c.amounts[key] = amount
+	return models.Payment{OrderID: order_id, Amount: amount, RefundKey: key}, nil
+}
+
+func TestRefundAndRestockOnce(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	orders := NewOrderService(ctx, client, db.Collection("orders"), db.Collection("sub_orders"), db.Collection("products"), nil, nil, NewNotificationService(ctx, db.Collection("notifications")))
+	payments := &countingPayments{}
+	returns := &returnService{col: db.Collection("returns"), orders: orders, payments: payments, ctx: ctx}
+
+	product_id := primitive.NewObjectID()
+	_, err := db.Collection("products").InsertOne(ctx, bson.D{{Key: "_id", Value: product_id}, {Key: "stock", Value: 0}, {Key: "sales", Value: 2}})
+	require.NoError(t, err)
+	lines := []models.CartLine{{ProductID: product_id, SellerID: primitive.NewObjectID(), Quantity: 2, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}}}
+	order, err := newOrder(primitive.NewObjectID(), lines, time.Now())
+	require.NoError(t, err)
+	order.Status = OrderDelivered
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	_, err = db.Collection("orders").InsertOne(ctx, order)
+	require.NoError(t, err)
+	_, err = db.Collection("sub_orders").InsertOne(ctx, subs[0])
+	require.NoError(t, err)
+
+	ret := models.Return{ID: primitive.NewObjectID(), OrderID: order.ID, SubOrderID: subs[0].ID, Status: ReturnApproved, Items: []models.ReturnItem{{ProductID: product_id, Quantity: 2}}}
+	_, err = db.Collection("returns").InsertOne(ctx, ret)
+	require.NoError(t, err)
+
+	// an approval retried after the return failed to move to refunded, what the first call refunded is booked
+	for _, amount := range []int64{order.TotalPrice.Amount, 400} {
+		booked, err := returns.refund(subs[0], models.Money{Amount: amount, Currency: "NGN"}, "return-"+ret.ID.Hex(), &ret.ID, "")
+		require.NoError(t, err)
+		require.Equal(t, order.TotalPrice, booked)
+		require.NoError(t, returns.restock(ret))
+	}
+	require.Equal(t, 2, payments.refunds)
+
+	refunded, err := orders.GetOrder(order.ID)
+	require.NoError(t, err)
+	require.Equal(t, order.TotalPrice, refunded.SubOrders[0].Refunded)
+	require.Equal(t, OrderRefunded, refunded.SubOrders[0].Status)
+	require.Equal(t, OrderRefunded, refunded.Status)
+	require.Len(t, refunded.Events, 1)
+	require.Equal(t, OrderEventRefunded, refunded.Events[0].Kind)
+
+	var product models.Product
+	require.NoError(t, db.Collection("products").FindOne(ctx, bson.D{{Key: "_id", Value: product_id}}).Decode(&product))
+	require.Equal(t, int64(2), product.Stock)
+}
+
+func TestApproveReturnRetriesTheApprovedAmount(t *testing.T) {
+	client, db := testDatabase(t)
+	ctx := context.Background()
+	orders := NewOrderService(ctx, client, db.Collection("orders"), db.Collection("sub_orders"), db.Collection("products"), nil, nil, NewNotificationService(ctx, db.Collection("notifications")))
+	payments := &countingPayments{failing: true}
+	returns := NewReturnService(ctx, db.Collection("returns"), orders, payments, NewNotificationService(ctx, db.Collection("notifications")))
+
+	seller_id := primitive.NewObjectID()
+	lines := []models.CartLine{{ProductID: primitive.NewObjectID(), SellerID: seller_id, Quantity: 2, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}}}
+	order, err := newOrder(primitive.NewObjectID(), lines, time.Now())
+	require.NoError(t, err)
+	order.Status = OrderDelivered
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	_, err = db.Collection("orders").InsertOne(ctx, order)
+	require.NoError(t, err)
+	_, err = db.Collection("sub_orders").InsertOne(ctx, subs[0])
+	require.NoError(t, err)
+
+	ret := models.Return{ID: primitive.NewObjectID(), OrderID: order.ID, SubOrderID: subs[0].ID, SellerID: seller_id, Status: ReturnRequested,
+		Items: []models.ReturnItem{{ProductID: lines[0].ProductID, Quantity: 2}}, Amount: order.TotalPrice}
+	_, err = db.Collection("returns").InsertOne(ctx, ret)
+	require.NoError(t, err)
+
+	// the refund fails, the return stays approved for 600
+	partial := int64(600)
+	_, err = returns.ApproveReturn(ret.ID, seller_id, &partial, "")
+	require.ErrorIs(t, err, payment.ErrRefundTooLarge)
+
+	payments.failing = false
+	more := int64(800)
+	_, err = returns.ApproveReturn(ret.ID, seller_id, &more, "")
+	require.ErrorIs(t, err, ErrRefundAmountChanged)
+
+	refunded, err := returns.ApproveReturn(ret.ID, seller_id, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, ReturnRefunded, refunded.Status)
+	require.Equal(t, models.Money{Amount: 600, Currency: "NGN"}, refunded.Refunded)
+	sub, err := orders.SellerOrder(subs[0].ID, seller_id)
+	require.NoError(t, err)
+	require.Equal(t, models.Money{Amount: 600, Currency: "NGN"}, sub.Refunded)
+}
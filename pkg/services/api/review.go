@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/pagination"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+var (
+	ErrReviewNotFound    = errors.New("can't find review")
+	ErrInvalidRating     = errors.New("rating must be between 1 and 5")
+	ErrNotPurchased      = errors.New("only buyers who received this product can review it")
+	ErrOwnProduct        = errors.New("sellers cannot review their own products")
+	ErrDuplicateReview   = errors.New("you have already reviewed this product")
+	ErrInvalidModeration = errors.New("a review can only be approved or rejected")
+)
+
+type ReviewService interface {
+	CreateReview(user_id primitive.ObjectID, product_id primitive.ObjectID, rating int, body string, photos []string) (models.Review, error)
+	UpdateReview(id primitive.ObjectID, user_id primitive.ObjectID, rating int, body string, photos []string) (models.Review, error)
+	DeleteReview(id primitive.ObjectID, user_id primitive.ObjectID) error
+	Reply(id primitive.ObjectID, seller_id primitive.ObjectID, body string) (models.Review, error)
+	Moderate(id primitive.ObjectID, status string) (models.Review, error)
+	ProductReviews(product_id primitive.ObjectID, rating int, req pagination.Request) (pagination.Page[models.Review], error)
+	PendingReviews(req pagination.Request) (pagination.Page[models.Review], error)
+}
+
+type reviewService struct {
+	col      *mongo.Collection
+	prod_col *mongo.Collection
+	sub_col  *mongo.Collection
+	ctx      context.Context
+}
+
+func NewReviewService(ctx context.Context, col *mongo.Collection, prod_col *mongo.Collection, sub_col *mongo.Collection) ReviewService {
+	return &reviewService{
+		col:      col,
+		prod_col: prod_col,
+		sub_col:  sub_col,
+		ctx:      ctx,
+	}
+}
+
+// CreateReview saves a pending review, the seller must have delivered the product to the buyer.
+func (r *reviewService) CreateReview(user_id primitive.ObjectID, product_id primitive.ObjectID, rating int, body string, photos []string) (models.Review, error) {
+	if rating < 1 || rating > 5 {
+		return models.Review{}, ErrInvalidRating
+	}
+
+	var product models.Product
+	if err := r.prod_col.FindOne(r.ctx, bson.D{{Key: "_id", Value: product_id}}).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Review{}, ErrCantFindProduct
+		}
+		return models.Review{}, err
+	}
+
+	if product.UserID == user_id {
+		return models.Review{}, ErrOwnProduct
+	}
+
+	var sub models.SubOrder
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "items.productId", Value: product_id}, {Key: "status", Value: OrderDelivered}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if err := r.sub_col.FindOne(r.ctx, filter, opts).Decode(&sub); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Review{}, ErrNotPurchased
+		}
+		return models.Review{}, err
+	}
+
+	if photos == nil {
+		photos = []string{}
+	}
+
+	review := models.Review{
+		ID:        primitive.NewObjectID(),
+		ProductID: product_id,
+		SellerID:  product.UserID,
+		UserID:    user_id,
+		OrderID:   sub.OrderID,
+		Rating:    rating,
+		Body:      body,
+		Photos:    photos,
+		Status:    ReviewPending,
+		CreatedAT: time.Now(),
+		UpdatedAT: time.Now(),
+	}
+
+	if _, err := r.col.InsertOne(r.ctx, review, options.InsertOne()); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Review{}, ErrDuplicateReview
+		}
+		return models.Review{}, err
+	}
+	return review, nil
+}
+
+// UpdateReview lets the author edit their review, it goes back to moderation and stops counting until approved again.
+func (r *reviewService) UpdateReview(id primitive.ObjectID, user_id primitive.ObjectID, rating int, body string, photos []string) (models.Review, error) {
+	if rating < 1 || rating > 5 {
+		return models.Review{}, ErrInvalidRating
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	setObj := bson.D{
+		{Key: "rating", Value: rating},
+		{Key: "body", Value: body},
+		{Key: "status", Value: ReviewPending},
+		{Key: "updatedAt", Value: time.Now()},
+	}
+	// nil keeps the photos already on the review
+	if photos != nil {
+		setObj = append(setObj, bson.E{Key: "photos", Value: photos})
+	}
+	updateObj := bson.D{{Key: "$set", Value: setObj}}
+
+	var before models.Review
+	if err := r.col.FindOneAndUpdate(r.ctx, filter, updateObj, options.FindOneAndUpdate()).Decode(&before); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Review{}, ErrReviewNotFound
+		}
+		return models.Review{}, err
+	}
+
+	if before.Status == ReviewApproved {
+		if err := r.applyRating(before.ProductID, before.Rating, -1); err != nil {
+			return models.Review{}, err
+		}
+	}
+
+	return r.findOne(id)
+}
+
+func (r *reviewService) DeleteReview(id primitive.ObjectID, user_id primitive.ObjectID) error {
+	var review models.Review
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}
+	if err := r.col.FindOneAndDelete(r.ctx, filter).Decode(&review); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrReviewNotFound
+		}
+		return err
+	}
+
+	if review.Status == ReviewApproved {
+		return r.applyRating(review.ProductID, review.Rating, -1)
+	}
+	return nil
+}
+
+// Reply sets or replaces the seller's answer to a review of one of their products.
+func (r *reviewService) Reply(id primitive.ObjectID, seller_id primitive.ObjectID, body string) (models.Review, error) {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}}
+	reply := models.ReviewReply{Body: body, CreatedAT: time.Now()}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "reply", Value: reply}, {Key: "updatedAt", Value: time.Now()}}}}
+
+	var review models.Review
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.col.FindOneAndUpdate(r.ctx, filter, updateObj, opts).Decode(&review); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Review{}, ErrReviewNotFound
+		}
+		return models.Review{}, err
+	}
+	return review, nil
+}
+
+// Moderate approves or rejects a review and moves its rating in or out of the product's aggregate.
+func (r *reviewService) Moderate(id primitive.ObjectID, status string) (models.Review, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return models.Review{}, ErrInvalidModeration
+	}
+
+	// matching on the other statuses makes a repeated call a no-op, so a rating is never counted twice
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: bson.D{{Key: "$ne", Value: status}}}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "updatedAt", Value: time.Now()}}}}
+
+	var before models.Review
+	err := r.col.FindOneAndUpdate(r.ctx, filter, updateObj, options.FindOneAndUpdate()).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return r.findOne(id)
+	}
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	switch {
+	case status == ReviewApproved:
+		err = r.applyRating(before.ProductID, before.Rating, 1)
+	case before.Status == ReviewApproved:
+		err = r.applyRating(before.ProductID, before.Rating, -1)
+	}
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	before.Status = status
+	return before, nil
+}
+
+// ProductReviews lists the approved reviews of a product, newest first, rating 0 means every rating.
+func (r *reviewService) ProductReviews(product_id primitive.ObjectID, rating int, req pagination.Request) (pagination.Page[models.Review], error) {
+	filter := bson.D{{Key: "productId", Value: product_id}, {Key: "status", Value: ReviewApproved}}
+	if rating != 0 {
+		if rating < 1 || rating > 5 {
+			return pagination.Page[models.Review]{}, ErrInvalidRating
+		}
+		filter = append(filter, bson.E{Key: "rating", Value: rating})
+	}
+	return pagination.Find(r.ctx, r.col, filter, req, pagination.Sort{Field: "_id", Desc: true}, reviewKey)
+}
+
+// PendingReviews is the moderation queue, oldest first.
+func (r *reviewService) PendingReviews(req pagination.Request) (pagination.Page[models.Review], error) {
+	filter := bson.D{{Key: "status", Value: ReviewPending}}
+	return pagination.Find(r.ctx, r.col, filter, req, pagination.Sort{Field: "_id"}, reviewKey)
+}
+
+func (r *reviewService) findOne(id primitive.ObjectID) (models.Review, error) {
+	var review models.Review
+	if err := r.col.FindOne(r.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&review); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Review{}, ErrReviewNotFound
+		}
+		return models.Review{}, err
+	}
+	return review, nil
+}
+
+func (r *reviewService) applyRating(product_id primitive.ObjectID, rating int, delta int64) error {
+	_, err := r.prod_col.UpdateByID(r.ctx, product_id, ratingUpdate(rating, delta), options.Update())
+	return err
+}
+
+func reviewKey(review models.Review) (interface{}, primitive.ObjectID) {
+	return review.ID, review.ID
+}
+
+// ratingUpdate adds delta reviews of the given rating to a product's aggregate and recomputes the
+// average in the same write, so concurrent moderation never leaves the average out of step.
+func ratingUpdate(rating int, delta int64) mongo.Pipeline {
+	star := strconv.Itoa(rating)
+	add := func(field string, by int64) bson.D {
+		return bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{field, 0}}}, by}}}
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "ratingCount", Value: add("$ratingCount", delta)},
+			{Key: "ratingSum", Value: add("$ratingSum", int64(rating)*delta)},
+			{Key: "ratingHistogram", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$ratingHistogram", bson.D{}}}},
+				bson.D{{Key: star, Value: add("$ratingHistogram."+star, delta)}},
+			}}}},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "rating", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$gt", Value: bson.A{"$ratingCount", 0}}},
+				bson.D{{Key: "$divide", Value: bson.A{"$ratingSum", "$ratingCount"}}},
+				0,
+			}}}},
+		}}},
+	}
+}
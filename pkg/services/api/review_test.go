@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRatingUpdate(t *testing.T) {
+	pipeline := ratingUpdate(4, -1)
+	require.Len(t, pipeline, 2)
+
+	counts := pipeline[0][0].Value.(bson.D)
+	require.Equal(t, "ratingCount", counts[0].Key)
+	require.Equal(t, bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$ratingCount", 0}}}, int64(-1)}, counts[0].Value.(bson.D)[0].Value)
+	require.Equal(t, int64(-4), counts[1].Value.(bson.D)[0].Value.(bson.A)[1])
+
+	histogram := counts[2].Value.(bson.D)[0].Value.(bson.A)[1].(bson.D)
+	require.Equal(t, "4", histogram[0].Key)
+
+	require.Equal(t, "rating", pipeline[1][0].Value.(bson.D)[0].Key)
+}
+
+func TestCreateReviewNeedsDeliveredSubOrder(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+	reviews := NewReviewService(ctx, db.Collection("reviews"), db.Collection("products"), db.Collection("suborders"))
+
+	buyer, seller := primitive.NewObjectID(), primitive.NewObjectID()
+	product := models.Product{ID: primitive.NewObjectID(), UserID: seller, Status: StatusPublished}
+	_, err := db.Collection("products").InsertOne(ctx, product)
+	require.NoError(t, err)
+
+	sub := models.SubOrder{
+		ID:       primitive.NewObjectID(),
+		OrderID:  primitive.NewObjectID(),
+		UserID:   buyer,
+		SellerID: seller,
+		Status:   OrderShipped,
+		Items:    []models.OrderItem{{ProductID: product.ID, SellerID: seller, Quantity: 1}},
+	}
+	_, err = db.Collection("suborders").InsertOne(ctx, sub)
+	require.NoError(t, err)
+
+	_, err = reviews.CreateReview(buyer, product.ID, 5, "great", nil)
+	require.ErrorIs(t, err, ErrNotPurchased)
+
+	_, err = db.Collection("suborders").UpdateByID(ctx, sub.ID, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: OrderDelivered}}}})
+	require.NoError(t, err)
+
+	review, err := reviews.CreateReview(buyer, product.ID, 5, "great", nil)
+	require.NoError(t, err)
+	require.Equal(t, sub.OrderID, review.OrderID)
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/shipping"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/types"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrDeliveryZoneNotFound = errors.New("delivery zone not found")
+	ErrDeliveryZoneOverlaps = errors.New("another delivery zone of the shop already covers one of these regions")
+	ErrNoDelivery           = errors.New("a seller in the cart doesn't deliver to this address")
+	ErrShippingRateNotFound = errors.New("the shipping rate picked for a seller isn't offered for this address")
+)
+
+type ShippingService interface {
+	CreateZone(seller_id primitive.ObjectID, data types.AddDeliveryZone) (models.DeliveryZone, error)
+	// UpdateZone replaces the name, regions and rates of a zone, orders already placed keep the rate they were charged.
+	UpdateZone(seller_id primitive.ObjectID, id primitive.ObjectID, data types.AddDeliveryZone) (models.DeliveryZone, error)
+	DeleteZone(seller_id primitive.ObjectID, id primitive.ObjectID) error
+	GetZones(seller_id primitive.ObjectID) ([]models.DeliveryZone, error)
+	// Address finds the address of the user's address book an order goes to, their default one when id is empty.
+	Address(ctx context.Context, user_id primitive.ObjectID, id string) (models.Address, error)
+	// Quote lists what every seller of a new order offers to deliver it to address.
+	Quote(ctx context.Context, order models.Order, products map[primitive.ObjectID]models.Product, address models.Address) ([]models.ShippingQuote, error)
+	// Apply charges a new order for delivery to address at the rate picked per seller id in choices, or the cheapest one.
+	// ctx should be the session context of the checkout placing the order.
+	Apply(ctx context.Context, order *models.Order, products map[primitive.ObjectID]models.Product, address models.Address, choices map[string]string) error
+}
+
+type shippingService struct {
+	col      *mongo.Collection
+	user_col *mongo.Collection
+	ctx      context.Context
+}
+
+func NewShippingService(ctx context.Context, col *mongo.Collection, user_col *mongo.Collection) ShippingService {
+	return &shippingService{
+		col:      col,
+		user_col: user_col,
+		ctx:      ctx,
+	}
+}
+
+func (s *shippingService) CreateZone(seller_id primitive.ObjectID, data types.AddDeliveryZone) (models.DeliveryZone, error) {
+	now := time.Now()
+	zone, err := s.newZone(seller_id, data)
+	if err != nil {
+		return models.DeliveryZone{}, err
+	}
+	zone.ID = primitive.NewObjectID()
+	zone.CreatedAT, zone.UpdatedAT = now, now
+
+	if _, err = s.col.InsertOne(s.ctx, zone); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.DeliveryZone{}, ErrDeliveryZoneOverlaps
+		}
+		return models.DeliveryZone{}, err
+	}
+	return zone, nil
+}
+
+func (s *shippingService) UpdateZone(seller_id primitive.ObjectID, id primitive.ObjectID, data types.AddDeliveryZone) (models.DeliveryZone, error) {
+	zone, err := s.newZone(seller_id, data)
+	if err != nil {
+		return models.DeliveryZone{}, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "name", Value: zone.Name},
+		{Key: "regions", Value: zone.Regions},
+		{Key: "rates", Value: zone.Rates},
+		{Key: "updatedAt", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err = s.col.FindOneAndUpdate(s.ctx, filter, updateObj, opts).Decode(&zone); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.DeliveryZone{}, ErrDeliveryZoneNotFound
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return models.DeliveryZone{}, ErrDeliveryZoneOverlaps
+		}
+		return models.DeliveryZone{}, err
+	}
+	return zone, nil
+}
+
+func (s *shippingService) DeleteZone(seller_id primitive.ObjectID, id primitive.ObjectID) error {
+	result, err := s.col.DeleteOne(s.ctx, bson.D{{Key: "_id", Value: id}, {Key: "sellerId", Value: seller_id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrDeliveryZoneNotFound
+	}
+	return nil
+}
+
+// GetZones lists the seller's zones, oldest first.
+func (s *shippingService) GetZones(seller_id primitive.ObjectID) ([]models.DeliveryZone, error) {
+	return s.zones(s.ctx, []primitive.ObjectID{seller_id})
+}
+
+func (s *shippingService) Address(ctx context.Context, user_id primitive.ObjectID, id string) (models.Address, error) {
+	return findAddress(ctx, s.user_col, user_id, id)
+}
+
+func (s *shippingService) Quote(ctx context.Context, order models.Order, products map[primitive.ObjectID]models.Product, address models.Address) ([]models.ShippingQuote, error) {
+	zones, err := s.zones(ctx, order.SellerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: order.SellerIDs}}}, {Key: "freeShipping", Value: true}}
+	cursor, err := s.user_col.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	sellers := []models.User{}
+	if err = cursor.All(ctx, &sellers); err != nil {
+		return nil, err
+	}
+	free := map[primitive.ObjectID]bool{}
+	for _, seller := range sellers {
+		free[seller.ID] = true
+	}
+
+	return quoteOrder(order, products, zones, free, address.Zone()), nil
+}
+
+func (s *shippingService) Apply(ctx context.Context, order *models.Order, products map[primitive.ObjectID]models.Product, address models.Address, choices map[string]string) error {
+	quotes, err := s.Quote(ctx, *order, products, address)
+	if err != nil {
+		return err
+	}
+	order.ShippingAddress = &address
+	return applyShipping(order, quotes, choices)
+}
+
+func (s *shippingService) zones(ctx context.Context, seller_ids []primitive.ObjectID) ([]models.DeliveryZone, error) {
+	filter := bson.D{{Key: "sellerId", Value: bson.D{{Key: "$in", Value: seller_ids}}}}
+	cursor, err := s.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	zones := []models.DeliveryZone{}
+	if err = cursor.All(ctx, &zones); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// newZone checks data and builds the zone of the seller from it, prices are in the shop's currency unless data says otherwise.
+func (s *shippingService) newZone(seller_id primitive.ObjectID, data types.AddDeliveryZone) (models.DeliveryZone, error) {
+	currency := strings.ToUpper(data.Currency)
+	if currency == "" {
+		var seller models.User
+		opts := options.FindOne().SetProjection(bson.D{{Key: "currency", Value: 1}})
+		if err := s.user_col.FindOne(s.ctx, bson.D{{Key: "_id", Value: seller_id}}, opts).Decode(&seller); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return models.DeliveryZone{}, ErrUserNotFound
+			}
+			return models.DeliveryZone{}, err
+		}
+		currency = seller.Currency
+	}
+	if !money.Valid(currency) {
+		return models.DeliveryZone{}, money.ErrUnknownCurrency
+	}
+
+	zone := models.DeliveryZone{SellerID: seller_id, Name: strings.TrimSpace(data.Name), Regions: []string{}, Rates: []models.ShippingRate{}}
+	seen := map[string]bool{}
+	for _, region := range data.Regions {
+		region, err := tax.NormalizeRegion(region)
+		if err != nil {
+			return models.DeliveryZone{}, err
+		}
+		if region != "" && !seen[region] {
+			seen[region] = true
+			zone.Regions = append(zone.Regions, region)
+		}
+	}
+
+	for _, r := range data.Rates {
+		rate := models.ShippingRate{
+			ID:      primitive.NewObjectID(),
+			Name:    strings.TrimSpace(r.Name),
+			Kind:    r.Kind,
+			Price:   money.New(r.Price, currency),
+			MinDays: r.MinDays,
+			MaxDays: r.MaxDays,
+		}
+		switch r.Kind {
+		case shipping.RateWeight:
+			per_kg := money.New(r.PerKg, currency)
+			rate.PerKg = &per_kg
+		case shipping.RateFreeOver:
+			free_over := money.New(r.FreeOver, currency)
+			rate.FreeOver = &free_over
+		}
+		if err := shipping.CheckRate(rate); err != nil {
+			return models.DeliveryZone{}, err
+		}
+		zone.Rates = append(zone.Rates, rate)
+	}
+	return zone, nil
+}
+
+// quoteOrder prices the options of every seller of order for delivery to region. Where none of their zones
+// covers region the sellers in free ship for free, the others get a quote without options.
+func quoteOrder(order models.Order, products map[primitive.ObjectID]models.Product, zones []models.DeliveryZone, free map[primitive.ObjectID]bool, region string) []models.ShippingQuote {
+	currency := order.TotalPrice.Currency
+	by_seller := map[primitive.ObjectID][]models.DeliveryZone{}
+	for _, zone := range zones {
+		by_seller[zone.SellerID] = append(by_seller[zone.SellerID], zone)
+	}
+	subtotals, grams := map[primitive.ObjectID]int64{}, map[primitive.ObjectID]int64{}
+	// sellers with an item that has no weight, products listed before weights were kept have none
+	unweighed := map[primitive.ObjectID]bool{}
+	for _, item := range order.Items {
+		subtotals[item.SellerID] += item.UnitPrice.Amount * item.Quantity
+		grams[item.SellerID] += products[item.ProductID].Weight * item.Quantity
+		if products[item.ProductID].Weight <= 0 {
+			unweighed[item.SellerID] = true
+		}
+	}
+
+	quotes := []models.ShippingQuote{}
+	for _, seller_id := range order.SellerIDs {
+		quote := models.ShippingQuote{SellerID: seller_id, Options: []models.ShippingOption{}}
+		if zone, ok := shipping.MatchZone(by_seller[seller_id], region); ok {
+			quote.Options = shipping.Options(seller_id, zone, money.New(subtotals[seller_id], currency), grams[seller_id], !unweighed[seller_id])
+		} else if free[seller_id] {
+			quote.Options = append(quote.Options, shipping.Free(seller_id, currency))
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes
+}
+
+// applyShipping adds the option picked in choices, or the cheapest one, of every quote to order.
+func applyShipping(order *models.Order, quotes []models.ShippingQuote, choices map[string]string) error {
+	rates := []models.ShippingOption{}
+	total := int64(0)
+	for _, quote := range quotes {
+		if len(quote.Options) == 0 {
+			return ErrNoDelivery
+		}
+		option := quote.Options[0]
+		if rate_id, ok := choices[quote.SellerID.Hex()]; ok {
+			found := false
+			for _, o := range quote.Options {
+				if o.RateID != nil && o.RateID.Hex() == rate_id {
+					option, found = o, true
+					break
+				}
+			}
+			if !found {
+				return ErrShippingRateNotFound
+			}
+		}
+		rates = append(rates, option)
+		total += option.Price.Amount
+	}
+
+	order.ShippingRates = rates
+	order.Shipping = money.New(total, order.TotalPrice.Currency)
+	order.TotalPrice.Amount += total
+	return nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/shipping"
+	"kamoushop/pkg/services/types"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQuoteAndApplyShipping(t *testing.T) {
+	near, far, relaxed := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	rice, shirt, mug := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	order := promotionOrder(t,
+		models.CartLine{ProductID: rice, SellerID: near, Quantity: 3, UnitPrice: models.Money{Amount: 2000, Currency: "NGN"}},
+		models.CartLine{ProductID: shirt, SellerID: far, Quantity: 1, UnitPrice: models.Money{Amount: 5000, Currency: "NGN"}},
+		models.CartLine{ProductID: mug, SellerID: relaxed, Quantity: 1, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}},
+	)
+	products := map[primitive.ObjectID]models.Product{rice: {Weight: 1500}, shirt: {Weight: 300}, mug: {Weight: 400}}
+
+	per_kg := models.Money{Amount: 200, Currency: "NGN"}
+	zones := []models.DeliveryZone{
+		{ID: primitive.NewObjectID(), SellerID: near, Regions: []string{"NG"}, Rates: []models.ShippingRate{
+			{ID: primitive.NewObjectID(), Name: "By weight", Kind: shipping.RateWeight, Price: models.Money{Amount: 1000, Currency: "NGN"}, PerKg: &per_kg},
+		}},
+		{ID: primitive.NewObjectID(), SellerID: far, Regions: []string{"GH"}, Rates: []models.ShippingRate{
+			{ID: primitive.NewObjectID(), Name: "Standard", Kind: shipping.RateFlat, Price: models.Money{Amount: 900, Currency: "NGN"}},
+		}},
+	}
+
+	// no zones doesn't mean free shipping, the seller has to say so
+	quotes := quoteOrder(order, products, zones, nil, "NG-LA")
+	require.Empty(t, quotes[2].Options)
+	// nor can a product without a weight be priced by weight
+	unweighed := map[primitive.ObjectID]models.Product{rice: {}, shirt: {Weight: 300}, mug: {Weight: 400}}
+	quotes = quoteOrder(order, unweighed, zones, nil, "NG-LA")
+	require.Empty(t, quotes[0].Options)
+
+	quotes = quoteOrder(order, products, zones, map[primitive.ObjectID]bool{relaxed: true}, "NG-LA")
+	require.Len(t, quotes, 3)
+	// 4.5kg starts 5 kilograms
+	require.Equal(t, int64(2000), quotes[0].Options[0].Price.Amount)
+	require.Empty(t, quotes[1].Options)
+	require.Equal(t, shipping.FreeName, quotes[2].Options[0].Name)
+
+	require.ErrorIs(t, applyShipping(&order, quotes, nil), ErrNoDelivery)
+
+	quotes = append(quotes[:1], quotes[2])
+	require.ErrorIs(t, applyShipping(&order, quotes, map[string]string{near.Hex(): zones[1].Rates[0].ID.Hex()}), ErrShippingRateNotFound)
+
+	require.NoError(t, applyShipping(&order, quotes, map[string]string{near.Hex(): zones[0].Rates[0].ID.Hex()}))
+	require.Equal(t, models.Money{Amount: 2000, Currency: "NGN"}, order.Shipping)
+	require.Equal(t, models.Money{Amount: 14000, Currency: "NGN"}, order.TotalPrice)
+
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	require.Equal(t, "By weight", subs[0].ShippingRate.Name)
+	require.Equal(t, models.Money{Amount: 8000, Currency: "NGN"}, subs[0].TotalPrice)
+	require.Nil(t, subs[1].ShippingRate)
+	require.Equal(t, models.Money{Amount: 0, Currency: "NGN"}, subs[2].Shipping)
+}
+
+func TestAddressBook(t *testing.T) {
+	address, err := newAddress(primitive.NewObjectID(), types.AddAddress{Name: " Ada Obi ", Line1: "1 Marina", City: "Lagos", Country: "ng", Region: "ng-la"})
+	require.NoError(t, err)
+	require.Equal(t, "Ada Obi", address.Name)
+	require.Equal(t, "NG-LA", address.Zone())
+
+	_, err = newAddress(primitive.NewObjectID(), types.AddAddress{Country: "NG", Region: "GH-AA"})
+	require.ErrorIs(t, err, ErrInvalidAddressRegion)
+	_, err = newAddress(primitive.NewObjectID(), types.AddAddress{Country: "NG-LA"})
+	require.ErrorIs(t, err, ErrInvalidAddressRegion)
+
+	book := []models.Address{{ID: primitive.NewObjectID(), IsDefault: true}, {ID: primitive.NewObjectID()}}
+	book = defaultAddress(book, book[1].ID)
+	require.False(t, book[0].IsDefault)
+	require.True(t, book[1].IsDefault)
+	require.Equal(t, 1, addressIndex(book, book[1].ID))
+	require.Equal(t, -1, addressIndex(book, primitive.NewObjectID()))
+}
+
+func TestShippingService(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+	users := db.Collection("users")
+	s := NewShippingService(ctx, db.Collection("delivery_zones"), users)
+
+	seller, product := primitive.NewObjectID(), primitive.NewObjectID()
+	zone, err := s.CreateZone(seller, types.AddDeliveryZone{Name: "Lagos", Regions: []string{"ng-la"}, Currency: "NGN", Rates: []types.AddShippingRate{
+		{Name: "Standard", Kind: "flat", Price: 500},
+		{Name: "Express", Kind: "flat", Price: 1500},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"NG-LA"}, zone.Regions)
+
+	order := promotionOrder(t, models.CartLine{ProductID: product, SellerID: seller, Quantity: 2, UnitPrice: models.Money{Amount: 1000, Currency: "NGN"}})
+	products := map[primitive.ObjectID]models.Product{product: {ID: product, UserID: seller}}
+	address := models.Address{City: "Lagos", Country: "NG", Region: "NG-LA"}
+
+	quotes, err := s.Quote(ctx, order, products, address)
+	require.NoError(t, err)
+	require.Len(t, quotes, 1)
+	require.Len(t, quotes[0].Options, 2)
+	require.Equal(t, "Standard", quotes[0].Options[0].Name)
+
+	err = s.Apply(ctx, &order, products, address, map[string]string{seller.Hex(): primitive.NewObjectID().Hex()})
+	require.ErrorIs(t, err, ErrShippingRateNotFound)
+
+	require.NoError(t, s.Apply(ctx, &order, products, address, map[string]string{seller.Hex(): zone.Rates[1].ID.Hex()}))
+	require.Equal(t, "Lagos", order.ShippingAddress.City)
+	require.Equal(t, models.Money{Amount: 1500, Currency: "NGN"}, order.Shipping)
+	require.Equal(t, models.Money{Amount: 3500, Currency: "NGN"}, order.TotalPrice)
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/types"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTaxRuleNotFound = errors.New("tax rule not found")
+	ErrTaxRuleExists   = errors.New("a tax rule for this region and category already exists")
+)
+
+type TaxService interface {
+	CreateRule(data types.AddTaxRule) (models.TaxRule, error)
+	// UpdateRule changes the name, rate or rounding of a rule, orders already placed keep the tax they were charged.
+	UpdateRule(id primitive.ObjectID, data types.UpdateTaxRule) (models.TaxRule, error)
+	DeleteRule(id primitive.ObjectID) error
+	GetRules() ([]models.TaxRule, error)
+	// Apply taxes the items of a new order delivered to region, products holds the ordered products.
+	// ctx should be the session context of the checkout placing the order.
+	Apply(ctx context.Context, order *models.Order, products map[primitive.ObjectID]models.Product, region string) error
+}
+
+type taxService struct {
+	col        *mongo.Collection
+	user_col   *mongo.Collection
+	categories CategoryService
+	ctx        context.Context
+}
+
+func NewTaxService(ctx context.Context, col *mongo.Collection, user_col *mongo.Collection, categories CategoryService) TaxService {
+	return &taxService{
+		col:        col,
+		user_col:   user_col,
+		categories: categories,
+		ctx:        ctx,
+	}
+}
+
+func (t *taxService) CreateRule(data types.AddTaxRule) (models.TaxRule, error) {
+	region, err := tax.NormalizeRegion(data.Region)
+	if err != nil {
+		return models.TaxRule{}, err
+	}
+
+	now := time.Now()
+	rule := models.TaxRule{
+		ID:        primitive.NewObjectID(),
+		Name:      strings.TrimSpace(data.Name),
+		Region:    region,
+		Rate:      data.Rate,
+		Rounding:  data.Rounding,
+		CreatedAT: now,
+		UpdatedAT: now,
+	}
+	if rule.Rounding == "" {
+		rule.Rounding = tax.RoundHalfUp
+	}
+	if data.Category != "" {
+		category, err := t.categories.GetBySlug(data.Category)
+		if err != nil {
+			return models.TaxRule{}, err
+		}
+		rule.CategoryID = &category.ID
+	}
+	if err = checkTaxRule(rule); err != nil {
+		return models.TaxRule{}, err
+	}
+
+	if _, err = t.col.InsertOne(t.ctx, rule); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.TaxRule{}, ErrTaxRuleExists
+		}
+		return models.TaxRule{}, err
+	}
+	return rule, nil
+}
+
+func (t *taxService) UpdateRule(id primitive.ObjectID, data types.UpdateTaxRule) (models.TaxRule, error) {
+	set := bson.D{{Key: "updatedAt", Value: time.Now()}}
+	if data.Name != nil {
+		set = append(set, bson.E{Key: "name", Value: strings.TrimSpace(*data.Name)})
+	}
+	if data.Rate != nil {
+		if *data.Rate < 0 || *data.Rate > tax.MaxRate {
+			return models.TaxRule{}, tax.ErrInvalidRate
+		}
+		set = append(set, bson.E{Key: "rate", Value: *data.Rate})
+	}
+	if data.Rounding != nil {
+		if !tax.ValidRounding(*data.Rounding) {
+			return models.TaxRule{}, tax.ErrInvalidRounding
+		}
+		set = append(set, bson.E{Key: "rounding", Value: *data.Rounding})
+	}
+
+	var rule models.TaxRule
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := t.col.FindOneAndUpdate(t.ctx, bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$set", Value: set}}, opts).Decode(&rule); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.TaxRule{}, ErrTaxRuleNotFound
+		}
+		return models.TaxRule{}, err
+	}
+	return rule, nil
+}
+
+func (t *taxService) DeleteRule(id primitive.ObjectID) error {
+	result, err := t.col.DeleteOne(t.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTaxRuleNotFound
+	}
+	return nil
+}
+
+// GetRules lists every rule by region, rules for every category first.
+func (t *taxService) GetRules() ([]models.TaxRule, error) {
+	return t.rules(t.ctx)
+}
+
+func (t *taxService) Apply(ctx context.Context, order *models.Order, products map[primitive.ObjectID]models.Product, region string) error {
+	region, err := tax.NormalizeRegion(region)
+	if err != nil {
+		return err
+	}
+
+	rules, err := t.rules(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: order.SellerIDs}}}, {Key: "pricesIncludeTax", Value: true}}
+	cursor, err := t.user_col.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	sellers := []models.User{}
+	if err = cursor.All(ctx, &sellers); err != nil {
+		return err
+	}
+	inclusive := map[primitive.ObjectID]bool{}
+	for _, seller := range sellers {
+		inclusive[seller.ID] = true
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, product := range products {
+		for _, id := range product.CategoryIDs {
+			if !containsID(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	found, err := t.categories.GetByIDs(ids)
+	if err != nil {
+		return err
+	}
+	categories := map[primitive.ObjectID]models.Category{}
+	for _, category := range found {
+		categories[category.ID] = category
+	}
+
+	applyTax(order, products, categories, rules, region, inclusive)
+	return nil
+}
+
+func (t *taxService) rules(ctx context.Context) ([]models.TaxRule, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "region", Value: 1}, {Key: "categoryId", Value: 1}})
+	cursor, err := t.col.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	rules := []models.TaxRule{}
+	if err = cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func checkTaxRule(rule models.TaxRule) error {
+	if rule.Rate < 0 || rule.Rate > tax.MaxRate {
+		return tax.ErrInvalidRate
+	}
+	if !tax.ValidRounding(rule.Rounding) {
+		return tax.ErrInvalidRounding
+	}
+	return nil
+}
+
+// applyTax taxes each item of order at the rule matching its product and the categories it is in, on what is
+// left to pay for it after discounts. inclusive holds the sellers whose prices include tax, for the others
+// it is added to the item.
+func applyTax(order *models.Order, products map[primitive.ObjectID]models.Product, categories map[primitive.ObjectID]models.Category, rules []models.TaxRule, region string, inclusive map[primitive.ObjectID]bool) {
+	currency := order.TotalPrice.Currency
+	order.TaxRegion = region
+
+	total, added := int64(0), int64(0)
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.TaxIncluded = inclusive[item.SellerID]
+		item.TaxRate = 0
+		item.Tax = money.New(0, currency)
+
+		in := []models.Category{}
+		for _, id := range products[item.ProductID].CategoryIDs {
+			if category, ok := categories[id]; ok {
+				in = append(in, category)
+			}
+		}
+		rule, ok := tax.Match(rules, region, in)
+		if !ok {
+			continue
+		}
+		item.TaxRate = rule.Rate
+		item.Tax.Amount = tax.Amount(item.Total.Amount, rule.Rate, item.TaxIncluded, rule.Rounding)
+		if !item.TaxIncluded {
+			item.Total.Amount += item.Tax.Amount
+			added += item.Tax.Amount
+		}
+		total += item.Tax.Amount
+	}
+
+	order.Tax = money.New(total, currency)
+	order.TotalPrice.Amount += added
+}
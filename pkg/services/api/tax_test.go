@@ -0,0 +1,61 @@
+package api
+
+import (
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/tax"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApplyTax(t *testing.T) {
+	food, baked := primitive.NewObjectID(), primitive.NewObjectID()
+	bread, shirt, mug := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	grocer, tailor := primitive.NewObjectID(), primitive.NewObjectID()
+	products := map[primitive.ObjectID]models.Product{
+		bread: {ID: bread, CategoryIDs: []primitive.ObjectID{baked}},
+		shirt: {ID: shirt},
+		mug:   {ID: mug},
+	}
+	// the bread is taxed as food, the category above its own
+	categories := map[primitive.ObjectID]models.Category{
+		baked: {ID: baked, Ancestors: []primitive.ObjectID{food}},
+	}
+	rules := []models.TaxRule{
+		{Region: "NG", Rate: 750, Rounding: tax.RoundHalfUp},
+		{Region: "NG", CategoryID: &food, Rate: 0, Rounding: tax.RoundHalfUp},
+	}
+
+	order := promotionOrder(t,
+		models.CartLine{ProductID: bread, SellerID: grocer, Quantity: 2, UnitPrice: models.Money{Amount: 500, Currency: "NGN"}},
+		models.CartLine{ProductID: shirt, SellerID: tailor, Quantity: 1, UnitPrice: models.Money{Amount: 10000, Currency: "NGN"}},
+		models.CartLine{ProductID: mug, SellerID: grocer, Quantity: 1, UnitPrice: models.Money{Amount: 2150, Currency: "NGN"}},
+	)
+	// a promotion took 1000 off the shirt before tax
+	order.Items[1].Discount.Amount, order.Items[1].Total.Amount, order.TotalPrice.Amount = 1000, 9000, 12150
+
+	// the grocer's prices include tax
+	applyTax(&order, products, categories, rules, "NG-LA", map[primitive.ObjectID]bool{grocer: true})
+
+	require.Equal(t, "NG-LA", order.TaxRegion)
+	require.Zero(t, order.Items[0].Tax.Amount)
+
+	require.Equal(t, int64(750), order.Items[1].TaxRate)
+	require.Equal(t, models.Money{Amount: 675, Currency: "NGN"}, order.Items[1].Tax)
+	require.Equal(t, models.Money{Amount: 9675, Currency: "NGN"}, order.Items[1].Total)
+
+	// 2150 includes 150 of tax
+	require.True(t, order.Items[2].TaxIncluded)
+	require.Equal(t, models.Money{Amount: 150, Currency: "NGN"}, order.Items[2].Tax)
+	require.Equal(t, models.Money{Amount: 2150, Currency: "NGN"}, order.Items[2].Total)
+
+	require.Equal(t, models.Money{Amount: 825, Currency: "NGN"}, order.Tax)
+	require.Equal(t, models.Money{Amount: 12825, Currency: "NGN"}, order.TotalPrice)
+
+	subs, err := SplitOrder(order)
+	require.NoError(t, err)
+	require.Equal(t, models.Money{Amount: 150, Currency: "NGN"}, subs[0].Tax)
+	require.Equal(t, models.Money{Amount: 675, Currency: "NGN"}, subs[1].Tax)
+	require.Equal(t, models.Money{Amount: 9675, Currency: "NGN"}, subs[1].TotalPrice)
+}
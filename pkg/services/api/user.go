@@ -2,8 +2,12 @@ package api
 
 import (
 	"context"
+	"errors"
 	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"kamoushop/pkg/services/pagination"
 	"kamoushop/pkg/services/types"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -11,26 +15,42 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrShopHasProducts = errors.New("the shop currency cannot change once the shop has products")
+
 type UserService interface {
 	GetUserById(id primitive.ObjectID) (types.User, error)
 	GetUserByIdWithPassword(id primitive.ObjectID) (models.User, error)
 	UpdateUser(filter bson.D, updateObj bson.D) error
 	FindOne(filter bson.D) (models.User, error)
-	GetAllUsers(limit int64, page int64) ([]types.User, int64, error)
-	QueryBrands(brand_name_keyword string, limit int64, page int64) ([]types.User, int64, error)
+	GetAllUsers(req pagination.Request) (pagination.Page[types.User], error)
+	QueryBrands(brand_name_keyword string, req pagination.Request) (pagination.Page[types.User], error)
 	DeleteUser(userId primitive.ObjectID) error
+	UpdateBrandName(userId primitive.ObjectID, brand_name string) error
+	UpdateCurrency(userId primitive.ObjectID, currency string) error
+	UpdateTaxPricing(userId primitive.ObjectID, prices_include_tax bool) error
+	UpdateFreeShipping(userId primitive.ObjectID, free_shipping bool) error
+	StarShop(user_id primitive.ObjectID, shop_id primitive.ObjectID) error
+	UnstarShop(user_id primitive.ObjectID, shop_id primitive.ObjectID) error
+	Following(user_id primitive.ObjectID, req pagination.Request) (pagination.Page[types.User], error)
+	GetAddresses(user_id primitive.ObjectID) ([]models.Address, error)
+	AddAddress(user_id primitive.ObjectID, data types.AddAddress) (models.Address, error)
+	UpdateAddress(user_id primitive.ObjectID, id primitive.ObjectID, data types.AddAddress) (models.Address, error)
+	DeleteAddress(user_id primitive.ObjectID, id primitive.ObjectID) error
+	SetDefaultAddress(user_id primitive.ObjectID, id primitive.ObjectID) (models.Address, error)
 	// AddToCart(user_id primitive.ObjectID, cart []models.UserProduct) error
 }
 
 type userService struct {
-	col *mongo.Collection
-	ctx context.Context
+	col      *mongo.Collection
+	prod_col *mongo.Collection
+	ctx      context.Context
 }
 
-func NewUserService(col *mongo.Collection, ctx context.Context) UserService {
+func NewUserService(col *mongo.Collection, prod_col *mongo.Collection, ctx context.Context) UserService {
 	return &userService{
-		col: col,
-		ctx: ctx,
+		col:      col,
+		prod_col: prod_col,
+		ctx:      ctx,
 	}
 }
 
@@ -69,60 +89,81 @@ func (u *userService) FindOne(filter bson.D) (models.User, error) {
 	return user, nil
 }
 
-func (u *userService) GetAllUsers(limit int64, page int64) ([]types.User, int64, error) {
-	counter := int64(1)
-	skip := (page - counter) * limit
-	cursor, err := u.col.Find(u.ctx, bson.D{}, &options.FindOptions{Limit: &limit, Skip: &skip})
-
-	if err != nil {
-		return nil, 0, err
-	}
-
-	count, err := u.col.CountDocuments(u.ctx, bson.D{})
-	if err != nil {
-		return nil, 0, err
-	}
-
-	var users []types.User
+func (u *userService) GetAllUsers(req pagination.Request) (pagination.Page[types.User], error) {
+	return pagination.Find(u.ctx, u.col, bson.D{}, req, pagination.Sort{Field: "_id"}, userKey)
+}
 
-	if err = cursor.All(u.ctx, &users); err != nil {
-		return nil, 0, err
-	}
+func (u *userService) QueryBrands(brand_name_keyword string, req pagination.Request) (pagination.Page[types.User], error) {
+	filter := primitive.Regex{Pattern: brand_name_keyword, Options: "i"}
+	return pagination.Find(u.ctx, u.col, bson.D{{Key: "brandName", Value: filter}}, req, pagination.Sort{Field: "_id"}, userKey)
+}
 
-	return users, count, nil
+func userKey(user types.User) (interface{}, primitive.ObjectID) {
+	return user.ID, user.ID
 }
 
-func (u *userService) QueryBrands(brand_name_keyword string, limit int64, page int64) ([]types.User, int64, error) {
-	counter := int64(1)
-	skip := (page - counter) * limit
-	filter := primitive.Regex{Pattern: brand_name_keyword, Options: "i"}
-	cursor, err := u.col.Find(u.ctx, bson.D{{Key: "brandName", Value: filter}}, &options.FindOptions{Limit: &limit, Skip: &skip})
+func (u *userService) DeleteUser(userId primitive.ObjectID) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: userId}}
 
+	_, err := u.col.DeleteOne(u.ctx, filter, options.Delete())
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 
-	count, err := u.col.CountDocuments(u.ctx, bson.D{{Key: "brandName", Value: filter}})
-	if err != nil {
-		return nil, 0, err
-	}
+	return nil
+}
 
-	var brands []types.User
+// UpdateBrandName renames the user's shop and the brand copied onto their products for search.
+func (u *userService) UpdateBrandName(userId primitive.ObjectID, brand_name string) error {
+	filter := bson.D{{Key: "_id", Value: userId}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "brandName", Value: brand_name}, {Key: "updatedAt", Value: time.Now()}}}}
 
-	if err = cursor.All(u.ctx, &brands); err != nil {
-		return nil, 0, err
+	if _, err := u.col.UpdateOne(u.ctx, filter, updateObj, options.Update()); err != nil {
+		return err
 	}
 
-	return brands, count, nil
+	prodFilter := bson.D{{Key: "userId", Value: userId}}
+	prodUpdate := bson.D{{Key: "$set", Value: bson.D{{Key: "brand", Value: brand_name}}}}
+	if _, err := u.prod_col.UpdateMany(u.ctx, prodFilter, prodUpdate); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (u *userService) DeleteUser(userId primitive.ObjectID) error {
-	filter := bson.D{primitive.E{Key: "_id", Value: userId}}
+// UpdateCurrency changes the currency of the user's shop, prices are not converted so it is only
+// allowed while the shop has no products.
+func (u *userService) UpdateCurrency(userId primitive.ObjectID, currency string) error {
+	if !money.Valid(currency) {
+		return money.ErrUnknownCurrency
+	}
 
-	_, err := u.col.DeleteOne(u.ctx, filter, options.Delete())
+	count, err := u.prod_col.CountDocuments(u.ctx, bson.D{{Key: "userId", Value: userId}}, options.Count().SetLimit(1))
 	if err != nil {
 		return err
 	}
+	if count > 0 {
+		return ErrShopHasProducts
+	}
 
-	return nil
+	filter := bson.D{{Key: "_id", Value: userId}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "currency", Value: currency}, {Key: "updatedAt", Value: time.Now()}}}}
+	_, err = u.col.UpdateOne(u.ctx, filter, updateObj, options.Update())
+	return err
+}
+
+// UpdateTaxPricing sets whether the shop's prices include tax, orders already placed keep the tax they were charged.
+func (u *userService) UpdateTaxPricing(userId primitive.ObjectID, prices_include_tax bool) error {
+	filter := bson.D{{Key: "_id", Value: userId}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "pricesIncludeTax", Value: prices_include_tax}, {Key: "updatedAt", Value: time.Now()}}}}
+	_, err := u.col.UpdateOne(u.ctx, filter, updateObj, options.Update())
+	return err
+}
+
+// UpdateFreeShipping sets whether the shop delivers for free where none of its delivery zones does,
+// a shop without zones or free shipping can't be ordered from.
+func (u *userService) UpdateFreeShipping(userId primitive.ObjectID, free_shipping bool) error {
+	filter := bson.D{{Key: "_id", Value: userId}}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "freeShipping", Value: free_shipping}, {Key: "updatedAt", Value: time.Now()}}}}
+	_, err := u.col.UpdateOne(u.ctx, filter, updateObj, options.Update())
+	return err
 }
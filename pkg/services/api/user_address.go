@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/tax"
+	"kamoushop/pkg/services/types"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxAddresses bounds the address book of a user.
+const MaxAddresses = 20
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAddressNotFound      = errors.New("address not found")
+	ErrAddressRequired      = errors.New("add a delivery address to your address book first")
+	ErrAddressBookFull      = errors.New("the address book holds at most 20 addresses")
+	ErrAddressBookChanged   = errors.New("the address book changed in the meantime, try again")
+	ErrInvalidAddressRegion = errors.New("country must be an ISO 3166 country code and region a subdivision of it, e.g. NG and NG-LA")
+)
+
+// GetAddresses lists the user's address book in the order the addresses were added.
+func (u *userService) GetAddresses(user_id primitive.ObjectID) ([]models.Address, error) {
+	return findAddresses(u.ctx, u.col, user_id)
+}
+
+// AddAddress adds an address to the user's address book, the first one becomes the default.
+func (u *userService) AddAddress(user_id primitive.ObjectID, data types.AddAddress) (models.Address, error) {
+	address, err := newAddress(primitive.NewObjectID(), data)
+	if err != nil {
+		return models.Address{}, err
+	}
+	err = u.editAddresses(user_id, func(book []models.Address) ([]models.Address, error) {
+		if len(book) >= MaxAddresses {
+			return nil, ErrAddressBookFull
+		}
+		book = append(book, address)
+		if data.IsDefault || len(book) == 1 {
+			book = defaultAddress(book, address.ID)
+		}
+		return book, nil
+	})
+	if err != nil {
+		return models.Address{}, err
+	}
+	return u.address(user_id, address.ID)
+}
+
+// UpdateAddress replaces an address of the user's address book, orders already placed keep the copy they were delivered to.
+func (u *userService) UpdateAddress(user_id primitive.ObjectID, id primitive.ObjectID, data types.AddAddress) (models.Address, error) {
+	address, err := newAddress(id, data)
+	if err != nil {
+		return models.Address{}, err
+	}
+	err = u.editAddresses(user_id, func(book []models.Address) ([]models.Address, error) {
+		i := addressIndex(book, id)
+		if i < 0 {
+			return nil, ErrAddressNotFound
+		}
+		// unsetting the flag doesn't leave the book without a default, another address has to be picked instead
+		address.IsDefault = book[i].IsDefault
+		book[i] = address
+		if data.IsDefault {
+			book = defaultAddress(book, id)
+		}
+		return book, nil
+	})
+	if err != nil {
+		return models.Address{}, err
+	}
+	return u.address(user_id, id)
+}
+
+// DeleteAddress removes an address from the user's address book, the oldest address left takes over as default.
+func (u *userService) DeleteAddress(user_id primitive.ObjectID, id primitive.ObjectID) error {
+	return u.editAddresses(user_id, func(book []models.Address) ([]models.Address, error) {
+		i := addressIndex(book, id)
+		if i < 0 {
+			return nil, ErrAddressNotFound
+		}
+		was_default := book[i].IsDefault
+		book = append(book[:i:i], book[i+1:]...)
+		if was_default && len(book) > 0 {
+			book = defaultAddress(book, book[0].ID)
+		}
+		return book, nil
+	})
+}
+
+func (u *userService) SetDefaultAddress(user_id primitive.ObjectID, id primitive.ObjectID) (models.Address, error) {
+	err := u.editAddresses(user_id, func(book []models.Address) ([]models.Address, error) {
+		if addressIndex(book, id) < 0 {
+			return nil, ErrAddressNotFound
+		}
+		return defaultAddress(book, id), nil
+	})
+	if err != nil {
+		return models.Address{}, err
+	}
+	return u.address(user_id, id)
+}
+
+func (u *userService) address(user_id primitive.ObjectID, id primitive.ObjectID) (models.Address, error) {
+	book, err := findAddresses(u.ctx, u.col, user_id)
+	if err != nil {
+		return models.Address{}, err
+	}
+	i := addressIndex(book, id)
+	if i < 0 {
+		return models.Address{}, ErrAddressNotFound
+	}
+	return book[i], nil
+}
+
+// editAddresses writes back the address book edit made of the stored one, provided nobody changed it since
+// it was read, so two requests cannot leave it without a default or with two.
+func (u *userService) editAddresses(user_id primitive.ObjectID, edit func(book []models.Address) ([]models.Address, error)) error {
+	book, err := findAddresses(u.ctx, u.col, user_id)
+	if err != nil {
+		return err
+	}
+
+	// users who never added an address have no addresses field
+	var current interface{} = book
+	if len(book) == 0 {
+		current = bson.D{{Key: "$in", Value: bson.A{nil, bson.A{}}}}
+	}
+	filter := bson.D{{Key: "_id", Value: user_id}, {Key: "addresses", Value: current}}
+
+	if book, err = edit(append([]models.Address{}, book...)); err != nil {
+		return err
+	}
+	updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "addresses", Value: book}, {Key: "updatedAt", Value: time.Now()}}}}
+	result, err := u.col.UpdateOne(u.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAddressBookChanged
+	}
+	return nil
+}
+
+func findAddresses(ctx context.Context, col *mongo.Collection, user_id primitive.ObjectID) ([]models.Address, error) {
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.D{{Key: "addresses", Value: 1}})
+	if err := col.FindOne(ctx, bson.D{{Key: "_id", Value: user_id}}, opts).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.Addresses == nil {
+		return []models.Address{}, nil
+	}
+	return user.Addresses, nil
+}
+
+// findAddress picks the address with id from the user's address book, or their default address when id is empty.
+func findAddress(ctx context.Context, col *mongo.Collection, user_id primitive.ObjectID, id string) (models.Address, error) {
+	book, err := findAddresses(ctx, col, user_id)
+	if err != nil {
+		return models.Address{}, err
+	}
+	for _, address := range book {
+		if (id == "" && address.IsDefault) || address.ID.Hex() == id {
+			return address, nil
+		}
+	}
+	if id == "" {
+		return models.Address{}, ErrAddressRequired
+	}
+	return models.Address{}, ErrAddressNotFound
+}
+
+func newAddress(id primitive.ObjectID, data types.AddAddress) (models.Address, error) {
+	country, err := tax.NormalizeRegion(data.Country)
+	if err != nil || strings.Contains(country, "-") {
+		return models.Address{}, ErrInvalidAddressRegion
+	}
+	region, err := tax.NormalizeRegion(data.Region)
+	if err != nil || (region != "" && !strings.HasPrefix(region, country+"-")) {
+		return models.Address{}, ErrInvalidAddressRegion
+	}
+
+	return models.Address{
+		ID:         id,
+		Label:      strings.TrimSpace(data.Label),
+		Name:       strings.TrimSpace(data.Name),
+		Phone:      strings.TrimSpace(data.Phone),
+		Line1:      strings.TrimSpace(data.Line1),
+		Line2:      strings.TrimSpace(data.Line2),
+		City:       strings.TrimSpace(data.City),
+		PostalCode: strings.TrimSpace(data.PostalCode),
+		Country:    country,
+		Region:     region,
+	}, nil
+}
+
+func addressIndex(book []models.Address, id primitive.ObjectID) int {
+	for i, address := range book {
+		if address.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// defaultAddress makes the address with id the only default of book.
+func defaultAddress(book []models.Address, id primitive.ObjectID) []models.Address {
+	for i := range book {
+		book[i].IsDefault = book[i].ID == id
+	}
+	return book
+}
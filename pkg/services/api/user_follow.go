@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"kamoushop/pkg/services/pagination"
+	"kamoushop/pkg/services/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrShopNotFound = errors.New("can't find shop")
+	ErrStarOwnShop  = errors.New("you cannot star your own shop")
+)
+
+// StarShop adds the user to the shop's stars, starring a shop twice changes nothing.
+// The count and the set are updated in one write so they cannot drift apart.
+func (u *userService) StarShop(user_id primitive.ObjectID, shop_id primitive.ObjectID) error {
+	if user_id == shop_id {
+		return ErrStarOwnShop
+	}
+
+	filter := bson.D{{Key: "_id", Value: shop_id}, {Key: "starredBy", Value: bson.D{{Key: "$ne", Value: user_id}}}}
+	updateObj := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "stars", Value: 1}}},
+		{Key: "$addToSet", Value: bson.D{{Key: "starredBy", Value: user_id}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+	return u.toggleStar(shop_id, filter, updateObj)
+}
+
+// UnstarShop removes the user from the shop's stars, unstarring a shop that was not starred changes nothing.
+func (u *userService) UnstarShop(user_id primitive.ObjectID, shop_id primitive.ObjectID) error {
+	filter := bson.D{{Key: "_id", Value: shop_id}, {Key: "starredBy", Value: user_id}}
+	updateObj := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "stars", Value: -1}}},
+		{Key: "$pull", Value: bson.D{{Key: "starredBy", Value: user_id}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+	return u.toggleStar(shop_id, filter, updateObj)
+}
+
+func (u *userService) toggleStar(shop_id primitive.ObjectID, filter bson.D, updateObj bson.D) error {
+	result, err := u.col.UpdateOne(u.ctx, filter, updateObj, options.Update())
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// nothing matched, either the shop does not exist or the call was a repeat
+	count, err := u.col.CountDocuments(u.ctx, bson.D{{Key: "_id", Value: shop_id}}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrShopNotFound
+	}
+	return nil
+}
+
+// Following lists the shops the user has starred.
+func (u *userService) Following(user_id primitive.ObjectID, req pagination.Request) (pagination.Page[types.User], error) {
+	filter := bson.D{{Key: "starredBy", Value: user_id}}
+	return pagination.Find(u.ctx, u.col, filter, req, pagination.Sort{Field: "_id"}, userKey)
+}
@@ -0,0 +1,440 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SavedForLaterName is the name of the list created the first time a user saves a cart item for later.
+const SavedForLaterName = "Saved for later"
+
+// watchOverlap is how far NotifyWatchers looks back before the time it is asked for.
+const watchOverlap = time.Minute
+
+var (
+	ErrWishlistNotFound  = errors.New("can't find wishlist")
+	ErrAlreadyWishlisted = errors.New("product is already on this wishlist")
+	ErrNotWishlisted     = errors.New("product is not on this wishlist")
+)
+
+// Cart is the part of the cart a wishlist or a reorder moves items in and out of.
+type Cart interface {
+	GetCart(user_id primitive.ObjectID) (models.Cart, error)
+	AddItem(user_id primitive.ObjectID, product_id primitive.ObjectID, variant string, quantity int64) (models.Cart, error)
+	RemoveProduct(user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Cart, error)
+}
+
+type WishlistService interface {
+	CreateWishlist(user_id primitive.ObjectID, name string, shared bool) (models.Wishlist, error)
+	GetWishlists(user_id primitive.ObjectID) ([]models.Wishlist, error)
+	GetWishlist(id primitive.ObjectID, user_id primitive.ObjectID) (models.Wishlist, error)
+	GetShared(token string) (models.Wishlist, error)
+	UpdateWishlist(id primitive.ObjectID, user_id primitive.ObjectID, name string, shared bool) (models.Wishlist, error)
+	DeleteWishlist(id primitive.ObjectID, user_id primitive.ObjectID) error
+	AddItem(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error)
+	RemoveItem(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error)
+	MoveToCart(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) error
+	SaveForLater(user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error)
+	NotifyWatchers(since time.Time, now time.Time) (int, error)
+}
+
+type wishlistService struct {
+	col      *mongo.Collection
+	prod_col *mongo.Collection
+	cart     Cart
+	notify   NotificationService
+	ctx      context.Context
+}
+
+func NewWishlistService(ctx context.Context, col *mongo.Collection, prod_col *mongo.Collection, cart Cart, notify NotificationService) WishlistService {
+	return &wishlistService{
+		col:      col,
+		prod_col: prod_col,
+		cart:     cart,
+		notify:   notify,
+		ctx:      ctx,
+	}
+}
+
+func (w *wishlistService) CreateWishlist(user_id primitive.ObjectID, name string, shared bool) (models.Wishlist, error) {
+	wishlist := models.Wishlist{
+		ID:        primitive.NewObjectID(),
+		UserID:    user_id,
+		Name:      name,
+		Items:     []models.WishlistItem{},
+		CreatedAT: time.Now(),
+		UpdatedAT: time.Now(),
+	}
+	if shared {
+		token, err := newShareToken()
+		if err != nil {
+			return models.Wishlist{}, err
+		}
+		wishlist.Shared = true
+		wishlist.ShareToken = token
+	}
+
+	if _, err := w.col.InsertOne(w.ctx, wishlist, options.InsertOne()); err != nil {
+		return models.Wishlist{}, err
+	}
+	return wishlist, nil
+}
+
+func (w *wishlistService) GetWishlists(user_id primitive.ObjectID) ([]models.Wishlist, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := w.col.Find(w.ctx, bson.D{{Key: "userId", Value: user_id}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	wishlists := []models.Wishlist{}
+	if err = cursor.All(w.ctx, &wishlists); err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+func (w *wishlistService) GetWishlist(id primitive.ObjectID, user_id primitive.ObjectID) (models.Wishlist, error) {
+	return w.findOne(bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}})
+}
+
+// GetShared returns a list through its share link, the token stops working once the list is made private.
+func (w *wishlistService) GetShared(token string) (models.Wishlist, error) {
+	wishlist, err := w.findOne(bson.D{{Key: "shareToken", Value: token}, {Key: "shared", Value: true}})
+	if err != nil {
+		return models.Wishlist{}, err
+	}
+	// the token is the only thing that grants access, do not hand it on
+	wishlist.ShareToken = ""
+	return wishlist, nil
+}
+
+// UpdateWishlist renames a list and switches it between private and shared, sharing it again
+// after it was made private gives it a new link.
+func (w *wishlistService) UpdateWishlist(id primitive.ObjectID, user_id primitive.ObjectID, name string, shared bool) (models.Wishlist, error) {
+	wishlist, err := w.GetWishlist(id, user_id)
+	if err != nil {
+		return models.Wishlist{}, err
+	}
+
+	set := bson.D{{Key: "shared", Value: shared}, {Key: "updatedAt", Value: time.Now()}}
+	if name != "" {
+		set = append(set, bson.E{Key: "name", Value: name})
+	}
+	if shared && wishlist.ShareToken == "" {
+		token, err := newShareToken()
+		if err != nil {
+			return models.Wishlist{}, err
+		}
+		set = append(set, bson.E{Key: "shareToken", Value: token})
+	}
+
+	updateObj := bson.D{{Key: "$set", Value: set}}
+	if !shared {
+		updateObj = append(updateObj, bson.E{Key: "$unset", Value: bson.D{{Key: "shareToken", Value: ""}}})
+	}
+
+	return w.update(bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}, updateObj)
+}
+
+func (w *wishlistService) DeleteWishlist(id primitive.ObjectID, user_id primitive.ObjectID) error {
+	result, err := w.col.DeleteOne(w.ctx, bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}}, options.Delete())
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+func (w *wishlistService) AddItem(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error) {
+	var product models.Product
+	if err := w.prod_col.FindOne(w.ctx, bson.D{{Key: "_id", Value: product_id}, {Key: "status", Value: StatusPublished}}).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Wishlist{}, ErrCantFindProduct
+		}
+		return models.Wishlist{}, err
+	}
+
+	item := models.WishlistItem{
+		ProductID: product.ID,
+		Name:      product.Name,
+		Image:     product.Image,
+		Price:     product.EffectivePriceAt(time.Now()),
+		InStock:   product.Stock > 0,
+		AddedAT:   time.Now(),
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}, {Key: "items.productId", Value: bson.D{{Key: "$ne", Value: product_id}}}}
+	updateObj := bson.D{
+		{Key: "$push", Value: bson.D{{Key: "items", Value: item}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+
+	wishlist, err := w.update(filter, updateObj)
+	if err == ErrWishlistNotFound {
+		// the list exists when it is only the product that is already on it
+		if _, err = w.GetWishlist(id, user_id); err == nil {
+			return models.Wishlist{}, ErrAlreadyWishlisted
+		}
+	}
+	return wishlist, err
+}
+
+func (w *wishlistService) RemoveItem(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error) {
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "userId", Value: user_id}, {Key: "items.productId", Value: product_id}}
+	updateObj := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "items", Value: bson.D{{Key: "productId", Value: product_id}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}},
+	}
+
+	wishlist, err := w.update(filter, updateObj)
+	if err == ErrWishlistNotFound {
+		if _, err = w.GetWishlist(id, user_id); err == nil {
+			return models.Wishlist{}, ErrNotWishlisted
+		}
+	}
+	return wishlist, err
+}
+
+// MoveToCart puts a wishlisted product in the cart and takes it off the list.
+func (w *wishlistService) MoveToCart(id primitive.ObjectID, user_id primitive.ObjectID, product_id primitive.ObjectID) error {
+	wishlist, err := w.GetWishlist(id, user_id)
+	if err != nil {
+		return err
+	}
+	if !hasItem(wishlist, product_id) {
+		return ErrNotWishlisted
+	}
+
+	if _, err = w.cart.AddItem(user_id, product_id, "", 1); err != nil {
+		return err
+	}
+	_, err = w.RemoveItem(id, user_id, product_id)
+	return err
+}
+
+// SaveForLater takes a product out of the cart and keeps it on the user's saved for later list.
+func (w *wishlistService) SaveForLater(user_id primitive.ObjectID, product_id primitive.ObjectID) (models.Wishlist, error) {
+	filter := bson.D{{Key: "userId", Value: user_id}, {Key: "savedForLater", Value: true}}
+	updateObj := bson.D{{Key: "$setOnInsert", Value: models.Wishlist{
+		ID:            primitive.NewObjectID(),
+		UserID:        user_id,
+		Name:          SavedForLaterName,
+		SavedForLater: true,
+		Items:         []models.WishlistItem{},
+		CreatedAT:     time.Now(),
+		UpdatedAT:     time.Now(),
+	}}}
+
+	var saved models.Wishlist
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := w.col.FindOneAndUpdate(w.ctx, filter, updateObj, opts).Decode(&saved); err != nil {
+		return models.Wishlist{}, err
+	}
+
+	if !hasItem(saved, product_id) {
+		var err error
+		if saved, err = w.AddItem(saved.ID, user_id, product_id); err != nil {
+			return models.Wishlist{}, err
+		}
+	}
+
+	if _, err := w.cart.RemoveProduct(user_id, product_id); err != nil && err != ErrLineNotFound {
+		return models.Wishlist{}, err
+	}
+	return saved, nil
+}
+
+// NotifyWatchers compares the wishlisted products changed since the given time, all of them with
+// a zero since, with the price and stock last seen on the list and notifies the owners of lists
+// whose product got cheaper or came back in stock. What the lists saw is only saved once the
+// notifications are out, a failed run is repeated in full. It returns the number of notifications sent.
+func (w *wishlistService) NotifyWatchers(since time.Time, now time.Time) (int, error) {
+	ids, err := w.col.Distinct(w.ctx, "items.productId", bson.D{})
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if !since.IsZero() {
+		// writes that were in flight at the last run may carry an earlier updatedAt
+		since = since.Add(-watchOverlap)
+		window := bson.D{{Key: "$gte", Value: since}, {Key: "$lte", Value: now}}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "updatedAt", Value: bson.D{{Key: "$gte", Value: since}}}},
+			bson.D{{Key: "saleStartsAt", Value: window}},
+			bson.D{{Key: "saleEndsAt", Value: window}},
+		}})
+	}
+
+	products := map[primitive.ObjectID]models.Product{}
+	changed := []primitive.ObjectID{}
+	cursor, err := w.prod_col.Find(w.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	for cursor.Next(w.ctx) {
+		var product models.Product
+		if err = cursor.Decode(&product); err != nil {
+			cursor.Close(w.ctx)
+			return 0, err
+		}
+		products[product.ID] = product
+		changed = append(changed, product.ID)
+	}
+	cursor.Close(w.ctx)
+	if err = cursor.Err(); err != nil {
+		return 0, err
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	cursor, err = w.col.Find(w.ctx, bson.D{{Key: "items.productId", Value: bson.D{{Key: "$in", Value: changed}}}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(w.ctx)
+
+	sent := map[string]bool{}
+	notifications := []models.Notification{}
+	updates := []mongo.WriteModel{}
+
+	for cursor.Next(w.ctx) {
+		var wishlist models.Wishlist
+		if err = cursor.Decode(&wishlist); err != nil {
+			return 0, err
+		}
+
+		for _, item := range wishlist.Items {
+			product, ok := products[item.ProductID]
+			if !ok {
+				continue
+			}
+
+			seen, kind := watch(item, product, now)
+			if seen == item {
+				continue
+			}
+
+			filter := bson.D{{Key: "_id", Value: wishlist.ID}, {Key: "items.productId", Value: item.ProductID}}
+			updateObj := bson.D{{Key: "$set", Value: bson.D{{Key: "items.$.price", Value: seen.Price}, {Key: "items.$.inStock", Value: seen.InStock}}}}
+			updates = append(updates, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(updateObj))
+
+			// a product on several of the user's lists is announced once
+			key := wishlist.UserID.Hex() + item.ProductID.Hex() + kind
+			if kind == "" || sent[key] {
+				continue
+			}
+			sent[key] = true
+			notifications = append(notifications, watchNotification(wishlist.UserID, item, seen, kind, now))
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	if err = w.notify.Notify(notifications...); err != nil {
+		return 0, err
+	}
+	if len(updates) > 0 {
+		if _, err = w.col.BulkWrite(w.ctx, updates); err != nil {
+			return 0, err
+		}
+	}
+	return len(notifications), nil
+}
+
+// watch returns what the item should now remember about product and, when the buyer should hear
+// about it, the kind of notification. Price rises are remembered silently so the next drop is
+// measured from the new price.
+func watch(item models.WishlistItem, product models.Product, now time.Time) (models.WishlistItem, string) {
+	seen := item
+	seen.Price = product.EffectivePriceAt(now)
+	seen.InStock = product.Stock > 0 && product.Status == StatusPublished
+
+	kind := ""
+	if seen.InStock && !item.InStock {
+		kind = NotifyBackInStock
+	} else if seen.InStock && seen.Price.Currency == item.Price.Currency && seen.Price.Amount < item.Price.Amount {
+		kind = NotifyPriceDrop
+	}
+	return seen, kind
+}
+
+func watchNotification(user_id primitive.ObjectID, item models.WishlistItem, seen models.WishlistItem, kind string, now time.Time) models.Notification {
+	product_id := item.ProductID
+	notification := models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    user_id,
+		Kind:      kind,
+		ProductID: &product_id,
+		CreatedAT: now,
+	}
+
+	switch kind {
+	case NotifyPriceDrop:
+		notification.Title = "Price drop on your wishlist"
+		notification.Body = fmt.Sprintf("%s is now %s, down from %s", item.Name, money.Format(seen.Price), money.Format(item.Price))
+	case NotifyBackInStock:
+		notification.Title = "Back in stock"
+		notification.Body = fmt.Sprintf("%s from your wishlist is available again at %s", item.Name, money.Format(seen.Price))
+	}
+	return notification
+}
+
+func (w *wishlistService) findOne(filter bson.D) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	if err := w.col.FindOne(w.ctx, filter).Decode(&wishlist); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Wishlist{}, ErrWishlistNotFound
+		}
+		return models.Wishlist{}, err
+	}
+	return wishlist, nil
+}
+
+func (w *wishlistService) update(filter bson.D, updateObj bson.D) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := w.col.FindOneAndUpdate(w.ctx, filter, updateObj, opts).Decode(&wishlist); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.Wishlist{}, ErrWishlistNotFound
+		}
+		return models.Wishlist{}, err
+	}
+	return wishlist, nil
+}
+
+func hasItem(wishlist models.Wishlist, product_id primitive.ObjectID) bool {
+	for _, item := range wishlist.Items {
+		if item.ProductID == product_id {
+			return true
+		}
+	}
+	return false
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
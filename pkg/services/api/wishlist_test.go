@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"kamoushop/pkg/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWatch(t *testing.T) {
+	now := time.Now()
+	item := models.WishlistItem{Price: models.Money{Amount: 1000, Currency: "NGN"}, InStock: true}
+	product := models.Product{Price: models.Money{Amount: 1000, Currency: "NGN"}, Stock: 3, Status: StatusPublished}
+
+	seen, kind := watch(item, product, now)
+	require.Equal(t, item, seen)
+	require.Empty(t, kind)
+
+	sale := models.Money{Amount: 800, Currency: "NGN"}
+	product.SalePrice = &sale
+	seen, kind = watch(item, product, now)
+	require.Equal(t, NotifyPriceDrop, kind)
+	require.Equal(t, int64(800), seen.Price.Amount)
+
+	// the price going back up is remembered without a notification
+	seen, kind = watch(seen, models.Product{Price: models.Money{Amount: 1200, Currency: "NGN"}, Stock: 3, Status: StatusPublished}, now)
+	require.Empty(t, kind)
+	require.Equal(t, int64(1200), seen.Price.Amount)
+
+	product.Stock = 0
+	seen, kind = watch(item, product, now)
+	require.Empty(t, kind)
+	require.False(t, seen.InStock)
+
+	product.Stock = 5
+	_, kind = watch(seen, product, now)
+	require.Equal(t, NotifyBackInStock, kind)
+}
+
+// failingNotifier fails every Notify until ok is set and keeps what it was given.
+type failingNotifier struct {
+	NotificationService
+	ok   bool
+	sent []models.Notification
+}
+
+func (f *failingNotifier) Notify(notifications ...models.Notification) error {
+	if !f.ok {
+		return errors.New("notifications are down")
+	}
+	f.sent = append(f.sent, notifications...)
+	return nil
+}
+
+func TestNotifyWatchers(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+	notifier := &failingNotifier{}
+	wishlists := NewWishlistService(ctx, db.Collection("wishlists"), db.Collection("products"), nil, notifier)
+
+	now := time.Now()
+	product := models.Product{ID: primitive.NewObjectID(), Price: models.Money{Amount: 800, Currency: "NGN"}, Stock: 2, Status: StatusPublished, UpdatedAT: now}
+	stale := models.Product{ID: primitive.NewObjectID(), Price: models.Money{Amount: 500, Currency: "NGN"}, Stock: 2, Status: StatusPublished, UpdatedAT: now.Add(-time.Hour)}
+	_, err := db.Collection("products").InsertMany(ctx, []interface{}{product, stale})
+	require.NoError(t, err)
+
+	wishlist := models.Wishlist{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Items: []models.WishlistItem{
+		{ProductID: product.ID, Price: models.Money{Amount: 1000, Currency: "NGN"}, InStock: true},
+		{ProductID: stale.ID, Price: models.Money{Amount: 1000, Currency: "NGN"}, InStock: true},
+	}}
+	_, err = db.Collection("wishlists").InsertOne(ctx, wishlist)
+	require.NoError(t, err)
+
+	// nothing is remembered while the notifications can't go out
+	_, err = wishlists.NotifyWatchers(now.Add(-time.Minute), now)
+	require.Error(t, err)
+	saved, err := wishlists.GetWishlist(wishlist.ID, wishlist.UserID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), saved.Items[0].Price.Amount)
+
+	// only the product changed since the last run is looked at
+	notifier.ok = true
+	sent, err := wishlists.NotifyWatchers(now.Add(-time.Minute), now)
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	require.Equal(t, &product.ID, notifier.sent[0].ProductID)
+
+	saved, err = wishlists.GetWishlist(wishlist.ID, wishlist.UserID)
+	require.NoError(t, err)
+	require.Equal(t, int64(800), saved.Items[0].Price.Amount)
+	require.Equal(t, int64(1000), saved.Items[1].Price.Amount)
+}
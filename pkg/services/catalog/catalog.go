@@ -0,0 +1,288 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kamoushop/pkg/services/money"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	// MaxRows caps a single import, bigger catalogs have to be split into several files
+	MaxRows = 5000
+	// categories are separated by this in a csv cell
+	categorySep = "|"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv or jsonl")
+	ErrTooManyRows   = fmt.Errorf("an import can contain at most %d rows", MaxRows)
+	ErrMissingHeader = errors.New("csv header must contain at least sku, name, description and price")
+)
+
+// Header is the column order of csv imports and exports.
+var Header = []string{"sku", "name", "description", "price", "currency", "stock", "categories", "image_url", "status"}
+
+// Row is one product of an import or export file.
+type Row struct {
+	Line        int    `json:"-"`
+	SKU         string `json:"sku"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       int64  `json:"price"`
+	// optional, when set it must be the seller's shop currency
+	Currency   string   `json:"currency,omitempty"`
+	Stock      int64    `json:"stock"`
+	Categories []string `json:"categories,omitempty"`
+	ImageURL   string   `json:"image_url,omitempty"`
+	Status     string   `json:"status,omitempty"`
+}
+
+type RowError struct {
+	Line   int      `json:"line"`
+	SKU    string   `json:"sku,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+// Report is returned by every import, on a dry run Created and Updated stay zero.
+type Report struct {
+	DryRun  bool       `json:"dry_run"`
+	Total   int        `json:"total"`
+	Valid   int        `json:"valid"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Errors  []RowError `json:"errors"`
+}
+
+// Parse reads every row of r, rows that cannot be decoded are reported as errors instead of aborting the import.
+func Parse(format string, r io.Reader) ([]Row, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSONL:
+		return parseJSONL(r)
+	default:
+		return nil, nil, ErrUnknownFormat
+	}
+}
+
+func parseCSV(r io.Reader) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, ErrMissingHeader
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range Header[:4] {
+		if _, ok := cols[required]; !ok {
+			return nil, nil, ErrMissingHeader
+		}
+	}
+
+	rows := []Row{}
+	row_errors := []RowError{}
+	line := 1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+
+		if err != nil {
+			row_errors = append(row_errors, RowError{Line: line, Errors: []string{err.Error()}})
+			continue
+		}
+
+		if len(rows)+len(row_errors) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+
+		cell := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{
+			Line:        line,
+			SKU:         cell("sku"),
+			Name:        cell("name"),
+			Description: cell("description"),
+			Currency:    strings.ToUpper(cell("currency")),
+			ImageURL:    cell("image_url"),
+			Status:      cell("status"),
+		}
+
+		problems := []string{}
+		if row.Price, err = parseInt(cell("price")); err != nil {
+			problems = append(problems, "price must be a whole number")
+		}
+		if row.Stock, err = parseInt(cell("stock")); err != nil {
+			problems = append(problems, "stock must be a whole number")
+		}
+		for _, slug := range strings.Split(cell("categories"), categorySep) {
+			if slug = strings.TrimSpace(slug); slug != "" {
+				row.Categories = append(row.Categories, slug)
+			}
+		}
+
+		if len(problems) > 0 {
+			row_errors = append(row_errors, RowError{Line: line, SKU: row.SKU, Errors: problems})
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, row_errors, nil
+}
+
+func parseJSONL(r io.Reader) ([]Row, []RowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	rows := []Row{}
+	row_errors := []RowError{}
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if len(rows)+len(row_errors) >= MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+
+		var row Row
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			row_errors = append(row_errors, RowError{Line: line, Errors: []string{"invalid json: " + err.Error()}})
+			continue
+		}
+		row.Line = line
+		row.Currency = strings.ToUpper(row.Currency)
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, row_errors, nil
+}
+
+func parseInt(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Validate returns everything wrong with a row, an empty slice means the row can be imported.
+func Validate(row Row) []string {
+	problems := []string{}
+
+	if row.SKU == "" {
+		problems = append(problems, "sku is required")
+	}
+	if len(row.Name) < 3 {
+		problems = append(problems, "name must be at least 3 characters")
+	}
+	if len(row.Description) < 5 {
+		problems = append(problems, "description must be at least 5 characters")
+	}
+	if row.Price <= 0 {
+		problems = append(problems, "price must be greater than 0")
+	}
+	if row.Currency != "" && !money.Valid(row.Currency) {
+		problems = append(problems, "currency is not supported")
+	}
+	if row.Stock < 0 {
+		problems = append(problems, "stock cannot be negative")
+	}
+	if row.Status != "" && row.Status != "draft" && row.Status != "published" {
+		problems = append(problems, "status must be draft or published")
+	}
+	if row.ImageURL != "" {
+		if u, err := url.Parse(row.ImageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, "image_url must be an http(s) url")
+		}
+	}
+	return problems
+}
+
+// Writer streams rows out in one of the import formats.
+type Writer interface {
+	Write(row Row) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(Header); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(row Row) error {
+	return c.w.Write([]string{
+		row.SKU,
+		row.Name,
+		row.Description,
+		strconv.FormatInt(row.Price, 10),
+		row.Currency,
+		strconv.FormatInt(row.Stock, 10),
+		strings.Join(row.Categories, categorySep),
+		row.ImageURL,
+		row.Status,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(row Row) error {
+	return j.enc.Encode(row)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := `sku,name,description,price,stock,categories,image_url
+TS-1,T-shirt,Plain cotton tee,2500,10,clothing|tops,https://example.com/tee.png
+TS-2,Hoodie,Warm hoodie,abc,3,,
+`
+	rows, row_errors, err := Parse(FormatCSV, strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, Row{
+		Line:        2,
+		SKU:         "TS-1",
+		Name:        "T-shirt",
+		Description: "Plain cotton tee",
+		Price:       2500,
+		Stock:       10,
+		Categories:  []string{"clothing", "tops"},
+		ImageURL:    "https://example.com/tee.png",
+	}, rows[0])
+
+	require.Len(t, row_errors, 1)
+	require.Equal(t, 3, row_errors[0].Line)
+	require.Equal(t, "TS-2", row_errors[0].SKU)
+
+	_, _, err = Parse(FormatCSV, strings.NewReader("sku,name\n"))
+	require.ErrorIs(t, err, ErrMissingHeader)
+}
+
+func TestParseJSONL(t *testing.T) {
+	input := `{"sku":"MUG-1","name":"Mug","description":"Ceramic mug","price":1500,"stock":4}
+
+{"sku":
+`
+	rows, row_errors, err := Parse(FormatJSONL, strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, "MUG-1", rows[0].SKU)
+	require.Equal(t, 1, rows[0].Line)
+	require.Len(t, row_errors, 1)
+	require.Equal(t, 3, row_errors[0].Line)
+
+	_, _, err = Parse("xml", strings.NewReader(input))
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestValidate(t *testing.T) {
+	require.Empty(t, Validate(Row{SKU: "A", Name: "Lamp", Description: "Desk lamp", Price: 100}))
+
+	problems := Validate(Row{Name: "x", Price: 0, Currency: "XYZ", Stock: -1, Status: "live", ImageURL: "ftp://example.com/a.png"})
+	require.Len(t, problems, 8)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	rows := []Row{{SKU: "A-1", Name: "Lamp", Description: "Desk, lamp", Price: 100, Currency: "NGN", Stock: 2, Categories: []string{"home", "lighting"}}}
+
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		var buf bytes.Buffer
+		w, err := NewWriter(format, &buf)
+		require.NoError(t, err)
+		require.NoError(t, w.Write(rows[0]))
+		require.NoError(t, w.Flush())
+
+		parsed, row_errors, err := Parse(format, &buf)
+		require.NoError(t, err)
+		require.Empty(t, row_errors)
+		require.Len(t, parsed, 1)
+		parsed[0].Line = 0
+		require.Equal(t, rows[0], parsed[0])
+	}
+}
@@ -0,0 +1,194 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"kamoushop/pkg/models"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+	ErrNoRate           = errors.New("no exchange rate configured for currency")
+	ErrInvalidRates     = errors.New("exchange rates must look like USD:1,NGN:1550.5")
+)
+
+// exponents holds the number of minor unit digits of the currencies we accept.
+var exponents = map[string]int{
+	"NGN": 2,
+	"GHS": 2,
+	"KES": 2,
+	"ZAR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CAD": 2,
+	"XOF": 0,
+	"JPY": 0,
+}
+
+func Valid(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	return exp, nil
+}
+
+func New(amount int64, currency string) models.Money {
+	return models.Money{Amount: amount, Currency: currency}
+}
+
+func Add(a models.Money, b models.Money) (models.Money, error) {
+	if a.Currency != b.Currency {
+		return models.Money{}, ErrCurrencyMismatch
+	}
+	return models.Money{Amount: a.Amount + b.Amount, Currency: a.Currency}, nil
+}
+
+func Multiply(m models.Money, quantity int64) models.Money {
+	return models.Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Sum adds amounts of a single currency, the zero value of currency is returned for an empty list.
+func Sum(currency string, amounts ...models.Money) (models.Money, error) {
+	total := models.Money{Currency: currency}
+	for _, m := range amounts {
+		var err error
+		if total, err = Add(total, m); err != nil {
+			return models.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Format renders m for people, e.g. "NGN 1,500.00".
+func Format(m models.Money) string {
+	exp, err := Exponent(m.Currency)
+	if err != nil {
+		return fmt.Sprintf("%s %d", m.Currency, m.Amount)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	unit := int64(1)
+	for i := 0; i < exp; i++ {
+		unit *= 10
+	}
+
+	major := strconv.FormatInt(amount/unit, 10)
+	for i := len(major) - 3; i > 0; i -= 3 {
+		major = major[:i] + "," + major[i:]
+	}
+
+	if exp == 0 {
+		return fmt.Sprintf("%s %s%s", m.Currency, sign, major)
+	}
+	return fmt.Sprintf("%s %s%s.%0*d", m.Currency, sign, major, exp, amount%unit)
+}
+
+// Converter converts amounts for display with a locally configured rate table,
+// it is never used to decide what a buyer is charged.
+type Converter struct {
+	// units of each currency worth one unit of the base currency
+	rates map[string]*big.Rat
+}
+
+// NewConverter parses a table like "USD:1,NGN:1550.5,GBP:0.79", all rates are against the same base.
+func NewConverter(spec string) (*Converter, error) {
+	c := &Converter{rates: map[string]*big.Rat{}}
+
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidRates
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if !Valid(currency) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+		}
+
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(parts[1]))
+		if !ok || rate.Sign() <= 0 {
+			return nil, ErrInvalidRates
+		}
+		c.rates[currency] = rate
+	}
+	return c, nil
+}
+
+// Convert turns m into currency to, rounding half away from zero to the target's minor unit.
+func (c *Converter) Convert(m models.Money, to string) (models.Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+
+	from_exp, err := Exponent(m.Currency)
+	if err != nil {
+		return models.Money{}, err
+	}
+	to_exp, err := Exponent(to)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	from_rate, ok := c.rates[m.Currency]
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w: %s", ErrNoRate, m.Currency)
+	}
+	to_rate, ok := c.rates[to]
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w: %s", ErrNoRate, to)
+	}
+
+	// minor(from) / 10^from_exp / from_rate * to_rate * 10^to_exp
+	v := new(big.Rat).SetInt64(m.Amount)
+	v.Mul(v, to_rate)
+	v.Quo(v, from_rate)
+	v.Mul(v, pow10(to_exp))
+	v.Quo(v, pow10(from_exp))
+
+	return models.Money{Amount: round(v), Currency: to}, nil
+}
+
+func pow10(exp int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+}
+
+// round rounds half away from zero.
+func round(v *big.Rat) int64 {
+	num := new(big.Int).Set(v.Num())
+	den := v.Denom()
+
+	neg := num.Sign() < 0
+	num.Abs(num)
+
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(r, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if neg {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
@@ -0,0 +1,56 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSum(t *testing.T) {
+	total, err := Sum("NGN", New(150000, "NGN"), New(2550, "NGN"))
+	require.NoError(t, err)
+	require.Equal(t, New(152550, "NGN"), total)
+
+	_, err = Sum("NGN", New(100, "NGN"), New(100, "USD"))
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	empty, err := Sum("USD")
+	require.NoError(t, err)
+	require.Equal(t, New(0, "USD"), empty)
+}
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, "NGN 1,500.00", Format(New(150000, "NGN")))
+	require.Equal(t, "USD 0.05", Format(New(5, "USD")))
+	require.Equal(t, "USD -12.30", Format(New(-1230, "USD")))
+	require.Equal(t, "JPY 1,234,567", Format(New(1234567, "JPY")))
+}
+
+func TestConverter(t *testing.T) {
+	c, err := NewConverter("USD:1, NGN:1500, JPY:150")
+	require.NoError(t, err)
+
+	// $10.00 -> NGN 15,000.00
+	m, err := c.Convert(New(1000, "USD"), "NGN")
+	require.NoError(t, err)
+	require.Equal(t, New(1500000, "NGN"), m)
+
+	// NGN 1.00 -> $0.000666.. rounds to $0.00, NGN 10.00 -> $0.0066.. rounds to $0.01
+	m, err = c.Convert(New(1000, "NGN"), "USD")
+	require.NoError(t, err)
+	require.Equal(t, New(1, "USD"), m)
+
+	// $1.00 -> 150 yen, which has no minor unit
+	m, err = c.Convert(New(100, "USD"), "JPY")
+	require.NoError(t, err)
+	require.Equal(t, New(150, "JPY"), m)
+
+	_, err = c.Convert(New(100, "USD"), "GBP")
+	require.ErrorIs(t, err, ErrNoRate)
+
+	_, err = NewConverter("USD=1")
+	require.ErrorIs(t, err, ErrInvalidRates)
+
+	_, err = NewConverter("ABC:1")
+	require.ErrorIs(t, err, ErrUnknownCurrency)
+}
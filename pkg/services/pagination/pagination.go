@@ -0,0 +1,242 @@
+package pagination
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLimit = int64(20)
+	MaxLimit     = int64(100)
+)
+
+var (
+	ErrInvalidLimit  = errors.New("limit must be between 1 and 100")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Request is what a client sends to page through a list, Cursor is either
+// the next or the prev token of a previous Page.
+type Request struct {
+	Limit  int64
+	Cursor string
+}
+
+// Page is the envelope shared by every list response.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Limit int64  `json:"limit"`
+}
+
+// Sort is the key a list is ordered by, _id is always used as the tie breaker
+// so the order is total and a cursor points at exactly one position.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// KeyFunc returns the sort key value and the _id of an item.
+type KeyFunc[T any] func(item T) (interface{}, primitive.ObjectID)
+
+type cursor struct {
+	Key  interface{}        `bson:"k"`
+	ID   primitive.ObjectID `bson:"i"`
+	Prev bool               `bson:"p"`
+}
+
+func encode(c cursor) string {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decode(token string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &cursor{}
+	if err = bson.Unmarshal(raw, c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Plan is a validated Request applied to a sort order.
+type Plan struct {
+	Limit  int64
+	sort   Sort
+	cursor *cursor
+}
+
+func NewPlan(req Request, sort Sort) (Plan, error) {
+	if req.Limit == 0 {
+		req.Limit = DefaultLimit
+	}
+
+	if req.Limit < 1 || req.Limit > MaxLimit {
+		return Plan{}, ErrInvalidLimit
+	}
+
+	plan := Plan{Limit: req.Limit, sort: sort}
+	if req.Cursor != "" {
+		c, err := decode(req.Cursor)
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.cursor = c
+	}
+	return plan, nil
+}
+
+// descending reports the direction the query has to scan in, walking back
+// from a prev cursor scans against the list order.
+func (p Plan) descending() bool {
+	if p.cursor != nil && p.cursor.Prev {
+		return !p.sort.Desc
+	}
+	return p.sort.Desc
+}
+
+// Match is the condition that selects the items after the cursor, it is empty on the first page.
+func (p Plan) Match() bson.D {
+	if p.cursor == nil {
+		return bson.D{}
+	}
+
+	op := "$gt"
+	if p.descending() {
+		op = "$lt"
+	}
+
+	if p.sort.Field == "_id" {
+		return bson.D{{Key: "_id", Value: bson.D{{Key: op, Value: p.cursor.ID}}}}
+	}
+
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: p.sort.Field, Value: bson.D{{Key: op, Value: p.cursor.Key}}}},
+		bson.D{{Key: p.sort.Field, Value: p.cursor.Key}, {Key: "_id", Value: bson.D{{Key: op, Value: p.cursor.ID}}}},
+	}}}
+}
+
+// SortDoc is the sort the query has to run with.
+func (p Plan) SortDoc() bson.D {
+	dir := 1
+	if p.descending() {
+		dir = -1
+	}
+
+	if p.sort.Field == "_id" {
+		return bson.D{{Key: "_id", Value: dir}}
+	}
+	return bson.D{{Key: p.sort.Field, Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// FetchLimit asks for one item more than the page size to find out if there is a further page.
+func (p Plan) FetchLimit() int64 {
+	return p.Limit + 1
+}
+
+// Filter joins filter with the cursor condition.
+func (p Plan) Filter(filter bson.D) bson.D {
+	match := p.Match()
+	if len(match) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		return match
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, match}}}
+}
+
+// Finish turns the items fetched with FetchLimit into a page in list order.
+func Finish[T any](p Plan, items []T, key KeyFunc[T]) Page[T] {
+	page := Page[T]{Items: []T{}, Limit: p.Limit}
+
+	more := int64(len(items)) > p.Limit
+	if more {
+		items = items[:p.Limit]
+	}
+
+	backwards := p.cursor != nil && p.cursor.Prev
+	if backwards {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	page.Items = append(page.Items, items...)
+
+	if len(items) == 0 {
+		return page
+	}
+
+	first_key, first_id := key(items[0])
+	last_key, last_id := key(items[len(items)-1])
+
+	if (!backwards && more) || backwards {
+		page.Next = encode(cursor{Key: last_key, ID: last_id})
+	}
+	if (backwards && more) || (!backwards && p.cursor != nil) {
+		page.Prev = encode(cursor{Key: first_key, ID: first_id, Prev: true})
+	}
+	return page
+}
+
+// Find runs a paged query against col.
+func Find[T any](ctx context.Context, col *mongo.Collection, filter bson.D, req Request, sort Sort, key KeyFunc[T]) (Page[T], error) {
+	plan, err := NewPlan(req, sort)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	opts := options.Find().SetSort(plan.SortDoc()).SetLimit(plan.FetchLimit())
+	cursor, err := col.Find(ctx, plan.Filter(filter), opts)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	items := []T{}
+	if err = cursor.All(ctx, &items); err != nil {
+		return Page[T]{}, err
+	}
+
+	return Finish(plan, items, key), nil
+}
+
+// Aggregate runs a paged aggregation against col, stages run before the cursor condition and the
+// sort so they can add the field the list is sorted by.
+func Aggregate[T any](ctx context.Context, col *mongo.Collection, stages mongo.Pipeline, req Request, sort Sort, key KeyFunc[T]) (Page[T], error) {
+	plan, err := NewPlan(req, sort)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	pipeline := append(mongo.Pipeline{}, stages...)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$match", Value: plan.Match()}},
+		bson.D{{Key: "$sort", Value: plan.SortDoc()}},
+		bson.D{{Key: "$limit", Value: plan.FetchLimit()}},
+	)
+	cursor, err := col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	items := []T{}
+	if err = cursor.All(ctx, &items); err != nil {
+		return Page[T]{}, err
+	}
+
+	return Finish(plan, items, key), nil
+}
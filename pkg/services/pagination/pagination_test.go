@@ -0,0 +1,89 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type item struct {
+	ID    primitive.ObjectID
+	Price int64
+}
+
+func itemKey(i item) (interface{}, primitive.ObjectID) {
+	return i.Price, i.ID
+}
+
+func items(n int) []item {
+	out := []item{}
+	for i := 0; i < n; i++ {
+		out = append(out, item{ID: primitive.NewObjectID(), Price: int64(i * 10)})
+	}
+	return out
+}
+
+func TestNewPlan(t *testing.T) {
+	plan, err := NewPlan(Request{}, Sort{Field: "price"})
+	require.NoError(t, err)
+	require.Equal(t, DefaultLimit, plan.Limit)
+	require.Empty(t, plan.Match())
+
+	_, err = NewPlan(Request{Limit: -1}, Sort{Field: "price"})
+	require.ErrorIs(t, err, ErrInvalidLimit)
+
+	_, err = NewPlan(Request{Limit: MaxLimit + 1}, Sort{Field: "price"})
+	require.ErrorIs(t, err, ErrInvalidLimit)
+
+	_, err = NewPlan(Request{Cursor: "not a cursor"}, Sort{Field: "price"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestFinishForwardAndBack(t *testing.T) {
+	all := items(5)
+	sort := Sort{Field: "price"}
+
+	plan, err := NewPlan(Request{Limit: 2}, sort)
+	require.NoError(t, err)
+
+	first := Finish(plan, append([]item{}, all[:3]...), itemKey)
+	require.Equal(t, all[:2], first.Items)
+	require.NotEmpty(t, first.Next)
+	require.Empty(t, first.Prev)
+
+	plan, err = NewPlan(Request{Limit: 2, Cursor: first.Next}, sort)
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "price", Value: bson.D{{Key: "$gt", Value: int64(10)}}}},
+		bson.D{{Key: "price", Value: int64(10)}, {Key: "_id", Value: bson.D{{Key: "$gt", Value: all[1].ID}}}},
+	}}}, plan.Match())
+	require.Equal(t, bson.D{{Key: "price", Value: 1}, {Key: "_id", Value: 1}}, plan.SortDoc())
+
+	second := Finish(plan, append([]item{}, all[2:5]...), itemKey)
+	require.Equal(t, all[2:4], second.Items)
+	require.NotEmpty(t, second.Next)
+	require.NotEmpty(t, second.Prev)
+
+	// walking back scans in reverse and flips the page into list order again
+	plan, err = NewPlan(Request{Limit: 2, Cursor: second.Prev}, sort)
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{Key: "price", Value: -1}, {Key: "_id", Value: -1}}, plan.SortDoc())
+
+	back := Finish(plan, []item{all[1], all[0]}, itemKey)
+	require.Equal(t, all[:2], back.Items)
+	require.Empty(t, back.Prev)
+	require.NotEmpty(t, back.Next)
+}
+
+func TestFinishLastPage(t *testing.T) {
+	all := items(2)
+	plan, err := NewPlan(Request{Limit: 5}, Sort{Field: "_id", Desc: true})
+	require.NoError(t, err)
+
+	page := Finish(plan, all, itemKey)
+	require.Equal(t, all, page.Items)
+	require.Empty(t, page.Next)
+	require.Empty(t, page.Prev)
+}
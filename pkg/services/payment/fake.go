@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"kamoushop/pkg/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const FakeSignatureHeader = "X-Fake-Signature"
+
+var ErrUnknownIntent = errors.New("the fake provider has no such payment")
+
+// Fake is an in-memory provider for development and tests, nothing leaves the process.
+// Payments are made by sending the webhooks Webhook builds to the webhook endpoint.
+// Intents it doesn't know, e.g. after a restart, can't be captured or refunded.
+type Fake struct {
+	secret  string
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	events  int
+	refunds int
+}
+
+type fakeIntent struct {
+	amount   models.Money
+	captured int64
+	refunded int64
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{secret: secret, intents: map[string]*fakeIntent{}}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, intent Intent) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	provider_ref := "fake_" + intent.Reference
+	f.intents[provider_ref] = &fakeIntent{amount: intent.Amount}
+	return f.result(provider_ref, StatusPending, map[string]interface{}{"reference": intent.Reference, "amount": intent.Amount})
+}
+
+func (f *Fake) Capture(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[provider_ref]
+	if !ok {
+		return Result{}, ErrUnknownIntent
+	}
+	if amount.Amount > intent.amount.Amount || amount.Currency != intent.amount.Currency {
+		return Result{}, ErrRefundTooLarge
+	}
+	intent.captured = amount.Amount
+	return f.result(provider_ref, StatusSucceeded, map[string]interface{}{"captured": amount})
+}
+
+// Refund refunds right away, a refund that fails later is played with RefundWebhook.
+func (f *Fake) Refund(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[provider_ref]
+	if !ok {
+		return Result{}, ErrUnknownIntent
+	}
+	captured := intent.captured
+	if captured == 0 {
+		// intents paid through a webhook were never captured explicitly
+		captured = intent.amount.Amount
+	}
+	if intent.refunded+amount.Amount > captured || amount.Currency != intent.amount.Currency {
+		return Result{}, ErrRefundTooLarge
+	}
+	intent.refunded += amount.Amount
+
+	f.refunds++
+	refund_id := "fake_refund_" + strconv.Itoa(f.refunds)
+	result, err := f.result(provider_ref, StatusSucceeded, map[string]interface{}{"refunded": amount, "refund_id": refund_id})
+	result.RefundID = refund_id
+	return result, err
+}
+
+type fakeEvent struct {
+	ID          string       `json:"id"`
+	Type        string       `json:"type"`
+	Reference   string       `json:"reference"`
+	ProviderRef string       `json:"provider_ref"`
+	RefundID    string       `json:"refund_id,omitempty"`
+	Amount      models.Money `json:"amount"`
+}
+
+// VerifyWebhook checks X-Fake-Signature, the hex HMAC-SHA256 of the body keyed with the secret.
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	if !equalHex(header.Get(FakeSignatureHeader), f.sign(body)) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var event fakeEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:          event.ID,
+		Type:        event.Type,
+		Reference:   event.Reference,
+		ProviderRef: event.ProviderRef,
+		RefundID:    event.RefundID,
+		Amount:      event.Amount,
+		Raw:         body,
+	}, nil
+}
+
+// Webhook builds a signed webhook call of kind, one of the Event types, for the intent behind provider_ref.
+func (f *Fake) Webhook(kind string, provider_ref string, amount models.Money) (http.Header, []byte, error) {
+	return f.RefundWebhook(kind, provider_ref, "", amount)
+}
+
+// RefundWebhook is Webhook for events about the refund refund_id of the intent.
+func (f *Fake) RefundWebhook(kind string, provider_ref string, refund_id string, amount models.Money) (http.Header, []byte, error) {
+	f.mu.Lock()
+	f.events++
+	id := "evt_" + provider_ref + "_" + kind + "_" + strconv.Itoa(f.events)
+	f.mu.Unlock()
+
+	reference := strings.TrimPrefix(provider_ref, "fake_")
+	body, err := json.Marshal(fakeEvent{ID: id, Type: kind, Reference: reference, ProviderRef: provider_ref, RefundID: refund_id, Amount: amount})
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, f.sign(body))
+	return header, body, nil
+}
+
+func (f *Fake) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *Fake) result(provider_ref string, status string, payload map[string]interface{}) (Result, error) {
+	payload["id"] = provider_ref
+	payload["status"] = status
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{ProviderRef: provider_ref, Status: status, ClientSecret: provider_ref + "_secret", Raw: raw}, nil
+}
@@ -0,0 +1,116 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"kamoushop/pkg/models"
+	"net/http"
+)
+
+const (
+	// a webhook moves an order forward on these
+	EventAuthorized = "authorized"
+	EventSucceeded  = "succeeded"
+	EventFailed     = "failed"
+	EventRefunded   = "refunded"
+	// a refund the provider accepted couldn't be paid out
+	EventRefundFailed = "refund_failed"
+	// anything else the provider sends, it is stored and otherwise ignored
+	EventOther = "other"
+
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+	ErrUnknownProvider  = errors.New("unknown payment provider")
+	ErrRefundTooLarge   = errors.New("refund is larger than what is left of the payment")
+)
+
+// Provider is a payment service provider. Amounts are minor units, as everywhere else in the shop.
+type Provider interface {
+	// Name is how the provider is stored on payments and addressed in webhook urls.
+	Name() string
+	// CreateIntent asks the provider to collect intent.Amount, the buyer finishes paying on the
+	// provider's side with the returned client secret or authorization url.
+	CreateIntent(ctx context.Context, intent Intent) (Result, error)
+	// Capture collects an authorized payment, provider_ref is Result.ProviderRef of the intent.
+	Capture(ctx context.Context, provider_ref string, amount models.Money) (Result, error)
+	// Refund gives amount of a captured payment back, repeated calls can refund it in parts.
+	Refund(ctx context.Context, provider_ref string, amount models.Money) (Result, error)
+	// VerifyWebhook checks the signature of a webhook call and parses it.
+	VerifyWebhook(header http.Header, body []byte) (Event, error)
+}
+
+// Intent is a request to collect a payment for an order.
+type Intent struct {
+	// our reference for the attempt, providers echo it back in webhooks
+	Reference string
+	Amount    models.Money
+	Email     string
+	OrderID   string
+}
+
+// Result is what a provider answered to a call.
+type Result struct {
+	ProviderRef string
+	// the provider's id of a refund, its webhooks carry it too
+	RefundID         string
+	Status           string
+	ClientSecret     string
+	AuthorizationURL string
+	// the provider's response as it was received
+	Raw []byte
+}
+
+// Event is a verified webhook call.
+type Event struct {
+	// the provider's id for the event, a redelivered event has the same id
+	ID          string
+	Type        string
+	Reference   string
+	ProviderRef string
+	// set on refund events, see Result.RefundID
+	RefundID string
+	Amount   models.Money
+	Raw      []byte
+}
+
+// Error is a call the provider refused.
+type Error struct {
+	Provider string
+	Status   int
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Provider, e.Message, e.Status)
+}
+
+// Providers looks providers up by name.
+type Providers map[string]Provider
+
+func NewProviders(providers ...Provider) Providers {
+	p := Providers{}
+	for _, provider := range providers {
+		p[provider.Name()] = provider
+	}
+	return p
+}
+
+func (p Providers) Get(name string) (Provider, error) {
+	provider, ok := p[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// equalHex compares a signature sent by a provider with the expected one in constant time.
+func equalHex(sent string, expected string) bool {
+	return hmac.Equal([]byte(sent), []byte(expected))
+}
@@ -0,0 +1,157 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"kamoushop/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var naira = models.Money{Amount: 250000, Currency: "NGN"}
+
+func TestPaystack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/transaction/initialize":
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "ref-1", body["reference"])
+			require.Equal(t, float64(250000), body["amount"])
+			w.Write([]byte(`{"status":true,"message":"ok","data":{"authorization_url":"https://checkout.paystack.com/x","access_code":"x","reference":"ref-1"}}`))
+		case "/transaction/verify/ref-1":
+			w.Write([]byte(`{"status":true,"message":"ok","data":{"status":"success","amount":250000,"currency":"NGN","reference":"ref-1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":false,"message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	p := NewPaystack("sk_test", server.URL)
+	result, err := p.CreateIntent(context.Background(), Intent{Reference: "ref-1", Amount: naira, Email: "buyer@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "ref-1", result.ProviderRef)
+	require.Equal(t, "https://checkout.paystack.com/x", result.AuthorizationURL)
+	require.NotEmpty(t, result.Raw)
+
+	result, err = p.Capture(context.Background(), "ref-1", naira)
+	require.NoError(t, err)
+	require.Equal(t, StatusSucceeded, result.Status)
+
+	_, err = p.Refund(context.Background(), "ref-1", naira)
+	var provider_err *Error
+	require.ErrorAs(t, err, &provider_err)
+	require.Equal(t, http.StatusNotFound, provider_err.Status)
+
+	body := []byte(`{"event":"charge.success","data":{"id":42,"reference":"ref-1","amount":250000,"currency":"NGN"}}`)
+	mac := hmac.New(sha512.New, []byte("sk_test"))
+	mac.Write(body)
+	header := http.Header{}
+	header.Set("x-paystack-signature", hex.EncodeToString(mac.Sum(nil)))
+
+	event, err := p.VerifyWebhook(header, body)
+	require.NoError(t, err)
+	require.Equal(t, Event{ID: "charge.success:42", Type: EventSucceeded, Reference: "ref-1", ProviderRef: "ref-1", Amount: naira, Raw: body}, event)
+
+	header.Set("x-paystack-signature", "00")
+	_, err = p.VerifyWebhook(header, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	body = []byte(`{"event":"refund.failed","data":{"id":7,"transaction_reference":"ref-1","amount":250000,"currency":"NGN"}}`)
+	mac = hmac.New(sha512.New, []byte("sk_test"))
+	mac.Write(body)
+	header.Set("x-paystack-signature", hex.EncodeToString(mac.Sum(nil)))
+	event, err = p.VerifyWebhook(header, body)
+	require.NoError(t, err)
+	require.Equal(t, EventRefundFailed, event.Type)
+	require.Equal(t, "7", event.RefundID)
+	require.Equal(t, "ref-1", event.Reference)
+}
+
+func TestStripe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _, _ := r.BasicAuth()
+		require.Equal(t, "sk_test", key)
+		require.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/v1/payment_intents":
+			require.Equal(t, "250000", r.PostForm.Get("amount"))
+			require.Equal(t, "ngn", r.PostForm.Get("currency"))
+			require.Equal(t, "ref-1", r.PostForm.Get("metadata[reference]"))
+			require.Equal(t, "ref-1", r.Header.Get("Idempotency-Key"))
+			w.Write([]byte(`{"id":"pi_1","status":"requires_payment_method","client_secret":"pi_1_secret"}`))
+		case "/v1/payment_intents/pi_1/capture":
+			w.Write([]byte(`{"id":"pi_1","status":"succeeded"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"no such refund"}}`))
+		}
+	}))
+	defer server.Close()
+
+	s := NewStripe("sk_test", "whsec", server.URL)
+	result, err := s.CreateIntent(context.Background(), Intent{Reference: "ref-1", Amount: naira})
+	require.NoError(t, err)
+	require.Equal(t, Result{ProviderRef: "pi_1", Status: StatusPending, ClientSecret: "pi_1_secret", Raw: result.Raw}, result)
+
+	result, err = s.Capture(context.Background(), "pi_1", naira)
+	require.NoError(t, err)
+	require.Equal(t, StatusSucceeded, result.Status)
+
+	_, err = s.Refund(context.Background(), "pi_1", naira)
+	require.EqualError(t, err, "stripe: no such refund (status 400)")
+
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":250000,"currency":"ngn","metadata":{"reference":"ref-1"}}}}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header := http.Header{}
+	header.Set("Stripe-Signature", "t="+timestamp+",v1=bad,v1="+stripeSignature("whsec", timestamp, body))
+
+	event, err := s.VerifyWebhook(header, body)
+	require.NoError(t, err)
+	require.Equal(t, Event{ID: "evt_1", Type: EventSucceeded, Reference: "ref-1", ProviderRef: "pi_1", Amount: naira, Raw: body}, event)
+
+	// a signature replayed after the tolerance is refused
+	s.now = func() time.Time { return now.Add(StripeWebhookTolerance + time.Second) }
+	_, err = s.VerifyWebhook(header, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake("secret")
+	result, err := f.CreateIntent(context.Background(), Intent{Reference: "ref-1", Amount: naira})
+	require.NoError(t, err)
+
+	header, body, err := f.Webhook(EventSucceeded, result.ProviderRef, naira)
+	require.NoError(t, err)
+	event, err := f.VerifyWebhook(header, body)
+	require.NoError(t, err)
+	require.Equal(t, EventSucceeded, event.Type)
+	require.Equal(t, "ref-1", event.Reference)
+	require.Equal(t, naira, event.Amount)
+
+	_, err = NewFake("other").VerifyWebhook(header, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = f.Refund(context.Background(), result.ProviderRef, models.Money{Amount: 200000, Currency: "NGN"})
+	require.NoError(t, err)
+	_, err = f.Refund(context.Background(), result.ProviderRef, models.Money{Amount: 50001, Currency: "NGN"})
+	require.ErrorIs(t, err, ErrRefundTooLarge)
+
+	// payments it never started can't be captured or refunded
+	_, err = f.Capture(context.Background(), "fake_other", naira)
+	require.ErrorIs(t, err, ErrUnknownIntent)
+	_, err = f.Refund(context.Background(), "fake_other", naira)
+	require.ErrorIs(t, err, ErrUnknownIntent)
+}
@@ -0,0 +1,204 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"kamoushop/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PaystackBaseURL = "https://api.paystack.co"
+
+// Paystack charges the card when the buyer pays, so Capture only confirms the charge went through.
+type Paystack struct {
+	secret_key string
+	base_url   string
+	client     *http.Client
+}
+
+// NewPaystack talks to base_url, an empty one is PaystackBaseURL.
+func NewPaystack(secret_key string, base_url string) *Paystack {
+	if base_url == "" {
+		base_url = PaystackBaseURL
+	}
+	return &Paystack{
+		secret_key: secret_key,
+		base_url:   strings.TrimSuffix(base_url, "/"),
+		client:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *Paystack) Name() string {
+	return "paystack"
+}
+
+type paystackResponse struct {
+	Status  bool            `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type paystackTransaction struct {
+	ID               int64  `json:"id"`
+	Reference        string `json:"reference"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	AuthorizationURL string `json:"authorization_url"`
+	AccessCode       string `json:"access_code"`
+	// refunds point at the transaction they belong to
+	Transaction struct {
+		Reference string `json:"reference"`
+	} `json:"transaction"`
+	TransactionReference string `json:"transaction_reference"`
+}
+
+func (p *Paystack) CreateIntent(ctx context.Context, intent Intent) (Result, error) {
+	body := map[string]interface{}{
+		"reference": intent.Reference,
+		"amount":    intent.Amount.Amount,
+		"currency":  intent.Amount.Currency,
+		"email":     intent.Email,
+		"metadata":  map[string]string{"order_id": intent.OrderID},
+	}
+	transaction, raw, err := p.call(ctx, http.MethodPost, "/transaction/initialize", body)
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+	return Result{
+		ProviderRef:      intent.Reference,
+		Status:           StatusPending,
+		ClientSecret:     transaction.AccessCode,
+		AuthorizationURL: transaction.AuthorizationURL,
+		Raw:              raw,
+	}, nil
+}
+
+func (p *Paystack) Capture(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	transaction, raw, err := p.call(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(provider_ref), nil)
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+
+	status := StatusPending
+	switch transaction.Status {
+	case "success":
+		status = StatusSucceeded
+		if transaction.Amount != amount.Amount || !strings.EqualFold(transaction.Currency, amount.Currency) {
+			status = StatusFailed
+		}
+	case "failed", "abandoned", "reversed":
+		status = StatusFailed
+	}
+	return Result{ProviderRef: provider_ref, Status: status, Raw: raw}, nil
+}
+
+func (p *Paystack) Refund(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	body := map[string]interface{}{"transaction": provider_ref, "amount": amount.Amount}
+	refund, raw, err := p.call(ctx, http.MethodPost, "/refund", body)
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+	// the refund is processed later and confirmed by a refund.processed or refund.failed webhook
+	return Result{ProviderRef: provider_ref, RefundID: strconv.FormatInt(refund.ID, 10), Status: StatusPending, Raw: raw}, nil
+}
+
+// VerifyWebhook checks x-paystack-signature, the hex HMAC-SHA512 of the body keyed with the secret key.
+func (p *Paystack) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	mac := hmac.New(sha512.New, []byte(p.secret_key))
+	mac.Write(body)
+	if !equalHex(header.Get("x-paystack-signature"), hex.EncodeToString(mac.Sum(nil))) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var payload struct {
+		Event string              `json:"event"`
+		Data  paystackTransaction `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Event{}, err
+	}
+
+	event := Event{
+		// paystack events carry no id of their own
+		ID:     fmt.Sprintf("%s:%d", payload.Event, payload.Data.ID),
+		Type:   EventOther,
+		Amount: models.Money{Amount: payload.Data.Amount, Currency: strings.ToUpper(payload.Data.Currency)},
+		Raw:    body,
+	}
+	switch payload.Event {
+	case "charge.success":
+		event.Type = EventSucceeded
+		event.Reference = payload.Data.Reference
+	case "charge.failed":
+		event.Type = EventFailed
+		event.Reference = payload.Data.Reference
+	case "refund.processed", "refund.failed":
+		event.Type = EventRefunded
+		if payload.Event == "refund.failed" {
+			event.Type = EventRefundFailed
+		}
+		event.RefundID = strconv.FormatInt(payload.Data.ID, 10)
+		event.Reference = payload.Data.TransactionReference
+		if event.Reference == "" {
+			event.Reference = payload.Data.Transaction.Reference
+		}
+	}
+	event.ProviderRef = event.Reference
+	return event, nil
+}
+
+func (p *Paystack) call(ctx context.Context, method string, path string, body interface{}) (paystackTransaction, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return paystackTransaction{}, nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.base_url+path, reader)
+	if err != nil {
+		return paystackTransaction{}, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secret_key)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return paystackTransaction{}, nil, err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return paystackTransaction{}, nil, err
+	}
+
+	var response paystackResponse
+	if err = json.Unmarshal(raw, &response); err != nil {
+		return paystackTransaction{}, raw, &Error{Provider: p.Name(), Status: res.StatusCode, Message: "unreadable response"}
+	}
+	if res.StatusCode >= 300 || !response.Status {
+		return paystackTransaction{}, raw, &Error{Provider: p.Name(), Status: res.StatusCode, Message: response.Message}
+	}
+
+	var transaction paystackTransaction
+	if len(response.Data) > 0 {
+		if err = json.Unmarshal(response.Data, &transaction); err != nil {
+			return paystackTransaction{}, raw, err
+		}
+	}
+	return transaction, raw, nil
+}
@@ -0,0 +1,236 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"kamoushop/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StripeBaseURL = "https://api.stripe.com"
+	// webhooks signed longer ago than this are refused, so a captured call can't be replayed later
+	StripeWebhookTolerance = 5 * time.Minute
+)
+
+// Stripe authorizes the card first, the payment is collected by Capture once the
+// amount_capturable_updated webhook arrives.
+type Stripe struct {
+	secret_key     string
+	webhook_secret string
+	base_url       string
+	client         *http.Client
+	now            func() time.Time
+}
+
+// NewStripe talks to base_url, an empty one is StripeBaseURL.
+func NewStripe(secret_key string, webhook_secret string, base_url string) *Stripe {
+	if base_url == "" {
+		base_url = StripeBaseURL
+	}
+	return &Stripe{
+		secret_key:     secret_key,
+		webhook_secret: webhook_secret,
+		base_url:       strings.TrimSuffix(base_url, "/"),
+		client:         &http.Client{Timeout: 15 * time.Second},
+		now:            time.Now,
+	}
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+type stripeObject struct {
+	ID            string            `json:"id"`
+	Object        string            `json:"object"`
+	Status        string            `json:"status"`
+	Amount        int64             `json:"amount"`
+	Currency      string            `json:"currency"`
+	ClientSecret  string            `json:"client_secret"`
+	PaymentIntent string            `json:"payment_intent"`
+	Metadata      map[string]string `json:"metadata"`
+	// charges report what was refunded so far
+	AmountRefunded int64 `json:"amount_refunded"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *Stripe) CreateIntent(ctx context.Context, intent Intent) (Result, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(intent.Amount.Amount, 10))
+	form.Set("currency", strings.ToLower(intent.Amount.Currency))
+	form.Set("capture_method", "manual")
+	form.Set("receipt_email", intent.Email)
+	form.Set("metadata[reference]", intent.Reference)
+	form.Set("metadata[order_id]", intent.OrderID)
+
+	object, raw, err := s.call(ctx, "/v1/payment_intents", form, intent.Reference)
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+	return Result{ProviderRef: object.ID, Status: StatusPending, ClientSecret: object.ClientSecret, Raw: raw}, nil
+}
+
+func (s *Stripe) Capture(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.FormatInt(amount.Amount, 10))
+
+	object, raw, err := s.call(ctx, "/v1/payment_intents/"+url.PathEscape(provider_ref)+"/capture", form, "capture-"+provider_ref)
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+	return Result{ProviderRef: object.ID, Status: stripeStatus(object.Status), Raw: raw}, nil
+}
+
+func (s *Stripe) Refund(ctx context.Context, provider_ref string, amount models.Money) (Result, error) {
+	form := url.Values{}
+	form.Set("payment_intent", provider_ref)
+	form.Set("amount", strconv.FormatInt(amount.Amount, 10))
+
+	object, raw, err := s.call(ctx, "/v1/refunds", form, "")
+	if err != nil {
+		return Result{Raw: raw}, err
+	}
+	return Result{ProviderRef: provider_ref, RefundID: object.ID, Status: stripeStatus(object.Status), Raw: raw}, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header: v1 is the hex HMAC-SHA256 of "t.body"
+// keyed with the webhook secret, t must be recent.
+func (s *Stripe) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	var timestamp string
+	signatures := []string{}
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Event{}, ErrInvalidSignature
+	}
+	if age := s.now().Sub(time.Unix(unix, 0)); age > StripeWebhookTolerance || age < -StripeWebhookTolerance {
+		return Event{}, ErrInvalidSignature
+	}
+
+	expected := stripeSignature(s.webhook_secret, timestamp, body)
+	valid := false
+	for _, signature := range signatures {
+		valid = valid || equalHex(signature, expected)
+	}
+	if !valid {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var payload struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object stripeObject `json:"object"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return Event{}, err
+	}
+
+	object := payload.Data.Object
+	event := Event{
+		ID:          payload.ID,
+		Type:        EventOther,
+		Reference:   object.Metadata["reference"],
+		ProviderRef: object.ID,
+		Amount:      models.Money{Amount: object.Amount, Currency: strings.ToUpper(object.Currency)},
+		Raw:         body,
+	}
+	switch payload.Type {
+	case "payment_intent.amount_capturable_updated":
+		event.Type = EventAuthorized
+	case "payment_intent.succeeded":
+		event.Type = EventSucceeded
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		event.Type = EventFailed
+	case "charge.refunded":
+		event.Type = EventRefunded
+		event.ProviderRef = object.PaymentIntent
+		event.Amount.Amount = object.AmountRefunded
+	case "charge.refund.updated", "refund.updated", "refund.failed":
+		// refunds that didn't succeed right away settle later
+		switch stripeStatus(object.Status) {
+		case StatusSucceeded:
+			event.Type = EventRefunded
+		case StatusFailed:
+			event.Type = EventRefundFailed
+		}
+		event.RefundID = object.ID
+		event.ProviderRef = object.PaymentIntent
+	}
+	return event, nil
+}
+
+func (s *Stripe) call(ctx context.Context, path string, form url.Values, idempotency_key string) (stripeObject, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.base_url+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return stripeObject{}, nil, err
+	}
+	req.SetBasicAuth(s.secret_key, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotency_key != "" {
+		req.Header.Set("Idempotency-Key", idempotency_key)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return stripeObject{}, nil, err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return stripeObject{}, nil, err
+	}
+
+	var object stripeObject
+	if err = json.Unmarshal(raw, &object); err != nil {
+		return stripeObject{}, raw, &Error{Provider: s.Name(), Status: res.StatusCode, Message: "unreadable response"}
+	}
+	if res.StatusCode >= 300 {
+		message := res.Status
+		if object.Error != nil {
+			message = object.Error.Message
+		}
+		return stripeObject{}, raw, &Error{Provider: s.Name(), Status: res.StatusCode, Message: message}
+	}
+	return object, raw, nil
+}
+
+func stripeSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func stripeStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return StatusSucceeded
+	case "canceled", "failed":
+		return StatusFailed
+	default:
+		return StatusPending
+	}
+}
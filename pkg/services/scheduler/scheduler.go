@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs job each interval until ctx is cancelled, failed runs are logged and retried on the next tick.
+func Every(ctx context.Context, interval time.Duration, name string, job func(now time.Time) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := job(now); err != nil {
+				log.Printf("scheduler: %s failed: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package search
+
+import (
+	"context"
+	"kamoushop/pkg/services/api"
+	"kamoushop/pkg/services/pagination"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// TextIndexName is the name of the text index EnsureIndexes creates on the product collection.
+	TextIndexName = "product_search"
+	priceBuckets  = 5
+	facetSize     = 20
+)
+
+type mongoBackend struct {
+	col     *mongo.Collection
+	cat_col *mongo.Collection
+	ctx     context.Context
+}
+
+func NewMongoBackend(ctx context.Context, col *mongo.Collection, cat_col *mongo.Collection) Backend {
+	return &mongoBackend{
+		col:     col,
+		cat_col: cat_col,
+		ctx:     ctx,
+	}
+}
+
+// TextIndex is the weighted text index the mongo backend searches against.
+func TextIndex() mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "name", Value: "text"},
+			{Key: "brand", Value: "text"},
+			{Key: "categoryNames", Value: "text"},
+			{Key: "description", Value: "text"},
+		},
+		Options: options.Index().SetName(TextIndexName).SetWeights(bson.D{
+			{Key: "name", Value: 10},
+			{Key: "brand", Value: 5},
+			{Key: "categoryNames", Value: 3},
+			{Key: "description", Value: 1},
+		}),
+	}
+}
+
+func (m *mongoBackend) Search(query Query) (Result, error) {
+	match := bson.D{{Key: "status", Value: api.StatusPublished}}
+	sort := pagination.Sort{Field: "createdAt", Desc: true}
+
+	// $text treats the input as search terms rather than a pattern, so user input can't inject anything
+	if query.Text != "" {
+		match = append(match, bson.E{Key: "$text", Value: bson.D{{Key: "$search", Value: query.Text}}})
+		sort = pagination.Sort{Field: "score", Desc: true}
+	}
+
+	plan, err := pagination.NewPlan(pagination.Request{Limit: query.Limit, Cursor: query.Cursor}, sort)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(query.CategoryIDs) > 0 {
+		match = append(match, bson.E{Key: "categoryIds", Value: bson.D{{Key: "$in", Value: query.CategoryIDs}}})
+	}
+
+	if query.ShopID != nil {
+		match = append(match, bson.E{Key: "userId", Value: *query.ShopID})
+	}
+
+	price := bson.D{}
+	if query.MinPrice > 0 {
+		price = append(price, bson.E{Key: "$gte", Value: query.MinPrice})
+	}
+	if query.MaxPrice > 0 {
+		price = append(price, bson.E{Key: "$lte", Value: query.MaxPrice})
+	}
+	effective := bson.D{}
+	if len(price) > 0 {
+		effective = bson.D{{Key: "effectiveAmount", Value: price}}
+	}
+	if query.Currency != "" {
+		match = append(match, bson.E{Key: "price.currency", Value: query.Currency})
+	}
+
+	// price bounds and buckets use the price products sell for right now, sales included
+	now := time.Now()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.D{{Key: "score", Value: score(query.Text)}, {Key: "effectiveAmount", Value: api.EffectiveAmountExpr(now)}}}},
+		{{Key: "$match", Value: effective}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "products", Value: bson.A{
+				bson.D{{Key: "$match", Value: plan.Match()}},
+				bson.D{{Key: "$sort", Value: plan.SortDoc()}},
+				bson.D{{Key: "$limit", Value: plan.FetchLimit()}},
+			}},
+			{Key: "total", Value: bson.A{
+				bson.D{{Key: "$count", Value: "count"}},
+			}},
+			{Key: "price", Value: bson.A{
+				bson.D{{Key: "$bucketAuto", Value: bson.D{
+					{Key: "groupBy", Value: "$effectiveAmount"},
+					{Key: "buckets", Value: priceBuckets},
+					{Key: "output", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}},
+				}}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "_id", Value: 0},
+					{Key: "min", Value: "$_id.min"},
+					{Key: "max", Value: "$_id.max"},
+					{Key: "count", Value: 1},
+				}}},
+			}},
+			{Key: "categories", Value: bson.A{
+				bson.D{{Key: "$unwind", Value: "$categoryIds"}},
+				bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$categoryIds"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+				bson.D{{Key: "$limit", Value: facetSize}},
+				bson.D{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: m.cat_col.Name()},
+					{Key: "localField", Value: "_id"},
+					{Key: "foreignField", Value: "_id"},
+					{Key: "as", Value: "category"},
+				}}},
+				bson.D{{Key: "$unwind", Value: "$category"}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "count", Value: 1},
+					{Key: "name", Value: "$category.name"},
+					{Key: "slug", Value: "$category.slug"},
+				}}},
+			}},
+			{Key: "shops", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: "$userId"},
+					{Key: "brand", Value: bson.D{{Key: "$first", Value: "$brand"}}},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+				bson.D{{Key: "$limit", Value: facetSize}},
+			}},
+		}}},
+	}
+
+	cursor, err := m.col.Aggregate(m.ctx, pipeline)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var rows []struct {
+		Products []Hit `bson:"products"`
+		Total    []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		Price      []PriceBucket   `bson:"price"`
+		Categories []CategoryCount `bson:"categories"`
+		Shops      []ShopCount     `bson:"shops"`
+	}
+
+	if err = cursor.All(m.ctx, &rows); err != nil {
+		return Result{}, err
+	}
+
+	key := func(hit Hit) (interface{}, primitive.ObjectID) {
+		if query.Text != "" {
+			return hit.Score, hit.ID
+		}
+		return hit.CreatedAT, hit.ID
+	}
+
+	result := Result{
+		Page:   pagination.Finish(plan, []Hit{}, key),
+		Facets: &Facets{Price: []PriceBucket{}, Categories: []CategoryCount{}, Shops: []ShopCount{}},
+	}
+	if len(rows) == 0 {
+		return result, nil
+	}
+
+	row := rows[0]
+	for i := range row.Products {
+		row.Products[i].EffectivePrice = row.Products[i].EffectivePriceAt(now)
+	}
+	result.Page = pagination.Finish(plan, row.Products, key)
+	if len(row.Total) > 0 {
+		result.Total = row.Total[0].Count
+	}
+	result.Facets.Price = append(result.Facets.Price, row.Price...)
+	result.Facets.Categories = append(result.Facets.Categories, row.Categories...)
+	result.Facets.Shops = append(result.Facets.Shops, row.Shops...)
+
+	return result, nil
+}
+
+func score(text string) interface{} {
+	if text == "" {
+		return 0
+	}
+	return bson.D{{Key: "$meta", Value: "textScore"}}
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/pagination"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Backend runs product searches, the mongo text index is the default implementation
+// but anything that can rank and facet products can be plugged in.
+type Backend interface {
+	Search(query Query) (Result, error)
+}
+
+type Query struct {
+	// free text matched against name, description, brand and category names
+	Text string
+	// restrict results to these categories (usually a category and its subtree)
+	CategoryIDs []primitive.ObjectID
+	ShopID      *primitive.ObjectID
+	MinPrice    int64
+	MaxPrice    int64
+	Currency    string
+	Limit       int64
+	Cursor      string
+}
+
+type Result struct {
+	pagination.Page[Hit]
+	Total  int64   `json:"total"`
+	Facets *Facets `json:"facets"`
+}
+
+type Hit struct {
+	models.Product `bson:",inline"`
+	Score          float64 `json:"score" bson:"score"`
+}
+
+type Facets struct {
+	Price      []PriceBucket   `json:"price"`
+	Categories []CategoryCount `json:"categories"`
+	Shops      []ShopCount     `json:"shops"`
+}
+
+type PriceBucket struct {
+	Min   int64 `json:"min" bson:"min"`
+	Max   int64 `json:"max" bson:"max"`
+	Count int64 `json:"count" bson:"count"`
+}
+
+type CategoryCount struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id"`
+	Name  string             `json:"name" bson:"name"`
+	Slug  string             `json:"slug" bson:"slug"`
+	Count int64              `json:"count" bson:"count"`
+}
+
+type ShopCount struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id"`
+	Brand string             `json:"brand" bson:"brand"`
+	Count int64              `json:"count" bson:"count"`
+}
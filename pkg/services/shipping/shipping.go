@@ -0,0 +1,128 @@
+package shipping
+
+import (
+	"errors"
+	"kamoushop/pkg/models"
+	"kamoushop/pkg/services/money"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	RateFlat     = "flat"
+	RateWeight   = "weight"
+	RateFreeOver = "free_over"
+
+	// FreeName is the option of sellers that ship for free where none of their zones delivers
+	FreeName = "Free shipping"
+)
+
+var (
+	ErrInvalidRateKind     = errors.New("rate kind must be flat, weight or free_over")
+	ErrInvalidRatePrice    = errors.New("rate prices must not be negative and weight and free_over rates need per_kg and free_over")
+	ErrInvalidDeliveryDays = errors.New("delivery days must not be negative and max_days must not be less than min_days")
+)
+
+func ValidKind(kind string) bool {
+	switch kind {
+	case RateFlat, RateWeight, RateFreeOver:
+		return true
+	}
+	return false
+}
+
+// CheckRate checks the kind, prices and delivery days of rate.
+func CheckRate(rate models.ShippingRate) error {
+	if !ValidKind(rate.Kind) {
+		return ErrInvalidRateKind
+	}
+	if !money.Valid(rate.Price.Currency) {
+		return money.ErrUnknownCurrency
+	}
+	if rate.Price.Amount < 0 {
+		return ErrInvalidRatePrice
+	}
+	for _, m := range []*models.Money{rate.PerKg, rate.FreeOver} {
+		if m != nil && (m.Amount < 0 || m.Currency != rate.Price.Currency) {
+			return ErrInvalidRatePrice
+		}
+	}
+	if (rate.Kind == RateWeight && rate.PerKg == nil) || (rate.Kind == RateFreeOver && rate.FreeOver == nil) {
+		return ErrInvalidRatePrice
+	}
+	if rate.MinDays < 0 || rate.MaxDays < rate.MinDays {
+		return ErrInvalidDeliveryDays
+	}
+	return nil
+}
+
+// MatchZone finds the zone of one seller that delivers to region. A zone listing the subdivision beats
+// one listing its country, which beats one for everywhere; of equally specific zones the first one wins.
+func MatchZone(zones []models.DeliveryZone, region string) (models.DeliveryZone, bool) {
+	best, score := models.DeliveryZone{}, -1
+	for _, zone := range zones {
+		s := -1
+		if len(zone.Regions) == 0 {
+			s = 0
+		}
+		for _, r := range zone.Regions {
+			switch {
+			case r == region && strings.Contains(region, "-"):
+				s = 2
+			case (r == region || strings.HasPrefix(region, r+"-")) && s < 1:
+				s = 1
+			}
+		}
+		if s > score {
+			best, score = zone, s
+		}
+	}
+	return best, score >= 0
+}
+
+// Price is what rate charges for items worth subtotal, before discounts, that weigh grams.
+func Price(rate models.ShippingRate, subtotal int64, grams int64) int64 {
+	switch rate.Kind {
+	case RateWeight:
+		kgs := (grams + 999) / 1000
+		return rate.Price.Amount + rate.PerKg.Amount*kgs
+	case RateFreeOver:
+		if subtotal >= rate.FreeOver.Amount {
+			return 0
+		}
+	}
+	return rate.Price.Amount
+}
+
+// Options prices the rates of zone for a sub-order of seller_id, cheapest first. Rates in another
+// currency than the sub-order are left out, and so are weight rates unless every item has a weight.
+func Options(seller_id primitive.ObjectID, zone models.DeliveryZone, subtotal models.Money, grams int64, weighed bool) []models.ShippingOption {
+	options := []models.ShippingOption{}
+	for _, rate := range zone.Rates {
+		if rate.Price.Currency != subtotal.Currency || (rate.Kind == RateWeight && !weighed) {
+			continue
+		}
+		zone_id, rate_id := zone.ID, rate.ID
+		options = append(options, models.ShippingOption{
+			SellerID: seller_id,
+			ZoneID:   &zone_id,
+			RateID:   &rate_id,
+			Name:     rate.Name,
+			Kind:     rate.Kind,
+			Price:    money.New(Price(rate, subtotal.Amount, grams), subtotal.Currency),
+			MinDays:  rate.MinDays,
+			MaxDays:  rate.MaxDays,
+		})
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Price.Amount < options[j].Price.Amount
+	})
+	return options
+}
+
+// Free is the option of a seller that ships for free where none of their zones delivers.
+func Free(seller_id primitive.ObjectID, currency string) models.ShippingOption {
+	return models.ShippingOption{SellerID: seller_id, Name: FreeName, Kind: RateFlat, Price: money.New(0, currency)}
+}
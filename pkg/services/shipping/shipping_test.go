@@ -0,0 +1,62 @@
+package shipping
+
+import (
+	"kamoushop/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatchZone(t *testing.T) {
+	zones := []models.DeliveryZone{
+		{Name: "world"},
+		{Name: "nigeria", Regions: []string{"GH", "NG"}},
+		{Name: "lagos", Regions: []string{"NG-LA", "NG-OG"}},
+	}
+	name := func(region string) string {
+		zone, ok := MatchZone(zones, region)
+		require.True(t, ok)
+		return zone.Name
+	}
+
+	require.Equal(t, "world", name("KE"))
+	require.Equal(t, "nigeria", name("NG"))
+	require.Equal(t, "nigeria", name("NG-KN"))
+	require.Equal(t, "lagos", name("NG-OG"))
+
+	_, ok := MatchZone(zones[1:], "KE")
+	require.False(t, ok)
+}
+
+func TestOptions(t *testing.T) {
+	ngn := func(amount int64) *models.Money { return &models.Money{Amount: amount, Currency: "NGN"} }
+	zone := models.DeliveryZone{ID: primitive.NewObjectID(), Rates: []models.ShippingRate{
+		{Name: "Express", Kind: RateFlat, Price: *ngn(5000), MinDays: 1, MaxDays: 2},
+		{Name: "Heavy", Kind: RateWeight, Price: *ngn(1000), PerKg: ngn(500)},
+		{Name: "Standard", Kind: RateFreeOver, Price: *ngn(2000), FreeOver: ngn(10000)},
+		{Name: "Abroad", Kind: RateFlat, Price: models.Money{Amount: 10, Currency: "USD"}},
+	}}
+	for _, rate := range zone.Rates {
+		require.NoError(t, CheckRate(rate))
+	}
+
+	// 2.1kg starts a third kilogram
+	options := Options(primitive.NewObjectID(), zone, *ngn(8000), 2100, true)
+	require.Len(t, options, 3)
+	require.Equal(t, []string{"Standard", "Heavy", "Express"}, []string{options[0].Name, options[1].Name, options[2].Name})
+	require.Equal(t, []int64{2000, 2500, 5000}, []int64{options[0].Price.Amount, options[1].Price.Amount, options[2].Price.Amount})
+	require.Equal(t, zone.ID, *options[0].ZoneID)
+
+	options = Options(primitive.NewObjectID(), zone, *ngn(10000), 0, true)
+	require.Equal(t, int64(0), options[0].Price.Amount)
+	require.Equal(t, int64(1000), options[1].Price.Amount)
+
+	// an item without a weight can't be priced by weight
+	options = Options(primitive.NewObjectID(), zone, *ngn(8000), 2100, false)
+	require.Equal(t, []string{"Standard", "Express"}, []string{options[0].Name, options[1].Name})
+
+	require.ErrorIs(t, CheckRate(models.ShippingRate{Kind: RateWeight, Price: *ngn(100)}), ErrInvalidRatePrice)
+	require.ErrorIs(t, CheckRate(models.ShippingRate{Kind: "pigeon", Price: *ngn(100)}), ErrInvalidRateKind)
+	require.ErrorIs(t, CheckRate(models.ShippingRate{Kind: RateFlat, Price: *ngn(100), MinDays: 3, MaxDays: 1}), ErrInvalidDeliveryDays)
+}
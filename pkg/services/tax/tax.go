@@ -0,0 +1,129 @@
+package tax
+
+import (
+	"errors"
+	"kamoushop/pkg/models"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	RoundHalfUp   = "half_up"
+	RoundHalfEven = "half_even"
+	RoundUp       = "up"
+	RoundDown     = "down"
+
+	// MaxRate is 100%, rates are in hundredths of a percent
+	MaxRate = 10000
+)
+
+var (
+	ErrInvalidRegion   = errors.New("region must be an ISO 3166 country or subdivision code, e.g. NG or NG-LA")
+	ErrInvalidRate     = errors.New("rate must be between 0 and 10000 hundredths of a percent")
+	ErrInvalidRounding = errors.New("rounding must be half_up, half_even, up or down")
+)
+
+var regionPattern = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// NormalizeRegion upper cases region and checks it, an empty region stays empty.
+func NormalizeRegion(region string) (string, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region != "" && !regionPattern.MatchString(region) {
+		return "", ErrInvalidRegion
+	}
+	return region, nil
+}
+
+func ValidRounding(rounding string) bool {
+	switch rounding {
+	case RoundHalfUp, RoundHalfEven, RoundUp, RoundDown:
+		return true
+	}
+	return false
+}
+
+// Match finds the rule for a product in categories delivered to region. A rule for the subdivision beats
+// one for its country, which beats one for everywhere; at the same region a rule for one of the
+// categories or their ancestors beats one for every category, the nearer the category the better.
+// Of equally specific rules the first one wins.
+func Match(rules []models.TaxRule, region string, categories []models.Category) (models.TaxRule, bool) {
+	// distance of each category from the product, 0 for its own categories, 1 for their parents...
+	distance := map[primitive.ObjectID]int{}
+	near := func(id primitive.ObjectID, d int) {
+		if old, ok := distance[id]; !ok || d < old {
+			distance[id] = d
+		}
+	}
+	for _, category := range categories {
+		near(category.ID, 0)
+		for i, id := range category.Ancestors {
+			near(id, len(category.Ancestors)-i)
+		}
+	}
+
+	best, score, far := models.TaxRule{}, -1, 0
+	for _, rule := range rules {
+		s, d := 0, 0
+		switch {
+		case rule.Region == "":
+		case rule.Region == region && strings.Contains(region, "-"):
+			s = 4
+		case rule.Region == region || strings.HasPrefix(region, rule.Region+"-"):
+			s = 2
+		default:
+			continue
+		}
+		if rule.CategoryID != nil {
+			var ok bool
+			if d, ok = distance[*rule.CategoryID]; !ok {
+				continue
+			}
+			s++
+		}
+		if s > score || (s == score && d < far) {
+			best, score, far = rule, s, d
+		}
+	}
+	return best, score >= 0
+}
+
+// Amount is the tax on amount at rate. When inclusive the tax is already part of amount,
+// otherwise it comes on top of it.
+func Amount(amount int64, rate int64, inclusive bool, rounding string) int64 {
+	if amount <= 0 || rate <= 0 {
+		return 0
+	}
+	den := int64(MaxRate)
+	if inclusive {
+		den += rate
+	}
+	v := new(big.Int).Mul(big.NewInt(amount), big.NewInt(rate))
+	return Round(v, big.NewInt(den), rounding)
+}
+
+// Round divides num by den, both positive, rounding the way rounding says. Unknown modes round half up.
+func Round(num *big.Int, den *big.Int, rounding string) int64 {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q.Int64()
+	}
+
+	half := new(big.Int).Mul(r, big.NewInt(2)).Cmp(den)
+	switch rounding {
+	case RoundDown:
+	case RoundUp:
+		q.Add(q, big.NewInt(1))
+	case RoundHalfEven:
+		if half > 0 || (half == 0 && q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(1))
+		}
+	default:
+		if half >= 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
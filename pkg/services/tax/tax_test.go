@@ -0,0 +1,77 @@
+package tax
+
+import (
+	"kamoushop/pkg/models"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizeRegion(t *testing.T) {
+	region, err := NormalizeRegion(" ng-la ")
+	require.NoError(t, err)
+	require.Equal(t, "NG-LA", region)
+
+	region, err = NormalizeRegion("")
+	require.NoError(t, err)
+	require.Empty(t, region)
+
+	_, err = NormalizeRegion("Nigeria")
+	require.ErrorIs(t, err, ErrInvalidRegion)
+}
+
+func TestMatch(t *testing.T) {
+	food, drinks, juice := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	rules := []models.TaxRule{
+		{Name: "default", Rate: 500},
+		{Name: "nigeria", Region: "NG", Rate: 750},
+		{Name: "nigeria food", Region: "NG", CategoryID: &food, Rate: 0},
+		{Name: "nigeria drinks", Region: "NG", CategoryID: &drinks, Rate: 500},
+		{Name: "lagos", Region: "NG-LA", Rate: 800},
+	}
+	name := func(region string, categories ...models.Category) string {
+		rule, ok := Match(rules, region, categories)
+		require.True(t, ok)
+		return rule.Name
+	}
+
+	require.Equal(t, "default", name("GH"))
+	require.Equal(t, "nigeria", name("NG"))
+	require.Equal(t, "nigeria", name("NG-KN"))
+	require.Equal(t, "nigeria food", name("NG-KN", models.Category{ID: food}))
+	// the region counts before the category
+	require.Equal(t, "lagos", name("NG-LA", models.Category{ID: food}))
+
+	// a rule for an ancestor applies to the categories under it, the nearer category wins
+	require.Equal(t, "nigeria food", name("NG", models.Category{ID: juice, Ancestors: []primitive.ObjectID{food}}))
+	require.Equal(t, "nigeria drinks", name("NG", models.Category{ID: juice, Ancestors: []primitive.ObjectID{food, drinks}}))
+	require.Equal(t, "nigeria drinks", name("NG", models.Category{ID: juice, Ancestors: []primitive.ObjectID{food}}, models.Category{ID: drinks}))
+
+	_, ok := Match(rules[1:], "GH", nil)
+	require.False(t, ok)
+}
+
+func TestAmount(t *testing.T) {
+	// 7.5% of 1000.10 is 75.0075
+	require.Equal(t, int64(7501), Amount(100010, 750, false, RoundHalfUp))
+	require.Equal(t, int64(7500), Amount(100010, 750, false, RoundDown))
+	require.Equal(t, int64(7501), Amount(100010, 750, false, RoundUp))
+
+	// 10750 includes 750 of tax at 7.5%
+	require.Equal(t, int64(750), Amount(10750, 750, true, RoundHalfUp))
+	require.Zero(t, Amount(10750, 0, true, RoundHalfUp))
+}
+
+func TestRound(t *testing.T) {
+	round := func(num int64, den int64, rounding string) int64 {
+		return Round(big.NewInt(num), big.NewInt(den), rounding)
+	}
+	require.Equal(t, int64(3), round(5, 2, RoundHalfUp))
+	require.Equal(t, int64(2), round(5, 2, RoundHalfEven))
+	require.Equal(t, int64(4), round(7, 2, RoundHalfEven))
+	require.Equal(t, int64(2), round(5, 2, RoundDown))
+	require.Equal(t, int64(3), round(11, 4, RoundUp))
+	require.Equal(t, int64(3), round(9, 3, RoundUp))
+}
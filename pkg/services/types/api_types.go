@@ -19,8 +19,14 @@ type User struct {
 	Stars      int64                `json:"stars,omitempty" bson:"stars" default:"0"`
 	StarredBy  []primitive.ObjectID `json:"starred_by" bson:"starredBy"`
 	IsVerified bool                 `json:"is_verified" bson:"isVerified" default:"false"`
-	CreatedAT  time.Time            `json:"created_at" bson:"createdAt"`
-	UpdatedAT  time.Time            `json:"updated_at" bson:"updatedAt"`
+	Role       string               `json:"role" bson:"role"`
+	Currency   string               `json:"currency" bson:"currency"`
+	// whether the shop's prices already include tax
+	PricesIncludeTax bool `json:"prices_include_tax" bson:"pricesIncludeTax"`
+	// whether the shop delivers for free where none of its delivery zones does
+	FreeShipping bool      `json:"free_shipping" bson:"freeShipping"`
+	CreatedAT    time.Time `json:"created_at" bson:"createdAt"`
+	UpdatedAT    time.Time `json:"updated_at" bson:"updatedAt"`
 }
 
 type AddUser struct {
@@ -28,6 +34,8 @@ type AddUser struct {
 	LastName  string `json:"last_name" binding:"required"`
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,alphanum,min=7"`
+	// shop currency, defaults to DEFAULT_CURRENCY
+	Currency string `json:"currency"`
 }
 
 type Login struct {
@@ -63,26 +71,36 @@ type UpdateBrandName struct {
 }
 
 type GetUsers struct {
-	Limit int64 `form:"limit" biniding:"required"`
-	Page  int64 `form:"page" binding:"required"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
 }
 
 type QueryBrands struct {
-	Limit   int64  `form:"limit" biniding:"required"`
-	Page    int64  `form:"page" binding:"required"`
+	Limit   int64  `form:"limit"`
+	Cursor  string `form:"cursor"`
 	Keyword string `form:"keyword" binding:"required"`
 }
 
 type Product struct {
-	Price       int    `form:"price" binding:"required"`
-	Name        string `form:"name" binding:"required,min=3"`
-	Image       string `form:"image"`
-	Description string `form:"description" binding:"required,min=5"`
+	// in the minor unit of the shop's currency, e.g. kobo for NGN, before shops had a currency it was whole units
+	Price       int      `form:"price" binding:"required,min=1"`
+	Name        string   `form:"name" binding:"required,min=3"`
+	Image       string   `form:"image"`
+	Description string   `form:"description" binding:"required,min=5"`
+	Stock       int64    `form:"stock" binding:"omitempty,min=0"`
+	Categories  []string `form:"categories"`
+	// shipping weight of one unit in grams
+	Weight int64 `form:"weight" binding:"omitempty,min=0"`
+	// draft (the default) or published, a publish_at in the future schedules the product instead
+	Status    string     `form:"status" binding:"omitempty,oneof=draft published"`
+	PublishAt *time.Time `form:"publish_at" time_format:"2006-01-02T15:04:05Z07:00"`
+	// filled in from Categories by the controller
+	CategoryNames []string `form:"-"`
 }
 
 type GetProductsByUserId struct {
-	Limit  int64  `form:"limit" biniding:"required"`
-	Page   int64  `form:"page" binding:"required"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
 	UserID string `form:"user_id" binding:"required"`
 }
 
@@ -101,9 +119,422 @@ type GetProdById struct {
 type UpdateProduct struct {
 	ID          string `json:"id" binding:"required"`
 	Description string `json:"description"`
-	Price       int64  `json:"price"`
+	// in the minor unit of the shop's currency, changed through the price history
+	Price *int64 `json:"price" binding:"omitempty,min=1"`
+	Stock *int64 `json:"stock" binding:"omitempty,min=0"`
+	// in grams
+	Weight *int64 `json:"weight" binding:"omitempty,min=0"`
+}
+
+type ChangeProductStatus struct {
+	Status    string     `json:"status" binding:"required"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type ImportProducts struct {
+	// csv or jsonl
+	Format string `form:"format" binding:"required,oneof=csv jsonl"`
+	DryRun bool   `form:"dry_run"`
+}
+
+type ExportProducts struct {
+	Format string `form:"format" binding:"required,oneof=csv jsonl"`
+}
+
+type UpdatePrice struct {
+	Price int64 `json:"price" binding:"required,min=1"`
+}
+
+type SetSale struct {
+	SalePrice int64      `json:"sale_price" binding:"required,min=1"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+}
+
+type GetPriceHistory struct {
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type ListProducts struct {
+	MinPrice     int64     `form:"min_price"`
+	MaxPrice     int64     `form:"max_price"`
+	Currency     string    `form:"currency"`
+	Category     string    `form:"category"`
+	Shop         string    `form:"shop"`
+	InStock      bool      `form:"in_stock"`
+	CreatedAfter time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	// one of newest, price_asc, price_desc, rating or popularity
+	Sort   string `form:"sort"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+	// prices are also shown converted to this currency, charges stay in the shop's currency
+	DisplayCurrency string `form:"display_currency"`
+}
+
+type GetFeed struct {
+	Limit           int64  `form:"limit"`
+	Cursor          string `form:"cursor"`
+	DisplayCurrency string `form:"display_currency"`
 }
 
 type AddToCart struct {
-	ProdID string `json:"prod_id" binidng:"required"`
+	ProdID string `json:"prod_id" binding:"required"`
+}
+
+type CartItem struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Variant   string `json:"variant"`
+	Quantity  int64  `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+type SetCartQuantity struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Variant   string `json:"variant"`
+	// zero removes the line
+	Quantity *int64 `json:"quantity" binding:"required,min=0,max=100"`
+}
+
+type GetCartLine struct {
+	ProductID string `uri:"product_id" binding:"required"`
+}
+
+type CartLineVariant struct {
+	Variant string `form:"variant"`
+}
+
+type AddCategory struct {
+	Name string `json:"name" binding:"required,min=2"`
+	Slug string `json:"slug"`
+	// slug of the parent category, empty for a top level category
+	Parent   string `json:"parent"`
+	Position int    `json:"position"`
+}
+
+type UpdateCategory struct {
+	Name *string `json:"name" binding:"omitempty,min=2"`
+	Slug *string `json:"slug" binding:"omitempty,min=2"`
+	// an empty string moves the category to the top level
+	Parent   *string `json:"parent"`
+	Position *int    `json:"position"`
+}
+
+type GetCategory struct {
+	Slug string `uri:"slug" binding:"required"`
+}
+
+type GetCategoryById struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetCategoryProducts struct {
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type SearchProducts struct {
+	Q        string `form:"q"`
+	Category string `form:"category"`
+	Shop     string `form:"shop"`
+	MinPrice int64  `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice int64  `form:"max_price" binding:"omitempty,min=0"`
+	Currency string `form:"currency"`
+	Limit    int64  `form:"limit"`
+	Cursor   string `form:"cursor"`
+
+	DisplayCurrency string `form:"display_currency"`
+}
+
+type DisplayCurrency struct {
+	Currency string `form:"display_currency"`
+}
+
+type UpdateCurrency struct {
+	Currency string `json:"currency" binding:"required"`
+}
+
+type UpdateTaxPricing struct {
+	PricesIncludeTax *bool `json:"prices_include_tax" binding:"required"`
+}
+
+type UpdateFreeShipping struct {
+	FreeShipping *bool `json:"free_shipping" binding:"required"`
+}
+
+type AssignCategories struct {
+	Categories []string `json:"categories" binding:"required"`
+}
+
+type CreateReview struct {
+	Rating int    `form:"rating" binding:"required,min=1,max=5"`
+	Body   string `form:"body" binding:"required,min=3,max=2000"`
+}
+
+type GetReview struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetProductReviews struct {
+	// only reviews with this many stars, 0 for all
+	Rating int    `form:"rating" binding:"omitempty,min=1,max=5"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type ReplyToReview struct {
+	Body string `json:"body" binding:"required,min=1,max=2000"`
+}
+
+type ModerateReview struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+}
+
+type GetPendingReviews struct {
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type CreateWishlist struct {
+	Name   string `json:"name" binding:"required,min=1,max=100"`
+	Shared bool   `json:"shared"`
+}
+
+type UpdateWishlist struct {
+	Name   string `json:"name" binding:"omitempty,min=1,max=100"`
+	Shared bool   `json:"shared"`
+}
+
+type GetWishlist struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetWishlistItem struct {
+	ID        string `uri:"id" binding:"required"`
+	ProductID string `uri:"product_id" binding:"required"`
+}
+
+type GetSharedWishlist struct {
+	Token string `uri:"token" binding:"required"`
+}
+
+type WishlistProduct struct {
+	ProductID string `json:"product_id" binding:"required"`
+}
+
+type GetNotifications struct {
+	Unread bool   `form:"unread"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type GetNotification struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetOrder struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+// GetOrderByNumber takes either the order number or the invoice number, e.g. KS-2026-000123.
+type GetOrderByNumber struct {
+	Number string `uri:"number" binding:"required,max=40"`
+}
+
+type GetOrders struct {
+	Status string    `form:"status"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int64     `form:"limit"`
+	Cursor string    `form:"cursor"`
+}
+
+type ExportOrders struct {
+	Status string    `form:"status"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+}
+
+type RejectOrder struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type ShipOrder struct {
+	Carrier        string `json:"carrier" binding:"required,max=100"`
+	TrackingNumber string `json:"tracking_number" binding:"required,max=100"`
+}
+
+type CancelOrder struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// RequestReturn is sent as a form so photos can come along, items is a json array
+// of {"product_id", "variant", "quantity"}.
+type RequestReturn struct {
+	SubOrderID string `form:"sub_order_id" binding:"required"`
+	Reason     string `form:"reason" binding:"required,min=3,max=2000"`
+	Items      string `form:"items" binding:"required"`
+}
+
+type ReturnItem struct {
+	ProductID string `json:"product_id" binding:"required"`
+	Variant   string `json:"variant"`
+	Quantity  int64  `json:"quantity" binding:"required,min=1"`
+}
+
+type GetReturn struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetReturns struct {
+	Status string `form:"status"`
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type ApproveReturn struct {
+	// minor units, a partial refund, the whole return is refunded without it
+	Amount *int64 `json:"amount"`
+	Note   string `json:"note" binding:"max=500"`
+}
+
+type DenyReturn struct {
+	Note string `json:"note" binding:"required,max=500"`
+}
+
+type UpdateOrderStatus struct {
+	// paid, refunded and cancelled move money and only follow payments, refunds and cancellations
+	Status string `json:"status" binding:"required,oneof=processing shipped delivered"`
+	Note   string `json:"note"`
+}
+
+type PaymentWebhook struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+// Checkout takes an optional coupon code and the region the order is taxed for, a retried checkout
+// keeps what the first attempt sent.
+type Checkout struct {
+	Coupon string `json:"coupon" binding:"omitempty,max=32"`
+	// address in the buyer's address book the order is delivered to, defaults to their default address
+	AddressID string `json:"address_id" binding:"omitempty,len=24"`
+	// id of the rate picked per seller id, sellers left out get their cheapest rate
+	ShippingRates map[string]string `json:"shipping_rates" binding:"omitempty,max=50"`
+}
+
+type AddPromotion struct {
+	// what buyers enter at checkout, a promotion without one applies by itself
+	Code string `json:"code" binding:"omitempty,alphanum,min=3,max=32"`
+	Name string `json:"name" binding:"required,min=2,max=80"`
+	Kind string `json:"kind" binding:"required,oneof=percentage fixed buy_x_get_y"`
+	// percentage promotions
+	Percent int64 `json:"percent"`
+	// fixed promotions, in the minor unit of currency
+	Amount int64 `json:"amount"`
+	// buy_x_get_y promotions, buying buy units of a product gets the next get units free
+	Buy int64 `json:"buy"`
+	Get int64 `json:"get"`
+	// in the minor unit of currency, 0 for no minimum
+	MinSpend int64 `json:"min_spend" binding:"min=0"`
+	// currency of amount and min_spend, defaults to DEFAULT_CURRENCY
+	Currency string `json:"currency"`
+	// shop for every product, products for product_ids only
+	Scope      string   `json:"scope" binding:"required,oneof=shop products"`
+	ProductIDs []string `json:"product_ids"`
+	// the seller running and funding the promotion, only their products are discounted.
+	// Empty for a promotion the marketplace funds
+	SellerID string `json:"seller_id"`
+	// 0 for no limit
+	UsageLimit       int64      `json:"usage_limit" binding:"min=0"`
+	PerCustomerLimit int64      `json:"per_customer_limit" binding:"min=0"`
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+}
+
+type UpdatePromotion struct {
+	Name             *string    `json:"name" binding:"omitempty,min=2,max=80"`
+	Active           *bool      `json:"active"`
+	UsageLimit       *int64     `json:"usage_limit" binding:"omitempty,min=0"`
+	PerCustomerLimit *int64     `json:"per_customer_limit" binding:"omitempty,min=0"`
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+}
+
+type GetPromotion struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type GetPromotions struct {
+	Limit  int64  `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type AddTaxRule struct {
+	Name string `json:"name" binding:"required,min=2,max=80"`
+	// ISO 3166 country or subdivision code, e.g. NG or NG-LA, empty for everywhere
+	Region string `json:"region"`
+	// slug of the category, empty for every category
+	Category string `json:"category"`
+	// in hundredths of a percent, 750 is 7.5%
+	Rate int64 `json:"rate" binding:"min=0,max=10000"`
+	// one of half_up, half_even, up or down, defaults to half_up
+	Rounding string `json:"rounding" binding:"omitempty,oneof=half_up half_even up down"`
+}
+
+type UpdateTaxRule struct {
+	Name     *string `json:"name" binding:"omitempty,min=2,max=80"`
+	Rate     *int64  `json:"rate" binding:"omitempty,min=0,max=10000"`
+	Rounding *string `json:"rounding" binding:"omitempty,oneof=half_up half_even up down"`
+}
+
+type GetTaxRule struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type AddAddress struct {
+	Label      string `json:"label" binding:"max=32"`
+	Name       string `json:"name" binding:"required,min=2,max=80"`
+	Phone      string `json:"phone" binding:"required,min=5,max=20"`
+	Line1      string `json:"line1" binding:"required,min=3,max=120"`
+	Line2      string `json:"line2" binding:"max=120"`
+	City       string `json:"city" binding:"required,min=2,max=80"`
+	PostalCode string `json:"postal_code" binding:"max=16"`
+	// ISO 3166 country code, e.g. NG
+	Country string `json:"country" binding:"required,len=2"`
+	// ISO 3166 subdivision code in Country, e.g. NG-LA
+	Region    string `json:"region" binding:"max=6"`
+	IsDefault bool   `json:"is_default"`
+}
+
+type GetAddress struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type AddDeliveryZone struct {
+	Name string `json:"name" binding:"required,min=2,max=80"`
+	// ISO 3166 country or subdivision codes, e.g. NG or NG-LA, none for everywhere else
+	Regions []string          `json:"regions" binding:"max=50"`
+	Rates   []AddShippingRate `json:"rates" binding:"required,min=1,max=10,dive"`
+	// currency of every price of the zone, defaults to the shop's
+	Currency string `json:"currency" binding:"omitempty,len=3"`
+}
+
+type AddShippingRate struct {
+	Name string `json:"name" binding:"required,min=2,max=40"`
+	// flat, weight (price plus per_kg for every started kilogram) or free_over (price, free from free_over)
+	Kind string `json:"kind" binding:"required,oneof=flat weight free_over"`
+	// in the minor unit of the currency
+	Price    int64 `json:"price" binding:"min=0"`
+	PerKg    int64 `json:"per_kg" binding:"min=0"`
+	FreeOver int64 `json:"free_over" binding:"min=0"`
+	MinDays  int64 `json:"min_days" binding:"min=0"`
+	MaxDays  int64 `json:"max_days" binding:"min=0"`
+}
+
+type GetDeliveryZone struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type ShippingQuote struct {
+	// defaults to the buyer's default address
+	AddressID string `json:"address_id" binding:"omitempty,len=24"`
 }
@@ -7,6 +7,8 @@ import (
 )
 
 type Config struct {
+	// production unless set, the fake payment provider is only allowed in development and test
+	AppEnv              string        `mapstructure:"APP_ENV"`
 	Cloudinary          string        `mapstructure:"CLOUDINARY_API_ENV"`
 	TokenKey            string        `mapstructure:"TOKEN_KEY"`
 	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
@@ -19,8 +21,42 @@ type Config struct {
 	UserCol             string        `mapstructure:"USER_COl"`
 	OrderCol            string        `mapstructure:"ORDER_COL"`
 	TokenCol            string        `mapstructure:"TOKEN_COL"`
+	CategoryCol         string        `mapstructure:"CATEGORY_COL"`
+	PriceHistoryCol     string        `mapstructure:"PRICE_HISTORY_COL"`
+	ReviewCol           string        `mapstructure:"REVIEW_COL"`
+	WishlistCol         string        `mapstructure:"WISHLIST_COL"`
+	NotificationCol     string        `mapstructure:"NOTIFICATION_COL"`
+	CartCol             string        `mapstructure:"CART_COL"`
+	SubOrderCol         string        `mapstructure:"SUB_ORDER_COL"`
+	PaymentCol          string        `mapstructure:"PAYMENT_COL"`
+	ReturnCol           string        `mapstructure:"RETURN_COL"`
+	CounterCol          string        `mapstructure:"COUNTER_COL"`
+	PromotionCol        string        `mapstructure:"PROMOTION_COL"`
+	RedemptionCol       string        `mapstructure:"REDEMPTION_COL"`
+	TaxRuleCol          string        `mapstructure:"TAX_RULE_COL"`
+	DeliveryZoneCol     string        `mapstructure:"DELIVERY_ZONE_COL"`
 	RedisUri            string        `mapstructure:"REDIS_URL"`
-	UniCloudKey         string        `mapstructure:"UNICLOUD_API_KEY"`
+	GuestCartTTL        time.Duration `mapstructure:"GUEST_CART_TTL"`
+	SchedulerInterval   time.Duration `mapstructure:"SCHEDULER_INTERVAL"`
+	DefaultCurrency     string        `mapstructure:"DEFAULT_CURRENCY"`
+	ExchangeRates       string        `mapstructure:"EXCHANGE_RATES"`
+	PaymentProvider     string        `mapstructure:"PAYMENT_PROVIDER"`
+	PaystackSecretKey   string        `mapstructure:"PAYSTACK_SECRET_KEY"`
+	StripeSecretKey     string        `mapstructure:"STRIPE_SECRET_KEY"`
+	StripeWebhookSecret string        `mapstructure:"STRIPE_WEBHOOK_SECRET"`
+	FakePayments        bool          `mapstructure:"FAKE_PAYMENTS"`
+	FakePaymentSecret   string        `mapstructure:"FAKE_PAYMENT_SECRET"`
+	ShopName            string        `mapstructure:"SHOP_NAME"`
+	ShopCode            string        `mapstructure:"SHOP_CODE"`
+	ShopAddress         string        `mapstructure:"SHOP_ADDRESS"`
+	ShopEmail           string        `mapstructure:"SHOP_EMAIL"`
+	ShopBrandColor      string        `mapstructure:"SHOP_BRAND_COLOR"`
+	ShopLogo            string        `mapstructure:"SHOP_LOGO"`
+	SMTPHost            string        `mapstructure:"SMTP_HOST"`
+	SMTPPort            int           `mapstructure:"SMTP_PORT"`
+	SMTPUsername        string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword        string        `mapstructure:"SMTP_PASSWORD"`
+	MailFrom            string        `mapstructure:"MAIL_FROM"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify lowercases s and collapses every run of non alphanumeric characters into a single "-".
+func Slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "-")
+}